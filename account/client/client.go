@@ -65,6 +65,7 @@ func (client *Client) GetAccount(ctx context.Context, Id string, userID string)
 		ID:    uint(r.Account.GetId()),
 		Name:  r.Account.GetName(),
 		Email: r.Account.GetEmail(),
+		Role:  r.Account.GetRole(),
 	}, nil
 }
 
@@ -85,6 +86,7 @@ func (client *Client) GetAccounts(ctx context.Context, skip, take uint64, userID
 			ID:    uint(a.GetId()),
 			Name:  a.GetName(),
 			Email: a.GetEmail(),
+			Role:  a.GetRole(),
 		})
 	}
 	return accounts, nil
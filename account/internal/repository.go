@@ -6,10 +6,13 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
+
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
 )
 
 type Repository interface {
 	Close()
+	Outbox() outbox.Store
 	PutAccount(ctx context.Context, a Account) (*Account, error)
 	GetAccountByEmail(ctx context.Context, email string) (*Account, error)
 	GetAccountByID(ctx context.Context, id string) (*Account, error)
@@ -36,7 +39,7 @@ func NewPostgresRepository(databaseURL string) (Repository, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&Account{})
+	err = db.AutoMigrate(&Account{}, &outbox.Message{})
 	if err != nil {
 		log.Println("Error during migrations:", err)
 	}
@@ -51,6 +54,10 @@ func (repository *postgresRepository) Close() {
 	}
 }
 
+func (repository *postgresRepository) Outbox() outbox.Store {
+	return outbox.NewStore(repository.db)
+}
+
 func (repository *postgresRepository) Ping() error {
 	sqlDB, err := repository.db.DB()
 	if err != nil {
@@ -59,8 +66,20 @@ func (repository *postgresRepository) Ping() error {
 	return sqlDB.Ping()
 }
 
+// PutAccount saves a new account and puts its account_created event in the
+// outbox in the same transaction
 func (repository *postgresRepository) PutAccount(ctx context.Context, a Account) (*Account, error) {
-	if err := repository.db.WithContext(ctx).Create(&a).Error; err != nil {
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&a).Error; err != nil {
+			return err
+		}
+		message, err := accountEventMessage("account_created", &a)
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, message)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &a, nil
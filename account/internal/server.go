@@ -80,6 +80,7 @@ func (server *grpcServer) GetAccount(ctx context.Context, r *pb.GetAccountReques
 		Id:    uint64(a.ID),
 		Name:  a.Name,
 		Email: a.Email,
+		Role:  a.Role,
 	}}, nil
 }
 
@@ -119,6 +120,7 @@ func (server *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequ
 				Id:    uint64(int(p.ID)),
 				Name:  p.Name,
 				Email: p.Email,
+				Role:  p.Role,
 			})
 		}
 	}
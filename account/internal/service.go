@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
 	"github.com/thomas/EcommerceAPI/pkg/utils"
 )
 
@@ -21,15 +23,45 @@ type Account struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Role     string `json:"role" gorm:"default:customer"`
+}
+
+// AccountEvent is published on the account_events topic when an account
+// changes
+type AccountEvent struct {
+	Type string           `json:"type"`
+	Data AccountEventData `json:"data"`
+}
+
+type AccountEventData struct {
+	AccountID uint   `json:"account_id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+}
+
+// accountEventMessage is an event of the account_events topic, keyed by the
+// account ID
+func accountEventMessage(eventType string, account *Account) (outbox.Message, error) {
+	return outbox.NewMessage("account_events", strconv.Itoa(int(account.ID)), AccountEvent{
+		Type: eventType,
+		Data: AccountEventData{
+			AccountID: account.ID,
+			Name:      account.Name,
+			Email:     account.Email,
+			Role:      account.Role,
+		},
+	})
 }
 
 type accountService struct {
 	repository  Repository
 	authService auth.AuthService
+	adminEmails []string
 }
 
-func NewService(r Repository, j auth.AuthService) Service {
-	return &accountService{r, j}
+func NewService(r Repository, j auth.AuthService, adminEmails []string) Service {
+	return &accountService{r, j, adminEmails}
 }
 
 func (service accountService) Register(ctx context.Context, name, email, password string) (string, error) {
@@ -42,16 +74,26 @@ func (service accountService) Register(ctx context.Context, name, email, passwor
 	if err != nil {
 		return "", err
 	}
+	// Accounts registered with one of the configured admin emails become admins
+	role := auth.RoleCustomer
+	for _, adminEmail := range service.adminEmails {
+		if strings.EqualFold(adminEmail, email) {
+			role = auth.RoleAdmin
+			break
+		}
+	}
+
 	acc := Account{
 		Name:     name,
 		Email:    email,
 		Password: hashedPass,
+		Role:     role,
 	}
 	account, err := service.repository.PutAccount(ctx, acc)
 	if err != nil {
 		return "", err
 	}
-	token, err := service.authService.GenerateToken(strconv.Itoa(int(account.ID)))
+	token, err := service.authService.GenerateToken(strconv.Itoa(int(account.ID)), account.Role)
 	if err != nil {
 		return "", err
 	}
@@ -61,7 +103,7 @@ func (service accountService) Register(ctx context.Context, name, email, passwor
 func (service accountService) Login(ctx context.Context, email, password string) (string, error) {
 	account, err := service.repository.GetAccountByEmail(ctx, email)
 	if err == nil && utils.VerifyPassword(password, account.Password) {
-		token, err := service.authService.GenerateToken(strconv.Itoa(int(account.ID)))
+		token, err := service.authService.GenerateToken(strconv.Itoa(int(account.ID)), account.Role)
 		if err == nil {
 			return token, nil
 		}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/thomas/EcommerceAPI/cart/models"
+	"github.com/thomas/EcommerceAPI/cart/proto/pb"
+	ordermodels "github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.CartServiceClient
+}
+
+func NewClient(url string) (*Client, error) {
+	conn, err := grpc.Dial(url, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	c := pb.NewCartServiceClient(conn)
+	return &Client{conn, c}, nil
+}
+
+func (client *Client) Close() {
+	client.conn.Close()
+}
+
+func (client *Client) GetCart(ctx context.Context, owner models.CartOwner) (*models.PricedCart, error) {
+	r, err := client.service.GetCart(ctx, &pb.GetCartRequest{Owner: ownerToProto(owner)})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (client *Client) AddItem(ctx context.Context, owner models.CartOwner, productId string, quantity uint32) (*models.PricedCart, error) {
+	r, err := client.service.AddItem(ctx, &pb.AddItemRequest{
+		Owner:     ownerToProto(owner),
+		ProductId: productId,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (client *Client) UpdateItem(ctx context.Context, owner models.CartOwner, productId string, quantity uint32) (*models.PricedCart, error) {
+	r, err := client.service.UpdateItem(ctx, &pb.UpdateItemRequest{
+		Owner:     ownerToProto(owner),
+		ProductId: productId,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (client *Client) RemoveItem(ctx context.Context, owner models.CartOwner, productId string) (*models.PricedCart, error) {
+	r, err := client.service.RemoveItem(ctx, &pb.RemoveItemRequest{
+		Owner:     ownerToProto(owner),
+		ProductId: productId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (client *Client) MergeCarts(ctx context.Context, guestToken, accountId string) (*models.PricedCart, error) {
+	r, err := client.service.MergeCarts(ctx, &pb.MergeCartsRequest{
+		GuestToken: guestToken,
+		AccountId:  accountId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+// Checkout places the order for the cart and returns the order ID
+func (client *Client) Checkout(ctx context.Context, cartId uint, accountId, couponCode, currency string, shippingAddress ordermodels.Address) (uint, error) {
+	r, err := client.service.Checkout(ctx, &pb.CheckoutRequest{
+		CartId:     uint64(cartId),
+		AccountId:  accountId,
+		CouponCode: couponCode,
+		Currency:   currency,
+		ShippingAddress: &pb.CartAddress{
+			Name:       shippingAddress.Name,
+			Line1:      shippingAddress.Line1,
+			Line2:      shippingAddress.Line2,
+			City:       shippingAddress.City,
+			Region:     shippingAddress.Region,
+			PostalCode: shippingAddress.PostalCode,
+			Country:    shippingAddress.Country,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint(r.OrderId), nil
+}
+
+func ownerToProto(owner models.CartOwner) *pb.CartOwner {
+	return &pb.CartOwner{AccountId: owner.AccountID, GuestToken: owner.GuestToken}
+}
+
+func cartFromProto(c *pb.Cart) *models.PricedCart {
+	cart := &models.PricedCart{
+		Cart: models.Cart{
+			ID:        uint(c.GetId()),
+			AccountID: c.GetAccountId(),
+			Status:    c.GetStatus(),
+		},
+		Subtotal: moneyFromProto(c.GetSubtotal()),
+	}
+	cart.UpdatedAt.UnmarshalBinary(c.GetUpdatedAt())
+	for _, item := range c.GetItems() {
+		cart.Lines = append(cart.Lines, models.PricedLine{
+			ProductID: item.GetProductId(),
+			Name:      item.GetName(),
+			Price:     moneyFromProto(item.GetPrice()),
+			Quantity:  item.GetQuantity(),
+			LineTotal: moneyFromProto(item.GetLineTotal()),
+			Available: item.GetAvailable(),
+		})
+	}
+	return cart
+}
+
+func moneyFromProto(m *pb.CartMoney) money.Money {
+	return money.New(m.GetAmount(), m.GetCurrency())
+}
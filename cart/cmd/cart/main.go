@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tinrab/retry"
+
+	internal "github.com/thomas/EcommerceAPI/cart/internal"
+	order "github.com/thomas/EcommerceAPI/order/client"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	product "github.com/thomas/EcommerceAPI/product/client"
+)
+
+type Config struct {
+	DatabaseUrl string `envconfig:"DATABASE_URL"`
+	ProductUrl  string `envconfig:"PRODUCT_SERVICE_URL"`
+	OrderUrl    string `envconfig:"ORDER_SERVICE_URL"`
+	// Without a file or url the stub rates are used
+	ExchangeRatesFile string        `envconfig:"EXCHANGE_RATES_FILE"`
+	ExchangeRatesUrl  string        `envconfig:"EXCHANGE_RATES_URL"`
+	ExchangeRatesTTL  time.Duration `envconfig:"EXCHANGE_RATES_TTL" default:"1h"`
+}
+
+func main() {
+	var cfg Config
+	var repository internal.Repository
+
+	err := envconfig.Process("", &cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rates, err := money.NewRateProvider(cfg.ExchangeRatesFile, cfg.ExchangeRatesUrl, cfg.ExchangeRatesTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
+		repository, err = internal.NewPostgresRepository(cfg.DatabaseUrl)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	})
+	defer repository.Close()
+
+	productClient, err := product.NewClient(cfg.ProductUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer productClient.Close()
+
+	orderClient, err := order.NewClient(cfg.OrderUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer orderClient.Close()
+
+	log.Println("Listening on port 8080...")
+	service := internal.NewCartService(repository, productClient, orderClient, rates)
+	log.Fatal(internal.ListenGRPC(service, 8080))
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/cart/models"
+)
+
+var (
+	ErrCartNotFound = errors.New("cart not found")
+	ErrCartChanged  = errors.New("the cart is being checked out")
+)
+
+type Repository interface {
+	Close()
+	GetOpenCart(ctx context.Context, owner models.CartOwner) (*models.Cart, error)
+	GetCartById(ctx context.Context, id uint) (*models.Cart, error)
+	SetItemQuantity(ctx context.Context, owner models.CartOwner, productId string, quantity uint32, add bool) (*models.Cart, error)
+	MergeCarts(ctx context.Context, guestToken, accountId string) error
+	SetCartStatus(ctx context.Context, cartId uint, from, to string, orderId uint) error
+}
+
+type postgresRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresRepository(databaseURL string) (Repository, error) {
+	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlDB.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.Cart{}, &models.CartItem{})
+
+	return &postgresRepository{db}, err
+}
+
+func (repository *postgresRepository) Close() {
+	sqlDB, err := repository.db.DB()
+	if err == nil {
+		sqlDB.Close()
+	}
+}
+
+// GetOpenCart returns the current cart of the owner, creating an empty one if
+// they have none. The cart may be in the middle of a checkout.
+func (repository *postgresRepository) GetOpenCart(ctx context.Context, owner models.CartOwner) (*models.Cart, error) {
+	var cart *models.Cart
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		cart, err = openCart(tx, owner)
+		return err
+	})
+	return cart, err
+}
+
+func (repository *postgresRepository) GetCartById(ctx context.Context, id uint) (*models.Cart, error) {
+	var cart models.Cart
+	err := repository.db.WithContext(ctx).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("added_at, id") }).
+		First(&cart, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// SetItemQuantity sets the quantity of a product in the open cart of the
+// owner, or adds to it when add is true. A quantity of zero removes the item.
+func (repository *postgresRepository) SetItemQuantity(ctx context.Context, owner models.CartOwner, productId string, quantity uint32, add bool) (*models.Cart, error) {
+	var cartId uint
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		cart, err := openCart(tx, owner)
+		if err != nil {
+			return err
+		}
+		cartId = cart.ID
+		return setItem(tx, cart, productId, quantity, add)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repository.GetCartById(ctx, cartId)
+}
+
+// MergeCarts moves the items of the guest cart into the open cart of the
+// account. Quantities of the products in both carts are added up.
+func (repository *postgresRepository) MergeCarts(ctx context.Context, guestToken, accountId string) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var guest models.Cart
+		err := tx.Preload("Items").
+			Where("guest_token = ? AND account_id = '' AND status = ?", guestToken, models.CartStatusOpen).
+			First(&guest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		cart, err := openCart(tx, models.CartOwner{AccountID: accountId})
+		if err != nil {
+			return err
+		}
+		for _, item := range guest.Items {
+			if err = setItem(tx, cart, item.ProductID, item.Quantity, true); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&guest).Updates(map[string]interface{}{
+			"status":     models.CartStatusMerged,
+			"updated_at": time.Now().UTC(),
+		}).Error
+	})
+}
+
+// SetCartStatus moves the cart from one status to another, and fails with
+// ErrCartChanged if it is no longer in the first one
+func (repository *postgresRepository) SetCartStatus(ctx context.Context, cartId uint, from, to string, orderId uint) error {
+	res := repository.db.WithContext(ctx).
+		Model(&models.Cart{}).
+		Where("id = ? AND status = ?", cartId, from).
+		Updates(map[string]interface{}{
+			"status":     to,
+			"order_id":   orderId,
+			"updated_at": time.Now().UTC(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCartChanged
+	}
+	return nil
+}
+
+func openCart(tx *gorm.DB, owner models.CartOwner) (*models.Cart, error) {
+	query := tx.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("added_at, id") }).
+		Where("status IN ?", []string{models.CartStatusOpen, models.CartStatusCheckingOut})
+	if owner.IsGuest() {
+		query = query.Where("guest_token = ? AND account_id = ''", owner.GuestToken)
+	} else {
+		query = query.Where("account_id = ?", owner.AccountID)
+	}
+
+	var cart models.Cart
+	err := query.Order("id").First(&cart).Error
+	if err == nil {
+		return &cart, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	cart = models.Cart{
+		AccountID:  owner.AccountID,
+		GuestToken: owner.GuestToken,
+		Status:     models.CartStatusOpen,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if owner.IsGuest() {
+		cart.AccountID = ""
+	} else {
+		cart.GuestToken = ""
+	}
+	if err = tx.Create(&cart).Error; err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func setItem(tx *gorm.DB, cart *models.Cart, productId string, quantity uint32, add bool) error {
+	if cart.Status != models.CartStatusOpen {
+		return ErrCartChanged
+	}
+	now := time.Now().UTC()
+	var existing *models.CartItem
+	for i := range cart.Items {
+		if cart.Items[i].ProductID == productId {
+			existing = &cart.Items[i]
+			break
+		}
+	}
+
+	var err error
+	switch {
+	case existing == nil && quantity == 0:
+		return nil
+	case existing == nil:
+		item := models.CartItem{CartID: cart.ID, ProductID: productId, Quantity: quantity, AddedAt: now}
+		err = tx.Create(&item).Error
+		cart.Items = append(cart.Items, item)
+	case add:
+		existing.Quantity = capQuantity(existing.Quantity + quantity)
+		err = tx.Model(existing).Update("quantity", existing.Quantity).Error
+	case quantity == 0:
+		err = tx.Delete(existing).Error
+	default:
+		existing.Quantity = quantity
+		err = tx.Model(existing).Update("quantity", quantity).Error
+	}
+	if err != nil {
+		return err
+	}
+	cart.Revision++
+	return tx.Model(cart).Updates(map[string]interface{}{
+		"revision":   gorm.Expr("revision + 1"),
+		"updated_at": now,
+	}).Error
+}
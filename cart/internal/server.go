@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/cart/models"
+	"github.com/thomas/EcommerceAPI/cart/proto/pb"
+	ordermodels "github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+type grpcServer struct {
+	pb.UnimplementedCartServiceServer
+	service Service
+}
+
+func ListenGRPC(service Service, port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+
+	serv := grpc.NewServer()
+	pb.RegisterCartServiceServer(serv, &grpcServer{
+		pb.UnimplementedCartServiceServer{},
+		service,
+	})
+	reflection.Register(serv)
+
+	return serv.Serve(lis)
+}
+
+func (server *grpcServer) GetCart(ctx context.Context, request *pb.GetCartRequest) (*pb.CartResponse, error) {
+	owner, err := ownerFromProto(request.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	cart, err := server.service.GetCart(ctx, owner)
+	return cartResponse(cart, err)
+}
+
+func (server *grpcServer) AddItem(ctx context.Context, request *pb.AddItemRequest) (*pb.CartResponse, error) {
+	owner, err := ownerFromProto(request.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	cart, err := server.service.AddItem(ctx, owner, request.GetProductId(), request.GetQuantity())
+	return cartResponse(cart, err)
+}
+
+func (server *grpcServer) UpdateItem(ctx context.Context, request *pb.UpdateItemRequest) (*pb.CartResponse, error) {
+	owner, err := ownerFromProto(request.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	cart, err := server.service.UpdateItem(ctx, owner, request.GetProductId(), request.GetQuantity())
+	return cartResponse(cart, err)
+}
+
+func (server *grpcServer) RemoveItem(ctx context.Context, request *pb.RemoveItemRequest) (*pb.CartResponse, error) {
+	owner, err := ownerFromProto(request.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	cart, err := server.service.RemoveItem(ctx, owner, request.GetProductId())
+	return cartResponse(cart, err)
+}
+
+func (server *grpcServer) MergeCarts(ctx context.Context, request *pb.MergeCartsRequest) (*pb.CartResponse, error) {
+	if request.GetAccountId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing account ID")
+	}
+	cart, err := server.service.MergeCarts(ctx, request.GetGuestToken(), request.GetAccountId())
+	return cartResponse(cart, err)
+}
+
+func (server *grpcServer) Checkout(ctx context.Context, request *pb.CheckoutRequest) (*pb.CheckoutResponse, error) {
+	address := request.GetShippingAddress()
+	shippingAddress := ordermodels.Address{
+		Name:       address.GetName(),
+		Line1:      address.GetLine1(),
+		Line2:      address.GetLine2(),
+		City:       address.GetCity(),
+		Region:     address.GetRegion(),
+		PostalCode: address.GetPostalCode(),
+		Country:    address.GetCountry(),
+	}
+	order, err := server.service.Checkout(ctx, uint(request.GetCartId()), request.GetAccountId(), request.GetCouponCode(), request.GetCurrency(), shippingAddress)
+	if err != nil {
+		log.Println("Error checking out cart:", err)
+		return nil, toStatus(err)
+	}
+	return &pb.CheckoutResponse{OrderId: uint64(order.ID)}, nil
+}
+
+func ownerFromProto(owner *pb.CartOwner) (models.CartOwner, error) {
+	if owner.GetAccountId() == "" && owner.GetGuestToken() == "" {
+		return models.CartOwner{}, status.Errorf(codes.InvalidArgument, "a cart needs an account ID or a guest token")
+	}
+	return models.CartOwner{AccountID: owner.GetAccountId(), GuestToken: owner.GetGuestToken()}, nil
+}
+
+func cartResponse(cart *models.PricedCart, err error) (*pb.CartResponse, error) {
+	if err != nil {
+		log.Println("Error updating cart:", err)
+		return nil, toStatus(err)
+	}
+	return &pb.CartResponse{Cart: cartToProto(cart)}, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrCartNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotCartOwner):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrInvalidQuantity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCartChanged), errors.Is(err, ErrEmptyCart):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
+func cartToProto(cart *models.PricedCart) *pb.Cart {
+	cartProto := &pb.Cart{
+		Id:        uint64(cart.ID),
+		AccountId: cart.AccountID,
+		Status:    cart.Status,
+		Items:     []*pb.CartItem{},
+		Subtotal:  moneyToProto(cart.Subtotal),
+	}
+	cartProto.UpdatedAt, _ = cart.UpdatedAt.MarshalBinary()
+	for _, line := range cart.Lines {
+		item := &pb.CartItem{
+			ProductId: line.ProductID,
+			Name:      line.Name,
+			Quantity:  line.Quantity,
+			Available: line.Available,
+		}
+		if line.Available {
+			item.Price = moneyToProto(line.Price)
+			item.LineTotal = moneyToProto(line.LineTotal)
+		}
+		cartProto.Items = append(cartProto.Items, item)
+	}
+	return cartProto
+}
+
+func moneyToProto(m money.Money) *pb.CartMoney {
+	return &pb.CartMoney{Amount: m.Amount, Currency: m.Currency}
+}
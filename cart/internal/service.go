@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/thomas/EcommerceAPI/cart/models"
+	ordermodels "github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	productmodels "github.com/thomas/EcommerceAPI/product/models"
+)
+
+// Quantities of an item are capped at what an order line can hold, adding
+// more leaves it at the cap
+const maxItemQuantity = ordermodels.MaxLineQuantity
+
+var (
+	ErrInvalidQuantity = fmt.Errorf("quantity must be between 1 and %d", maxItemQuantity)
+	ErrEmptyCart       = errors.New("the cart has no products that can be ordered")
+	ErrNotCartOwner    = errors.New("the cart belongs to someone else")
+)
+
+// ProductCatalog is implemented by the product service client
+type ProductCatalog interface {
+	GetProducts(ctx context.Context, skip, take uint64, ids []string, query string) ([]productmodels.Product, error)
+	GetProductsForService(ctx context.Context, ids []string) ([]productmodels.Product, error)
+}
+
+// OrderPlacer is implemented by the order service client
+type OrderPlacer interface {
+	PostOrder(ctx context.Context, accountID string, products []*ordermodels.OrderedProduct, couponCode, currency string, shippingAddress ordermodels.Address, idempotencyKey string) (*ordermodels.Order, error)
+}
+
+type Service interface {
+	GetCart(ctx context.Context, owner models.CartOwner) (*models.PricedCart, error)
+	AddItem(ctx context.Context, owner models.CartOwner, productId string, quantity uint32) (*models.PricedCart, error)
+	UpdateItem(ctx context.Context, owner models.CartOwner, productId string, quantity uint32) (*models.PricedCart, error)
+	RemoveItem(ctx context.Context, owner models.CartOwner, productId string) (*models.PricedCart, error)
+	MergeCarts(ctx context.Context, guestToken, accountId string) (*models.PricedCart, error)
+	Checkout(ctx context.Context, cartId uint, accountId, couponCode, currency string, shippingAddress ordermodels.Address) (*ordermodels.Order, error)
+}
+
+type cartService struct {
+	repository Repository
+	catalog    ProductCatalog
+	orders     OrderPlacer
+	rates      money.RateProvider
+}
+
+func NewCartService(repository Repository, catalog ProductCatalog, orders OrderPlacer, rates money.RateProvider) Service {
+	return &cartService{repository, catalog, orders, rates}
+}
+
+func (service cartService) GetCart(ctx context.Context, owner models.CartOwner) (*models.PricedCart, error) {
+	cart, err := service.repository.GetOpenCart(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	return service.priceCart(ctx, cart)
+}
+
+func (service cartService) AddItem(ctx context.Context, owner models.CartOwner, productId string, quantity uint32) (*models.PricedCart, error) {
+	if quantity == 0 || quantity > maxItemQuantity {
+		return nil, ErrInvalidQuantity
+	}
+	products, err := service.catalog.GetProducts(ctx, 0, 0, []string{productId}, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 || !products[0].IsPublic() {
+		return nil, errors.New("product not found")
+	}
+
+	cart, err := service.repository.SetItemQuantity(ctx, owner, productId, quantity, true)
+	if err != nil {
+		return nil, err
+	}
+	return service.priceCart(ctx, cart)
+}
+
+// UpdateItem sets the quantity of a product of the cart, zero removes it
+func (service cartService) UpdateItem(ctx context.Context, owner models.CartOwner, productId string, quantity uint32) (*models.PricedCart, error) {
+	if quantity > maxItemQuantity {
+		return nil, ErrInvalidQuantity
+	}
+	cart, err := service.repository.SetItemQuantity(ctx, owner, productId, quantity, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.priceCart(ctx, cart)
+}
+
+func (service cartService) RemoveItem(ctx context.Context, owner models.CartOwner, productId string) (*models.PricedCart, error) {
+	return service.UpdateItem(ctx, owner, productId, 0)
+}
+
+// MergeCarts moves the guest cart into the account cart when the guest logs in
+func (service cartService) MergeCarts(ctx context.Context, guestToken, accountId string) (*models.PricedCart, error) {
+	if guestToken != "" {
+		if err := service.repository.MergeCarts(ctx, guestToken, accountId); err != nil {
+			return nil, err
+		}
+	}
+	return service.GetCart(ctx, models.CartOwner{AccountID: accountId})
+}
+
+// Checkout turns the cart into an order. The cart is locked while the order is
+// placed and stays open if the order fails, so the shopper can try again.
+func (service cartService) Checkout(ctx context.Context, cartId uint, accountId, couponCode, currency string, shippingAddress ordermodels.Address) (*ordermodels.Order, error) {
+	cart, err := service.repository.GetCartById(ctx, cartId)
+	if err != nil {
+		return nil, err
+	}
+	if cart.AccountID == "" || cart.AccountID != accountId {
+		return nil, ErrNotCartOwner
+	}
+	if cart.Status != models.CartStatusOpen {
+		return nil, ErrCartChanged
+	}
+
+	// Products that are no longer sold stay in the cart but are not ordered
+	priced, err := service.priceCart(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	var products []*ordermodels.OrderedProduct
+	for _, line := range priced.Lines {
+		if line.Available {
+			products = append(products, &ordermodels.OrderedProduct{
+				ID:       line.ProductID,
+				Quantity: line.Quantity,
+			})
+		}
+	}
+	if len(products) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	if err = service.repository.SetCartStatus(ctx, cart.ID, models.CartStatusOpen, models.CartStatusCheckingOut, 0); err != nil {
+		return nil, err
+	}
+
+	// A checkout retried after a timeout gets the order of the first attempt,
+	// unless the cart was edited in between and is ordered anew
+	idempotencyKey := fmt.Sprintf("cart-%d-%d", cart.ID, cart.Revision)
+	order, err := service.orders.PostOrder(ctx, accountId, products, couponCode, currency, shippingAddress, idempotencyKey)
+	if err != nil {
+		if releaseErr := service.repository.SetCartStatus(ctx, cart.ID, models.CartStatusCheckingOut, models.CartStatusOpen, 0); releaseErr != nil {
+			log.Printf("Failed to reopen cart %d: %v", cart.ID, releaseErr)
+		}
+		return nil, err
+	}
+
+	err = service.repository.SetCartStatus(ctx, cart.ID, models.CartStatusCheckingOut, models.CartStatusCheckedOut, order.ID)
+	if err != nil {
+		// The order exists, the cart only failed to record it
+		log.Printf("Failed to close cart %d after order %d: %v", cart.ID, order.ID, err)
+	}
+	return order, nil
+}
+
+// priceCart looks up the current name and price of the products of the cart
+func (service cartService) priceCart(ctx context.Context, cart *models.Cart) (*models.PricedCart, error) {
+	priced := &models.PricedCart{Cart: *cart, Subtotal: money.New(0, "")}
+	if len(cart.Items) == 0 {
+		return priced, nil
+	}
+
+	var ids []string
+	for _, item := range cart.Items {
+		ids = append(ids, item.ProductID)
+	}
+	// Products that are no longer published keep their name in the cart
+	products, err := service.catalog.GetProductsForService(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byId := map[string]productmodels.Product{}
+	for _, product := range products {
+		byId[product.ID] = product
+	}
+
+	first := true
+	for _, item := range cart.Items {
+		line := models.PricedLine{ProductID: item.ProductID, Quantity: item.Quantity}
+		product, ok := byId[item.ProductID]
+		if ok {
+			line.Name = product.Name
+			line.Price = product.PriceMoney()
+			line.LineTotal = line.Price.Times(int64(item.Quantity))
+			line.Available = product.IsPublic()
+		}
+		priced.Lines = append(priced.Lines, line)
+		if !line.Available {
+			continue
+		}
+
+		if first {
+			priced.Subtotal = money.New(0, line.Price.Currency)
+			first = false
+		}
+		lineTotal, _, err := money.Convert(ctx, service.rates, line.LineTotal, priced.Subtotal.Currency)
+		if err != nil {
+			return nil, err
+		}
+		priced.Subtotal, _ = priced.Subtotal.Add(lineTotal)
+	}
+	return priced, nil
+}
+
+func capQuantity(quantity uint32) uint32 {
+	if quantity > maxItemQuantity {
+		return maxItemQuantity
+	}
+	return quantity
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+const (
+	CartStatusOpen = "OPEN"
+	// The cart is being turned into an order, it cannot change meanwhile
+	CartStatusCheckingOut = "CHECKING_OUT"
+	CartStatusCheckedOut  = "CHECKED_OUT"
+	// A guest cart whose items were moved to an account cart on login
+	CartStatusMerged = "MERGED"
+)
+
+// Cart belongs either to an account or, before the shopper logs in, to the
+// guest token kept in their cookie
+type Cart struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement"`
+	AccountID  string     `gorm:"index"`
+	GuestToken string     `gorm:"index"`
+	Status     string     `gorm:"index"`
+	Items      []CartItem `gorm:"foreignKey:CartID"`
+	OrderID    uint
+	// Counts the edits of the items, see Checkout
+	Revision  uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type CartItem struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	CartID    uint `gorm:"index"`
+	ProductID string
+	Quantity  uint32
+	AddedAt   time.Time
+}
+
+// CartOwner identifies the open cart of a shopper, by account or guest token
+type CartOwner struct {
+	AccountID  string
+	GuestToken string
+}
+
+func (owner CartOwner) IsGuest() bool {
+	return owner.AccountID == ""
+}
+
+// PricedCart is a cart with the current prices of its products
+type PricedCart struct {
+	Cart
+	Lines []PricedLine
+	// In the currency of the first available product, the others converted
+	// at today's rates
+	Subtotal money.Money
+}
+
+type PricedLine struct {
+	ProductID string
+	Name      string
+	Price     money.Money
+	Quantity  uint32
+	LineTotal money.Money
+	// False when the product was unpublished or deleted since it was added
+	Available bool
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
@@ -11,15 +12,23 @@ import (
 	"github.com/thomas/EcommerceAPI/graphql/graph"
 	"github.com/thomas/EcommerceAPI/pkg/auth"
 	"github.com/thomas/EcommerceAPI/pkg/middleware"
+	"github.com/thomas/EcommerceAPI/pkg/money"
 )
 
 type AppConfig struct {
 	AccountUrl    string `envconfig:"ACCOUNT_SERVICE_URL"`
 	ProductUrl    string `envconfig:"PRODUCT_SERVICE_URL"`
 	OrderUrl      string `envconfig:"ORDER_SERVICE_URL"`
+	CartUrl       string `envconfig:"CART_SERVICE_URL"`
 	RecommenderUrl string `envconfig:"RECOMMENDER_SERVICE_URL"`
 	SecretKey     string `envconfig:"SECRET_KEY"`
 	Issuer        string `envconfig:"ISSUER"`
+	// Without a file or url the stub rates are used
+	ExchangeRatesFile string        `envconfig:"EXCHANGE_RATES_FILE"`
+	ExchangeRatesUrl  string        `envconfig:"EXCHANGE_RATES_URL"`
+	ExchangeRatesTTL  time.Duration `envconfig:"EXCHANGE_RATES_TTL" default:"1h"`
+	// Shared with the payment provider to sign its webhooks
+	PaymentWebhookSecret string `envconfig:"PAYMENT_WEBHOOK_SECRET"`
 }
 
 func main() {
@@ -29,7 +38,12 @@ func main() {
 		log.Fatal(err)
 	}
 
-	server, err := graph.NewGraphQLServer(cfg.AccountUrl, cfg.ProductUrl, cfg.OrderUrl, cfg.RecommenderUrl)
+	rates, err := money.NewRateProvider(cfg.ExchangeRatesFile, cfg.ExchangeRatesUrl, cfg.ExchangeRatesTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := graph.NewGraphQLServer(cfg.AccountUrl, cfg.ProductUrl, cfg.OrderUrl, cfg.CartUrl, cfg.RecommenderUrl, rates)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -58,6 +72,21 @@ func main() {
 		gin.WrapH(srv),
 	)
 
+	// Catalog downloads are plain files, not GraphQL responses
+	engine.GET("/catalog/export",
+		middleware.AuthorizeJWT(jwtService),
+		server.ExportCatalog,
+	)
+
+	// Invoices are PDF or JSON files, downloaded by their customer or seller
+	engine.GET("/invoices/:id",
+		middleware.AuthorizeJWT(jwtService),
+		server.DownloadInvoice,
+	)
+
+	// Called by the payment provider, authenticated by the webhook signature
+	engine.POST("/payments/webhook", server.PaymentWebhook(cfg.PaymentWebhookSecret))
+
 	// Create a separate endpoint for the playground to use
 	engine.POST("/graphql-playground", gin.WrapH(srv))
 
@@ -3,44 +3,82 @@ package graph
 import (
 	"context"
 	"log"
-	"strconv"
 	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
 )
 
 type accountResolver struct {
 	server *Server
 }
 
-func (resolver *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, error) {
+func (resolver *accountResolver) Orders(ctx context.Context, obj *Account, first *int, after *string, filter *OrderFilterInput, sort *OrderSort, currency *string) (*OrderConnection, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	query := models.OrderQuery{}
+	if first != nil {
+		if *first < 0 {
+			return nil, ErrInvalidParameter
+		}
+		query.First = *first
+	}
+	if after != nil {
+		query.After = *after
+	}
+	if sort != nil {
+		query.Sort = string(*sort)
+	}
+	if filter != nil {
+		query.Filter = models.OrderFilter{
+			CreatedAfter:  filter.CreatedAfter,
+			CreatedBefore: filter.CreatedBefore,
+		}
+		for _, status := range filter.Statuses {
+			query.Filter.Statuses = append(query.Filter.Statuses, string(status))
+		}
+		if filter.MinTotal != nil {
+			query.Filter.MinTotal = *filter.MinTotal
+		}
+		if filter.MaxTotal != nil {
+			query.Filter.MaxTotal = *filter.MaxTotal
+		}
+		if filter.ProductID != nil {
+			query.Filter.ProductID = *filter.ProductID
+		}
+		if filter.Currency != nil {
+			query.Filter.Currency = *filter.Currency
+		}
+	}
+
 	// Pass the account ID as both the ID to fetch and the caller ID for authentication
-	orderList, err := resolver.server.orderClient.GetOrdersForAccount(ctx, obj.ID, obj.ID)
+	page, err := resolver.server.orderClient.GetOrdersForAccount(ctx, obj.ID, obj.ID, query)
 	if err != nil {
 		log.Println("Error getting orders for account:", err)
 		return nil, err
 	}
 
-	var orders []*Order
-	for _, order := range orderList {
-		var products []*OrderedProduct
-		for _, orderedProduct := range order.Products {
-			products = append(products, &OrderedProduct{
-				ID:          orderedProduct.ID,
-				Name:        orderedProduct.Name,
-				Description: orderedProduct.Description,
-				Price:       orderedProduct.Price,
-				Quantity:    int(orderedProduct.Quantity),
-			})
-		}
-		orders = append(orders, &Order{
-			ID:         strconv.Itoa(int(order.ID)),
-			CreatedAt:  order.CreatedAt,
-			TotalPrice: order.TotalPrice,
-			Products:   products,
+	connection := &OrderConnection{
+		Edges:      []*OrderEdge{},
+		PageInfo:   &PageInfo{HasNextPage: page.HasNextPage},
+		TotalCount: int(page.TotalCount),
+	}
+	if page.EndCursor != "" {
+		connection.PageInfo.EndCursor = &page.EndCursor
+	}
+	for i := range page.Orders {
+		order := toOrder(&page.Orders[i])
+		if currency != nil {
+			if err = resolver.server.convertOrder(ctx, order, *currency); err != nil {
+				log.Println("Error converting order:", err)
+				return nil, err
+			}
+		}
+		connection.Edges = append(connection.Edges, &OrderEdge{
+			Cursor: models.OrderCursor(page.Orders[i].ID),
+			Node:   order,
 		})
 	}
 
-	return orders, nil
+	return connection, nil
 }
@@ -0,0 +1,212 @@
+package graph
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thomas/EcommerceAPI/cart/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+// Visitors who are not logged in keep their cart through this cookie
+const cartCookie = "cart_token"
+
+const cartCookieMaxAge = 30 * 24 * 3600
+
+func (resolver *queryResolver) Cart(ctx context.Context) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	owner, err := cartOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := resolver.server.cartClient.GetCart(ctx, owner)
+	if err != nil {
+		log.Println("Error getting cart:", err)
+		return nil, err
+	}
+	return toCart(cart), nil
+}
+
+func (resolver *mutationResolver) AddToCart(ctx context.Context, productId string, quantity *int) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	add := 1
+	if quantity != nil {
+		add = *quantity
+	}
+	if add <= 0 {
+		return nil, errors.New("product quantity must be greater than zero")
+	}
+
+	owner, err := cartOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := resolver.server.cartClient.AddItem(ctx, owner, productId, uint32(add))
+	if err != nil {
+		log.Println("Error adding to cart:", err)
+		return nil, err
+	}
+	return toCart(cart), nil
+}
+
+func (resolver *mutationResolver) UpdateCartItem(ctx context.Context, productId string, quantity int) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if quantity < 0 {
+		return nil, errors.New("product quantity cannot be negative")
+	}
+
+	owner, err := cartOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := resolver.server.cartClient.UpdateItem(ctx, owner, productId, uint32(quantity))
+	if err != nil {
+		log.Println("Error updating cart item:", err)
+		return nil, err
+	}
+	return toCart(cart), nil
+}
+
+func (resolver *mutationResolver) RemoveFromCart(ctx context.Context, productId string) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	owner, err := cartOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := resolver.server.cartClient.RemoveItem(ctx, owner, productId)
+	if err != nil {
+		log.Println("Error removing from cart:", err)
+		return nil, err
+	}
+	return toCart(cart), nil
+}
+
+func (resolver *mutationResolver) Checkout(ctx context.Context, cartId string, couponCode *string, currency *string, shippingAddress *AddressInput) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - guests log in first, which merges their cart
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for Checkout:", err)
+		return nil, errors.New("unauthorized: you must be logged in to check out")
+	}
+
+	id, err := strconv.ParseUint(cartId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	var code, orderCurrency string
+	if couponCode != nil {
+		code = *couponCode
+	}
+	if currency != nil {
+		orderCurrency = *currency
+	}
+
+	accountIdStr := strconv.Itoa(accountId)
+	orderId, err := resolver.server.cartClient.Checkout(ctx, uint(id), accountIdStr, code, orderCurrency, fromAddressInput(shippingAddress))
+	if err != nil {
+		log.Println("Error checking out cart:", err)
+		return nil, err
+	}
+
+	order, err := resolver.server.orderClient.GetOrder(ctx, orderId, accountIdStr, auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error getting the placed order:", err)
+		return nil, err
+	}
+	return toOrder(order), nil
+}
+
+// cartOwner is the logged in user, or else the visitor of the cart cookie,
+// which is created on the first visit
+func cartOwner(ctx context.Context) (models.CartOwner, error) {
+	if accountId := auth.GetUserId(ctx, false); accountId != "" {
+		return models.CartOwner{AccountID: accountId}, nil
+	}
+
+	ginContext, ok := ctx.Value("GinContextKey").(*gin.Context)
+	if !ok {
+		return models.CartOwner{}, errors.New("could not retrieve gin context")
+	}
+	token, err := ginContext.Cookie(cartCookie)
+	if err != nil || token == "" {
+		if token, err = newCartToken(); err != nil {
+			return models.CartOwner{}, err
+		}
+	}
+	// Refreshed on every visit so an active guest cart does not expire
+	ginContext.SetCookie(cartCookie, token, cartCookieMaxAge, "/", "localhost", false, true)
+	return models.CartOwner{GuestToken: token}, nil
+}
+
+func newCartToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// mergeGuestCart moves the cart of the visitor into the account that just
+// logged in. Logging in still succeeds when the merge fails.
+func (server *Server) mergeGuestCart(ctx context.Context, ginContext *gin.Context, token string) {
+	guestToken, err := ginContext.Cookie(cartCookie)
+	if err != nil || guestToken == "" {
+		return
+	}
+	accountId, err := auth.UserIdFromToken(token)
+	if err != nil {
+		log.Println("Error reading account ID to merge cart:", err)
+		return
+	}
+	if _, err = server.cartClient.MergeCarts(ctx, guestToken, accountId); err != nil {
+		log.Println("Error merging guest cart:", err)
+		return
+	}
+	ginContext.SetCookie(cartCookie, "", -1, "/", "localhost", false, true)
+}
+
+func toCart(cart *models.PricedCart) *Cart {
+	result := &Cart{
+		ID:        strconv.Itoa(int(cart.ID)),
+		Status:    cart.Status,
+		Items:     []*CartItem{},
+		Subtotal:  toMoney(cart.Subtotal),
+		UpdatedAt: cart.UpdatedAt,
+	}
+	for _, line := range cart.Lines {
+		item := &CartItem{
+			ProductID: line.ProductID,
+			Name:      line.Name,
+			Quantity:  int(line.Quantity),
+			Available: line.Available,
+		}
+		if line.Available {
+			item.Price = toMoney(line.Price)
+			item.LineTotal = toMoney(line.LineTotal)
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result
+}
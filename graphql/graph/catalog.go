@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gin-gonic/gin"
+
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+// Imports are validated and indexed while the file is streamed, which takes
+// longer than the other operations
+const importTimeout = 5 * time.Minute
+
+func (resolver *mutationResolver) ImportProducts(ctx context.Context, file graphql.Upload, format CatalogFormat, dryRun *bool) (*ImportJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ImportProducts:", err)
+		return nil, errors.New("unauthorized: you must be logged in to import products")
+	}
+
+	job, err := resolver.server.productClient.ImportProducts(ctx, int64(accountId), string(format), dryRun != nil && *dryRun, file.File)
+	if err != nil {
+		log.Println("Error importing products:", err)
+		return nil, err
+	}
+	return toImportJob(job), nil
+}
+
+func (resolver *queryResolver) ImportJob(ctx context.Context, id string) (*ImportJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ImportJob query:", err)
+		return nil, errors.New("unauthorized: you must be logged in to view an import")
+	}
+
+	job, err := resolver.server.productClient.GetImportJob(ctx, id, int64(accountId))
+	if err != nil {
+		log.Println("Error getting import job:", err)
+		return nil, err
+	}
+	return toImportJob(job), nil
+}
+
+// ExportCatalog streams the catalog of the logged in seller as a CSV or JSON
+// Lines file, GET /catalog/export?format=CSV
+func (server *Server) ExportCatalog(c *gin.Context) {
+	accountId, err := auth.GetUserIdInt(c.Request.Context(), true)
+	if err != nil {
+		return
+	}
+
+	format := strings.ToUpper(c.DefaultQuery("format", string(CatalogFormatCSV)))
+	if !CatalogFormat(format).IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be CSV or JSONL"})
+		return
+	}
+
+	filename, contentType := "catalog.csv", "text/csv"
+	if format == string(CatalogFormatJSONL) {
+		filename, contentType = "catalog.jsonl", "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	err = server.productClient.ExportProducts(c.Request.Context(), int64(accountId), format, c.Writer)
+	if err != nil {
+		log.Println("Error exporting products:", err)
+		// Once the first chunk is out the status can no longer be changed
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not export the catalog"})
+		}
+	}
+}
+
+func toImportJob(job *models.ImportJob) *ImportJob {
+	result := &ImportJob{
+		ID:        job.ID,
+		Format:    CatalogFormat(job.Format),
+		DryRun:    job.DryRun,
+		Status:    ImportJobStatus(job.Status),
+		TotalRows: int(job.TotalRows),
+		Imported:  int(job.Imported),
+		Failed:    int(job.Failed),
+		Errors:    []*ImportRowError{},
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	for _, rowError := range job.Errors {
+		result.Errors = append(result.Errors, &ImportRowError{
+			Row:     rowError.Row,
+			Message: rowError.Message,
+		})
+	}
+	if job.Error != "" {
+		result.Error = &job.Error
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Codes set in the extensions of GraphQL errors that clients are expected to handle
+const (
+	ErrorCodeVersionConflict = "VERSION_CONFLICT"
+)
+
+// newCodedError builds a GraphQL error carrying a machine readable code in
+// its extensions, e.g. {"message": "...", "extensions": {"code": "VERSION_CONFLICT"}}
+func newCodedError(ctx context.Context, code, message string) *gqlerror.Error {
+	return &gqlerror.Error{
+		Path:    graphql.GetPath(ctx),
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code": code,
+		},
+	}
+}
+
+// fromVersionConflict turns the codes.Aborted returned by the product service
+// for a stale expectedVersion into a VERSION_CONFLICT error
+func fromVersionConflict(ctx context.Context, err error) error {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.Aborted {
+		return newCodedError(ctx, ErrorCodeVersionConflict, s.Message())
+	}
+	return err
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/thomas/EcommerceAPI/product/client"
 
 	account "github.com/thomas/EcommerceAPI/account/client"
+	cart "github.com/thomas/EcommerceAPI/cart/client"
 	order "github.com/thomas/EcommerceAPI/order/client"
+	"github.com/thomas/EcommerceAPI/pkg/money"
 	"github.com/thomas/EcommerceAPI/recommender"
 )
 
@@ -13,10 +15,12 @@ type Server struct {
 	accountClient     *account.Client
 	productClient     *client.Client
 	orderClient       *order.Client
+	cartClient        *cart.Client
 	recommenderClient *recommender.Client
+	rates             money.RateProvider
 }
 
-func NewGraphQLServer(accountUrl, productUrl, orderUrl, recommenderUrl string) (*Server, error) {
+func NewGraphQLServer(accountUrl, productUrl, orderUrl, cartUrl, recommenderUrl string, rates money.RateProvider) (*Server, error) {
 	accClient, err := account.NewClient(accountUrl)
 	if err != nil {
 		return nil, err
@@ -35,12 +39,21 @@ func NewGraphQLServer(accountUrl, productUrl, orderUrl, recommenderUrl string) (
 		return nil, err
 	}
 
+	cartClient, err := cart.NewClient(cartUrl)
+	if err != nil {
+		accClient.Close()
+		prodClient.Close()
+		ordClient.Close()
+		return nil, err
+	}
+
 	// Use the recommender URL from the environment variable
 	recClient, err := recommender.NewClient(recommenderUrl)
 	if err != nil {
 		accClient.Close()
 		prodClient.Close()
 		ordClient.Close()
+		cartClient.Close()
 		return nil, err
 	}
 
@@ -48,7 +61,9 @@ func NewGraphQLServer(accountUrl, productUrl, orderUrl, recommenderUrl string) (
 		accountClient:     accClient,
 		productClient:     prodClient,
 		orderClient:       ordClient,
+		cartClient:        cartClient,
 		recommenderClient: recClient,
+		rates:             rates,
 	}, nil
 }
 
@@ -64,6 +79,18 @@ func (server *Server) Query() QueryResolver {
 	}
 }
 
+func (server *Server) Product() ProductResolver {
+	return &productResolver{
+		server: server,
+	}
+}
+
+func (server *Server) OrderedProduct() OrderedProductResolver {
+	return &orderedProductResolver{
+		server: server,
+	}
+}
+
 func (server *Server) Account() AccountResolver {
 	return &accountResolver{
 		server: server,
@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+// DownloadInvoice sends an invoice or credit note of the logged in customer or
+// seller as a file, GET /invoices/:id?format=PDF
+func (server *Server) DownloadInvoice(c *gin.Context) {
+	ctx := c.Request.Context()
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		return
+	}
+	invoiceId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidParameter.Error()})
+		return
+	}
+
+	document, err := server.orderClient.GetInvoiceDocument(ctx, uint(invoiceId), c.DefaultQuery("format", "PDF"), strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error downloading invoice:", err)
+		code, message := http.StatusInternalServerError, "could not download the invoice"
+		switch status.Code(err) {
+		case codes.NotFound:
+			code, message = http.StatusNotFound, status.Convert(err).Message()
+		case codes.PermissionDenied:
+			code, message = http.StatusForbidden, status.Convert(err).Message()
+		case codes.InvalidArgument:
+			code, message = http.StatusBadRequest, status.Convert(err).Message()
+		}
+		c.JSON(code, gin.H{"error": message})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+document.FileName+`"`)
+	c.Data(http.StatusOK, document.ContentType, document.Content)
+}
+
+func toInvoice(invoice *models.Invoice) *Invoice {
+	id := strconv.Itoa(int(invoice.ID))
+	result := &Invoice{
+		ID:       id,
+		Kind:     InvoiceKind(invoice.Kind),
+		Number:   invoice.DisplayNumber(),
+		SellerID: invoice.SellerID,
+		Subtotal: toMoney(invoice.SubtotalMoney()),
+		Discount: toMoney(invoice.DiscountMoney()),
+		Tax:      toMoney(invoice.TaxMoney()),
+		Shipping: toMoney(invoice.ShippingMoney()),
+		Total:    toMoney(invoice.TotalMoney()),
+		IssuedAt: invoice.IssuedAt,
+		PDFURL:   "/invoices/" + id + "?format=PDF",
+		JSONURL:  "/invoices/" + id + "?format=JSON",
+	}
+	if invoice.ReturnID != 0 {
+		returnId := strconv.Itoa(int(invoice.ReturnID))
+		result.ReturnID = &returnId
+	}
+	if invoice.CreditedInvoiceID != 0 {
+		creditedInvoiceId := strconv.Itoa(int(invoice.CreditedInvoiceID))
+		result.CreditedInvoiceID = &creditedInvoiceId
+	}
+	return result
+}
@@ -3,17 +3,124 @@
 package graph
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
+type Address struct {
+	Name       *string `json:"name,omitempty"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	Region     *string `json:"region,omitempty"`
+	PostalCode *string `json:"postalCode,omitempty"`
+	// ISO 3166-1 alpha-2 code
+	Country string `json:"country"`
+}
+
+type AddressInput struct {
+	Name  *string `json:"name,omitempty"`
+	Line1 string  `json:"line1"`
+	Line2 *string `json:"line2,omitempty"`
+	City  string  `json:"city"`
+	// State or province code
+	Region     *string `json:"region,omitempty"`
+	PostalCode *string `json:"postalCode,omitempty"`
+	// ISO 3166-1 alpha-2 code
+	Country string `json:"country"`
+}
+
 type AuthResponse struct {
 	Token string `json:"token"`
 }
 
+// The cart of the logged in user, or of the visitor holding the cart_token cookie
+type Cart struct {
+	ID        string      `json:"id"`
+	Status    string      `json:"status"`
+	Items     []*CartItem `json:"items"`
+	Subtotal  *Money      `json:"subtotal"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+type CartItem struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	// Missing when the product is no longer sold
+	Price     *Money `json:"price,omitempty"`
+	Quantity  int    `json:"quantity"`
+	LineTotal *Money `json:"lineTotal,omitempty"`
+	Available bool   `json:"available"`
+}
+
 type CreateProductInput struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	// ISO 4217 code of the price, defaults to USD
+	Currency *string `json:"currency,omitempty"`
+	Category *string `json:"category,omitempty"`
+	// Defaults to DRAFT, pass PUBLISHED to make the product public right away
+	Status *ProductStatus `json:"status,omitempty"`
+}
+
+type CreateReviewInput struct {
+	ProductID string  `json:"productId"`
+	Rating    int     `json:"rating"`
+	Title     *string `json:"title,omitempty"`
+	Body      *string `json:"body,omitempty"`
+}
+
+type ExchangeRate struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"rate"`
+}
+
+type ImportJob struct {
+	ID        string          `json:"id"`
+	Format    CatalogFormat   `json:"format"`
+	DryRun    bool            `json:"dryRun"`
+	Status    ImportJobStatus `json:"status"`
+	TotalRows int             `json:"totalRows"`
+	// Rows that were imported, or would have been in a dry run
+	Imported  int               `json:"imported"`
+	Failed    int               `json:"failed"`
+	Errors    []*ImportRowError `json:"errors"`
+	Error     *string           `json:"error,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+type ImportRowError struct {
+	// Rows are numbered from 1, not counting the CSV header
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// Each seller invoices their part of a paid order. The documents are downloaded
+// from GET /invoices/{id}?format=PDF or JSON, authenticated like /graphql.
+type Invoice struct {
+	ID   string      `json:"id"`
+	Kind InvoiceKind `json:"kind"`
+	// e.g. INV-12-000042, numbered per seller without gaps
+	Number   string `json:"number"`
+	SellerID int    `json:"sellerId"`
+	// The return a credit note is for
+	ReturnID *string `json:"returnId,omitempty"`
+	// The invoice a credit note gives back part of
+	CreditedInvoiceID *string   `json:"creditedInvoiceId,omitempty"`
+	Subtotal          *Money    `json:"subtotal"`
+	Discount          *Money    `json:"discount"`
+	Tax               *Money    `json:"tax"`
+	Shipping          *Money    `json:"shipping"`
+	Total             *Money    `json:"total"`
+	IssuedAt          time.Time `json:"issuedAt"`
+	PDFURL            string    `json:"pdfUrl"`
+	// UBL shaped JSON
+	JSONURL string `json:"jsonUrl"`
 }
 
 type LoginInput struct {
@@ -21,18 +128,164 @@ type LoginInput struct {
 	Password string `json:"password"`
 }
 
+// An amount in minor units (cents for USD) of an ISO 4217 currency
+type Money struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	// e.g. 12.50 USD
+	Formatted string `json:"formatted"`
+}
+
 type Mutation struct {
 }
 
 type Order struct {
-	ID         string            `json:"id"`
-	CreatedAt  time.Time         `json:"createdAt"`
-	TotalPrice float64           `json:"totalPrice"`
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Subtotal      float64   `json:"subtotal"`
+	DiscountTotal float64   `json:"discountTotal"`
+	TotalPrice    float64   `json:"totalPrice"`
+	// Price of the products before discounts
+	SubtotalMoney      *Money `json:"subtotalMoney"`
+	DiscountTotalMoney *Money `json:"discountTotalMoney"`
+	// What the customer pays, subtotal minus discounts plus shipping and exclusive taxes
+	TotalMoney    *Money `json:"totalMoney"`
+	ShippingMoney *Money `json:"shippingMoney"`
+	// Taxes of the products, the inclusive ones are already part of their prices
+	TaxMoney *Money `json:"taxMoney"`
+	// The taxes charged, line by line
+	Taxes           []*OrderTax `json:"taxes"`
+	ShippingAddress *Address    `json:"shippingAddress,omitempty"`
+	// One shipment per seller of the order
+	Shipments  []*Shipment       `json:"shipments"`
+	CouponCode *string           `json:"couponCode,omitempty"`
 	Products   []*OrderedProduct `json:"products"`
+	// The discounts applied, line by line
+	Discounts []*OrderDiscount `json:"discounts"`
+	// Rates the prices were converted with at checkout
+	ExchangeRates []*ExchangeRate `json:"exchangeRates"`
+	Status        OrderStatus     `json:"status"`
+	// Every status the order went through, oldest first
+	StatusHistory      []*OrderStatusChange `json:"statusHistory"`
+	CancellationReason *string              `json:"cancellationReason,omitempty"`
+	// Attempts to pay the order, oldest first
+	Payments []*Payment `json:"payments"`
+	// Products sent back after delivery, oldest first
+	Returns []*OrderReturn `json:"returns"`
+	// Invoices of the sellers once the order is paid, and their credit notes, oldest first
+	Invoices []*Invoice `json:"invoices"`
+}
+
+type OrderConnection struct {
+	Edges    []*OrderEdge `json:"edges"`
+	PageInfo *PageInfo    `json:"pageInfo"`
+	// Number of orders matching the filter, across all pages
+	TotalCount int `json:"totalCount"`
+}
+
+type OrderDiscount struct {
+	ProductID   string  `json:"productId"`
+	Code        string  `json:"code"`
+	Amount      float64 `json:"amount"`
+	AmountMoney *Money  `json:"amountMoney"`
+}
+
+type OrderEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Order `json:"node"`
+}
+
+type OrderFilterInput struct {
+	CreatedAfter  *time.Time    `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time    `json:"createdBefore,omitempty"`
+	Statuses      []OrderStatus `json:"statuses,omitempty"`
+	// Totals are in the currency of the filter
+	MinTotal *float64 `json:"minTotal,omitempty"`
+	MaxTotal *float64 `json:"maxTotal,omitempty"`
+	// Only the orders containing this product
+	ProductID *string `json:"productId,omitempty"`
+	// Only the orders in this currency, needed to sort or filter on totals when the orders are in several currencies
+	Currency *string `json:"currency,omitempty"`
 }
 
 type OrderInput struct {
-	Products []*OrderedProductInput `json:"products"`
+	Products   []*OrderedProductInput `json:"products"`
+	CouponCode *string                `json:"couponCode,omitempty"`
+	// ISO 4217 code to pay in, defaults to the currency of the first product
+	Currency *string `json:"currency,omitempty"`
+	// Retrying with the same key returns the order placed the first time, the Idempotency-Key header works too
+	IdempotencyKey  *string       `json:"idempotencyKey,omitempty"`
+	ShippingAddress *AddressInput `json:"shippingAddress,omitempty"`
+}
+
+type OrderLineError struct {
+	ProductID string             `json:"productId"`
+	Code      OrderLineErrorCode `json:"code"`
+	Message   string             `json:"message"`
+}
+
+// The price of an order before it is placed
+type OrderQuote struct {
+	SubtotalMoney      *Money `json:"subtotalMoney"`
+	DiscountTotalMoney *Money `json:"discountTotalMoney"`
+	ShippingMoney      *Money `json:"shippingMoney"`
+	// Only the exclusive taxes are included in totalMoney
+	TaxMoney   *Money           `json:"taxMoney"`
+	TotalMoney *Money           `json:"totalMoney"`
+	CouponCode *string          `json:"couponCode,omitempty"`
+	Discounts  []*OrderDiscount `json:"discounts"`
+	Taxes      []*OrderTax      `json:"taxes"`
+	Shipments  []*Shipment      `json:"shipments"`
+	// The products that can be ordered, priced
+	Lines []*QuoteLine `json:"lines"`
+	// The products that cannot be ordered, left out of the totals
+	Errors []*OrderLineError `json:"errors"`
+}
+
+type OrderReturn struct {
+	ID              string       `json:"id"`
+	OrderID         string       `json:"orderId"`
+	SellerID        int          `json:"sellerId"`
+	ProductID       string       `json:"productId"`
+	Quantity        int          `json:"quantity"`
+	Reason          ReturnReason `json:"reason"`
+	Comment         *string      `json:"comment,omitempty"`
+	Status          ReturnStatus `json:"status"`
+	RejectionReason *string      `json:"rejectionReason,omitempty"`
+	Carrier         *Carrier     `json:"carrier,omitempty"`
+	TrackingNumber  *string      `json:"trackingNumber,omitempty"`
+	// Page of the carrier following the returned parcel
+	TrackingURL *string `json:"trackingUrl,omitempty"`
+	// Price paid for the returned units, given back once the seller receives them
+	Refund *Money `json:"refund"`
+	// Whether the units were put back in stock
+	Restocked  bool       `json:"restocked"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ShippedAt  *time.Time `json:"shippedAt,omitempty"`
+	ReceivedAt *time.Time `json:"receivedAt,omitempty"`
+	RefundedAt *time.Time `json:"refundedAt,omitempty"`
+}
+
+type OrderStatusChange struct {
+	// Missing for the creation of the order
+	From *OrderStatus `json:"from,omitempty"`
+	To   OrderStatus  `json:"to"`
+	// Account that made the change, missing when made by the shop
+	ChangedBy *string   `json:"changedBy,omitempty"`
+	Note      *string   `json:"note,omitempty"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+type OrderTax struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	// Percent of the taxable amount
+	Rate float64 `json:"rate"`
+	// Whether the tax is part of the price rather than added to it
+	Inclusive bool `json:"inclusive"`
+	// Price of the line after its discounts
+	TaxableMoney *Money `json:"taxableMoney"`
+	AmountMoney  *Money `json:"amountMoney"`
 }
 
 type OrderedProduct struct {
@@ -40,7 +293,11 @@ type OrderedProduct struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	PriceMoney  *Money  `json:"priceMoney"`
 	Quantity    int     `json:"quantity"`
+	Variant     *string `json:"variant,omitempty"`
+	// The product as it is now, the fields above are what was bought. Null once the product is deleted
+	Product *Product `json:"product,omitempty"`
 }
 
 type OrderedProductInput struct {
@@ -48,14 +305,1043 @@ type OrderedProductInput struct {
 	Quantity int    `json:"quantity"`
 }
 
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
 type PaginationInput struct {
 	Skip int `json:"skip"`
 	Take int `json:"take"`
 }
 
+type Payment struct {
+	ID string `json:"id"`
+	// AUTHORIZED, CAPTURED, FAILED, REFUNDED or VOIDED
+	Status        string  `json:"status"`
+	Amount        *Money  `json:"amount"`
+	Provider      string  `json:"provider"`
+	FailureReason *string `json:"failureReason,omitempty"`
+	// Part of the amount given back so far, by cancellations and returns
+	Refunded  *Money    `json:"refunded"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PriceChange struct {
+	ID       string  `json:"id"`
+	OldPrice float64 `json:"oldPrice"`
+	NewPrice float64 `json:"newPrice"`
+	// Seller who made or scheduled the change
+	AccountID int               `json:"accountId"`
+	Reason    PriceChangeReason `json:"reason"`
+	ChangedAt time.Time         `json:"changedAt"`
+}
+
 type PriceRangeInput struct {
-	Min float64 `json:"min"`
-	Max float64 `json:"max"`
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+type PriceSchedule struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"productId"`
+	Price     float64   `json:"price"`
+	StartsAt  time.Time `json:"startsAt"`
+	// Set for a sale, the regular price comes back at this time
+	EndsAt *time.Time          `json:"endsAt,omitempty"`
+	Status PriceScheduleStatus `json:"status"`
+	// Price before the sale started
+	RegularPrice *float64  `json:"regularPrice,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type Product struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	Description   string        `json:"description"`
+	Price         float64       `json:"price"`
+	PriceMoney    *Money        `json:"priceMoney"`
+	AccountID     int           `json:"accountId"`
+	Category      *string       `json:"category,omitempty"`
+	Status        ProductStatus `json:"status"`
+	CreatedAt     *time.Time    `json:"createdAt,omitempty"`
+	UpdatedAt     *time.Time    `json:"updatedAt,omitempty"`
+	RatingAverage *float64      `json:"ratingAverage,omitempty"`
+	ReviewCount   int           `json:"reviewCount"`
+	Reviews       []*Review     `json:"reviews"`
+	// Incremented by every update, pass it back as expectedVersion to detect concurrent edits
+	Version int `json:"version"`
+	// Latest price changes first
+	PriceHistory []*PriceChange `json:"priceHistory"`
+	// Units left to order, null when the seller does not track the stock
+	Stock *int `json:"stock,omitempty"`
+	// Shipping weight of one unit
+	WeightGrams *int `json:"weightGrams,omitempty"`
+	// Selects the tax rules of the product, null for the standard rate
+	TaxCategory *string `json:"taxCategory,omitempty"`
+}
+
+type Promotion struct {
+	ID   string        `json:"id"`
+	Code string        `json:"code"`
+	Type PromotionType `json:"type"`
+	// Percent off for PERCENTAGE, amount off for FIXED
+	Value float64 `json:"value"`
+	// Currency of a FIXED value and of minBasket
+	Currency    string `json:"currency"`
+	BuyQuantity *int   `json:"buyQuantity,omitempty"`
+	GetQuantity *int   `json:"getQuantity,omitempty"`
+	// Only products of this seller are discounted
+	SellerID *int `json:"sellerId,omitempty"`
+	// Only products of this category are discounted
+	Category *string `json:"category,omitempty"`
+	// Minimum price of the discounted products
+	MinBasket         *float64   `json:"minBasket,omitempty"`
+	MaxUses           *int       `json:"maxUses,omitempty"`
+	MaxUsesPerAccount *int       `json:"maxUsesPerAccount,omitempty"`
+	UsedCount         int        `json:"usedCount"`
+	StartsAt          *time.Time `json:"startsAt,omitempty"`
+	EndsAt            *time.Time `json:"endsAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+type PromotionInput struct {
+	Code  string        `json:"code"`
+	Type  PromotionType `json:"type"`
+	Value *float64      `json:"value,omitempty"`
+	// Defaults to USD
+	Currency    *string `json:"currency,omitempty"`
+	BuyQuantity *int    `json:"buyQuantity,omitempty"`
+	GetQuantity *int    `json:"getQuantity,omitempty"`
+	// Admins only, a seller's promotions always apply to their own products
+	SellerID          *int       `json:"sellerId,omitempty"`
+	Category          *string    `json:"category,omitempty"`
+	MinBasket         *float64   `json:"minBasket,omitempty"`
+	MaxUses           *int       `json:"maxUses,omitempty"`
+	MaxUsesPerAccount *int       `json:"maxUsesPerAccount,omitempty"`
+	StartsAt          *time.Time `json:"startsAt,omitempty"`
+	EndsAt            *time.Time `json:"endsAt,omitempty"`
+}
+
+type Query struct {
+}
+
+type QuoteLine struct {
+	ProductID      string `json:"productId"`
+	Name           string `json:"name"`
+	SellerID       int    `json:"sellerId"`
+	Quantity       int    `json:"quantity"`
+	UnitPriceMoney *Money `json:"unitPriceMoney"`
+	// Unit price times quantity
+	SubtotalMoney *Money `json:"subtotalMoney"`
+	DiscountMoney *Money `json:"discountMoney"`
+	TaxMoney      *Money `json:"taxMoney"`
+	// Subtotal minus the discount plus the exclusive tax
+	TotalMoney *Money `json:"totalMoney"`
+}
+
+type RegisterInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type Review struct {
+	ID           string       `json:"id"`
+	ProductID    string       `json:"productId"`
+	AccountID    int          `json:"accountId"`
+	Rating       int          `json:"rating"`
+	Title        string       `json:"title"`
+	Body         string       `json:"body"`
+	Status       ReviewStatus `json:"status"`
+	HelpfulCount int          `json:"helpfulCount"`
+	Reply        *ReviewReply `json:"reply,omitempty"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+type ReviewReply struct {
+	AccountID int       `json:"accountId"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SchedulePriceInput struct {
+	ProductID string     `json:"productId"`
+	Price     float64    `json:"price"`
+	StartsAt  time.Time  `json:"startsAt"`
+	EndsAt    *time.Time `json:"endsAt,omitempty"`
+}
+
+// The part of an order a seller handles: their lines, their shipment and the returns of their products
+type SellerOrder struct {
+	ID        string      `json:"id"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Status    OrderStatus `json:"status"`
+	// The customer who placed the order
+	AccountID       string             `json:"accountId"`
+	ShippingAddress *Address           `json:"shippingAddress,omitempty"`
+	Lines           []*SellerOrderLine `json:"lines"`
+	// Amounts of your lines only
+	SubtotalMoney      *Money         `json:"subtotalMoney"`
+	DiscountTotalMoney *Money         `json:"discountTotalMoney"`
+	TaxMoney           *Money         `json:"taxMoney"`
+	ShippingMoney      *Money         `json:"shippingMoney"`
+	TotalMoney         *Money         `json:"totalMoney"`
+	Shipments          []*Shipment    `json:"shipments"`
+	Returns            []*OrderReturn `json:"returns"`
+	// Your invoices of the order and their credit notes, oldest first
+	Invoices []*Invoice `json:"invoices"`
+	// Every status the order went through, oldest first
+	StatusHistory []*OrderStatusChange `json:"statusHistory"`
+}
+
+type SellerOrderConnection struct {
+	Edges    []*SellerOrderEdge `json:"edges"`
+	PageInfo *PageInfo          `json:"pageInfo"`
+	// Number of orders matching the filter, across all pages
+	TotalCount int `json:"totalCount"`
+}
+
+type SellerOrderEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *SellerOrder `json:"node"`
+}
+
+type SellerOrderFilterInput struct {
+	CreatedAfter  *time.Time    `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time    `json:"createdBefore,omitempty"`
+	Statuses      []OrderStatus `json:"statuses,omitempty"`
+	// Only the orders containing this product
+	ProductID *string `json:"productId,omitempty"`
+}
+
+type SellerOrderLine struct {
+	ProductID      string  `json:"productId"`
+	Name           string  `json:"name"`
+	Variant        *string `json:"variant,omitempty"`
+	Quantity       int     `json:"quantity"`
+	UnitPriceMoney *Money  `json:"unitPriceMoney"`
+	SubtotalMoney  *Money  `json:"subtotalMoney"`
+	DiscountMoney  *Money  `json:"discountMoney"`
+	TaxMoney       *Money  `json:"taxMoney"`
+	TotalMoney     *Money  `json:"totalMoney"`
+	// The shipment the line travels in
+	ShipmentID *string `json:"shipmentId,omitempty"`
+	// What you can do next with the line
+	Actions []FulfilmentAction `json:"actions"`
+}
+
+type Shipment struct {
+	ID       string         `json:"id"`
+	SellerID int            `json:"sellerId"`
+	Status   ShipmentStatus `json:"status"`
+	// What the customer paid for this shipment
+	Cost           *Money          `json:"cost"`
+	WeightGrams    int             `json:"weightGrams"`
+	Items          []*ShipmentItem `json:"items"`
+	Carrier        *Carrier        `json:"carrier,omitempty"`
+	TrackingNumber *string         `json:"trackingNumber,omitempty"`
+	// Page of the carrier following the parcel
+	TrackingURL *string    `json:"trackingUrl,omitempty"`
+	ShippedAt   *time.Time `json:"shippedAt,omitempty"`
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+}
+
+type ShipmentItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Only the fields that are set are changed
+type UpdateProductInput struct {
+	ID          string   `json:"id"`
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Price       *float64 `json:"price,omitempty"`
+	Category    *string  `json:"category,omitempty"`
+	// Units available to order, setting it makes checkouts hold the stock of the product
+	Stock *int `json:"stock,omitempty"`
+	// Shipping weight of one unit, used to price the shipments
+	WeightGrams *int `json:"weightGrams,omitempty"`
+	// Selects the tax rules of the product, empty for the standard rate
+	TaxCategory *string `json:"taxCategory,omitempty"`
+	// The update fails with a VERSION_CONFLICT error if the product is no longer at this version
+	ExpectedVersion *int `json:"expectedVersion,omitempty"`
+}
+
+type Carrier string
+
+const (
+	CarrierUps   Carrier = "UPS"
+	CarrierFedex Carrier = "FEDEX"
+	CarrierDhl   Carrier = "DHL"
+	CarrierUsps  Carrier = "USPS"
+	CarrierOther Carrier = "OTHER"
+)
+
+var AllCarrier = []Carrier{
+	CarrierUps,
+	CarrierFedex,
+	CarrierDhl,
+	CarrierUsps,
+	CarrierOther,
+}
+
+func (e Carrier) IsValid() bool {
+	switch e {
+	case CarrierUps, CarrierFedex, CarrierDhl, CarrierUsps, CarrierOther:
+		return true
+	}
+	return false
+}
+
+func (e Carrier) String() string {
+	return string(e)
+}
+
+func (e *Carrier) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Carrier(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Carrier", str)
+	}
+	return nil
+}
+
+func (e Carrier) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type CatalogFormat string
+
+const (
+	CatalogFormatCSV   CatalogFormat = "CSV"
+	CatalogFormatJSONL CatalogFormat = "JSONL"
+)
+
+var AllCatalogFormat = []CatalogFormat{
+	CatalogFormatCSV,
+	CatalogFormatJSONL,
+}
+
+func (e CatalogFormat) IsValid() bool {
+	switch e {
+	case CatalogFormatCSV, CatalogFormatJSONL:
+		return true
+	}
+	return false
+}
+
+func (e CatalogFormat) String() string {
+	return string(e)
+}
+
+func (e *CatalogFormat) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CatalogFormat(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CatalogFormat", str)
+	}
+	return nil
+}
+
+func (e CatalogFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type FulfilmentAction string
+
+const (
+	// shipShipment
+	FulfilmentActionShip FulfilmentAction = "SHIP"
+	// updateShipmentStatus to IN_TRANSIT
+	FulfilmentActionMarkInTransit FulfilmentAction = "MARK_IN_TRANSIT"
+	// updateShipmentStatus to DELIVERED
+	FulfilmentActionMarkDelivered FulfilmentAction = "MARK_DELIVERED"
+	// updateShipmentStatus to FAILED
+	FulfilmentActionMarkFailed FulfilmentAction = "MARK_FAILED"
+	// reviewReturn
+	FulfilmentActionReviewReturn FulfilmentAction = "REVIEW_RETURN"
+	// receiveReturn
+	FulfilmentActionReceiveReturn FulfilmentAction = "RECEIVE_RETURN"
+)
+
+var AllFulfilmentAction = []FulfilmentAction{
+	FulfilmentActionShip,
+	FulfilmentActionMarkInTransit,
+	FulfilmentActionMarkDelivered,
+	FulfilmentActionMarkFailed,
+	FulfilmentActionReviewReturn,
+	FulfilmentActionReceiveReturn,
+}
+
+func (e FulfilmentAction) IsValid() bool {
+	switch e {
+	case FulfilmentActionShip, FulfilmentActionMarkInTransit, FulfilmentActionMarkDelivered, FulfilmentActionMarkFailed, FulfilmentActionReviewReturn, FulfilmentActionReceiveReturn:
+		return true
+	}
+	return false
+}
+
+func (e FulfilmentAction) String() string {
+	return string(e)
+}
+
+func (e *FulfilmentAction) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = FulfilmentAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid FulfilmentAction", str)
+	}
+	return nil
+}
+
+func (e FulfilmentAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ImportJobStatus string
+
+const (
+	ImportJobStatusRunning   ImportJobStatus = "RUNNING"
+	ImportJobStatusCompleted ImportJobStatus = "COMPLETED"
+	ImportJobStatusFailed    ImportJobStatus = "FAILED"
+)
+
+var AllImportJobStatus = []ImportJobStatus{
+	ImportJobStatusRunning,
+	ImportJobStatusCompleted,
+	ImportJobStatusFailed,
+}
+
+func (e ImportJobStatus) IsValid() bool {
+	switch e {
+	case ImportJobStatusRunning, ImportJobStatusCompleted, ImportJobStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e ImportJobStatus) String() string {
+	return string(e)
+}
+
+func (e *ImportJobStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ImportJobStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ImportJobStatus", str)
+	}
+	return nil
+}
+
+func (e ImportJobStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type InvoiceKind string
+
+const (
+	InvoiceKindInvoice InvoiceKind = "INVOICE"
+	// Gives back part of an invoice, for a return or a refund
+	InvoiceKindCreditNote InvoiceKind = "CREDIT_NOTE"
+)
+
+var AllInvoiceKind = []InvoiceKind{
+	InvoiceKindInvoice,
+	InvoiceKindCreditNote,
+}
+
+func (e InvoiceKind) IsValid() bool {
+	switch e {
+	case InvoiceKindInvoice, InvoiceKindCreditNote:
+		return true
+	}
+	return false
+}
+
+func (e InvoiceKind) String() string {
+	return string(e)
+}
+
+func (e *InvoiceKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = InvoiceKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid InvoiceKind", str)
+	}
+	return nil
+}
+
+func (e InvoiceKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderLineErrorCode string
+
+const (
+	OrderLineErrorCodeUnknownProduct OrderLineErrorCode = "UNKNOWN_PRODUCT"
+	OrderLineErrorCodeOutOfStock     OrderLineErrorCode = "OUT_OF_STOCK"
+	OrderLineErrorCodeQuantityLimit  OrderLineErrorCode = "QUANTITY_LIMIT"
+)
+
+var AllOrderLineErrorCode = []OrderLineErrorCode{
+	OrderLineErrorCodeUnknownProduct,
+	OrderLineErrorCodeOutOfStock,
+	OrderLineErrorCodeQuantityLimit,
+}
+
+func (e OrderLineErrorCode) IsValid() bool {
+	switch e {
+	case OrderLineErrorCodeUnknownProduct, OrderLineErrorCodeOutOfStock, OrderLineErrorCodeQuantityLimit:
+		return true
+	}
+	return false
+}
+
+func (e OrderLineErrorCode) String() string {
+	return string(e)
+}
+
+func (e *OrderLineErrorCode) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderLineErrorCode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderLineErrorCode", str)
+	}
+	return nil
+}
+
+func (e OrderLineErrorCode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderSort string
+
+const (
+	OrderSortNewest    OrderSort = "NEWEST"
+	OrderSortOldest    OrderSort = "OLDEST"
+	OrderSortTotalAsc  OrderSort = "TOTAL_ASC"
+	OrderSortTotalDesc OrderSort = "TOTAL_DESC"
+)
+
+var AllOrderSort = []OrderSort{
+	OrderSortNewest,
+	OrderSortOldest,
+	OrderSortTotalAsc,
+	OrderSortTotalDesc,
+}
+
+func (e OrderSort) IsValid() bool {
+	switch e {
+	case OrderSortNewest, OrderSortOldest, OrderSortTotalAsc, OrderSortTotalDesc:
+		return true
+	}
+	return false
+}
+
+func (e OrderSort) String() string {
+	return string(e)
+}
+
+func (e *OrderSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderSort", str)
+	}
+	return nil
+}
+
+func (e OrderSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "PENDING"
+	OrderStatusPaid      OrderStatus = "PAID"
+	OrderStatusFulfilled OrderStatus = "FULFILLED"
+	OrderStatusShipped   OrderStatus = "SHIPPED"
+	OrderStatusDelivered OrderStatus = "DELIVERED"
+	OrderStatusCancelled OrderStatus = "CANCELLED"
+	OrderStatusRefunded  OrderStatus = "REFUNDED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusPaid,
+	OrderStatusFulfilled,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+	OrderStatusRefunded,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusFulfilled, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PriceChangeReason string
+
+const (
+	PriceChangeReasonManual    PriceChangeReason = "MANUAL"
+	PriceChangeReasonScheduled PriceChangeReason = "SCHEDULED"
+	PriceChangeReasonSaleStart PriceChangeReason = "SALE_START"
+	PriceChangeReasonSaleEnd   PriceChangeReason = "SALE_END"
+)
+
+var AllPriceChangeReason = []PriceChangeReason{
+	PriceChangeReasonManual,
+	PriceChangeReasonScheduled,
+	PriceChangeReasonSaleStart,
+	PriceChangeReasonSaleEnd,
+}
+
+func (e PriceChangeReason) IsValid() bool {
+	switch e {
+	case PriceChangeReasonManual, PriceChangeReasonScheduled, PriceChangeReasonSaleStart, PriceChangeReasonSaleEnd:
+		return true
+	}
+	return false
+}
+
+func (e PriceChangeReason) String() string {
+	return string(e)
+}
+
+func (e *PriceChangeReason) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PriceChangeReason(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PriceChangeReason", str)
+	}
+	return nil
+}
+
+func (e PriceChangeReason) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PriceScheduleStatus string
+
+const (
+	PriceScheduleStatusPending   PriceScheduleStatus = "PENDING"
+	PriceScheduleStatusActive    PriceScheduleStatus = "ACTIVE"
+	PriceScheduleStatusDone      PriceScheduleStatus = "DONE"
+	PriceScheduleStatusCancelled PriceScheduleStatus = "CANCELLED"
+)
+
+var AllPriceScheduleStatus = []PriceScheduleStatus{
+	PriceScheduleStatusPending,
+	PriceScheduleStatusActive,
+	PriceScheduleStatusDone,
+	PriceScheduleStatusCancelled,
+}
+
+func (e PriceScheduleStatus) IsValid() bool {
+	switch e {
+	case PriceScheduleStatusPending, PriceScheduleStatusActive, PriceScheduleStatusDone, PriceScheduleStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (e PriceScheduleStatus) String() string {
+	return string(e)
+}
+
+func (e *PriceScheduleStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PriceScheduleStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PriceScheduleStatus", str)
+	}
+	return nil
+}
+
+func (e PriceScheduleStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductStatus string
+
+const (
+	ProductStatusDraft     ProductStatus = "DRAFT"
+	ProductStatusPublished ProductStatus = "PUBLISHED"
+	ProductStatusArchived  ProductStatus = "ARCHIVED"
+)
+
+var AllProductStatus = []ProductStatus{
+	ProductStatusDraft,
+	ProductStatusPublished,
+	ProductStatusArchived,
+}
+
+func (e ProductStatus) IsValid() bool {
+	switch e {
+	case ProductStatusDraft, ProductStatusPublished, ProductStatusArchived:
+		return true
+	}
+	return false
+}
+
+func (e ProductStatus) String() string {
+	return string(e)
+}
+
+func (e *ProductStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductStatus", str)
+	}
+	return nil
+}
+
+func (e ProductStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PromotionType string
+
+const (
+	PromotionTypePercentage PromotionType = "PERCENTAGE"
+	PromotionTypeFixed      PromotionType = "FIXED"
+	PromotionTypeBuyXGetY   PromotionType = "BUY_X_GET_Y"
+)
+
+var AllPromotionType = []PromotionType{
+	PromotionTypePercentage,
+	PromotionTypeFixed,
+	PromotionTypeBuyXGetY,
+}
+
+func (e PromotionType) IsValid() bool {
+	switch e {
+	case PromotionTypePercentage, PromotionTypeFixed, PromotionTypeBuyXGetY:
+		return true
+	}
+	return false
+}
+
+func (e PromotionType) String() string {
+	return string(e)
+}
+
+func (e *PromotionType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PromotionType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PromotionType", str)
+	}
+	return nil
+}
+
+func (e PromotionType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReturnReason string
+
+const (
+	ReturnReasonDamaged        ReturnReason = "DAMAGED"
+	ReturnReasonWrongItem      ReturnReason = "WRONG_ITEM"
+	ReturnReasonNotAsDescribed ReturnReason = "NOT_AS_DESCRIBED"
+	ReturnReasonNoLongerNeeded ReturnReason = "NO_LONGER_NEEDED"
+	ReturnReasonOther          ReturnReason = "OTHER"
+)
+
+var AllReturnReason = []ReturnReason{
+	ReturnReasonDamaged,
+	ReturnReasonWrongItem,
+	ReturnReasonNotAsDescribed,
+	ReturnReasonNoLongerNeeded,
+	ReturnReasonOther,
+}
+
+func (e ReturnReason) IsValid() bool {
+	switch e {
+	case ReturnReasonDamaged, ReturnReasonWrongItem, ReturnReasonNotAsDescribed, ReturnReasonNoLongerNeeded, ReturnReasonOther:
+		return true
+	}
+	return false
+}
+
+func (e ReturnReason) String() string {
+	return string(e)
+}
+
+func (e *ReturnReason) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReturnReason(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReturnReason", str)
+	}
+	return nil
+}
+
+func (e ReturnReason) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "REQUESTED"
+	ReturnStatusApproved  ReturnStatus = "APPROVED"
+	ReturnStatusRejected  ReturnStatus = "REJECTED"
+	// The customer sent the parcel back
+	ReturnStatusShipped ReturnStatus = "SHIPPED"
+	// The seller got the parcel, the refund is on its way
+	ReturnStatusReceived ReturnStatus = "RECEIVED"
+	// The refund is being sent to the payment provider
+	ReturnStatusRefunding ReturnStatus = "REFUNDING"
+	ReturnStatusRefunded  ReturnStatus = "REFUNDED"
+)
+
+var AllReturnStatus = []ReturnStatus{
+	ReturnStatusRequested,
+	ReturnStatusApproved,
+	ReturnStatusRejected,
+	ReturnStatusShipped,
+	ReturnStatusReceived,
+	ReturnStatusRefunding,
+	ReturnStatusRefunded,
+}
+
+func (e ReturnStatus) IsValid() bool {
+	switch e {
+	case ReturnStatusRequested, ReturnStatusApproved, ReturnStatusRejected, ReturnStatusShipped, ReturnStatusReceived, ReturnStatusRefunding, ReturnStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e ReturnStatus) String() string {
+	return string(e)
+}
+
+func (e *ReturnStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReturnStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReturnStatus", str)
+	}
+	return nil
+}
+
+func (e ReturnStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPublished ReviewStatus = "PUBLISHED"
+	ReviewStatusRejected  ReviewStatus = "REJECTED"
+)
+
+var AllReviewStatus = []ReviewStatus{
+	ReviewStatusPublished,
+	ReviewStatusRejected,
+}
+
+func (e ReviewStatus) IsValid() bool {
+	switch e {
+	case ReviewStatusPublished, ReviewStatusRejected:
+		return true
+	}
+	return false
+}
+
+func (e ReviewStatus) String() string {
+	return string(e)
+}
+
+func (e *ReviewStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReviewStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReviewStatus", str)
+	}
+	return nil
+}
+
+func (e ReviewStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SellerOrderSort string
+
+const (
+	SellerOrderSortNewest SellerOrderSort = "NEWEST"
+	SellerOrderSortOldest SellerOrderSort = "OLDEST"
+)
+
+var AllSellerOrderSort = []SellerOrderSort{
+	SellerOrderSortNewest,
+	SellerOrderSortOldest,
+}
+
+func (e SellerOrderSort) IsValid() bool {
+	switch e {
+	case SellerOrderSortNewest, SellerOrderSortOldest:
+		return true
+	}
+	return false
+}
+
+func (e SellerOrderSort) String() string {
+	return string(e)
+}
+
+func (e *SellerOrderSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SellerOrderSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SellerOrderSort", str)
+	}
+	return nil
+}
+
+func (e SellerOrderSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ShipmentStatus string
+
+const (
+	ShipmentStatusPending   ShipmentStatus = "PENDING"
+	ShipmentStatusShipped   ShipmentStatus = "SHIPPED"
+	ShipmentStatusInTransit ShipmentStatus = "IN_TRANSIT"
+	ShipmentStatusDelivered ShipmentStatus = "DELIVERED"
+	// The carrier could not deliver the parcel, the seller can ship it again
+	ShipmentStatusFailed ShipmentStatus = "FAILED"
+)
+
+var AllShipmentStatus = []ShipmentStatus{
+	ShipmentStatusPending,
+	ShipmentStatusShipped,
+	ShipmentStatusInTransit,
+	ShipmentStatusDelivered,
+	ShipmentStatusFailed,
+}
+
+func (e ShipmentStatus) IsValid() bool {
+	switch e {
+	case ShipmentStatusPending, ShipmentStatusShipped, ShipmentStatusInTransit, ShipmentStatusDelivered, ShipmentStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e ShipmentStatus) String() string {
+	return string(e)
+}
+
+func (e *ShipmentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ShipmentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ShipmentStatus", str)
+	}
+	return nil
+}
+
+func (e ShipmentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
 type SortOrder string
@@ -65,29 +1351,42 @@ const (
 	SortOrderPriceDesc  SortOrder = "PRICE_DESC"
 	SortOrderNewest     SortOrder = "NEWEST"
 	SortOrderPopularity SortOrder = "POPULARITY"
+	SortOrderRating     SortOrder = "RATING"
 )
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	AccountID   int     `json:"accountId"`
-	Category    string  `json:"category"`
+var AllSortOrder = []SortOrder{
+	SortOrderPriceAsc,
+	SortOrderPriceDesc,
+	SortOrderNewest,
+	SortOrderPopularity,
+	SortOrderRating,
 }
 
-type Query struct {
+func (e SortOrder) IsValid() bool {
+	switch e {
+	case SortOrderPriceAsc, SortOrderPriceDesc, SortOrderNewest, SortOrderPopularity, SortOrderRating:
+		return true
+	}
+	return false
 }
 
-type RegisterInput struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+func (e SortOrder) String() string {
+	return string(e)
 }
 
-type UpdateProductInput struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+func (e *SortOrder) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortOrder", str)
+	}
+	return nil
+}
+
+func (e SortOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+func toMoney(m money.Money) *Money {
+	return &Money{
+		Amount:    int(m.Amount),
+		Currency:  m.Currency,
+		Formatted: m.String(),
+	}
+}
+
+func fromMoney(m *Money) money.Money {
+	return money.New(int64(m.Amount), m.Currency)
+}
+
+// convertMoney converts an amount for display at today's rate
+func (server *Server) convertMoney(ctx context.Context, m *Money, currency string) (*Money, error) {
+	converted, _, err := money.Convert(ctx, server.rates, fromMoney(m), currency)
+	if err != nil {
+		return nil, err
+	}
+	return toMoney(converted), nil
+}
+
+func (server *Server) convertProduct(ctx context.Context, product *Product, currency string) error {
+	price, err := server.convertMoney(ctx, product.PriceMoney, currency)
+	if err != nil {
+		return err
+	}
+	product.PriceMoney = price
+	product.Price = fromMoney(price).Float()
+	return nil
+}
+
+// convertOrder shows an order in another currency. The rates the order was
+// placed with stay in exchangeRates.
+func (server *Server) convertOrder(ctx context.Context, order *Order, currency string) error {
+	var err error
+	if order.SubtotalMoney, err = server.convertMoney(ctx, order.SubtotalMoney, currency); err != nil {
+		return err
+	}
+	if order.DiscountTotalMoney, err = server.convertMoney(ctx, order.DiscountTotalMoney, currency); err != nil {
+		return err
+	}
+	if order.TotalMoney, err = server.convertMoney(ctx, order.TotalMoney, currency); err != nil {
+		return err
+	}
+	if order.ShippingMoney, err = server.convertMoney(ctx, order.ShippingMoney, currency); err != nil {
+		return err
+	}
+	if order.TaxMoney, err = server.convertMoney(ctx, order.TaxMoney, currency); err != nil {
+		return err
+	}
+	order.Subtotal = fromMoney(order.SubtotalMoney).Float()
+	order.DiscountTotal = fromMoney(order.DiscountTotalMoney).Float()
+	order.TotalPrice = fromMoney(order.TotalMoney).Float()
+
+	for _, product := range order.Products {
+		if product.PriceMoney, err = server.convertMoney(ctx, product.PriceMoney, currency); err != nil {
+			return err
+		}
+		product.Price = fromMoney(product.PriceMoney).Float()
+	}
+	for _, discount := range order.Discounts {
+		if discount.AmountMoney, err = server.convertMoney(ctx, discount.AmountMoney, currency); err != nil {
+			return err
+		}
+		discount.Amount = fromMoney(discount.AmountMoney).Float()
+	}
+	for _, shipment := range order.Shipments {
+		if shipment.Cost, err = server.convertMoney(ctx, shipment.Cost, currency); err != nil {
+			return err
+		}
+	}
+	for _, tax := range order.Taxes {
+		if tax.TaxableMoney, err = server.convertMoney(ctx, tax.TaxableMoney, currency); err != nil {
+			return err
+		}
+		if tax.AmountMoney, err = server.convertMoney(ctx, tax.AmountMoney, currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/thomas/EcommerceAPI/order/models"
 	"github.com/thomas/EcommerceAPI/pkg/auth"
+	productmodels "github.com/thomas/EcommerceAPI/product/models"
 )
 
 var (
@@ -36,6 +37,7 @@ func (resolver *mutationResolver) Register(ctx context.Context, in RegisterInput
 		return nil, errors.New("could not retrieve gin context")
 	}
 	ginContext.SetCookie("token", token, 3600, "/", "localhost", false, true)
+	resolver.server.mergeGuestCart(ctx, ginContext, token)
 
 	return &AuthResponse{Token: token}, nil
 }
@@ -55,6 +57,7 @@ func (resolver *mutationResolver) Login(ctx context.Context, in LoginInput) (*Au
 		return nil, errors.New("could not retrieve gin context")
 	}
 	ginContext.SetCookie("token", token, 3600, "/", "localhost", false, true)
+	resolver.server.mergeGuestCart(ctx, ginContext, token)
 
 	return &AuthResponse{Token: token}, nil
 }
@@ -73,8 +76,17 @@ func (resolver *mutationResolver) CreateProduct(ctx context.Context, in CreatePr
 	}
 
 	log.Println("CreateProduct called with accountId:", accountId)
+	var status string
+	if in.Status != nil {
+		status = string(*in.Status)
+	}
+	var currency string
+	if in.Currency != nil {
+		currency = *in.Currency
+	}
+
 	// For now, we'll use an empty string for the category
-	postProduct, err := resolver.server.productClient.PostProduct(ctx, in.Name, in.Description, in.Price, int64(accountId), "")
+	postProduct, err := resolver.server.productClient.PostProduct(ctx, in.Name, in.Description, in.Price, currency, int64(accountId), "", status)
 	if err != nil {
 		log.Println("Error creating product:", err)
 		return nil, err
@@ -83,14 +95,8 @@ func (resolver *mutationResolver) CreateProduct(ctx context.Context, in CreatePr
 	log.Println("Created product:", postProduct)
 	log.Println("Product id: ", postProduct.ID)
 
-	return &Product{
-		ID:          postProduct.ID,
-		Name:        postProduct.Name,
-		Description: postProduct.Description,
-		Price:       postProduct.Price,
-		AccountID:   accountId,
-		Category:    postProduct.Category,
-	}, nil
+	postProduct.AccountID = accountId
+	return toProduct(postProduct), nil
 }
 
 func (resolver *mutationResolver) UpdateProduct(ctx context.Context, in UpdateProductInput) (*Product, error) {
@@ -104,21 +110,34 @@ func (resolver *mutationResolver) UpdateProduct(ctx context.Context, in UpdatePr
 		return nil, errors.New("unauthorized: you must be logged in to update a product")
 	}
 
-	// For now, we'll use an empty string for the category
-	updatedProduct, err := resolver.server.productClient.UpdateProduct(ctx, in.ID, in.Name, in.Description, in.Price, int64(accountId), "")
+	var expectedVersion int64
+	if in.ExpectedVersion != nil {
+		expectedVersion = int64(*in.ExpectedVersion)
+	}
+
+	changes := productmodels.ProductChanges{
+		Name:        in.Name,
+		Description: in.Description,
+		Price:       in.Price,
+		Category:    in.Category,
+	}
+	if in.Stock != nil {
+		stock := int64(*in.Stock)
+		changes.Stock = &stock
+	}
+	if in.WeightGrams != nil {
+		weight := int64(*in.WeightGrams)
+		changes.WeightGrams = &weight
+	}
+	changes.TaxCategory = in.TaxCategory
+	updatedProduct, err := resolver.server.productClient.UpdateProduct(ctx, in.ID, int64(accountId), changes, expectedVersion)
 	if err != nil {
 		log.Println("Error updating product:", err)
-		return nil, err
+		return nil, fromVersionConflict(ctx, err)
 	}
 
-	return &Product{
-		ID:          updatedProduct.ID,
-		Name:        updatedProduct.Name,
-		Description: updatedProduct.Description,
-		Price:       updatedProduct.Price,
-		AccountID:   accountId,
-		Category:    updatedProduct.Category,
-	}, nil
+	updatedProduct.AccountID = accountId
+	return toProduct(updatedProduct), nil
 }
 
 func (resolver *mutationResolver) DeleteProduct(ctx context.Context, id string) (*bool, error) {
@@ -142,17 +161,75 @@ func (resolver *mutationResolver) DeleteProduct(ctx context.Context, id string)
 	return &success, nil
 }
 
+func (resolver *mutationResolver) SetProductStatus(ctx context.Context, id string, status ProductStatus) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for SetProductStatus:", err)
+		return nil, errors.New("unauthorized: you must be logged in to change a product status")
+	}
+
+	product, err := resolver.server.productClient.SetProductStatus(ctx, id, int64(accountId), string(status))
+	if err != nil {
+		log.Println("Error changing product status:", err)
+		return nil, err
+	}
+
+	return toProduct(product), nil
+}
+
 func (resolver *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	// Validate input
-	if len(in.Products) == 0 {
+	products, err := orderedProductsInput(in.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for CreateOrder:", err)
+		return nil, errors.New("unauthorized: you must be logged in to create an order")
+	}
+
+	// Convert accountId to string for the order service
+	accountIdStr := strconv.Itoa(accountId)
+
+	// Create the order
+	var couponCode string
+	if in.CouponCode != nil {
+		couponCode = *in.CouponCode
+	}
+	var currency string
+	if in.Currency != nil {
+		currency = *in.Currency
+	}
+	idempotencyKey, err := orderIdempotencyKey(ctx, in.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	postOrder, err := resolver.server.orderClient.PostOrder(ctx, accountIdStr, products, couponCode, currency, fromAddressInput(in.ShippingAddress), idempotencyKey)
+	if err != nil {
+		log.Println("Error creating order:", err)
+		return nil, err
+	}
+
+	return toOrder(postOrder), nil
+}
+
+// orderedProductsInput validates the products of an order input
+func orderedProductsInput(in []*OrderedProductInput) ([]*models.OrderedProduct, error) {
+	if len(in) == 0 {
 		return nil, errors.New("order must contain at least one product")
 	}
 
 	var products []*models.OrderedProduct
-	for _, product := range in.Products {
+	for _, product := range in {
 		if product.Quantity <= 0 {
 			return nil, errors.New("product quantity must be greater than zero")
 		}
@@ -161,40 +238,88 @@ func (resolver *mutationResolver) CreateOrder(ctx context.Context, in OrderInput
 			Quantity: uint32(product.Quantity),
 		})
 	}
+	return products, nil
+}
+
+func (resolver *mutationResolver) CreateReview(ctx context.Context, in CreateReviewInput) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 
 	// Enforce authentication - this will abort the request if not authenticated
 	accountId, err := auth.GetUserIdInt(ctx, true)
 	if err != nil {
-		log.Println("Authentication failed for CreateOrder:", err)
-		return nil, errors.New("unauthorized: you must be logged in to create an order")
+		log.Println("Authentication failed for CreateReview:", err)
+		return nil, errors.New("unauthorized: you must be logged in to review a product")
 	}
 
-	// Convert accountId to string for the order service
-	accountIdStr := strconv.Itoa(accountId)
+	var title, body string
+	if in.Title != nil {
+		title = *in.Title
+	}
+	if in.Body != nil {
+		body = *in.Body
+	}
 
-	// Create the order
-	postOrder, err := resolver.server.orderClient.PostOrder(ctx, accountIdStr, products)
+	review, err := resolver.server.productClient.CreateReview(ctx, in.ProductID, int64(accountId), in.Rating, title, body)
 	if err != nil {
-		log.Println("Error creating order:", err)
+		log.Println("Error creating review:", err)
 		return nil, err
 	}
+	return toReview(review), nil
+}
 
-	// Format the response
-	var orderedProducts []*OrderedProduct
-	for _, orderedProduct := range postOrder.Products {
-		orderedProducts = append(orderedProducts, &OrderedProduct{
-			ID:          orderedProduct.ID,
-			Name:        orderedProduct.Name,
-			Description: orderedProduct.Description,
-			Price:       orderedProduct.Price,
-			Quantity:    int(orderedProduct.Quantity),
-		})
+func (resolver *mutationResolver) ReplyToReview(ctx context.Context, reviewId string, body string) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ReplyToReview:", err)
+		return nil, errors.New("unauthorized: you must be logged in to reply to a review")
 	}
 
-	return &Order{
-		ID:         strconv.Itoa(int(postOrder.ID)),
-		CreatedAt:  postOrder.CreatedAt,
-		TotalPrice: postOrder.TotalPrice,
-		Products:   orderedProducts,
-	}, nil
+	review, err := resolver.server.productClient.ReplyToReview(ctx, reviewId, int64(accountId), body)
+	if err != nil {
+		log.Println("Error replying to review:", err)
+		return nil, err
+	}
+	return toReview(review), nil
+}
+
+func (resolver *mutationResolver) MarkReviewHelpful(ctx context.Context, reviewId string) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for MarkReviewHelpful:", err)
+		return nil, errors.New("unauthorized: you must be logged in to vote on a review")
+	}
+
+	review, err := resolver.server.productClient.VoteReviewHelpful(ctx, reviewId, int64(accountId))
+	if err != nil {
+		log.Println("Error voting on review:", err)
+		return nil, err
+	}
+	return toReview(review), nil
+}
+
+func (resolver *mutationResolver) ModerateReview(ctx context.Context, reviewId string, status ReviewStatus) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		log.Println("Authentication failed for ModerateReview:", err)
+		return nil, errors.New("unauthorized: you must be logged in to moderate reviews")
+	}
+
+	review, err := resolver.server.productClient.ModerateReview(ctx, reviewId, string(status), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error moderating review:", err)
+		return nil, err
+	}
+	return toReview(review), nil
 }
@@ -0,0 +1,266 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+func toOrder(order *models.Order) *Order {
+	result := &Order{
+		ID:            strconv.Itoa(int(order.ID)),
+		CreatedAt:     order.CreatedAt,
+		Subtotal:      order.Subtotal,
+		DiscountTotal: order.DiscountTotal,
+		TotalPrice:    order.TotalPrice,
+
+		SubtotalMoney:      toMoney(order.SubtotalMoney()),
+		DiscountTotalMoney: toMoney(order.DiscountTotalMoney()),
+		TotalMoney:         toMoney(order.TotalMoney()),
+		Products:           []*OrderedProduct{},
+		Discounts:          []*OrderDiscount{},
+		ExchangeRates:      []*ExchangeRate{},
+		Status:             OrderStatus(order.Status),
+		StatusHistory:      []*OrderStatusChange{},
+		Payments:           []*Payment{},
+	}
+	result.ShippingMoney = toMoney(order.ShippingTotalMoney())
+	result.ShippingAddress = toAddress(order.ShippingAddress)
+	result.Shipments = []*Shipment{}
+	for i := range order.Shipments {
+		result.Shipments = append(result.Shipments, toShipment(&order.Shipments[i]))
+	}
+	result.TaxMoney = toMoney(order.TaxTotalMoney())
+	result.Taxes = []*OrderTax{}
+	for _, tax := range order.Taxes {
+		result.Taxes = append(result.Taxes, toOrderTax(tax, order.Currency))
+	}
+	// Orders placed before statuses existed
+	if order.Status == "" {
+		result.Status = OrderStatusPending
+	}
+	if order.CouponCode != "" {
+		result.CouponCode = &order.CouponCode
+	}
+	if order.CancellationReason != "" {
+		result.CancellationReason = &order.CancellationReason
+	}
+	for _, orderedProduct := range order.Products {
+		line := &OrderedProduct{
+			ID:          orderedProduct.ID,
+			Name:        orderedProduct.Name,
+			Description: orderedProduct.Description,
+			Price:       orderedProduct.Price,
+			PriceMoney:  toMoney(orderedProduct.PriceMoney()),
+			Quantity:    int(orderedProduct.Quantity),
+		}
+		if orderedProduct.Variant != "" {
+			line.Variant = &orderedProduct.Variant
+		}
+		result.Products = append(result.Products, line)
+	}
+	for _, discount := range order.Discounts {
+		result.Discounts = append(result.Discounts, toOrderDiscount(discount, order.Currency))
+	}
+	for _, rate := range order.ExchangeRates {
+		result.ExchangeRates = append(result.ExchangeRates, &ExchangeRate{
+			From: rate.FromCurrency,
+			To:   rate.ToCurrency,
+			Rate: rate.Rate,
+		})
+	}
+	for _, change := range order.StatusHistory {
+		statusChange := &OrderStatusChange{
+			To:        OrderStatus(change.ToStatus),
+			ChangedAt: change.CreatedAt,
+		}
+		if change.FromStatus != "" {
+			from := OrderStatus(change.FromStatus)
+			statusChange.From = &from
+		}
+		if change.ChangedBy != "" {
+			statusChange.ChangedBy = &change.ChangedBy
+		}
+		if change.Note != "" {
+			statusChange.Note = &change.Note
+		}
+		result.StatusHistory = append(result.StatusHistory, statusChange)
+	}
+	for _, intent := range order.Payments {
+		p := &Payment{
+			ID:        strconv.Itoa(int(intent.ID)),
+			Status:    intent.Status,
+			Amount:    toMoney(intent.AmountMoney()),
+			Provider:  intent.Provider,
+			Refunded:  toMoney(intent.RefundedMoney()),
+			CreatedAt: intent.CreatedAt,
+		}
+		if intent.FailureReason != "" {
+			p.FailureReason = &intent.FailureReason
+		}
+		result.Payments = append(result.Payments, p)
+	}
+	result.Returns = []*OrderReturn{}
+	for i := range order.Returns {
+		result.Returns = append(result.Returns, toOrderReturn(&order.Returns[i]))
+	}
+	result.Invoices = []*Invoice{}
+	for i := range order.Invoices {
+		result.Invoices = append(result.Invoices, toInvoice(&order.Invoices[i]))
+	}
+	return result
+}
+
+func toOrderDiscount(discount models.OrderDiscount, currency string) *OrderDiscount {
+	return &OrderDiscount{
+		ProductID: discount.ProductID,
+		Code:      discount.Code,
+		Amount:    discount.Amount,
+
+		AmountMoney: toMoney(money.New(discount.AmountMinor, currency)),
+	}
+}
+
+func toOrderTax(tax models.OrderTax, currency string) *OrderTax {
+	return &OrderTax{
+		ProductID:    tax.ProductID,
+		Name:         tax.Name,
+		Rate:         tax.Rate,
+		Inclusive:    tax.Inclusive,
+		TaxableMoney: toMoney(money.New(tax.TaxableMinor, currency)),
+		AmountMoney:  toMoney(money.New(tax.AmountMinor, currency)),
+	}
+}
+
+func (resolver *queryResolver) Order(ctx context.Context, id string, currency *string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for Order query:", err)
+		return nil, errors.New("unauthorized: you must be logged in to see an order")
+	}
+
+	orderId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+
+	res, err := resolver.server.orderClient.GetOrder(ctx, uint(orderId), strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error getting order:", err)
+		return nil, err
+	}
+	order := toOrder(res)
+	if currency != nil {
+		if err = resolver.server.convertOrder(ctx, order, *currency); err != nil {
+			log.Println("Error converting order:", err)
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (resolver *mutationResolver) UpdateOrderStatus(ctx context.Context, orderId string, status OrderStatus, note *string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for UpdateOrderStatus:", err)
+		return nil, errors.New("unauthorized: you must be logged in to change an order status")
+	}
+
+	id, err := strconv.ParseUint(orderId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	var statusNote string
+	if note != nil {
+		statusNote = *note
+	}
+
+	order, err := resolver.server.orderClient.UpdateOrderStatus(ctx, uint(id), string(status), statusNote, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error updating order status:", err)
+		return nil, err
+	}
+	return toOrder(order), nil
+}
+
+func (resolver *mutationResolver) CancelOrder(ctx context.Context, orderId string, reason *string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for CancelOrder:", err)
+		return nil, errors.New("unauthorized: you must be logged in to cancel an order")
+	}
+
+	id, err := strconv.ParseUint(orderId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	var cancellationReason string
+	if reason != nil {
+		cancellationReason = *reason
+	}
+
+	order, err := resolver.server.orderClient.CancelOrder(ctx, uint(id), cancellationReason, strconv.Itoa(accountId))
+	if err != nil {
+		log.Println("Error cancelling order:", err)
+		return nil, err
+	}
+	return toOrder(order), nil
+}
+
+// orderIdempotencyKey takes the key from the argument or else from the
+// Idempotency-Key header, they must agree when both are given
+func orderIdempotencyKey(ctx context.Context, argument *string) (string, error) {
+	var header string
+	if ginContext, ok := ctx.Value("GinContextKey").(*gin.Context); ok {
+		header = strings.TrimSpace(ginContext.GetHeader("Idempotency-Key"))
+	}
+	if argument == nil || *argument == "" {
+		return header, nil
+	}
+	if header != "" && header != *argument {
+		return "", errors.New("the idempotencyKey argument and the Idempotency-Key header differ")
+	}
+	return *argument, nil
+}
+
+type orderedProductResolver struct {
+	server *Server
+}
+
+// Product links the order line to the live product, nil when it was deleted
+// or is no longer published
+func (resolver *orderedProductResolver) Product(ctx context.Context, obj *OrderedProduct) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	products, err := resolver.server.productClient.GetProducts(ctx, 0, 0, []string{obj.ID}, "")
+	if err != nil {
+		log.Println("Error getting ordered product:", err)
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, nil
+	}
+	return toProduct(&products[0]), nil
+}
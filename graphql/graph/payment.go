@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/pkg/payment"
+)
+
+// Webhooks are small, a larger body is not from the provider
+const maxWebhookSize = 64 << 10
+
+func (resolver *mutationResolver) PayOrder(ctx context.Context, orderId string, paymentMethod string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for PayOrder:", err)
+		return nil, errors.New("unauthorized: you must be logged in to pay an order")
+	}
+
+	id, err := strconv.ParseUint(orderId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+
+	order, err := resolver.server.orderClient.PayOrder(ctx, uint(id), paymentMethod, strconv.Itoa(accountId))
+	if err != nil {
+		log.Println("Error paying order:", err)
+		return nil, err
+	}
+	return toOrder(order), nil
+}
+
+// PaymentWebhook receives the webhooks of the payment provider, POST
+// /payments/webhook. The provider retries until it gets a 2xx, so errors on
+// our side answer 500 and events seen before answer 200.
+func (server *Server) PaymentWebhook(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not read the body"})
+			return
+		}
+		if err = payment.Verify(secret, body, c.GetHeader(payment.SignatureHeader), time.Now()); err != nil {
+			log.Println("Rejected payment webhook:", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var event payment.Event
+		if err = json.Unmarshal(body, &event); err != nil || event.ID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event"})
+			return
+		}
+
+		duplicate, err := server.orderClient.HandlePaymentEvent(c.Request.Context(), event)
+		if err != nil {
+			log.Println("Error handling payment webhook:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not process the event"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": duplicate})
+	}
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+func (resolver *mutationResolver) SchedulePriceChange(ctx context.Context, in SchedulePriceInput) (*PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for SchedulePriceChange:", err)
+		return nil, errors.New("unauthorized: you must be logged in to schedule a price change")
+	}
+
+	schedule, err := resolver.server.productClient.SchedulePriceChange(ctx, in.ProductID, int64(accountId), in.Price, in.StartsAt, in.EndsAt)
+	if err != nil {
+		log.Println("Error scheduling price change:", err)
+		return nil, err
+	}
+	return toPriceSchedule(schedule), nil
+}
+
+func (resolver *mutationResolver) CancelPriceSchedule(ctx context.Context, id string) (*PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for CancelPriceSchedule:", err)
+		return nil, errors.New("unauthorized: you must be logged in to cancel a price schedule")
+	}
+
+	schedule, err := resolver.server.productClient.CancelPriceSchedule(ctx, id, int64(accountId))
+	if err != nil {
+		log.Println("Error cancelling price schedule:", err)
+		return nil, err
+	}
+	return toPriceSchedule(schedule), nil
+}
+
+func (resolver *queryResolver) PriceSchedules(ctx context.Context, productId string) ([]*PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for PriceSchedules query:", err)
+		return nil, errors.New("unauthorized: you must be logged in to view price schedules")
+	}
+
+	scheduleList, err := resolver.server.productClient.GetPriceSchedules(ctx, productId, int64(accountId))
+	if err != nil {
+		log.Println("Error getting price schedules:", err)
+		return nil, err
+	}
+
+	schedules := []*PriceSchedule{}
+	for i := range scheduleList {
+		schedules = append(schedules, toPriceSchedule(&scheduleList[i]))
+	}
+	return schedules, nil
+}
+
+func toPriceSchedule(schedule *models.PriceSchedule) *PriceSchedule {
+	result := &PriceSchedule{
+		ID:        schedule.ID,
+		ProductID: schedule.ProductID,
+		Price:     schedule.Price,
+		StartsAt:  schedule.StartsAt,
+		EndsAt:    schedule.EndsAt,
+		Status:    PriceScheduleStatus(schedule.Status),
+		CreatedAt: schedule.CreatedAt,
+	}
+	// The regular price is only known once the sale started
+	if schedule.IsSale() && schedule.RegularPrice > 0 {
+		result.RegularPrice = &schedule.RegularPrice
+	}
+	return result
+}
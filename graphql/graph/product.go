@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+type productResolver struct {
+	server *Server
+}
+
+func (resolver *productResolver) Reviews(ctx context.Context, obj *Product, pagination *PaginationInput) ([]*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+
+	reviewList, err := resolver.server.productClient.GetReviews(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Println("Error getting reviews for product:", err)
+		return nil, err
+	}
+
+	reviews := []*Review{}
+	for i := range reviewList {
+		reviews = append(reviews, toReview(&reviewList[i]))
+	}
+	return reviews, nil
+}
+
+func (resolver *productResolver) PriceHistory(ctx context.Context, obj *Product, pagination *PaginationInput) ([]*PriceChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+
+	changeList, err := resolver.server.productClient.GetPriceHistory(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Println("Error getting price history for product:", err)
+		return nil, err
+	}
+
+	changes := []*PriceChange{}
+	for _, change := range changeList {
+		changes = append(changes, &PriceChange{
+			ID:        change.ID,
+			OldPrice:  change.OldPrice,
+			NewPrice:  change.NewPrice,
+			AccountID: change.AccountID,
+			Reason:    PriceChangeReason(change.Reason),
+			ChangedAt: change.ChangedAt,
+		})
+	}
+	return changes, nil
+}
+
+// toReview converts a review from the product service into its GraphQL representation
+func toReview(review *models.Review) *Review {
+	result := &Review{
+		ID:           review.ID,
+		ProductID:    review.ProductID,
+		AccountID:    review.AccountID,
+		Rating:       review.Rating,
+		Title:        review.Title,
+		Body:         review.Body,
+		Status:       ReviewStatus(review.Status),
+		HelpfulCount: int(review.HelpfulCount),
+		CreatedAt:    review.CreatedAt,
+		UpdatedAt:    review.UpdatedAt,
+	}
+	if review.Reply != nil {
+		result.Reply = &ReviewReply{
+			AccountID: review.Reply.AccountID,
+			Body:      review.Reply.Body,
+			CreatedAt: review.Reply.CreatedAt,
+		}
+	}
+	return result
+}
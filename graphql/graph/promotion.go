@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+func (resolver *mutationResolver) CreatePromotion(ctx context.Context, in PromotionInput) (*Promotion, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for CreatePromotion:", err)
+		return nil, errors.New("unauthorized: you must be logged in to create a promotion")
+	}
+
+	promotion := models.Promotion{
+		Code:     in.Code,
+		Type:     string(in.Type),
+		StartsAt: in.StartsAt,
+		EndsAt:   in.EndsAt,
+	}
+	if in.Value != nil {
+		promotion.Value = *in.Value
+	}
+	if in.Currency != nil {
+		promotion.Currency = *in.Currency
+	}
+	if in.BuyQuantity != nil {
+		promotion.BuyQuantity = *in.BuyQuantity
+	}
+	if in.GetQuantity != nil {
+		promotion.GetQuantity = *in.GetQuantity
+	}
+	if in.SellerID != nil {
+		promotion.SellerID = *in.SellerID
+	}
+	if in.Category != nil {
+		promotion.Category = *in.Category
+	}
+	if in.MinBasket != nil {
+		promotion.MinBasket = *in.MinBasket
+	}
+	if in.MaxUses != nil {
+		promotion.MaxUses = *in.MaxUses
+	}
+	if in.MaxUsesPerAccount != nil {
+		promotion.MaxUsesPerAccount = *in.MaxUsesPerAccount
+	}
+
+	created, err := resolver.server.orderClient.CreatePromotion(ctx, promotion, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error creating promotion:", err)
+		return nil, err
+	}
+	return toPromotion(created), nil
+}
+
+func (resolver *queryResolver) Promotions(ctx context.Context) ([]*Promotion, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for Promotions query:", err)
+		return nil, errors.New("unauthorized: you must be logged in to view promotions")
+	}
+
+	promotionList, err := resolver.server.orderClient.GetPromotions(ctx, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error getting promotions:", err)
+		return nil, err
+	}
+
+	promotions := []*Promotion{}
+	for i := range promotionList {
+		promotions = append(promotions, toPromotion(&promotionList[i]))
+	}
+	return promotions, nil
+}
+
+func toPromotion(promotion *models.Promotion) *Promotion {
+	result := &Promotion{
+		ID:        strconv.Itoa(int(promotion.ID)),
+		Code:      promotion.Code,
+		Type:      PromotionType(promotion.Type),
+		Value:     promotion.Value,
+		Currency:  promotion.Currency,
+		UsedCount: promotion.UsedCount,
+		StartsAt:  promotion.StartsAt,
+		EndsAt:    promotion.EndsAt,
+		CreatedAt: promotion.CreatedAt,
+	}
+	if promotion.Type == models.PromotionBuyXGetY {
+		result.BuyQuantity = &promotion.BuyQuantity
+		result.GetQuantity = &promotion.GetQuantity
+	}
+	if promotion.SellerID != 0 {
+		result.SellerID = &promotion.SellerID
+	}
+	if promotion.Category != "" {
+		result.Category = &promotion.Category
+	}
+	if promotion.MinBasket != 0 {
+		result.MinBasket = &promotion.MinBasket
+	}
+	if promotion.MaxUses != 0 {
+		result.MaxUses = &promotion.MaxUses
+	}
+	if promotion.MaxUsesPerAccount != 0 {
+		result.MaxUsesPerAccount = &promotion.MaxUsesPerAccount
+	}
+	return result
+}
@@ -2,14 +2,13 @@ package graph
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"log"
 	"strconv"
 	"time"
 
-	"github.com/99designs/gqlgen/graphql"
 	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/pkg/money"
 	"github.com/thomas/EcommerceAPI/product/models"
 )
 
@@ -76,86 +75,52 @@ func (resolver *queryResolver) Product(
 	viewedProductsIds []*string,
 	byAccountId *bool,
 	ownedByMe *bool,
+	priceRange *PriceRangeInput,
+	category *string,
+	minRating *float64,
+	sortBy *SortOrder,
+	currency *string,
 ) ([]*Product, error) {
-	// These parameters are not in the interface yet
-	var priceRange *PriceRangeInput
-	var category *string
-	var sortBy *SortOrder
-
-	// Extract the parameters from the context
-	if opCtx := graphql.GetOperationContext(ctx); opCtx != nil {
-		// First try to get parameters from variables (for variable-based queries)
-		if opCtx.Variables != nil {
-			if val, ok := opCtx.Variables["priceRange"]; ok {
-				if prMap, ok := val.(map[string]interface{}); ok {
-					var min, max float64
-					if minVal, ok := prMap["min"]; ok {
-						switch v := minVal.(type) {
-						case float64:
-							min = v
-						case float32:
-							min = float64(v)
-						case int:
-							min = float64(v)
-						case int64:
-							min = float64(v)
-						case json.Number:
-							min, _ = v.Float64()
-						}
-					}
-					if maxVal, ok := prMap["max"]; ok {
-						switch v := maxVal.(type) {
-						case float64:
-							max = v
-						case float32:
-							max = float64(v)
-						case int:
-							max = float64(v)
-						case int64:
-							max = float64(v)
-						case json.Number:
-							max, _ = v.Float64()
-						}
-					}
-					priceRange = &PriceRangeInput{
-						Min: min,
-						Max: max,
-					}
-				}
-			}
-			if val, ok := opCtx.Variables["category"]; ok {
-				if catStr, ok := val.(string); ok {
-					category = &catStr
-				}
-			}
-			if val, ok := opCtx.Variables["sortBy"]; ok {
-				if sortStr, ok := val.(string); ok {
-					sortEnum := SortOrder(sortStr)
-					sortBy = &sortEnum
-				}
-			}
-		}
-
-		// We'll skip the direct query parameter extraction for now
-		// as it requires more complex type handling
-	}
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	products, err := resolver.findProducts(ctx, pagination, query, id, viewedProductsIds, byAccountId, ownedByMe, priceRange, category, minRating, sortBy, currency)
+	if err != nil || currency == nil {
+		return products, err
+	}
+	for _, product := range products {
+		if err = resolver.server.convertProduct(ctx, product, *currency); err != nil {
+			log.Println("Error converting product price:", err)
+			return nil, err
+		}
+	}
+	return products, nil
+}
+
+func (resolver *queryResolver) findProducts(
+	ctx context.Context,
+	pagination *PaginationInput,
+	query, id *string,
+	viewedProductsIds []*string,
+	byAccountId *bool,
+	ownedByMe *bool,
+	priceRange *PriceRangeInput,
+	category *string,
+	minRating *float64,
+	sortBy *SortOrder,
+	currency *string,
+) ([]*Product, error) {
+
 	// Get single product by ID - public operation
 	if id != nil {
-		res, err := resolver.server.productClient.GetProduct(ctx, *id)
+		// Owners can also see their own drafts and archived products
+		viewerId, _ := auth.GetUserIdInt(ctx, false)
+		res, err := resolver.server.productClient.GetProduct(ctx, *id, viewerId)
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
-		return []*Product{{
-			ID:          res.ID,
-			Name:        res.Name,
-			Description: res.Description,
-			Price:       res.Price,
-			AccountID:   res.AccountID,
-		}}, nil
+		return []*Product{toProduct(res)}, nil
 	}
 
 	skip, take := uint64(0), uint64(0)
@@ -219,14 +184,8 @@ func (resolver *queryResolver) Product(
 
 		// Convert to GraphQL products
 		var products []*Product
-		for _, product := range paginatedProducts {
-			products = append(products, &Product{
-				ID:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				AccountID:   product.AccountID,
-			})
+		for i := range paginatedProducts {
+			products = append(products, toProduct(&paginatedProducts[i]))
 		}
 
 		log.Printf("Returning %d products with skip=%d, take=%d", len(products), skip, take)
@@ -249,38 +208,16 @@ func (resolver *queryResolver) Product(
 			return nil, errors.New("error processing user ID")
 		}
 
-		log.Printf("Filtering products for account ID: %d", accountId)
-
-		// Use the direct query to get all products
-		productList, err := resolver.server.productClient.GetProducts(ctx, 0, 100, nil, "")
+		// The product service returns every product of the account, whatever its status
+		productList, err := resolver.server.productClient.GetProductsForAccount(ctx, int64(accountId), skip, take, accountIdStr, auth.GetUserRole(ctx))
 		if err != nil {
 			log.Println("Error getting products:", err)
 			return nil, err
 		}
 
-		log.Printf("Found %d total products", len(productList))
-
-		// Filter products by account ID
-		var filteredProducts []models.Product
-		for _, product := range productList {
-			log.Printf("Product %s has account ID %d (comparing with %d)", product.ID, product.AccountID, accountId)
-			if product.AccountID == accountId {
-				filteredProducts = append(filteredProducts, product)
-			}
-		}
-
-		log.Printf("After filtering, found %d products owned by user", len(filteredProducts))
-
-		// Convert to GraphQL products
 		var products []*Product
-		for _, product := range filteredProducts {
-			products = append(products, &Product{
-				ID:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				AccountID:   product.AccountID,
-			})
+		for i := range productList {
+			products = append(products, toProduct(&productList[i]))
 		}
 
 		return products, nil
@@ -310,8 +247,12 @@ func (resolver *queryResolver) Product(
 					Name:        product.Name,
 					Description: product.Description,
 					Price:       product.Price,
+					// The recommender keeps the decimal price only
+					PriceMoney: toMoney(money.FromFloat(product.Price, "")),
 					// AccountID is not available in ProductReplica
-					AccountID:   0,
+					AccountID: 0,
+					// The recommender only knows about published products
+					Status: ProductStatusPublished,
 				},
 			)
 		}
@@ -324,32 +265,44 @@ func (resolver *queryResolver) Product(
 		q = *query
 	}
 
-	// Convert GraphQL price range to product service price range
+	// Convert GraphQL price range to product service price range. The range
+	// is in the currency of the query, which prices are also sorted in.
 	var productPriceRange *models.PriceRange
+	if priceRange != nil || currency != nil {
+		productPriceRange = &models.PriceRange{}
+		if currency != nil {
+			productPriceRange.Currency = *currency
+		}
+	}
 	if priceRange != nil {
 		log.Printf("GraphQL received price range: Min=%v, Max=%v", priceRange.Min, priceRange.Max)
-		productPriceRange = &models.PriceRange{
-			Min: priceRange.Min,
-			Max: priceRange.Max,
+		if priceRange.Min != nil {
+			productPriceRange.Min = *priceRange.Min
+		}
+		if priceRange.Max != nil {
+			productPriceRange.Max = *priceRange.Max
 		}
 		log.Printf("Converted to product price range: Min=%v, Max=%v", productPriceRange.Min, productPriceRange.Max)
 	}
 
-	// Category and sort order are handled directly in the resolver
-
 	// Call product service with advanced search including filters
 	var categoryStr string
 	if category != nil {
 		categoryStr = *category
 	}
 
+	var minRatingValue float64
+	if minRating != nil {
+		minRatingValue = *minRating
+	}
+
 	var sortOrderStr string
 	if sortBy != nil {
 		sortOrderStr = string(*sortBy)
 	}
 
-	log.Printf("Searching products with query=%s, priceRange=%v, category=%s, sortOrder=%s", q, productPriceRange, categoryStr, sortOrderStr)
-	productList, err := resolver.server.productClient.SearchProducts(ctx, q, skip, take, productPriceRange, categoryStr, sortOrderStr)
+	log.Printf("Searching products with query=%s, priceRange=%v, category=%s, minRating=%v, sortOrder=%s", q, productPriceRange, categoryStr, minRatingValue, sortOrderStr)
+	productList, err := resolver.server.productClient.SearchProducts(ctx, q, skip, take, productPriceRange, categoryStr, minRatingValue, sortOrderStr, resolver.server.rates)
 	if err != nil {
 		log.Println("Error searching products:", err)
 		return nil, err
@@ -359,17 +312,8 @@ func (resolver *queryResolver) Product(
 
 	// Convert to GraphQL products
 	var products []*Product
-	for _, product := range productList {
-		products = append(products,
-			&Product{
-				ID:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				AccountID:   product.AccountID,
-				Category:    product.Category,
-			},
-		)
+	for i := range productList {
+		products = append(products, toProduct(&productList[i]))
 	}
 
 	// Price range filtering, category filtering, and sorting are now handled by the SearchProducts method
@@ -377,6 +321,49 @@ func (resolver *queryResolver) Product(
 	return products, nil
 }
 
+// toProduct converts a product from the product service into its GraphQL representation
+func toProduct(product *models.Product) *Product {
+	result := &Product{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		PriceMoney:  toMoney(product.PriceMoney()),
+		AccountID:   product.AccountID,
+		Status:      ProductStatus(product.Status),
+		Version:     int(product.Version),
+	}
+	// Products indexed before statuses existed are published
+	if result.Status == "" {
+		result.Status = ProductStatusPublished
+	}
+	if product.Category != "" {
+		result.Category = &product.Category
+	}
+	if !product.CreatedAt.IsZero() {
+		result.CreatedAt = &product.CreatedAt
+	}
+	if !product.UpdatedAt.IsZero() {
+		result.UpdatedAt = &product.UpdatedAt
+	}
+	if product.Stock != nil {
+		stock := int(*product.Stock)
+		result.Stock = &stock
+	}
+	if product.WeightGrams > 0 {
+		weight := int(product.WeightGrams)
+		result.WeightGrams = &weight
+	}
+	if product.TaxCategory != "" {
+		result.TaxCategory = &product.TaxCategory
+	}
+	if product.ReviewCount > 0 {
+		result.RatingAverage = &product.RatingAverage
+		result.ReviewCount = int(product.ReviewCount)
+	}
+	return result
+}
+
 func (pagination PaginationInput) bounds() (uint64, uint64) {
 	skipValue := uint64(0)
 	takeValue := uint64(100)
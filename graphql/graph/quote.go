@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+func (resolver *queryResolver) OrderQuote(ctx context.Context, in OrderInput) (*OrderQuote, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	products, err := orderedProductsInput(in.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for OrderQuote:", err)
+		return nil, errors.New("unauthorized: you must be logged in to quote an order")
+	}
+
+	var couponCode string
+	if in.CouponCode != nil {
+		couponCode = *in.CouponCode
+	}
+	var currency string
+	if in.Currency != nil {
+		currency = *in.Currency
+	}
+	quote, err := resolver.server.orderClient.QuoteOrder(ctx, strconv.Itoa(accountId), products, couponCode, currency, fromAddressInput(in.ShippingAddress))
+	if err != nil {
+		log.Println("Error quoting order:", err)
+		return nil, err
+	}
+	return toOrderQuote(quote), nil
+}
+
+func toOrderQuote(quote *models.OrderQuote) *OrderQuote {
+	order := &quote.Order
+	result := &OrderQuote{
+		SubtotalMoney:      toMoney(order.SubtotalMoney()),
+		DiscountTotalMoney: toMoney(order.DiscountTotalMoney()),
+		ShippingMoney:      toMoney(order.ShippingTotalMoney()),
+		TaxMoney:           toMoney(order.TaxTotalMoney()),
+		TotalMoney:         toMoney(order.TotalMoney()),
+		Discounts:          []*OrderDiscount{},
+		Taxes:              []*OrderTax{},
+		Shipments:          []*Shipment{},
+		Lines:              []*QuoteLine{},
+		Errors:             []*OrderLineError{},
+	}
+	if order.CouponCode != "" {
+		result.CouponCode = &order.CouponCode
+	}
+	for _, discount := range order.Discounts {
+		result.Discounts = append(result.Discounts, toOrderDiscount(discount, order.Currency))
+	}
+	for _, tax := range order.Taxes {
+		result.Taxes = append(result.Taxes, toOrderTax(tax, order.Currency))
+	}
+	for i := range order.Shipments {
+		result.Shipments = append(result.Shipments, toShipment(&order.Shipments[i]))
+	}
+	for _, line := range order.Lines() {
+		result.Lines = append(result.Lines, &QuoteLine{
+			ProductID:      line.Product.ID,
+			Name:           line.Product.Name,
+			SellerID:       line.Product.SellerID,
+			Quantity:       int(line.Product.Quantity),
+			UnitPriceMoney: toMoney(line.Product.PriceMoney()),
+			SubtotalMoney:  toMoney(line.Subtotal),
+			DiscountMoney:  toMoney(line.Discount),
+			TaxMoney:       toMoney(line.Tax),
+			TotalMoney:     toMoney(line.Total),
+		})
+	}
+	for _, lineError := range quote.Errors {
+		result.Errors = append(result.Errors, &OrderLineError{
+			ProductID: lineError.ProductID,
+			Code:      OrderLineErrorCode(lineError.Code),
+			Message:   lineError.Message,
+		})
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+func (resolver *mutationResolver) RequestReturn(ctx context.Context, orderId string, productId string, quantity int, reason ReturnReason, comment *string) (*OrderReturn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for RequestReturn:", err)
+		return nil, errors.New("unauthorized: you must be logged in to return a product")
+	}
+
+	id, err := strconv.ParseUint(orderId, 10, 64)
+	if err != nil || quantity <= 0 {
+		return nil, ErrInvalidParameter
+	}
+	text := ""
+	if comment != nil {
+		text = *comment
+	}
+	orderReturn, err := resolver.server.orderClient.RequestReturn(ctx, uint(id), productId, quantity, string(reason), text, strconv.Itoa(accountId))
+	if err != nil {
+		log.Println("Error requesting return:", err)
+		return nil, err
+	}
+	return toOrderReturn(orderReturn), nil
+}
+
+func (resolver *mutationResolver) ReviewReturn(ctx context.Context, returnId string, approve bool, reason *string) (*OrderReturn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ReviewReturn:", err)
+		return nil, errors.New("unauthorized: you must be logged in to review a return")
+	}
+
+	id, err := strconv.ParseUint(returnId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	text := ""
+	if reason != nil {
+		text = *reason
+	}
+	orderReturn, err := resolver.server.orderClient.ReviewReturn(ctx, uint(id), approve, text, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error reviewing return:", err)
+		return nil, err
+	}
+	return toOrderReturn(orderReturn), nil
+}
+
+func (resolver *mutationResolver) ShipReturn(ctx context.Context, returnId string, carrier Carrier, trackingNumber string) (*OrderReturn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ShipReturn:", err)
+		return nil, errors.New("unauthorized: you must be logged in to ship a return")
+	}
+
+	id, err := strconv.ParseUint(returnId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	orderReturn, err := resolver.server.orderClient.ShipReturn(ctx, uint(id), string(carrier), trackingNumber, strconv.Itoa(accountId))
+	if err != nil {
+		log.Println("Error shipping return:", err)
+		return nil, err
+	}
+	return toOrderReturn(orderReturn), nil
+}
+
+func (resolver *mutationResolver) ReceiveReturn(ctx context.Context, returnId string, restock *bool) (*OrderReturn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ReceiveReturn:", err)
+		return nil, errors.New("unauthorized: you must be logged in to receive a return")
+	}
+
+	id, err := strconv.ParseUint(returnId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	orderReturn, err := resolver.server.orderClient.ReceiveReturn(ctx, uint(id), restock == nil || *restock, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error receiving return:", err)
+		return nil, err
+	}
+	return toOrderReturn(orderReturn), nil
+}
+
+func toOrderReturn(orderReturn *models.OrderReturn) *OrderReturn {
+	result := &OrderReturn{
+		ID:         strconv.Itoa(int(orderReturn.ID)),
+		OrderID:    strconv.Itoa(int(orderReturn.OrderID)),
+		SellerID:   orderReturn.SellerID,
+		ProductID:  orderReturn.ProductID,
+		Quantity:   orderReturn.Quantity,
+		Reason:     ReturnReason(orderReturn.Reason),
+		Status:     ReturnStatus(orderReturn.Status),
+		Refund:     toMoney(orderReturn.RefundMoney()),
+		Restocked:  orderReturn.Restocked,
+		CreatedAt:  orderReturn.CreatedAt,
+		ShippedAt:  orderReturn.ShippedAt,
+		ReceivedAt: orderReturn.ReceivedAt,
+		RefundedAt: orderReturn.RefundedAt,
+	}
+	if orderReturn.Comment != "" {
+		result.Comment = &orderReturn.Comment
+	}
+	if orderReturn.RejectionReason != "" {
+		result.RejectionReason = &orderReturn.RejectionReason
+	}
+	if orderReturn.Carrier != "" {
+		carrier := Carrier(orderReturn.Carrier)
+		result.Carrier = &carrier
+	}
+	if orderReturn.TrackingNumber != "" {
+		result.TrackingNumber = &orderReturn.TrackingNumber
+	}
+	if trackingURL := orderReturn.TrackingURL(); trackingURL != "" {
+		result.TrackingURL = &trackingURL
+	}
+	return result
+}
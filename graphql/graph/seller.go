@@ -0,0 +1,127 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+func (resolver *queryResolver) SellerOrders(ctx context.Context, first *int, after *string, filter *SellerOrderFilterInput, sort *SellerOrderSort, sellerId *int) (*SellerOrderConnection, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for SellerOrders query:", err)
+		return nil, errors.New("unauthorized: you must be logged in to see the orders of your products")
+	}
+
+	query := models.OrderQuery{}
+	if first != nil {
+		if *first < 0 {
+			return nil, ErrInvalidParameter
+		}
+		query.First = *first
+	}
+	if after != nil {
+		query.After = *after
+	}
+	if sort != nil {
+		query.Sort = string(*sort)
+	}
+	if filter != nil {
+		query.Filter = models.OrderFilter{
+			CreatedAfter:  filter.CreatedAfter,
+			CreatedBefore: filter.CreatedBefore,
+		}
+		for _, status := range filter.Statuses {
+			query.Filter.Statuses = append(query.Filter.Statuses, string(status))
+		}
+		if filter.ProductID != nil {
+			query.Filter.ProductID = *filter.ProductID
+		}
+	}
+	seller := accountId
+	if sellerId != nil {
+		seller = *sellerId
+	}
+
+	page, err := resolver.server.orderClient.GetOrdersForSeller(ctx, seller, query, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error getting orders for seller:", err)
+		return nil, err
+	}
+
+	connection := &SellerOrderConnection{
+		Edges:      []*SellerOrderEdge{},
+		PageInfo:   &PageInfo{HasNextPage: page.HasNextPage},
+		TotalCount: int(page.TotalCount),
+	}
+	if page.EndCursor != "" {
+		connection.PageInfo.EndCursor = &page.EndCursor
+	}
+	for i := range page.Orders {
+		connection.Edges = append(connection.Edges, &SellerOrderEdge{
+			Cursor: models.OrderCursor(page.Orders[i].ID),
+			Node:   toSellerOrder(&page.Orders[i]),
+		})
+	}
+	return connection, nil
+}
+
+// toSellerOrder shows the part of an order a seller handles, see
+// models.Order.ForSeller
+func toSellerOrder(order *models.Order) *SellerOrder {
+	full := toOrder(order)
+	result := &SellerOrder{
+		ID:                 full.ID,
+		CreatedAt:          full.CreatedAt,
+		Status:             full.Status,
+		AccountID:          order.AccountID,
+		ShippingAddress:    full.ShippingAddress,
+		Lines:              []*SellerOrderLine{},
+		SubtotalMoney:      full.SubtotalMoney,
+		DiscountTotalMoney: full.DiscountTotalMoney,
+		TaxMoney:           full.TaxMoney,
+		ShippingMoney:      full.ShippingMoney,
+		TotalMoney:         full.TotalMoney,
+		Shipments:          full.Shipments,
+		Returns:            full.Returns,
+		Invoices:           full.Invoices,
+		StatusHistory:      full.StatusHistory,
+	}
+	for _, line := range order.Lines() {
+		sellerLine := &SellerOrderLine{
+			ProductID:      line.Product.ID,
+			Name:           line.Product.Name,
+			Quantity:       int(line.Product.Quantity),
+			UnitPriceMoney: toMoney(line.Product.PriceMoney()),
+			SubtotalMoney:  toMoney(line.Subtotal),
+			DiscountMoney:  toMoney(line.Discount),
+			TaxMoney:       toMoney(line.Tax),
+			TotalMoney:     toMoney(line.Total),
+			Actions:        []FulfilmentAction{},
+		}
+		if line.Product.Variant != "" {
+			sellerLine.Variant = &line.Product.Variant
+		}
+		for _, shipment := range order.Shipments {
+			if shipment.Holds(line.Product.ID) {
+				shipmentId := strconv.Itoa(int(shipment.ID))
+				sellerLine.ShipmentID = &shipmentId
+				break
+			}
+		}
+		for _, action := range order.FulfilmentActions(line.Product.ID) {
+			sellerLine.Actions = append(sellerLine.Actions, FulfilmentAction(action))
+		}
+		result.Lines = append(result.Lines, sellerLine)
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+func (resolver *mutationResolver) ShipShipment(ctx context.Context, shipmentId string, carrier Carrier, trackingNumber string) (*Shipment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for ShipShipment:", err)
+		return nil, errors.New("unauthorized: you must be logged in to ship a shipment")
+	}
+
+	id, err := strconv.ParseUint(shipmentId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	shipment, err := resolver.server.orderClient.ShipShipment(ctx, uint(id), string(carrier), trackingNumber, strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error shipping shipment:", err)
+		return nil, err
+	}
+	return toShipment(shipment), nil
+}
+
+func (resolver *mutationResolver) UpdateShipmentStatus(ctx context.Context, shipmentId string, status ShipmentStatus) (*Shipment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Enforce authentication - this will abort the request if not authenticated
+	accountId, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		log.Println("Authentication failed for UpdateShipmentStatus:", err)
+		return nil, errors.New("unauthorized: you must be logged in to update a shipment")
+	}
+
+	id, err := strconv.ParseUint(shipmentId, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	shipment, err := resolver.server.orderClient.UpdateShipmentStatus(ctx, uint(id), string(status), strconv.Itoa(accountId), auth.GetUserRole(ctx))
+	if err != nil {
+		log.Println("Error updating shipment status:", err)
+		return nil, err
+	}
+	return toShipment(shipment), nil
+}
+
+func toShipment(shipment *models.Shipment) *Shipment {
+	result := &Shipment{
+		ID:          strconv.Itoa(int(shipment.ID)),
+		SellerID:    shipment.SellerID,
+		Status:      ShipmentStatus(shipment.Status),
+		Cost:        toMoney(shipment.CostMoney()),
+		WeightGrams: int(shipment.WeightGrams),
+		Items:       []*ShipmentItem{},
+		ShippedAt:   shipment.ShippedAt,
+		DeliveredAt: shipment.DeliveredAt,
+	}
+	for _, item := range shipment.Items {
+		result.Items = append(result.Items, &ShipmentItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	if shipment.Carrier != "" {
+		carrier := Carrier(shipment.Carrier)
+		result.Carrier = &carrier
+	}
+	if shipment.TrackingNumber != "" {
+		result.TrackingNumber = &shipment.TrackingNumber
+	}
+	if trackingURL := shipment.TrackingURL(); trackingURL != "" {
+		result.TrackingURL = &trackingURL
+	}
+	return result
+}
+
+// toAddress returns nil for the orders placed without an address
+func toAddress(address models.Address) *Address {
+	if address == (models.Address{}) {
+		return nil
+	}
+	result := &Address{
+		Line1:   address.Line1,
+		City:    address.City,
+		Country: address.Country,
+	}
+	if address.Name != "" {
+		result.Name = &address.Name
+	}
+	if address.Line2 != "" {
+		result.Line2 = &address.Line2
+	}
+	if address.Region != "" {
+		result.Region = &address.Region
+	}
+	if address.PostalCode != "" {
+		result.PostalCode = &address.PostalCode
+	}
+	return result
+}
+
+func fromAddressInput(in *AddressInput) models.Address {
+	if in == nil {
+		return models.Address{}
+	}
+	address := models.Address{Line1: in.Line1, City: in.City, Country: in.Country}
+	if in.Name != nil {
+		address.Name = *in.Name
+	}
+	if in.Line2 != nil {
+		address.Line2 = *in.Line2
+	}
+	if in.Region != nil {
+		address.Region = *in.Region
+	}
+	if in.PostalCode != nil {
+		address.PostalCode = *in.PostalCode
+	}
+	return address
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"log"
+	"strconv"
 	"time"
 
 	"google.golang.org/grpc"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/thomas/EcommerceAPI/order/models"
 	"github.com/thomas/EcommerceAPI/order/proto/pb"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/payment"
 )
 
 type Client struct {
@@ -34,6 +37,10 @@ func (client *Client) PostOrder(
 	ctx context.Context,
 	accountID string,
 	products []*models.OrderedProduct,
+	couponCode string,
+	currency string,
+	shippingAddress models.Address,
+	idempotencyKey string,
 ) (*models.Order, error) {
 	var protoProducts []*pb.OrderProduct
 	for _, p := range products {
@@ -46,45 +53,56 @@ func (client *Client) PostOrder(
 	r, err := client.service.PostOrder(
 		ctx,
 		&pb.PostOrderRequest{
-			AccountId: accountID,
-			Products:  protoProducts,
+			AccountId:       accountID,
+			Products:        protoProducts,
+			CouponCode:      couponCode,
+			Currency:        currency,
+			IdempotencyKey:  idempotencyKey,
+			ShippingAddress: addressToProto(shippingAddress),
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
-	// Create response order
-	newOrder := r.Order
-	newOrderCreatedAt := time.Time{}
-	newOrderCreatedAt.UnmarshalBinary(newOrder.CreatedAt)
+	order := orderFromProto(r.Order)
+	return &order, nil
+}
 
-	// Extract product details from the response
-	var orderProducts []*models.OrderedProduct
-	for _, p := range newOrder.Products {
-		orderProducts = append(orderProducts, &models.OrderedProduct{
-			ID:          p.Id,
-			Quantity:    p.Quantity,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
+// QuoteOrder prices an order without placing it. The order of the quote is not
+// saved, it has no ID.
+func (client *Client) QuoteOrder(ctx context.Context, accountID string, products []*models.OrderedProduct, couponCode, currency string, shippingAddress models.Address) (*models.OrderQuote, error) {
+	var protoProducts []*pb.OrderProduct
+	for _, p := range products {
+		protoProducts = append(protoProducts, &pb.OrderProduct{
+			Id:       p.ID,
+			Quantity: p.Quantity,
 		})
 	}
 
-	return &models.Order{
-		ID:         uint(r.Order.GetId()),
-		CreatedAt:  newOrderCreatedAt,
-		TotalPrice: newOrder.TotalPrice,
-		AccountID:  newOrder.AccountId,
-		Products:   orderProducts,
-	}, nil
+	r, err := client.service.QuoteOrder(ctx, &pb.QuoteOrderRequest{
+		AccountId:       accountID,
+		Products:        protoProducts,
+		CouponCode:      couponCode,
+		Currency:        currency,
+		ShippingAddress: addressToProto(shippingAddress),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return quoteFromProto(r.GetQuote()), nil
 }
 
-func (client *Client) GetOrdersForAccount(ctx context.Context, accountID string, userID string) ([]models.Order, error) {
+// GetOrdersForAccount returns a page of the orders of the account
+func (client *Client) GetOrdersForAccount(ctx context.Context, accountID string, userID string, query models.OrderQuery) (*models.OrderPage, error) {
 	// Add the user ID to the context metadata
 	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", userID)
 
 	r, err := client.service.GetOrdersForAccount(ctx, &pb.GetOrdersForAccountRequest{
 		AccountId: accountID,
+		First:     uint32(query.First),
+		After:     query.After,
+		Filter:    orderFilterToProto(query.Filter),
+		Sort:      query.Sort,
 	})
 	if err != nil {
 		log.Println("Error getting orders for account:", err)
@@ -92,29 +110,615 @@ func (client *Client) GetOrdersForAccount(ctx context.Context, accountID string,
 	}
 
 	// Create response orders
-	var orders []models.Order
+	page := &models.OrderPage{
+		EndCursor:   r.GetEndCursor(),
+		HasNextPage: r.GetHasNextPage(),
+		TotalCount:  int64(r.GetTotalCount()),
+	}
+	for _, orderProto := range r.Orders {
+		page.Orders = append(page.Orders, orderFromProto(orderProto))
+	}
+	return page, nil
+}
+
+// GetOrdersForSeller returns a page of the orders holding products of the
+// seller, with only the part of each order the seller handles
+func (client *Client) GetOrdersForSeller(ctx context.Context, sellerID int, query models.OrderQuery, callerID, role string) (*models.OrderPage, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.GetOrdersForSeller(ctx, &pb.GetOrdersForSellerRequest{
+		SellerId: int64(sellerID),
+		First:    uint32(query.First),
+		After:    query.After,
+		Filter:   orderFilterToProto(query.Filter),
+		Sort:     query.Sort,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.OrderPage{
+		EndCursor:   r.GetEndCursor(),
+		HasNextPage: r.GetHasNextPage(),
+		TotalCount:  int64(r.GetTotalCount()),
+	}
 	for _, orderProto := range r.Orders {
-		newOrder := models.Order{
-			ID:         uint(orderProto.Id),
-			TotalPrice: orderProto.TotalPrice,
-			AccountID:  orderProto.AccountId,
+		page.Orders = append(page.Orders, orderFromProto(orderProto))
+	}
+	return page, nil
+}
+
+func orderFilterToProto(filter models.OrderFilter) *pb.OrderFilter {
+	filterProto := &pb.OrderFilter{
+		Statuses:  filter.Statuses,
+		MinTotal:  filter.MinTotal,
+		MaxTotal:  filter.MaxTotal,
+		ProductId: filter.ProductID,
+		Currency:  filter.Currency,
+	}
+	if filter.CreatedAfter != nil {
+		filterProto.CreatedAfter, _ = filter.CreatedAfter.MarshalBinary()
+	}
+	if filter.CreatedBefore != nil {
+		filterProto.CreatedBefore, _ = filter.CreatedBefore.MarshalBinary()
+	}
+	return filterProto
+}
+
+// GetOrder returns an order of the caller, or any order to an admin
+func (client *Client) GetOrder(ctx context.Context, orderID uint, callerID, role string) (*models.Order, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.GetOrder(ctx, &pb.GetOrderRequest{
+		Id: strconv.FormatUint(uint64(orderID), 10),
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := orderFromProto(r.Order)
+	return &order, nil
+}
+
+func (client *Client) HasPurchased(ctx context.Context, accountID, productID string) (bool, error) {
+	r, err := client.service.HasPurchased(ctx, &pb.HasPurchasedRequest{
+		AccountId: accountID,
+		ProductId: productID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return r.Purchased, nil
+}
+
+// UpdateOrderStatus moves the order to a new status on behalf of an admin or
+// of a seller of the order
+func (client *Client) UpdateOrderStatus(ctx context.Context, orderID uint, status, note, callerID, role string) (*models.Order, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{
+		OrderId: uint64(orderID),
+		Status:  status,
+		Note:    note,
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := orderFromProto(r.Order)
+	return &order, nil
+}
+
+func (client *Client) CancelOrder(ctx context.Context, orderID uint, reason, callerID string) (*models.Order, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID)
+
+	r, err := client.service.CancelOrder(ctx, &pb.CancelOrderRequest{
+		OrderId: uint64(orderID),
+		Reason:  reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := orderFromProto(r.Order)
+	return &order, nil
+}
+
+func (client *Client) PayOrder(ctx context.Context, orderID uint, paymentMethod, callerID string) (*models.Order, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID)
+
+	r, err := client.service.PayOrder(ctx, &pb.PayOrderRequest{
+		OrderId:       uint64(orderID),
+		PaymentMethod: paymentMethod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := orderFromProto(r.Order)
+	return &order, nil
+}
+
+// HandlePaymentEvent passes on a webhook whose signature was verified, and
+// reports whether it had already been processed
+func (client *Client) HandlePaymentEvent(ctx context.Context, event payment.Event) (bool, error) {
+	e := &pb.PaymentEvent{
+		Id:          event.ID,
+		Type:        event.Type,
+		ProviderRef: event.ProviderRef,
+		Amount:      &pb.Money{Amount: event.Amount, Currency: event.Currency},
+	}
+	e.CreatedAt, _ = event.CreatedAt.MarshalBinary()
+
+	r, err := client.service.HandlePaymentEvent(ctx, &pb.HandlePaymentEventRequest{Event: e})
+	if err != nil {
+		return false, err
+	}
+	return r.Duplicate, nil
+}
+
+// ShipShipment records the carrier and tracking number of a shipment on
+// behalf of its seller or an admin
+func (client *Client) ShipShipment(ctx context.Context, shipmentID uint, carrier, trackingNumber, callerID, role string) (*models.Shipment, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.ShipShipment(ctx, &pb.ShipShipmentRequest{
+		ShipmentId:     uint64(shipmentID),
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	shipment := shipmentFromProto(r.Shipment)
+	return &shipment, nil
+}
+
+func (client *Client) UpdateShipmentStatus(ctx context.Context, shipmentID uint, status, callerID, role string) (*models.Shipment, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.UpdateShipmentStatus(ctx, &pb.UpdateShipmentStatusRequest{
+		ShipmentId: uint64(shipmentID),
+		Status:     status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	shipment := shipmentFromProto(r.Shipment)
+	return &shipment, nil
+}
+
+// RequestReturn asks to send back units of a line of a delivered order on
+// behalf of the customer who placed it
+func (client *Client) RequestReturn(ctx context.Context, orderID uint, productID string, quantity int, reason, comment, callerID string) (*models.OrderReturn, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID)
+
+	r, err := client.service.RequestReturn(ctx, &pb.RequestReturnRequest{
+		OrderId:   uint64(orderID),
+		ProductId: productID,
+		Quantity:  uint32(quantity),
+		Reason:    reason,
+		Comment:   comment,
+	})
+	if err != nil {
+		return nil, err
+	}
+	orderReturn := returnFromProto(r.OrderReturn)
+	return &orderReturn, nil
+}
+
+// ReviewReturn approves or rejects a return on behalf of the seller of the
+// product or an admin
+func (client *Client) ReviewReturn(ctx context.Context, returnID uint, approve bool, reason, callerID, role string) (*models.OrderReturn, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.ReviewReturn(ctx, &pb.ReviewReturnRequest{
+		ReturnId: uint64(returnID),
+		Approve:  approve,
+		Reason:   reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	orderReturn := returnFromProto(r.OrderReturn)
+	return &orderReturn, nil
+}
+
+func (client *Client) ShipReturn(ctx context.Context, returnID uint, carrier, trackingNumber, callerID string) (*models.OrderReturn, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID)
+
+	r, err := client.service.ShipReturn(ctx, &pb.ShipReturnRequest{
+		ReturnId:       uint64(returnID),
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	orderReturn := returnFromProto(r.OrderReturn)
+	return &orderReturn, nil
+}
+
+func (client *Client) ReceiveReturn(ctx context.Context, returnID uint, restock bool, callerID, role string) (*models.OrderReturn, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.ReceiveReturn(ctx, &pb.ReceiveReturnRequest{
+		ReturnId: uint64(returnID),
+		Restock:  restock,
+	})
+	if err != nil {
+		return nil, err
+	}
+	orderReturn := returnFromProto(r.OrderReturn)
+	return &orderReturn, nil
+}
+
+// GetInvoiceDocument downloads an invoice or credit note as a PDF or JSON
+// file, on behalf of its customer, its seller or an admin
+func (client *Client) GetInvoiceDocument(ctx context.Context, invoiceID uint, format, callerID, role string) (*models.InvoiceDocument, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.GetInvoiceDocument(ctx, &pb.GetInvoiceDocumentRequest{
+		InvoiceId: uint64(invoiceID),
+		Format:    format,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.InvoiceDocument{
+		FileName:    r.GetFileName(),
+		ContentType: r.GetContentType(),
+		Content:     r.GetContent(),
+	}, nil
+}
+
+func (client *Client) CreatePromotion(ctx context.Context, promotion models.Promotion, callerID, role string) (*models.Promotion, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	p := &pb.Promotion{
+		Code:              promotion.Code,
+		Type:              promotion.Type,
+		Value:             promotion.Value,
+		Currency:          promotion.Currency,
+		BuyQuantity:       int32(promotion.BuyQuantity),
+		GetQuantity:       int32(promotion.GetQuantity),
+		SellerId:          int64(promotion.SellerID),
+		Category:          promotion.Category,
+		MinBasket:         promotion.MinBasket,
+		MaxUses:           int32(promotion.MaxUses),
+		MaxUsesPerAccount: int32(promotion.MaxUsesPerAccount),
+	}
+	if promotion.StartsAt != nil {
+		p.StartsAt, _ = promotion.StartsAt.MarshalBinary()
+	}
+	if promotion.EndsAt != nil {
+		p.EndsAt, _ = promotion.EndsAt.MarshalBinary()
+	}
+
+	r, err := client.service.CreatePromotion(ctx, &pb.CreatePromotionRequest{Promotion: p})
+	if err != nil {
+		return nil, err
+	}
+	created := promotionFromProto(r.Promotion)
+	return &created, nil
+}
+
+func (client *Client) GetPromotions(ctx context.Context, callerID, role string) ([]models.Promotion, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+
+	r, err := client.service.GetPromotions(ctx, &pb.GetPromotionsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var promotions []models.Promotion
+	for _, p := range r.Promotions {
+		promotions = append(promotions, promotionFromProto(p))
+	}
+	return promotions, nil
+}
+
+func orderFromProto(orderProto *pb.Order) models.Order {
+	order := models.Order{
+		ID:            uint(orderProto.GetId()),
+		TotalPrice:    orderProto.GetTotalPrice(),
+		Subtotal:      orderProto.GetSubtotal(),
+		DiscountTotal: orderProto.GetDiscountTotal(),
+		CouponCode:    orderProto.GetCouponCode(),
+		AccountID:     orderProto.GetAccountId(),
+		Status:        orderProto.GetStatus(),
+	}
+	order.CreatedAt.UnmarshalBinary(orderProto.GetCreatedAt())
+	order.CancellationReason = orderProto.GetCancellationReason()
+
+	// Servers that predate the money fields only send the decimal amounts
+	order.Currency = money.DefaultCurrency
+	if total := orderProto.GetTotalMoney(); total != nil {
+		order.Currency = total.GetCurrency()
+		order.SubtotalMinor = orderProto.GetSubtotalMoney().GetAmount()
+		order.DiscountTotalMinor = orderProto.GetDiscountTotalMoney().GetAmount()
+		order.TotalMinor = total.GetAmount()
+	} else {
+		order.SubtotalMinor = money.FromFloat(order.Subtotal, order.Currency).Amount
+		order.DiscountTotalMinor = money.FromFloat(order.DiscountTotal, order.Currency).Amount
+		order.TotalMinor = money.FromFloat(order.TotalPrice, order.Currency).Amount
+	}
+
+	for _, p := range orderProto.GetProducts() {
+		product := &models.OrderedProduct{
+			ID:          p.Id,
+			Quantity:    p.Quantity,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Currency:    order.Currency,
+		}
+		product.Variant = p.GetVariant()
+		product.SellerID = int(p.GetSellerId())
+		if price := p.GetPriceMoney(); price != nil {
+			product.Currency = price.GetCurrency()
+			product.Price = money.New(price.GetAmount(), price.GetCurrency()).Float()
+		}
+		order.Products = append(order.Products, product)
+	}
+	for _, r := range orderProto.GetExchangeRates() {
+		order.ExchangeRates = append(order.ExchangeRates, models.ExchangeRate{
+			OrderID:      order.ID,
+			FromCurrency: r.GetFrom(),
+			ToCurrency:   r.GetTo(),
+			Rate:         r.GetRate(),
+		})
+	}
+	for _, c := range orderProto.GetStatusHistory() {
+		change := models.OrderStatusChange{
+			OrderID:    order.ID,
+			FromStatus: c.GetFrom(),
+			ToStatus:   c.GetTo(),
+			ChangedBy:  c.GetChangedBy(),
+			Note:       c.GetNote(),
+		}
+		change.CreatedAt.UnmarshalBinary(c.GetChangedAt())
+		order.StatusHistory = append(order.StatusHistory, change)
+	}
+	for _, p := range orderProto.GetPayments() {
+		intent := models.PaymentIntent{
+			ID:            uint(p.GetId()),
+			OrderID:       order.ID,
+			Provider:      p.GetProvider(),
+			ProviderRef:   p.GetProviderRef(),
+			AmountMinor:   p.GetAmount().GetAmount(),
+			Currency:      p.GetAmount().GetCurrency(),
+			Status:        p.GetStatus(),
+			FailureReason: p.GetFailureReason(),
+			RefundedMinor: p.GetRefunded().GetAmount(),
+		}
+		intent.CreatedAt.UnmarshalBinary(p.GetCreatedAt())
+		order.Payments = append(order.Payments, intent)
+	}
+	for _, d := range orderProto.GetDiscounts() {
+		discount := models.OrderDiscount{
+			OrderID:     order.ID,
+			ProductID:   d.ProductId,
+			PromotionID: uint(d.PromotionId),
+			Code:        d.Code,
+			Amount:      d.Amount,
+			AmountMinor: money.FromFloat(d.Amount, order.Currency).Amount,
 		}
-		newOrder.CreatedAt = time.Time{}
-		newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
-
-		var products []*models.OrderedProduct
-		for _, p := range orderProto.Products {
-			products = append(products, &models.OrderedProduct{
-				ID:          p.Id,
-				Quantity:    p.Quantity,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+		if amount := d.GetAmountMoney(); amount != nil {
+			discount.AmountMinor = amount.GetAmount()
 		}
-		newOrder.Products = products
+		order.Discounts = append(order.Discounts, discount)
+	}
+	if address := orderProto.GetShippingAddress(); address != nil {
+		order.ShippingAddress = models.Address{
+			Name:       address.GetName(),
+			Line1:      address.GetLine1(),
+			Line2:      address.GetLine2(),
+			City:       address.GetCity(),
+			Region:     address.GetRegion(),
+			PostalCode: address.GetPostalCode(),
+			Country:    address.GetCountry(),
+		}
+	}
+	order.ShippingTotalMinor = orderProto.GetShippingTotalMoney().GetAmount()
+	for _, s := range orderProto.GetShipments() {
+		order.Shipments = append(order.Shipments, shipmentFromProto(s))
+	}
+	order.TaxTotalMinor = orderProto.GetTaxTotalMoney().GetAmount()
+	for _, t := range orderProto.GetTaxes() {
+		order.Taxes = append(order.Taxes, taxFromProto(t))
+	}
+	for _, r := range orderProto.GetReturns() {
+		order.Returns = append(order.Returns, returnFromProto(r))
+	}
+	for _, i := range orderProto.GetInvoices() {
+		order.Invoices = append(order.Invoices, invoiceFromProto(i))
+	}
+	return order
+}
 
-		orders = append(orders, newOrder)
+func quoteFromProto(q *pb.OrderQuote) *models.OrderQuote {
+	quote := &models.OrderQuote{}
+	order := &quote.Order
+	order.Currency = q.GetCurrency()
+	order.SubtotalMinor = q.GetSubtotal().GetAmount()
+	order.DiscountTotalMinor = q.GetDiscountTotal().GetAmount()
+	order.TotalMinor = q.GetTotal().GetAmount()
+	order.CouponCode = q.GetCouponCode()
+	order.Subtotal = order.SubtotalMoney().Float()
+	order.DiscountTotal = order.DiscountTotalMoney().Float()
+	order.TotalPrice = order.TotalMoney().Float()
+	order.ShippingTotalMinor = q.GetShippingTotal().GetAmount()
+	order.TaxTotalMinor = q.GetTaxTotal().GetAmount()
+	for _, d := range q.GetDiscounts() {
+		order.Discounts = append(order.Discounts, models.OrderDiscount{
+			ProductID:   d.GetProductId(),
+			PromotionID: uint(d.GetPromotionId()),
+			Code:        d.GetCode(),
+			Amount:      d.GetAmount(),
+			AmountMinor: d.GetAmountMoney().GetAmount(),
+		})
+	}
+	for _, t := range q.GetTaxes() {
+		order.Taxes = append(order.Taxes, taxFromProto(t))
+	}
+	for _, s := range q.GetShipments() {
+		order.Shipments = append(order.Shipments, shipmentFromProto(s))
+	}
+	// The discounts and taxes of the lines come back from Order.Lines
+	for _, line := range q.GetLines() {
+		order.Products = append(order.Products, &models.OrderedProduct{
+			ID:       line.GetProductId(),
+			Name:     line.GetName(),
+			SellerID: int(line.GetSellerId()),
+			Quantity: line.GetQuantity(),
+			Price:    money.New(line.GetUnitPrice().GetAmount(), line.GetUnitPrice().GetCurrency()).Float(),
+			Currency: line.GetUnitPrice().GetCurrency(),
+		})
+	}
+	for _, e := range q.GetErrors() {
+		quote.Errors = append(quote.Errors, models.LineError{
+			ProductID: e.GetProductId(),
+			Code:      e.GetCode(),
+			Message:   e.GetMessage(),
+		})
+	}
+	return quote
+}
+
+func taxFromProto(t *pb.OrderTax) models.OrderTax {
+	return models.OrderTax{
+		ProductID:    t.GetProductId(),
+		Name:         t.GetName(),
+		Rate:         t.GetRate(),
+		Inclusive:    t.GetInclusive(),
+		TaxableMinor: t.GetTaxable().GetAmount(),
+		AmountMinor:  t.GetAmount().GetAmount(),
+	}
+}
+
+func addressToProto(address models.Address) *pb.Address {
+	return &pb.Address{
+		Name:       address.Name,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+	}
+}
+
+func shipmentFromProto(s *pb.Shipment) models.Shipment {
+	shipment := models.Shipment{
+		ID:             uint(s.GetId()),
+		OrderID:        uint(s.GetOrderId()),
+		SellerID:       int(s.GetSellerId()),
+		CostMinor:      s.GetCost().GetAmount(),
+		Currency:       s.GetCost().GetCurrency(),
+		WeightGrams:    s.GetWeightGrams(),
+		Status:         s.GetStatus(),
+		Carrier:        s.GetCarrier(),
+		TrackingNumber: s.GetTrackingNumber(),
+	}
+	for _, item := range s.GetItems() {
+		shipment.Items = append(shipment.Items, models.ShipmentItem{
+			ShipmentID: shipment.ID,
+			ProductID:  item.GetProductId(),
+			Quantity:   int(item.GetQuantity()),
+		})
+	}
+	if len(s.GetShippedAt()) > 0 {
+		shipment.ShippedAt = &time.Time{}
+		shipment.ShippedAt.UnmarshalBinary(s.GetShippedAt())
+	}
+	if len(s.GetDeliveredAt()) > 0 {
+		shipment.DeliveredAt = &time.Time{}
+		shipment.DeliveredAt.UnmarshalBinary(s.GetDeliveredAt())
+	}
+	shipment.CreatedAt.UnmarshalBinary(s.GetCreatedAt())
+	return shipment
+}
+
+func returnFromProto(r *pb.OrderReturn) models.OrderReturn {
+	orderReturn := models.OrderReturn{
+		ID:              uint(r.GetId()),
+		OrderID:         uint(r.GetOrderId()),
+		AccountID:       r.GetAccountId(),
+		SellerID:        int(r.GetSellerId()),
+		ProductID:       r.GetProductId(),
+		Quantity:        int(r.GetQuantity()),
+		Reason:          r.GetReason(),
+		Comment:         r.GetComment(),
+		Status:          r.GetStatus(),
+		RejectionReason: r.GetRejectionReason(),
+		Carrier:         r.GetCarrier(),
+		TrackingNumber:  r.GetTrackingNumber(),
+		RefundMinor:     r.GetRefund().GetAmount(),
+		Currency:        r.GetRefund().GetCurrency(),
+		Restocked:       r.GetRestocked(),
+	}
+	if len(r.GetShippedAt()) > 0 {
+		orderReturn.ShippedAt = &time.Time{}
+		orderReturn.ShippedAt.UnmarshalBinary(r.GetShippedAt())
+	}
+	if len(r.GetReceivedAt()) > 0 {
+		orderReturn.ReceivedAt = &time.Time{}
+		orderReturn.ReceivedAt.UnmarshalBinary(r.GetReceivedAt())
+	}
+	if len(r.GetRefundedAt()) > 0 {
+		orderReturn.RefundedAt = &time.Time{}
+		orderReturn.RefundedAt.UnmarshalBinary(r.GetRefundedAt())
+	}
+	orderReturn.CreatedAt.UnmarshalBinary(r.GetCreatedAt())
+	return orderReturn
+}
+
+func invoiceFromProto(i *pb.Invoice) models.Invoice {
+	invoice := models.Invoice{
+		ID:                uint(i.GetId()),
+		Kind:              i.GetKind(),
+		Number:            i.GetNumber(),
+		OrderID:           uint(i.GetOrderId()),
+		AccountID:         i.GetAccountId(),
+		SellerID:          int(i.GetSellerId()),
+		ReturnID:          uint(i.GetReturnId()),
+		CreditedInvoiceID: uint(i.GetCreditedInvoiceId()),
+		Currency:          i.GetTotal().GetCurrency(),
+		SubtotalMinor:     i.GetSubtotal().GetAmount(),
+		DiscountMinor:     i.GetDiscount().GetAmount(),
+		TaxMinor:          i.GetTax().GetAmount(),
+		ShippingMinor:     i.GetShipping().GetAmount(),
+		TotalMinor:        i.GetTotal().GetAmount(),
+	}
+	invoice.IssuedAt.UnmarshalBinary(i.GetIssuedAt())
+	return invoice
+}
+
+func promotionFromProto(p *pb.Promotion) models.Promotion {
+	promotion := models.Promotion{
+		ID:                uint(p.GetId()),
+		Code:              p.GetCode(),
+		Type:              p.GetType(),
+		Value:             p.GetValue(),
+		Currency:          p.GetCurrency(),
+		BuyQuantity:       int(p.GetBuyQuantity()),
+		GetQuantity:       int(p.GetGetQuantity()),
+		SellerID:          int(p.GetSellerId()),
+		Category:          p.GetCategory(),
+		MinBasket:         p.GetMinBasket(),
+		MaxUses:           int(p.GetMaxUses()),
+		MaxUsesPerAccount: int(p.GetMaxUsesPerAccount()),
+		UsedCount:         int(p.GetUsedCount()),
+		CreatedBy:         int(p.GetCreatedBy()),
+	}
+	if len(p.GetStartsAt()) > 0 {
+		startsAt := time.Time{}
+		if startsAt.UnmarshalBinary(p.GetStartsAt()) == nil {
+			promotion.StartsAt = &startsAt
+		}
+	}
+	if len(p.GetEndsAt()) > 0 {
+		endsAt := time.Time{}
+		if endsAt.UnmarshalBinary(p.GetEndsAt()) == nil {
+			promotion.EndsAt = &endsAt
+		}
 	}
-	return orders, nil
+	promotion.CreatedAt.UnmarshalBinary(p.GetCreatedAt())
+	return promotion
 }
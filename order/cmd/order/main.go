@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"github.com/IBM/sarama"
 	"github.com/kelseyhightower/envconfig"
 	internal "github.com/thomas/EcommerceAPI/order/internal"
+	"github.com/thomas/EcommerceAPI/pkg/blob"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+	"github.com/thomas/EcommerceAPI/pkg/payment"
+	product "github.com/thomas/EcommerceAPI/product/client"
 	"github.com/tinrab/retry"
 	"log"
+	"net/http"
 	"time"
 )
 
@@ -14,22 +21,55 @@ type Config struct {
 	AccountUrl       string `envconfig:"ACCOUNT_SERVICE_URL"`
 	ProductUrl       string `envconfig:"PRODUCT_SERVICE_URL"`
 	BootstrapServers string `envconfig:"BOOTSTRAP_SERVERS" default:"kafka:9092"`
+	// Without a file or url the stub rates are used
+	ExchangeRatesFile string        `envconfig:"EXCHANGE_RATES_FILE"`
+	ExchangeRatesUrl  string        `envconfig:"EXCHANGE_RATES_URL"`
+	ExchangeRatesTTL  time.Duration `envconfig:"EXCHANGE_RATES_TTL" default:"1h"`
+	// Where the fake payment gateway sends its webhooks, none when empty
+	PaymentWebhookUrl    string `envconfig:"PAYMENT_WEBHOOK_URL"`
+	PaymentWebhookSecret string `envconfig:"PAYMENT_WEBHOOK_SECRET"`
+	// A weight table in JSON, see internal.WeightTable. Without one every
+	// shipment costs the flat rate, free by default.
+	ShippingRatesFile string  `envconfig:"SHIPPING_RATES_FILE"`
+	ShippingFlatRate  float64 `envconfig:"SHIPPING_FLAT_RATE" default:"0"`
+	ShippingCurrency  string  `envconfig:"SHIPPING_CURRENCY" default:"USD"`
+	// A tax table in JSON, see internal.TaxTable. Without one nothing is taxed.
+	TaxRulesFile string `envconfig:"TAX_RULES_FILE"`
+	// Where the PDF and JSON documents of the invoices are stored
+	InvoiceDir string `envconfig:"INVOICE_DIR" default:"/var/lib/order/invoices"`
+	// How long a checkout holds the stock while waiting for its payment
+	PaymentTimeout time.Duration `envconfig:"PAYMENT_TIMEOUT" default:"30m"`
+	// How often the stalled and late checkouts are resumed
+	SagaInterval time.Duration `envconfig:"SAGA_INTERVAL" default:"10s"`
+	// How often the invoices that failed to be issued are retried
+	InvoiceRetryInterval time.Duration `envconfig:"INVOICE_RETRY_INTERVAL" default:"1m"`
+	// How often the outbox is relayed to Kafka
+	OutboxInterval time.Duration `envconfig:"OUTBOX_INTERVAL" default:"1s"`
+	MetricsAddr    string        `envconfig:"METRICS_ADDR" default:":9090"`
 }
 
 func main() {
 	var cfg Config
 	var repository internal.Repository
-	var producer sarama.AsyncProducer
+	var producer sarama.SyncProducer
 
 	err := envconfig.Process("", &cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	producer, err = sarama.NewAsyncProducer([]string{cfg.BootstrapServers}, nil)
+	rates, err := money.NewRateProvider(cfg.ExchangeRatesFile, cfg.ExchangeRatesUrl, cfg.ExchangeRatesTTL)
 	if err != nil {
-		log.Println(err)
+		log.Fatal(err)
 	}
+
+	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
+		producer, err = outbox.NewProducer([]string{cfg.BootstrapServers})
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	})
 	defer producer.Close()
 
 	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
@@ -40,7 +80,41 @@ func main() {
 		return
 	})
 	defer repository.Close()
+	go internal.PurgeIdempotencyKeys(context.Background(), repository, time.Hour)
+	go outbox.NewRelay(repository.Outbox(), producer).Run(context.Background(), cfg.OutboxInterval)
+
+	// Serves the outbox metrics on /debug/vars
+	go func() {
+		log.Println(http.ListenAndServe(cfg.MetricsAddr, nil))
+	}()
+
+	gateway := payment.NewFakeGateway(cfg.PaymentWebhookUrl, cfg.PaymentWebhookSecret)
+
+	shipping, err := internal.NewShippingCalculator(cfg.ShippingRatesFile, cfg.ShippingFlatRate, cfg.ShippingCurrency)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	taxes, err := internal.NewTaxCalculator(cfg.TaxRulesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	documents, err := blob.NewFileStore(cfg.InvoiceDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	productClient, err := product.NewClient(cfg.ProductUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer productClient.Close()
+
+	service := internal.NewOrderService(repository, rates, internal.NewProductStock(productClient), gateway, shipping, taxes, documents, cfg.PaymentTimeout)
+	go internal.RunSagas(context.Background(), service, cfg.SagaInterval)
+	go internal.RunDocuments(context.Background(), service, cfg.InvoiceRetryInterval)
+
 	log.Println("Listening on port 8080...")
-	service := internal.NewOrderService(repository, producer)
 	log.Fatal(internal.ListenGRPC(service, cfg.AccountUrl, cfg.ProductUrl, 8080))
 }
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+// CancelOrder moves the order to CANCELLED and keeps the reason with it. The
+// messages are put in the outbox in the same transaction.
+func (repository *postgresRepository) CancelOrder(ctx context.Context, change models.OrderStatusChange, reason string, messages []outbox.Message) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := transitionOrder(tx, change, map[string]interface{}{
+			"cancellation_reason": reason,
+		})
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, messages...)
+	})
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+)
+
+func (server *grpcServer) CancelOrder(ctx context.Context, request *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	callerID, _, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := server.service.CancelOrder(ctx, uint(request.GetOrderId()), strconv.Itoa(callerID), request.GetReason())
+	if err != nil {
+		log.Println("Error cancelling order:", err)
+		return nil, cancelError(err)
+	}
+	if err = server.decorateOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	return &pb.CancelOrderResponse{Order: orderToProto(order)}, nil
+}
+
+func cancelError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotOrderOwner):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrOrderNotCancellable):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrReasonTooLong):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return statusError(err)
+}
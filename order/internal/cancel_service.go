@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+const maxCancellationReasonLength = 500
+
+var (
+	ErrNotOrderOwner       = errors.New("only the customer who placed the order can cancel it")
+	ErrOrderNotCancellable = errors.New("the order can no longer be cancelled")
+	ErrReasonTooLong       = errors.New("the cancellation reason is too long")
+)
+
+// CancelOrder lets the customer cancel their order until it is fulfilled. The
+// stock held for it is released and a paid order is refunded.
+func (service orderService) CancelOrder(ctx context.Context, orderId uint, accountId, reason string) (*models.Order, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxCancellationReasonLength {
+		return nil, ErrReasonTooLong
+	}
+
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return nil, err
+	}
+	if order.AccountID != accountId {
+		return nil, ErrNotOrderOwner
+	}
+	if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaid {
+		return nil, ErrOrderNotCancellable
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   models.OrderStatusCancelled,
+		ChangedBy:  accountId,
+		Note:       reason,
+		CreatedAt:  time.Now().UTC(),
+	}
+	order, err = service.cancelOrder(ctx, order, change, "cancelled by the customer")
+	if errors.Is(err, ErrOrderStatusChanged) {
+		return nil, ErrOrderNotCancellable
+	}
+	return order, err
+}
+
+// cancelOrder claims the change of the order to CANCELLED, with the note of
+// the change as the reason, then undoes what the order holds: a checkout
+// waiting for its payment is compensated, otherwise the stock is released
+// and the payments are refunded. It fails with ErrOrderStatusChanged when the
+// order moved first.
+func (service orderService) cancelOrder(ctx context.Context, order *models.Order, change models.OrderStatusChange, failureReason string) (*models.Order, error) {
+	wasPaid := order.Status != models.OrderStatusPending
+	order.Status = models.OrderStatusCancelled
+	order.CancellationReason = change.Note
+	order.StatusHistory = append(order.StatusHistory, change)
+
+	message, err := orderEventMessage("order_cancelled", order)
+	if err != nil {
+		return nil, err
+	}
+	if err = service.repository.CancelOrder(ctx, change, change.Note, []outbox.Message{message}); err != nil {
+		return nil, err
+	}
+
+	// A checkout waiting for its payment is compensated, the saga runner
+	// retries what fails
+	err = service.repository.AdvanceSaga(ctx, order.ID, models.SagaAwaitPayment, models.SagaCompensating, map[string]interface{}{
+		"failure_reason": failureReason,
+	})
+	if err == nil {
+		if err = service.compensate(ctx, order.ID, models.SagaCompensating, failureReason); err != nil {
+			log.Printf("Failed to compensate the checkout of cancelled order %d: %v", order.ID, err)
+		}
+		return service.repository.GetOrder(ctx, order.ID)
+	}
+
+	// Otherwise the order stays cancelled when the follow-ups fail, they are
+	// logged to be retried by hand
+	if err = service.stock.ReleaseStock(ctx, order); err != nil {
+		log.Printf("Failed to release the stock of cancelled order %d: %v", order.ID, err)
+	}
+	if err = service.refundPayments(ctx, order); err != nil {
+		log.Printf("Failed to refund cancelled order %d: %v", order.ID, err)
+	} else if wasPaid {
+		if err = service.moveOrder(ctx, order.ID, models.OrderStatusRefunded, change.Note); err != nil {
+			log.Printf("Failed to record the refund of order %d: %v", order.ID, err)
+		}
+	}
+
+	return service.repository.GetOrder(ctx, order.ID)
+}
+
+// orderEventMessage is an event of the order_events topic, keyed by the
+// order ID
+func orderEventMessage(eventType string, order *models.Order) (outbox.Message, error) {
+	data := models.OrderEventData{
+		OrderID:   order.ID,
+		AccountID: order.AccountID,
+		Status:    order.Status,
+		Reason:    order.CancellationReason,
+		Products:  []models.OrderEventProduct{},
+	}
+	for _, product := range order.Products {
+		data.Products = append(data.Products, models.OrderEventProduct{
+			ProductID: product.ID,
+			Quantity:  product.Quantity,
+		})
+	}
+	return outbox.NewMessage("order_events", strconv.Itoa(int(order.ID)), models.OrderEvent{
+		Type: eventType,
+		Data: data,
+	})
+}
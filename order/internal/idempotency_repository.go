@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+)
+
+var (
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	ErrIdempotencyKeyInUse    = errors.New("a request with this idempotency key is still in progress")
+)
+
+func (repository *postgresRepository) GetIdempotencyKey(ctx context.Context, accountId, key string) (*models.IdempotencyKey, error) {
+	var idempotencyKey models.IdempotencyKey
+	err := repository.db.WithContext(ctx).
+		Where("account_id = ? AND key = ?", accountId, key).
+		First(&idempotencyKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &idempotencyKey, nil
+}
+
+// ClaimIdempotencyKey saves a new key before its order is placed. Only one of
+// concurrent requests with the same key gets it, the others get
+// ErrIdempotencyKeyInUse.
+func (repository *postgresRepository) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	err := repository.db.WithContext(ctx).Create(key).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrIdempotencyKeyInUse
+	}
+	return err
+}
+
+func (repository *postgresRepository) DeleteIdempotencyKey(ctx context.Context, id uint) error {
+	return repository.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, id).Error
+}
+
+// DeleteExpiredIdempotencyKeys drops the keys past their retention window
+func (repository *postgresRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	result := repository.db.WithContext(ctx).
+		Where("expires_at < ?", now).
+		Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func isIdempotencyError(err error) bool {
+	return errors.Is(err, ErrIdempotencyKeyReused) ||
+		errors.Is(err, ErrIdempotencyKeyInUse) ||
+		errors.Is(err, ErrInvalidIdempotencyKey)
+}
+
+func idempotencyError(err error) error {
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyReused), errors.Is(err, ErrInvalidIdempotencyKey):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrIdempotencyKeyInUse):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+)
+
+const (
+	// How long a key returns the order it placed
+	idempotencyKeyTTL = 24 * time.Hour
+	// A key still without an order after this long belongs to a request that
+	// died half way, it can be claimed again
+	abandonedKeyAge         = time.Minute
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	ErrIdempotencyKeyReused  = errors.New("the idempotency key was already used with a different request")
+	ErrInvalidIdempotencyKey = errors.New("the idempotency key must be at most 255 characters")
+)
+
+// OrderRequestHash identifies the content of an order request, whatever the
+// order of its products, the case of its coupon and currency and the spacing
+// of its shipping address
+func OrderRequestHash(quantities map[string]uint32, couponCode, currency string, address models.Address) string {
+	ids := make([]string, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	hash := sha256.New()
+	for _, id := range ids {
+		fmt.Fprintf(hash, "product:%s:%d\n", id, quantities[id])
+	}
+	fmt.Fprintf(hash, "coupon:%s\n", normalizeCode(couponCode))
+	fmt.Fprintf(hash, "currency:%s\n", strings.ToUpper(strings.TrimSpace(currency)))
+	// An invalid address is refused later, the request is hashed all the same.
+	// Requests without one hash as they did before addresses existed.
+	address, _ = normalizeAddress(address)
+	if address != (models.Address{}) {
+		fmt.Fprintf(hash, "address:%q,%q,%q,%q,%q,%q,%q\n", address.Name, address.Line1, address.Line2,
+			address.City, address.Region, address.PostalCode, address.Country)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ReplayOrder returns the order already placed with the idempotency key, or
+// nil when the key is new
+func (service orderService) ReplayOrder(ctx context.Context, key models.IdempotencyKey) (*models.Order, error) {
+	if len(key.Key) > maxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotencyKey
+	}
+	existing, err := service.repository.GetIdempotencyKey(ctx, key.AccountID, key.Key)
+	if errors.Is(err, ErrIdempotencyKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expired := existing.ExpiresAt.Before(now)
+	abandoned := existing.OrderID == 0 && existing.CreatedAt.Before(now.Add(-abandonedKeyAge))
+	if expired || abandoned {
+		return nil, service.repository.DeleteIdempotencyKey(ctx, existing.ID)
+	}
+	if existing.RequestHash != key.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.OrderID == 0 {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	return service.repository.GetOrder(ctx, existing.OrderID)
+}
+
+func (service orderService) claimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, now time.Time) error {
+	if len(key.Key) > maxIdempotencyKeyLength {
+		return ErrInvalidIdempotencyKey
+	}
+	key.CreatedAt = now
+	key.ExpiresAt = now.Add(idempotencyKeyTTL)
+	return service.repository.ClaimIdempotencyKey(ctx, key)
+}
+
+// PurgeIdempotencyKeys deletes the expired keys every interval until ctx is
+// cancelled
+func PurgeIdempotencyKeys(ctx context.Context, repository Repository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := repository.DeleteExpiredIdempotencyKeys(ctx, now.UTC())
+			if err != nil {
+				log.Println("Failed to purge idempotency keys:", err)
+			} else if deleted > 0 {
+				log.Printf("Purged %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
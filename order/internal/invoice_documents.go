@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/pdf"
+)
+
+// Layout of the PDF, in points
+const (
+	pageMargin  = 50.0
+	lineHeight  = 14.0
+	productCell = 200.0
+	// Rows stop above the space the totals need
+	tableBottom = pageMargin + 6*lineHeight
+)
+
+// Right edges of the columns of the lines
+var invoiceColumns = []struct {
+	title string
+	right float64
+}{
+	{"Qty", 290},
+	{"Unit price", 360},
+	{"Discount", 420},
+	{"Tax", 480},
+	{"Total", pdf.PageWidth - pageMargin},
+}
+
+// invoicePDF renders the invoice or credit note as an A4 PDF: the parties at
+// the top, then a row per line, then the totals
+func invoicePDF(invoice *models.Invoice) []byte {
+	doc := pdf.New()
+	right := pdf.PageWidth - pageMargin
+
+	title := "Invoice"
+	if invoice.Kind == models.InvoiceKindCreditNote {
+		title = "Credit note"
+	}
+	y := pdf.PageHeight - pageMargin - 20
+	doc.Text(pdf.Bold, 20, pageMargin, y, title)
+	details := []string{
+		"Number: " + invoice.DisplayNumber(),
+		"Issued: " + invoice.IssuedAt.Format("2006-01-02"),
+		fmt.Sprintf("Order: %d", invoice.OrderID),
+	}
+	if invoice.CreditedInvoiceNumber != "" {
+		details = append(details, "Credits invoice: "+invoice.CreditedInvoiceNumber)
+	}
+	if invoice.ReturnID != 0 {
+		details = append(details, fmt.Sprintf("Return: %d", invoice.ReturnID))
+	}
+	for i, detail := range details {
+		doc.TextRight(pdf.Regular, 10, right, y-float64(i)*lineHeight, detail)
+	}
+
+	y -= float64(len(details)+1) * lineHeight
+	doc.Text(pdf.Bold, 10, pageMargin, y, "Seller")
+	doc.Text(pdf.Regular, 10, pageMargin, y-lineHeight, fmt.Sprintf("Seller %d", invoice.SellerID))
+	doc.Text(pdf.Bold, 10, 300, y, "Bill to")
+	for i, line := range billingLines(invoice) {
+		doc.Text(pdf.Regular, 10, 300, y-float64(i+1)*lineHeight, line)
+	}
+
+	y -= 9 * lineHeight
+	doc.Text(pdf.Regular, 9, pageMargin, y, "Amounts in "+invoice.Currency)
+	y -= 1.5 * lineHeight
+	y = lineHeader(doc, y)
+	for _, line := range invoice.Lines {
+		if y < tableBottom {
+			doc.AddPage()
+			doc.Text(pdf.Regular, 9, pageMargin, pdf.PageHeight-pageMargin, title+" "+invoice.DisplayNumber()+", continued")
+			y = lineHeader(doc, pdf.PageHeight-pageMargin-2*lineHeight)
+		}
+		doc.Text(pdf.Regular, 9, pageMargin, y, fit(fmt.Sprintf("%s (%s)", line.Name, line.ProductID), productCell))
+		cells := []string{
+			strconv.Itoa(line.Quantity),
+			amount(line.UnitPriceMinor, invoice.Currency),
+			amount(line.DiscountMinor, invoice.Currency),
+			amount(line.TaxMinor, invoice.Currency),
+			amount(line.TotalMinor, invoice.Currency),
+		}
+		for i, cell := range cells {
+			doc.TextRight(pdf.Regular, 9, invoiceColumns[i].right, y, cell)
+		}
+		y -= lineHeight
+	}
+
+	doc.Line(pageMargin, y+lineHeight-4, right, y+lineHeight-4)
+	totals := []struct {
+		label string
+		value money.Money
+	}{
+		{"Subtotal", invoice.SubtotalMoney()},
+		{"Discount", invoice.DiscountMoney()},
+		{"Shipping", invoice.ShippingMoney()},
+		{"Tax", invoice.TaxMoney()},
+	}
+	for _, total := range totals {
+		doc.Text(pdf.Regular, 10, 360, y, total.label)
+		doc.TextRight(pdf.Regular, 10, right, y, total.value.String())
+		y -= lineHeight
+	}
+	label := "Total"
+	if invoice.Kind == models.InvoiceKindCreditNote {
+		label = "Total credited"
+	}
+	doc.Text(pdf.Bold, 10, 360, y, label)
+	doc.TextRight(pdf.Bold, 10, right, y, invoice.TotalMoney().String())
+	doc.Text(pdf.Regular, 8, pageMargin, pageMargin/2, "The tax column lists every tax of the lines, the total only adds those not included in the prices.")
+	return doc.Bytes()
+}
+
+// lineHeader draws the titles of the columns and returns where the first row
+// goes
+func lineHeader(doc *pdf.Document, y float64) float64 {
+	doc.Text(pdf.Bold, 9, pageMargin, y, "Product")
+	for _, column := range invoiceColumns {
+		doc.TextRight(pdf.Bold, 9, column.right, y, column.title)
+	}
+	doc.Line(pageMargin, y-4, pdf.PageWidth-pageMargin, y-4)
+	return y - lineHeight - 2
+}
+
+// billingLines returns the customer and their address, leaving out the empty
+// parts
+func billingLines(invoice *models.Invoice) []string {
+	address := invoice.BillingAddress
+	var lines []string
+	for _, line := range []string{
+		address.Name,
+		address.Line1,
+		address.Line2,
+		strings.TrimSpace(address.PostalCode + " " + address.City),
+		address.Region,
+		address.Country,
+		"Account " + invoice.AccountID,
+	} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// fit shortens the text until it fits the width
+func fit(text string, width float64) string {
+	if pdf.Width(pdf.Regular, 9, text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.Width(pdf.Regular, 9, string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// amount formats minor units as a decimal without the currency, e.g. 12.50
+func amount(minor int64, currency string) string {
+	return strings.TrimSuffix(money.New(minor, currency).String(), " "+currency)
+}
+
+// ublInvoice is the machine readable variant of an invoice. Its fields are
+// named after those of the UBL 2.1 Invoice and CreditNote documents, its
+// amounts are decimals in DocumentCurrencyCode.
+type ublInvoice struct {
+	ID                      string               `json:"ID"`
+	IssueDate               string               `json:"IssueDate"`
+	InvoiceTypeCode         string               `json:"InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode      string               `json:"CreditNoteTypeCode,omitempty"`
+	DocumentCurrencyCode    string               `json:"DocumentCurrencyCode"`
+	OrderReference          ublReference         `json:"OrderReference"`
+	BillingReference        *ublBillingReference `json:"BillingReference,omitempty"`
+	AccountingSupplierParty ublParty             `json:"AccountingSupplierParty"`
+	AccountingCustomerParty ublParty             `json:"AccountingCustomerParty"`
+	TaxTotal                ublTaxTotal          `json:"TaxTotal"`
+	LegalMonetaryTotal      ublMonetaryTotal     `json:"LegalMonetaryTotal"`
+	InvoiceLine             []ublLine            `json:"InvoiceLine,omitempty"`
+	CreditNoteLine          []ublLine            `json:"CreditNoteLine,omitempty"`
+}
+
+type ublReference struct {
+	ID string `json:"ID"`
+}
+
+type ublBillingReference struct {
+	InvoiceDocumentReference ublReference `json:"InvoiceDocumentReference"`
+}
+
+type ublParty struct {
+	Party struct {
+		PartyIdentification ublReference      `json:"PartyIdentification"`
+		PartyName           *ublPartyName     `json:"PartyName,omitempty"`
+		PostalAddress       *ublPostalAddress `json:"PostalAddress,omitempty"`
+	} `json:"Party"`
+}
+
+type ublPartyName struct {
+	Name string `json:"Name"`
+}
+
+type ublPostalAddress struct {
+	StreetName           string `json:"StreetName,omitempty"`
+	AdditionalStreetName string `json:"AdditionalStreetName,omitempty"`
+	CityName             string `json:"CityName,omitempty"`
+	PostalZone           string `json:"PostalZone,omitempty"`
+	CountrySubentity     string `json:"CountrySubentity,omitempty"`
+	Country              struct {
+		IdentificationCode string `json:"IdentificationCode,omitempty"`
+	} `json:"Country"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount string `json:"TaxAmount"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount  string `json:"LineExtensionAmount"`
+	AllowanceTotalAmount string `json:"AllowanceTotalAmount"`
+	ChargeTotalAmount    string `json:"ChargeTotalAmount"`
+	PayableAmount        string `json:"PayableAmount"`
+}
+
+type ublLine struct {
+	ID                  string      `json:"ID"`
+	InvoicedQuantity    int         `json:"InvoicedQuantity,omitempty"`
+	CreditedQuantity    int         `json:"CreditedQuantity,omitempty"`
+	LineExtensionAmount string      `json:"LineExtensionAmount"`
+	AllowanceAmount     string      `json:"AllowanceAmount"`
+	TaxTotal            ublTaxTotal `json:"TaxTotal"`
+	Item                struct {
+		Name                      string       `json:"Name"`
+		SellersItemIdentification ublReference `json:"SellersItemIdentification"`
+	} `json:"Item"`
+	Price struct {
+		PriceAmount string `json:"PriceAmount"`
+	} `json:"Price"`
+}
+
+// invoiceJSON renders the invoice or credit note as a UBL shaped JSON
+// document. The line extension amounts are net of the discounts, which are
+// also given as allowances.
+func invoiceJSON(invoice *models.Invoice) ([]byte, error) {
+	currency := invoice.Currency
+	document := ublInvoice{
+		ID:                   invoice.DisplayNumber(),
+		IssueDate:            invoice.IssuedAt.Format("2006-01-02"),
+		DocumentCurrencyCode: currency,
+		OrderReference:       ublReference{ID: strconv.Itoa(int(invoice.OrderID))},
+		TaxTotal:             ublTaxTotal{TaxAmount: amount(invoice.TaxMinor, currency)},
+		LegalMonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount:  amount(invoice.SubtotalMinor-invoice.DiscountMinor, currency),
+			AllowanceTotalAmount: amount(invoice.DiscountMinor, currency),
+			ChargeTotalAmount:    amount(invoice.ShippingMinor, currency),
+			PayableAmount:        amount(invoice.TotalMinor, currency),
+		},
+	}
+	document.AccountingSupplierParty.Party.PartyIdentification.ID = strconv.Itoa(invoice.SellerID)
+
+	address := invoice.BillingAddress
+	customer := &document.AccountingCustomerParty.Party
+	customer.PartyIdentification.ID = invoice.AccountID
+	if address.Name != "" {
+		customer.PartyName = &ublPartyName{Name: address.Name}
+	}
+	if address.Country != "" {
+		customer.PostalAddress = &ublPostalAddress{
+			StreetName:           address.Line1,
+			AdditionalStreetName: address.Line2,
+			CityName:             address.City,
+			PostalZone:           address.PostalCode,
+			CountrySubentity:     address.Region,
+		}
+		customer.PostalAddress.Country.IdentificationCode = address.Country
+	}
+
+	lines := make([]ublLine, 0, len(invoice.Lines))
+	for i, line := range invoice.Lines {
+		entry := ublLine{
+			ID:                  strconv.Itoa(i + 1),
+			LineExtensionAmount: amount(line.SubtotalMinor-line.DiscountMinor, currency),
+			AllowanceAmount:     amount(line.DiscountMinor, currency),
+			TaxTotal:            ublTaxTotal{TaxAmount: amount(line.TaxMinor, currency)},
+		}
+		entry.Item.Name = line.Name
+		entry.Item.SellersItemIdentification.ID = line.ProductID
+		entry.Price.PriceAmount = amount(line.UnitPriceMinor, currency)
+		if invoice.Kind == models.InvoiceKindCreditNote {
+			entry.CreditedQuantity = line.Quantity
+		} else {
+			entry.InvoicedQuantity = line.Quantity
+		}
+		lines = append(lines, entry)
+	}
+
+	// 380 is a commercial invoice and 381 a credit note in UNCL1001
+	if invoice.Kind == models.InvoiceKindCreditNote {
+		document.CreditNoteTypeCode = "381"
+		document.BillingReference = &ublBillingReference{InvoiceDocumentReference: ublReference{ID: invoice.CreditedInvoiceNumber}}
+		document.CreditNoteLine = lines
+	} else {
+		document.InvoiceTypeCode = "380"
+		document.InvoiceLine = lines
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
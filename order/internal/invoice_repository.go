@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrInvoiceIssued means the order already has this invoice or credit
+	// note, e.g. issued by a concurrent retry
+	ErrInvoiceIssued = errors.New("the invoice was already issued")
+)
+
+// PutInvoice numbers the invoice and saves it with its lines. The number is
+// taken from the sequence of the seller in the same transaction, which holds
+// the row of the sequence until it commits: an invoice that fails to save
+// gives its number back, so the numbers have no gaps. The message built from
+// the saved invoice is put in the outbox in the same transaction.
+func (repository *postgresRepository) PutInvoice(ctx context.Context, invoice *models.Invoice, message func(*models.Invoice) (outbox.Message, error)) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`INSERT INTO invoice_sequences (seller_id, kind, last_number) VALUES (?, ?, 1)
+			ON CONFLICT (seller_id, kind) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+			RETURNING last_number`, invoice.SellerID, invoice.Kind).
+			Scan(&invoice.Number).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(invoice).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrInvoiceIssued
+		}
+		if err != nil {
+			return err
+		}
+		created, err := message(invoice)
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, created)
+	})
+}
+
+func (repository *postgresRepository) GetInvoice(ctx context.Context, id uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := repository.db.WithContext(ctx).Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&invoice, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// ListInvoices returns the invoices and credit notes of the order with their
+// lines, in the order they were issued
+func (repository *postgresRepository) ListInvoices(ctx context.Context, orderId uint) ([]models.Invoice, error) {
+	var invoices []models.Invoice
+	err := repository.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Where("order_id = ?", orderId).
+		Order("id").
+		Find(&invoices).Error
+	return invoices, err
+}
+
+// ListOrdersWithDocumentsDue returns the orders whose invoices or credit notes
+// have been due since before dueBefore, oldest first
+func (repository *postgresRepository) ListOrdersWithDocumentsDue(ctx context.Context, dueBefore time.Time) ([]uint, error) {
+	var ids []uint
+	err := repository.db.WithContext(ctx).
+		Model(&models.Order{}).
+		Where("documents_due_at < ?", dueBefore).
+		Order("documents_due_at").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ClearDocumentsDue records that the documents of the order are issued. A
+// status change after issuedFrom, when the issue started, is left due.
+func (repository *postgresRepository) ClearDocumentsDue(ctx context.Context, orderId uint, issuedFrom time.Time) error {
+	return repository.db.WithContext(ctx).
+		Model(&models.Order{}).
+		Where("id = ? AND documents_due_at <= ?", orderId, issuedFrom).
+		Update("documents_due_at", nil).Error
+}
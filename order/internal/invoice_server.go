@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+)
+
+func (server *grpcServer) GetInvoiceDocument(ctx context.Context, request *pb.GetInvoiceDocumentRequest) (*pb.GetInvoiceDocumentResponse, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	document, err := server.service.GetInvoiceDocument(ctx, uint(request.GetInvoiceId()), request.GetFormat(), callerID, isAdmin)
+	if err != nil {
+		log.Println("Error getting invoice document:", err)
+		return nil, invoiceError(err)
+	}
+	return &pb.GetInvoiceDocumentResponse{
+		FileName:    document.FileName,
+		ContentType: document.ContentType,
+		Content:     document.Content,
+	}, nil
+}
+
+func invoiceError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvoiceNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidInvoiceFormat):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotInvoiceParticipant):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return statusError(err)
+}
+
+func invoiceToProto(invoice *models.Invoice) *pb.Invoice {
+	invoiceProto := &pb.Invoice{
+		Id:                uint64(invoice.ID),
+		Kind:              invoice.Kind,
+		Number:            invoice.Number,
+		OrderId:           uint64(invoice.OrderID),
+		AccountId:         invoice.AccountID,
+		SellerId:          int64(invoice.SellerID),
+		ReturnId:          uint64(invoice.ReturnID),
+		CreditedInvoiceId: uint64(invoice.CreditedInvoiceID),
+		Subtotal:          moneyToProto(invoice.SubtotalMoney()),
+		Discount:          moneyToProto(invoice.DiscountMoney()),
+		Tax:               moneyToProto(invoice.TaxMoney()),
+		Shipping:          moneyToProto(invoice.ShippingMoney()),
+		Total:             moneyToProto(invoice.TotalMoney()),
+	}
+	invoiceProto.IssuedAt, _ = invoice.IssuedAt.MarshalBinary()
+	return invoiceProto
+}
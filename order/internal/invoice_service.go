@@ -0,0 +1,373 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/blob"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+// Formats an invoice can be downloaded in
+const (
+	InvoiceFormatPDF  = "PDF"
+	InvoiceFormatJSON = "JSON"
+)
+
+var (
+	ErrInvalidInvoiceFormat  = errors.New("the invoice format must be PDF or JSON")
+	ErrNotInvoiceParticipant = errors.New("only admins, the customer and the seller of an invoice can download it")
+)
+
+// GetInvoiceDocument returns the invoice in the format, as it was stored when
+// the invoice was issued. An invoice whose documents failed to be stored is
+// rendered again.
+func (service orderService) GetInvoiceDocument(ctx context.Context, invoiceId uint, format string, callerID int, isAdmin bool) (*models.InvoiceDocument, error) {
+	format = strings.ToUpper(format)
+	if format == "" {
+		format = InvoiceFormatPDF
+	}
+	if format != InvoiceFormatPDF && format != InvoiceFormatJSON {
+		return nil, ErrInvalidInvoiceFormat
+	}
+
+	invoice, err := service.repository.GetInvoice(ctx, invoiceId)
+	if err != nil {
+		return nil, err
+	}
+	caller := strconv.Itoa(callerID)
+	if !isAdmin && invoice.AccountID != caller && strconv.Itoa(invoice.SellerID) != caller {
+		return nil, ErrNotInvoiceParticipant
+	}
+
+	key := invoiceKey(invoice, format)
+	document := &models.InvoiceDocument{FileName: key[strings.LastIndex(key, "/")+1:], ContentType: "application/pdf"}
+	if format == InvoiceFormatJSON {
+		document.ContentType = "application/json"
+	}
+	document.Content, err = service.documents.Get(ctx, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		if document.Content, err = renderInvoice(invoice, format); err != nil {
+			return nil, err
+		}
+		if err = service.documents.Put(ctx, key, document.Content); err != nil {
+			log.Printf("Failed to store invoice %d: %v", invoice.ID, err)
+		}
+		return document, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// Documents that failed to be issued are retried once they have been due
+// for this long, leaving time to the status change that made them due
+const dueDocumentsAge = time.Minute
+
+// issueDocuments follows the order into a new status: a paid order is
+// invoiced and a refunded one credited. The status is changed already, so a
+// failure leaves the documents due for ReissueDocuments.
+func (service orderService) issueDocuments(ctx context.Context, order *models.Order, status string) {
+	if status != models.OrderStatusPaid && status != models.OrderStatusRefunded {
+		return
+	}
+
+	startedAt := time.Now().UTC()
+	var err error
+	if status == models.OrderStatusPaid {
+		_, err = service.issueInvoices(ctx, order)
+	} else {
+		err = service.creditOrder(ctx, order)
+	}
+	if err != nil {
+		log.Printf("Failed to issue the invoices of order %d, they will be retried: %v", order.ID, err)
+		return
+	}
+	if err = service.repository.ClearDocumentsDue(ctx, order.ID, startedAt); err != nil {
+		log.Printf("Failed to record the invoices of order %d as issued: %v", order.ID, err)
+	}
+}
+
+// ReissueDocuments issues the invoices and credit notes that failed to be
+// issued when their order was paid or refunded
+func (service orderService) ReissueDocuments(ctx context.Context, now time.Time) error {
+	ids, err := service.repository.ListOrdersWithDocumentsDue(ctx, now.Add(-dueDocumentsAge))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		order, err := service.repository.GetOrder(ctx, id)
+		if err != nil {
+			log.Printf("Failed to reissue the invoices of order %d: %v", id, err)
+			continue
+		}
+		// A refunded order is credited, which invoices it first if needed
+		status := models.OrderStatusPaid
+		if order.Status == models.OrderStatusRefunded {
+			status = models.OrderStatusRefunded
+		}
+		service.issueDocuments(ctx, order, status)
+	}
+	return nil
+}
+
+// RunDocuments retries the due invoices and credit notes every interval until
+// ctx is cancelled
+func RunDocuments(ctx context.Context, service Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := service.ReissueDocuments(ctx, now.UTC()); err != nil {
+				log.Println("Failed to reissue invoices:", err)
+			}
+		}
+	}
+}
+
+// issueInvoices gives each seller of the order an invoice for their part, once,
+// and returns the invoices and credit notes of the order
+func (service orderService) issueInvoices(ctx context.Context, order *models.Order) ([]models.Invoice, error) {
+	invoices, err := service.repository.ListInvoices(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	invoiced := map[int]bool{}
+	for _, invoice := range invoices {
+		if invoice.Kind == models.InvoiceKindInvoice {
+			invoiced[invoice.SellerID] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, product := range order.Products {
+		if invoiced[product.SellerID] {
+			continue
+		}
+		invoiced[product.SellerID] = true
+
+		part := order.ForSeller(product.SellerID)
+		invoice := &models.Invoice{
+			Kind:           models.InvoiceKindInvoice,
+			SellerID:       product.SellerID,
+			OrderID:        order.ID,
+			AccountID:      order.AccountID,
+			BillingAddress: order.ShippingAddress,
+			Currency:       order.Currency,
+			ShippingMinor:  part.ShippingTotalMinor,
+			IssuedAt:       now,
+		}
+		for _, line := range part.Lines() {
+			invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+				ProductID:      line.Product.ID,
+				Name:           line.Product.Name,
+				Quantity:       int(line.Product.Quantity),
+				UnitPriceMinor: line.Product.PriceMoney().Amount,
+				SubtotalMinor:  line.Subtotal.Amount,
+				DiscountMinor:  line.Discount.Amount,
+				TaxMinor:       line.Tax.Amount,
+				TotalMinor:     line.Total.Amount,
+			})
+		}
+		invoice.Sum()
+		if err = service.putInvoice(ctx, invoice); err != nil {
+			return nil, err
+		}
+	}
+	return service.repository.ListInvoices(ctx, order.ID)
+}
+
+// creditReturn gives the seller's customer a credit note for the units of the
+// return, once
+func (service orderService) creditReturn(ctx context.Context, order *models.Order, orderReturn *models.OrderReturn) error {
+	invoices, err := service.issueInvoices(ctx, order)
+	if err != nil {
+		return err
+	}
+	invoice, credited := creditedInvoice(invoices, orderReturn.SellerID)
+	if invoice == nil {
+		return nil
+	}
+	for _, creditNote := range invoices {
+		if creditNote.ReturnID == orderReturn.ID {
+			return nil
+		}
+	}
+
+	creditNote := newCreditNote(invoice)
+	creditNote.ReturnID = orderReturn.ID
+	for _, line := range invoice.Lines {
+		if line.ProductID == orderReturn.ProductID {
+			creditNote.Lines = append(creditNote.Lines, creditLine(line, credited[line.ProductID], orderReturn.Quantity))
+		}
+	}
+	creditNote.Sum()
+	return service.putInvoice(ctx, creditNote)
+}
+
+// creditOrder gives a refunded order a credit note per invoice, for what the
+// earlier credit notes did not give back
+func (service orderService) creditOrder(ctx context.Context, order *models.Order) error {
+	invoices, err := service.issueInvoices(ctx, order)
+	if err != nil {
+		return err
+	}
+	for i := range invoices {
+		if invoices[i].Kind != models.InvoiceKindInvoice {
+			continue
+		}
+		invoice, credited := creditedInvoice(invoices, invoices[i].SellerID)
+
+		creditNote := newCreditNote(invoice)
+		creditNote.ShippingMinor = invoice.ShippingMinor - credited[""].TotalMinor
+		for _, line := range invoice.Lines {
+			if left := line.Quantity - credited[line.ProductID].Quantity; left > 0 {
+				creditNote.Lines = append(creditNote.Lines, creditLine(line, credited[line.ProductID], left))
+			}
+		}
+		if len(creditNote.Lines) == 0 && creditNote.ShippingMinor <= 0 {
+			continue
+		}
+		creditNote.Sum()
+		if err = service.putInvoice(ctx, creditNote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putInvoice saves the invoice and stores its documents. An invoice issued
+// concurrently is left to the other call. The documents that fail to be
+// stored are rendered again when downloaded.
+func (service orderService) putInvoice(ctx context.Context, invoice *models.Invoice) error {
+	err := service.repository.PutInvoice(ctx, invoice, invoiceEventMessage)
+	if errors.Is(err, ErrInvoiceIssued) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, format := range []string{InvoiceFormatPDF, InvoiceFormatJSON} {
+		content, err := renderInvoice(invoice, format)
+		if err == nil {
+			err = service.documents.Put(ctx, invoiceKey(invoice, format), content)
+		}
+		if err != nil {
+			log.Printf("Failed to store invoice %d as %s: %v", invoice.ID, format, err)
+		}
+	}
+	return nil
+}
+
+// creditedInvoice returns the invoice of the seller with what its credit notes
+// gave back so far, summed per product. The shipping they gave back is under
+// the empty product ID.
+func creditedInvoice(invoices []models.Invoice, sellerID int) (*models.Invoice, map[string]models.InvoiceLine) {
+	var invoice *models.Invoice
+	for i := range invoices {
+		if invoices[i].Kind == models.InvoiceKindInvoice && invoices[i].SellerID == sellerID {
+			invoice = &invoices[i]
+		}
+	}
+	if invoice == nil {
+		return nil, nil
+	}
+
+	credited := map[string]models.InvoiceLine{}
+	for _, creditNote := range invoices {
+		if creditNote.CreditedInvoiceID != invoice.ID {
+			continue
+		}
+		for _, line := range creditNote.Lines {
+			sum := credited[line.ProductID]
+			sum.Quantity += line.Quantity
+			sum.SubtotalMinor += line.SubtotalMinor
+			sum.DiscountMinor += line.DiscountMinor
+			sum.TaxMinor += line.TaxMinor
+			sum.TotalMinor += line.TotalMinor
+			credited[line.ProductID] = sum
+		}
+		shipping := credited[""]
+		shipping.TotalMinor += creditNote.ShippingMinor
+		credited[""] = shipping
+	}
+	return invoice, credited
+}
+
+func newCreditNote(invoice *models.Invoice) *models.Invoice {
+	return &models.Invoice{
+		Kind:                  models.InvoiceKindCreditNote,
+		SellerID:              invoice.SellerID,
+		OrderID:               invoice.OrderID,
+		CreditedInvoiceID:     invoice.ID,
+		CreditedInvoiceNumber: invoice.DisplayNumber(),
+		AccountID:             invoice.AccountID,
+		BillingAddress:        invoice.BillingAddress,
+		Currency:              invoice.Currency,
+		IssuedAt:              time.Now().UTC(),
+	}
+}
+
+// creditLine gives back quantity units of the invoice line, after the units
+// credited already. Each amount is the share of the line for the units
+// credited so far, less what the earlier credit notes gave back, the way
+// returns are refunded, so crediting every unit gives back the whole line.
+func creditLine(line, credited models.InvoiceLine, quantity int) models.InvoiceLine {
+	share := func(amount, creditedAmount int64) int64 {
+		units := float64(credited.Quantity + quantity)
+		return money.New(amount, "").Fraction(units, float64(line.Quantity), money.RoundDown).Amount - creditedAmount
+	}
+	return models.InvoiceLine{
+		ProductID:      line.ProductID,
+		Name:           line.Name,
+		Quantity:       quantity,
+		UnitPriceMinor: line.UnitPriceMinor,
+		SubtotalMinor:  share(line.SubtotalMinor, credited.SubtotalMinor),
+		DiscountMinor:  share(line.DiscountMinor, credited.DiscountMinor),
+		TaxMinor:       share(line.TaxMinor, credited.TaxMinor),
+		TotalMinor:     share(line.TotalMinor, credited.TotalMinor),
+	}
+}
+
+func renderInvoice(invoice *models.Invoice, format string) ([]byte, error) {
+	if format == InvoiceFormatJSON {
+		return invoiceJSON(invoice)
+	}
+	return invoicePDF(invoice), nil
+}
+
+// invoiceKey is where the document of the invoice is stored, e.g.
+// invoices/12/INV-12-000042.pdf
+func invoiceKey(invoice *models.Invoice, format string) string {
+	return fmt.Sprintf("invoices/%d/%s.%s", invoice.SellerID, invoice.DisplayNumber(), strings.ToLower(format))
+}
+
+// invoiceEventMessage is an event of the invoice_events topic, keyed by the
+// order ID
+func invoiceEventMessage(invoice *models.Invoice) (outbox.Message, error) {
+	return outbox.NewMessage("invoice_events", strconv.Itoa(int(invoice.OrderID)), models.InvoiceEvent{
+		Type: strings.ToLower(invoice.Kind) + "_issued",
+		Data: models.InvoiceEventData{
+			InvoiceID:  invoice.ID,
+			Kind:       invoice.Kind,
+			Number:     invoice.DisplayNumber(),
+			OrderID:    invoice.OrderID,
+			AccountID:  invoice.AccountID,
+			SellerID:   invoice.SellerID,
+			ReturnID:   invoice.ReturnID,
+			TotalMinor: invoice.TotalMinor,
+			Currency:   invoice.Currency,
+		},
+	})
+}
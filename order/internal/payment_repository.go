@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrPaymentStatusChanged means the status of the payment was changed by
+	// someone else between reading and updating it
+	ErrPaymentStatusChanged = errors.New("the payment status was changed concurrently")
+)
+
+func (repository *postgresRepository) PutPaymentIntent(ctx context.Context, intent *models.PaymentIntent) error {
+	return repository.db.WithContext(ctx).Create(intent).Error
+}
+
+// UpdatePaymentIntent saves the status of the payment as long as it is still
+// from. Nothing is written if it is not.
+func (repository *postgresRepository) UpdatePaymentIntent(ctx context.Context, intent *models.PaymentIntent, from string) error {
+	intent.UpdatedAt = time.Now().UTC()
+	result := repository.db.WithContext(ctx).Model(&models.PaymentIntent{}).
+		Where("id = ? AND status = ?", intent.ID, from).
+		Updates(map[string]interface{}{
+			"status":         intent.Status,
+			"failure_reason": intent.FailureReason,
+			"refunded_minor": gorm.Expr("GREATEST(refunded_minor, ?)", intent.RefundedMinor),
+			"updated_at":     intent.UpdatedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPaymentStatusChanged
+	}
+	return nil
+}
+
+func (repository *postgresRepository) GetPaymentIntent(ctx context.Context, id uint) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := repository.db.WithContext(ctx).First(&intent, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// RecordRefund raises the amount refunded on the payment to refundedMinor, it
+// never lowers it so refunds reported out of order add up
+func (repository *postgresRepository) RecordRefund(ctx context.Context, intentId uint, refundedMinor int64) error {
+	return repository.db.WithContext(ctx).Model(&models.PaymentIntent{}).
+		Where("id = ? AND refunded_minor < ?", intentId, refundedMinor).
+		Updates(map[string]interface{}{
+			"refunded_minor": refundedMinor,
+			"updated_at":     time.Now().UTC(),
+		}).Error
+}
+
+func (repository *postgresRepository) GetPaymentIntentByRef(ctx context.Context, providerRef string) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := repository.db.WithContext(ctx).
+		Where("provider_ref = ?", providerRef).
+		First(&intent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+func (repository *postgresRepository) HasPaymentEvent(ctx context.Context, eventId string) (bool, error) {
+	var count int64
+	err := repository.db.WithContext(ctx).
+		Model(&models.PaymentEvent{}).
+		Where("event_id = ?", eventId).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// PutPaymentEvent records a processed webhook, recording it twice is not an
+// error
+func (repository *postgresRepository) PutPaymentEvent(ctx context.Context, event *models.PaymentEvent) error {
+	err := repository.db.WithContext(ctx).Create(event).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+	"github.com/thomas/EcommerceAPI/pkg/payment"
+)
+
+func (server *grpcServer) PayOrder(ctx context.Context, request *pb.PayOrderRequest) (*pb.PayOrderResponse, error) {
+	callerID, _, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := server.service.PayOrder(ctx, uint(request.GetOrderId()), strconv.Itoa(callerID), request.GetPaymentMethod())
+	if err != nil {
+		log.Println("Error paying order:", err)
+		return nil, paymentError(err)
+	}
+	if err = server.decorateOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	return &pb.PayOrderResponse{Order: orderToProto(order)}, nil
+}
+
+func (server *grpcServer) HandlePaymentEvent(ctx context.Context, request *pb.HandlePaymentEventRequest) (*pb.HandlePaymentEventResponse, error) {
+	e := request.GetEvent()
+	if e.GetId() == "" || e.GetProviderRef() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "the event needs an ID and a provider reference")
+	}
+	event := payment.Event{
+		ID:          e.GetId(),
+		Type:        e.GetType(),
+		ProviderRef: e.GetProviderRef(),
+		Amount:      e.GetAmount().GetAmount(),
+		Currency:    e.GetAmount().GetCurrency(),
+	}
+	event.CreatedAt.UnmarshalBinary(e.GetCreatedAt())
+
+	duplicate, err := server.service.HandlePaymentEvent(ctx, event)
+	if err != nil {
+		log.Println("Error handling payment event:", err)
+		return nil, paymentError(err)
+	}
+	return &pb.HandlePaymentEventResponse{Duplicate: duplicate}, nil
+}
+
+func paymentError(err error) error {
+	switch {
+	case errors.Is(err, ErrPaymentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrMissingPaymentMethod):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotOrderOwner):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrOrderNotPayable), errors.Is(err, ErrPaymentDeclined):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrPaymentInProgress):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return statusError(err)
+}
@@ -0,0 +1,291 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/payment"
+)
+
+var (
+	ErrOrderNotPayable      = errors.New("only pending orders can be paid")
+	ErrMissingPaymentMethod = errors.New("a payment method is required")
+	ErrPaymentDeclined      = errors.New("the payment was declined")
+)
+
+// PayOrder charges the customer for a pending order: the total is authorized
+// then captured right away, and the order becomes PAID. The payment is a step
+// of the checkout saga of the order, see saga_service.go.
+func (service orderService) PayOrder(ctx context.Context, orderId uint, accountId, paymentMethod string) (*models.Order, error) {
+	paymentMethod = strings.TrimSpace(paymentMethod)
+	if paymentMethod == "" {
+		return nil, ErrMissingPaymentMethod
+	}
+
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return nil, err
+	}
+	if order.AccountID != accountId {
+		return nil, ErrNotOrderOwner
+	}
+	if order.Status != models.OrderStatusPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	checkout, err := service.startPayment(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = service.chargeOrder(ctx, order, paymentMethod)
+	if checkout {
+		service.finishPayment(ctx, order.ID, err == nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return service.repository.GetOrder(ctx, order.ID)
+}
+
+// chargeOrder authorizes and captures the total of the order
+func (service orderService) chargeOrder(ctx context.Context, order *models.Order, paymentMethod string) error {
+	// Nothing to charge when the discounts cover the whole order
+	if order.TotalMinor == 0 {
+		return service.moveOrder(ctx, order.ID, models.OrderStatusPaid, "nothing to pay")
+	}
+
+	intent := &models.PaymentIntent{
+		OrderID:     order.ID,
+		Provider:    service.gateway.Name(),
+		AmountMinor: order.TotalMinor,
+		Currency:    order.Currency,
+		Status:      models.PaymentRequiresAction,
+	}
+	if err := service.repository.PutPaymentIntent(ctx, intent); err != nil {
+		return err
+	}
+
+	result, err := service.gateway.Authorize(ctx, payment.AuthorizeRequest{
+		Reference:     fmt.Sprintf("pi_%d", intent.ID),
+		Amount:        intent.AmountMoney(),
+		PaymentMethod: paymentMethod,
+	})
+	if err != nil {
+		service.failPayment(ctx, intent, err.Error())
+		return err
+	}
+	intent.ProviderRef = result.ProviderRef
+	if result.Status == payment.StatusDeclined {
+		service.failPayment(ctx, intent, result.FailureReason)
+		return ErrPaymentDeclined
+	}
+	if err = service.applyPayment(ctx, intent, models.PaymentAuthorized, ""); err != nil {
+		return err
+	}
+	return service.capturePayment(ctx, intent)
+}
+
+// capturePayment captures an authorized payment, which pays its order. The
+// authorization is voided when the capture fails.
+func (service orderService) capturePayment(ctx context.Context, intent *models.PaymentIntent) error {
+	if _, err := service.gateway.Capture(ctx, intent.ProviderRef, intent.AmountMoney()); err != nil {
+		// Release the hold so the customer is not left with a pending charge
+		if _, voidErr := service.gateway.Void(ctx, intent.ProviderRef); voidErr != nil {
+			log.Printf("Failed to void payment %d: %v", intent.ID, voidErr)
+		}
+		service.failPayment(ctx, intent, err.Error())
+		return err
+	}
+	return service.applyPayment(ctx, intent, models.PaymentCaptured, "")
+}
+
+// HandlePaymentEvent applies a webhook of the payment provider. Events that
+// were already processed are skipped and reported as duplicates.
+func (service orderService) HandlePaymentEvent(ctx context.Context, event payment.Event) (bool, error) {
+	seen, err := service.repository.HasPaymentEvent(ctx, event.ID)
+	if err != nil {
+		return false, err
+	}
+	if seen {
+		return true, nil
+	}
+
+	intent, err := service.repository.GetPaymentIntentByRef(ctx, event.ProviderRef)
+	if err != nil {
+		return false, err
+	}
+
+	switch event.Type {
+	case payment.EventCaptured:
+		err = service.applyPayment(ctx, intent, models.PaymentCaptured, "")
+	case payment.EventFailed:
+		err = service.applyPayment(ctx, intent, models.PaymentFailed, "declined by the provider")
+	case payment.EventRefunded:
+		err = service.applyRefund(ctx, intent, event.Amount)
+	case payment.EventVoided:
+		err = service.applyPayment(ctx, intent, models.PaymentVoided, "")
+	default:
+		log.Println("Ignoring payment event of unknown type:", event.Type)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Recorded once applied, so an event that failed is applied again when
+	// the provider retries it
+	return false, service.repository.PutPaymentEvent(ctx, &models.PaymentEvent{
+		EventID:     event.ID,
+		Type:        event.Type,
+		ProviderRef: event.ProviderRef,
+		CreatedAt:   time.Now().UTC(),
+	})
+}
+
+// applyPayment records the new status of a payment and moves its order along:
+// a captured payment pays the order, a refunded one refunds it. A payment
+// captured for an order that was cancelled meanwhile is refunded instead.
+// Applying the same status twice changes nothing, the answer of the gateway
+// and its webhook often report the same thing. A status the payment cannot
+// reach any more, e.g. a failure reported after the capture, is ignored.
+func (service orderService) applyPayment(ctx context.Context, intent *models.PaymentIntent, status, reason string) error {
+	for intent.Status != status {
+		if !models.CanPaymentTransition(intent.Status, status) {
+			log.Printf("Payment %d cannot move from %s to %s", intent.ID, intent.Status, status)
+			return nil
+		}
+		from := intent.Status
+		intent.Status = status
+		intent.FailureReason = reason
+		err := service.repository.UpdatePaymentIntent(ctx, intent, from)
+		if errors.Is(err, ErrPaymentStatusChanged) {
+			// Someone else moved it first, check again from where it is now
+			current, err := service.repository.GetPaymentIntent(ctx, intent.ID)
+			if err != nil {
+				return err
+			}
+			*intent = *current
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	switch status {
+	case models.PaymentCaptured:
+		order, err := service.repository.GetOrder(ctx, intent.OrderID)
+		if err != nil {
+			return err
+		}
+		if order.Status == models.OrderStatusCancelled || order.Status == models.OrderStatusRefunded {
+			log.Printf("Refunding payment %d captured for order %d, which is %s", intent.ID, order.ID, order.Status)
+			return service.refundPayments(ctx, order)
+		}
+		return service.moveOrder(ctx, intent.OrderID, models.OrderStatusPaid, "")
+	case models.PaymentRefunded:
+		return service.moveOrder(ctx, intent.OrderID, models.OrderStatusRefunded, "")
+	}
+	return nil
+}
+
+// applyRefund records that refundedMinor of the payment was given back so
+// far. Refunds only add up, one reported late changes nothing. A payment
+// given back in full is REFUNDED, which refunds its order.
+func (service orderService) applyRefund(ctx context.Context, intent *models.PaymentIntent, refundedMinor int64) error {
+	if refundedMinor > intent.RefundedMinor {
+		if err := service.repository.RecordRefund(ctx, intent.ID, refundedMinor); err != nil {
+			return err
+		}
+		intent.RefundedMinor = refundedMinor
+	}
+	if intent.RefundedMinor < intent.AmountMinor {
+		return nil
+	}
+	return service.applyPayment(ctx, intent, models.PaymentRefunded, "")
+}
+
+func (service orderService) failPayment(ctx context.Context, intent *models.PaymentIntent, reason string) {
+	if err := service.applyPayment(ctx, intent, models.PaymentFailed, reason); err != nil {
+		log.Printf("Failed to record the failure of payment %d: %v", intent.ID, err)
+	}
+}
+
+// moveOrder changes the status of the order on behalf of the order service.
+// An order already in the status, or that cannot reach it any more, is left
+// as it is.
+func (service orderService) moveOrder(ctx context.Context, orderId uint, status, note string) error {
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	if order.Status == status {
+		return nil
+	}
+	if !models.CanTransition(order.Status, status) {
+		log.Printf("Order %d cannot move from %s to %s", order.ID, order.Status, status)
+		return nil
+	}
+
+	err = service.repository.UpdateOrderStatus(ctx, models.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		Note:       note,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if errors.Is(err, ErrOrderStatusChanged) {
+		// Someone else moved it first, e.g. the webhook of the same payment
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	service.issueDocuments(ctx, order, status)
+	return nil
+}
+
+// refundPayments gives back the money taken for the order and releases the
+// authorizations that were not captured
+func (service orderService) refundPayments(ctx context.Context, order *models.Order) error {
+	for i := range order.Payments {
+		intent := &order.Payments[i]
+		from := intent.Status
+		switch intent.Status {
+		case models.PaymentCaptured:
+			// Returns may have given part of it back already
+			left := money.New(intent.AmountMinor-intent.RefundedMinor, intent.Currency)
+			if left.Amount > 0 {
+				if _, err := service.gateway.Refund(ctx, intent.ProviderRef, orderRefundReference(order.ID), left); err != nil {
+					return err
+				}
+			}
+			intent.RefundedMinor = intent.AmountMinor
+			intent.Status = models.PaymentRefunded
+		case models.PaymentAuthorized:
+			if _, err := service.gateway.Void(ctx, intent.ProviderRef); err != nil {
+				return err
+			}
+			intent.Status = models.PaymentVoided
+		default:
+			continue
+		}
+		err := service.repository.UpdatePaymentIntent(ctx, intent, from)
+		// The webhook of the refund or void may have recorded it first
+		if err != nil && !errors.Is(err, ErrPaymentStatusChanged) {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderRefundReference is the reference of the refund of what is left of the
+// payments of an order, the provider refunds it once
+func orderRefundReference(orderId uint) string {
+	return fmt.Sprintf("order-%d", orderId)
+}
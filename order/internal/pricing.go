@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+var (
+	ErrPromotionNotApplicable = errors.New("the coupon does not apply to any product in the order")
+	ErrMinimumBasketNotMet    = errors.New("the order does not reach the minimum amount of the coupon")
+	ErrMixedCurrencies        = errors.New("all the products of an order must be priced in the same currency")
+)
+
+// Pricing is the price of an order with the discounts it gets, line by line
+type Pricing struct {
+	Subtotal      money.Money
+	DiscountTotal money.Money
+	Total         money.Money
+	Discounts     []models.OrderDiscount
+}
+
+// PriceOrder computes the subtotal, the discounts and the total of the
+// products. It only depends on its arguments: the same products and promotion
+// always give the same result, to the minor unit. The promotion may be nil.
+//
+// Percentage discounts are rounded half up on each line. A fixed discount is
+// spread over the eligible lines in proportion to their price, and the minor
+// units left over by rounding go to the lines in product id order.
+func PriceOrder(products []*models.OrderedProduct, promotion *models.Promotion) (*Pricing, error) {
+	lines := make([]*models.OrderedProduct, len(products))
+	copy(lines, products)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].ID < lines[j].ID
+	})
+
+	currency := money.DefaultCurrency
+	if len(lines) > 0 {
+		currency = money.NormalizeCurrency(lines[0].Currency)
+	}
+	subtotal := money.New(0, currency)
+	lineTotals := make([]money.Money, len(lines))
+	for i, line := range lines {
+		var err error
+		lineTotals[i] = line.PriceMoney().Times(int64(line.Quantity))
+		if subtotal, err = subtotal.Add(lineTotals[i]); err != nil {
+			return nil, ErrMixedCurrencies
+		}
+	}
+
+	pricing := &Pricing{Subtotal: subtotal, DiscountTotal: money.New(0, currency), Total: subtotal}
+	if promotion == nil {
+		return pricing, nil
+	}
+
+	var eligible []int
+	var weights []int64
+	eligibleTotal := money.New(0, currency)
+	for i, line := range lines {
+		if promotion.AppliesTo(line) && lineTotals[i].Amount > 0 {
+			eligible = append(eligible, i)
+			weights = append(weights, lineTotals[i].Amount)
+			eligibleTotal, _ = eligibleTotal.Add(lineTotals[i])
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, ErrPromotionNotApplicable
+	}
+	// Amounts of the promotion are in its own currency
+	if promotion.MinBasket > 0 || promotion.Type == models.PromotionFixed {
+		if money.NormalizeCurrency(promotion.Currency) != currency {
+			return nil, ErrPromotionNotApplicable
+		}
+	}
+	if eligibleTotal.Amount < money.FromFloat(promotion.MinBasket, currency).Amount {
+		return nil, ErrMinimumBasketNotMet
+	}
+
+	amounts := make([]money.Money, len(lines))
+	switch promotion.Type {
+	case models.PromotionPercentage:
+		percent := math.Min(math.Max(promotion.Value, 0), 100)
+		for _, i := range eligible {
+			amounts[i] = lineTotals[i].Percent(percent, money.RoundHalfUp)
+		}
+	case models.PromotionFixed:
+		off := money.FromFloat(promotion.Value, currency)
+		if off.Amount > eligibleTotal.Amount {
+			off = eligibleTotal
+		}
+		for k, share := range off.Allocate(weights) {
+			amounts[eligible[k]] = share
+		}
+	case models.PromotionBuyXGetY:
+		if promotion.BuyQuantity <= 0 || promotion.GetQuantity <= 0 {
+			return nil, ErrPromotionNotApplicable
+		}
+		group := uint32(promotion.BuyQuantity + promotion.GetQuantity)
+		for _, i := range eligible {
+			free := lines[i].Quantity / group * uint32(promotion.GetQuantity)
+			amounts[i] = lines[i].PriceMoney().Times(int64(free))
+		}
+	default:
+		return nil, ErrInvalidPromotion
+	}
+
+	discountTotal := money.New(0, currency)
+	for i, amount := range amounts {
+		if amount.Amount <= 0 {
+			continue
+		}
+		discountTotal, _ = discountTotal.Add(amount)
+		pricing.Discounts = append(pricing.Discounts, models.OrderDiscount{
+			ProductID:   lines[i].ID,
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			AmountMinor: amount.Amount,
+			Amount:      amount.Float(),
+		})
+	}
+	if discountTotal.IsZero() {
+		return nil, ErrPromotionNotApplicable
+	}
+	pricing.DiscountTotal = discountTotal
+	pricing.Total, _ = subtotal.Sub(discountTotal)
+	return pricing, nil
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+)
+
+var (
+	ErrPromotionNotFound     = errors.New("unknown coupon code")
+	ErrPromotionExhausted    = errors.New("the coupon has reached its usage limit")
+	ErrPromotionAccountLimit = errors.New("you have already used this coupon the maximum number of times")
+	ErrDuplicatePromotion    = errors.New("a promotion with this code already exists")
+)
+
+func (repository *postgresRepository) PutPromotion(ctx context.Context, promotion *models.Promotion) error {
+	err := repository.db.WithContext(ctx).Create(promotion).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicatePromotion
+	}
+	return err
+}
+
+func (repository *postgresRepository) GetPromotionByCode(ctx context.Context, code string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := repository.db.WithContext(ctx).Where("code = ?", code).First(&promotion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// ListPromotions returns the promotions created by an account, or all of them
+// when createdBy is zero, newest first
+func (repository *postgresRepository) ListPromotions(ctx context.Context, createdBy int) ([]models.Promotion, error) {
+	query := repository.db.WithContext(ctx).Order("id DESC")
+	if createdBy != 0 {
+		query = query.Where("created_by = ?", createdBy)
+	}
+	var promotions []models.Promotion
+	err := query.Find(&promotions).Error
+	return promotions, err
+}
+
+// redeemPromotion records the use of the promotion by the order. The
+// promotion row stays locked until the transaction ends, so two orders cannot
+// both take the last use.
+func redeemPromotion(tx *gorm.DB, promotionId uint, order *models.Order) error {
+	var promotion models.Promotion
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promotion, promotionId).Error
+	if err != nil {
+		return err
+	}
+	if promotion.MaxUses > 0 && promotion.UsedCount >= promotion.MaxUses {
+		return ErrPromotionExhausted
+	}
+	if promotion.MaxUsesPerAccount > 0 {
+		var used int64
+		err = tx.Model(&models.PromotionRedemption{}).
+			Where("promotion_id = ? AND account_id = ?", promotionId, order.AccountID).
+			Count(&used).Error
+		if err != nil {
+			return err
+		}
+		if used >= int64(promotion.MaxUsesPerAccount) {
+			return ErrPromotionAccountLimit
+		}
+	}
+
+	err = tx.Model(&promotion).Update("used_count", gorm.Expr("used_count + 1")).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.PromotionRedemption{
+		PromotionID: promotionId,
+		AccountID:   order.AccountID,
+		OrderID:     order.ID,
+		CreatedAt:   order.CreatedAt,
+	}).Error
+}
+
+// releasePromotions gives back the uses of the promotions redeemed by the
+// order, so a cancelled order does not count against their limits
+func releasePromotions(tx *gorm.DB, orderId uint) error {
+	var redemptions []models.PromotionRedemption
+	err := tx.Where("order_id = ?", orderId).Find(&redemptions).Error
+	if err != nil || len(redemptions) == 0 {
+		return err
+	}
+	for _, redemption := range redemptions {
+		err = tx.Model(&models.Promotion{}).
+			Where("id = ?", redemption.PromotionID).
+			Update("used_count", gorm.Expr("GREATEST(used_count - 1, 0)")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&redemptions).Error
+}
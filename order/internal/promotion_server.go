@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+)
+
+func (server *grpcServer) CreatePromotion(ctx context.Context, request *pb.CreatePromotionRequest) (*pb.PromotionResponse, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	promotion, err := server.service.CreatePromotion(ctx, promotionFromProto(request.GetPromotion()), callerID, isAdmin)
+	if errors.Is(err, ErrDuplicatePromotion) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		log.Println("Error creating promotion:", err)
+		return nil, err
+	}
+	return &pb.PromotionResponse{Promotion: promotionToProto(promotion)}, nil
+}
+
+func (server *grpcServer) GetPromotions(ctx context.Context, request *pb.GetPromotionsRequest) (*pb.GetPromotionsResponse, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions, err := server.service.GetPromotions(ctx, callerID, isAdmin)
+	if err != nil {
+		log.Println("Error getting promotions:", err)
+		return nil, err
+	}
+	response := &pb.GetPromotionsResponse{}
+	for i := range promotions {
+		response.Promotions = append(response.Promotions, promotionToProto(&promotions[i]))
+	}
+	return response, nil
+}
+
+// requestCaller reads the caller ID and whether they are an admin from the
+// request metadata
+func requestCaller(ctx context.Context) (int, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false, status.Errorf(codes.Unauthenticated, "missing metadata")
+	}
+	callerIDs := md.Get("caller-id")
+	if len(callerIDs) == 0 {
+		return 0, false, status.Errorf(codes.Unauthenticated, "missing caller ID")
+	}
+	callerID, err := strconv.Atoi(callerIDs[0])
+	if err != nil {
+		return 0, false, status.Errorf(codes.Unauthenticated, "invalid caller ID")
+	}
+	roles := md.Get("caller-role")
+	return callerID, len(roles) > 0 && roles[0] == auth.RoleAdmin, nil
+}
+
+func isCouponError(err error) bool {
+	return errors.Is(err, ErrPromotionNotFound) ||
+		errors.Is(err, ErrPromotionExpired) ||
+		errors.Is(err, ErrPromotionExhausted) ||
+		errors.Is(err, ErrPromotionAccountLimit) ||
+		errors.Is(err, ErrPromotionNotApplicable) ||
+		errors.Is(err, ErrMinimumBasketNotMet)
+}
+
+func promotionToProto(promotion *models.Promotion) *pb.Promotion {
+	p := &pb.Promotion{
+		Id:                uint64(promotion.ID),
+		Code:              promotion.Code,
+		Type:              promotion.Type,
+		Value:             promotion.Value,
+		Currency:          promotion.Currency,
+		BuyQuantity:       int32(promotion.BuyQuantity),
+		GetQuantity:       int32(promotion.GetQuantity),
+		SellerId:          int64(promotion.SellerID),
+		Category:          promotion.Category,
+		MinBasket:         promotion.MinBasket,
+		MaxUses:           int32(promotion.MaxUses),
+		MaxUsesPerAccount: int32(promotion.MaxUsesPerAccount),
+		UsedCount:         int32(promotion.UsedCount),
+		CreatedBy:         int64(promotion.CreatedBy),
+	}
+	if promotion.StartsAt != nil {
+		p.StartsAt, _ = promotion.StartsAt.MarshalBinary()
+	}
+	if promotion.EndsAt != nil {
+		p.EndsAt, _ = promotion.EndsAt.MarshalBinary()
+	}
+	p.CreatedAt, _ = promotion.CreatedAt.MarshalBinary()
+	return p
+}
+
+func promotionFromProto(p *pb.Promotion) models.Promotion {
+	promotion := models.Promotion{
+		ID:                uint(p.GetId()),
+		Code:              p.GetCode(),
+		Type:              p.GetType(),
+		Value:             p.GetValue(),
+		Currency:          p.GetCurrency(),
+		BuyQuantity:       int(p.GetBuyQuantity()),
+		GetQuantity:       int(p.GetGetQuantity()),
+		SellerID:          int(p.GetSellerId()),
+		Category:          p.GetCategory(),
+		MinBasket:         p.GetMinBasket(),
+		MaxUses:           int(p.GetMaxUses()),
+		MaxUsesPerAccount: int(p.GetMaxUsesPerAccount()),
+		UsedCount:         int(p.GetUsedCount()),
+		CreatedBy:         int(p.GetCreatedBy()),
+	}
+	if len(p.GetStartsAt()) > 0 {
+		startsAt := time.Time{}
+		if startsAt.UnmarshalBinary(p.GetStartsAt()) == nil {
+			promotion.StartsAt = &startsAt
+		}
+	}
+	if len(p.GetEndsAt()) > 0 {
+		endsAt := time.Time{}
+		if endsAt.UnmarshalBinary(p.GetEndsAt()) == nil {
+			promotion.EndsAt = &endsAt
+		}
+	}
+	promotion.CreatedAt.UnmarshalBinary(p.GetCreatedAt())
+	return promotion
+}
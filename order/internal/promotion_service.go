@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+var (
+	ErrInvalidPromotion = errors.New("invalid promotion")
+	ErrPromotionExpired = errors.New("the coupon is not valid at this time")
+)
+
+// CreatePromotion adds a coupon. Admins can create promotions for the whole
+// shop, anyone else only for the products they sell.
+func (service orderService) CreatePromotion(ctx context.Context, promotion models.Promotion, callerID int, isAdmin bool) (*models.Promotion, error) {
+	promotion.Code = normalizeCode(promotion.Code)
+	if promotion.Code == "" {
+		return nil, errors.New("a promotion needs a code")
+	}
+	switch promotion.Type {
+	case models.PromotionPercentage:
+		if promotion.Value <= 0 || promotion.Value > 100 {
+			return nil, errors.New("a percentage must be between 0 and 100")
+		}
+	case models.PromotionFixed:
+		if promotion.Value <= 0 {
+			return nil, errors.New("a fixed discount must be positive")
+		}
+	case models.PromotionBuyXGetY:
+		if promotion.BuyQuantity <= 0 || promotion.GetQuantity <= 0 {
+			return nil, errors.New("buy and get quantities must be positive")
+		}
+	default:
+		return nil, ErrInvalidPromotion
+	}
+	if err := money.ValidateCurrency(promotion.Currency); err != nil {
+		return nil, err
+	}
+	promotion.Currency = money.NormalizeCurrency(promotion.Currency)
+	if promotion.MinBasket < 0 || promotion.MaxUses < 0 || promotion.MaxUsesPerAccount < 0 {
+		return nil, ErrInvalidPromotion
+	}
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return nil, errors.New("a promotion must end after it starts")
+	}
+
+	if !isAdmin {
+		if promotion.SellerID != 0 && promotion.SellerID != callerID {
+			return nil, errors.New("unauthorized")
+		}
+		promotion.SellerID = callerID
+	}
+
+	promotion.UsedCount = 0
+	promotion.CreatedBy = callerID
+	promotion.CreatedAt = time.Now().UTC()
+	if err := service.repository.PutPromotion(ctx, &promotion); err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// GetPromotions returns every promotion to admins and their own to sellers
+func (service orderService) GetPromotions(ctx context.Context, callerID int, isAdmin bool) ([]models.Promotion, error) {
+	if isAdmin {
+		return service.repository.ListPromotions(ctx, 0)
+	}
+	return service.repository.ListPromotions(ctx, callerID)
+}
+
+// Coupon codes are case insensitive
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
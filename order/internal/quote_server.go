@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+// QuoteOrder prices the order PostOrder would place for the request. Unlike
+// PostOrder it does not fail on the lines that cannot be ordered, it returns
+// them as errors and prices the others.
+func (server *grpcServer) QuoteOrder(ctx context.Context, request *pb.QuoteOrderRequest) (*pb.QuoteOrderResponse, error) {
+	productQuantities, uniqueProductIDs := aggregateProducts(request.Products)
+	products, lineErrors, err := server.orderedProducts(ctx, productQuantities, uniqueProductIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	address := addressFromProto(request.GetShippingAddress())
+	quote, err := server.service.QuoteOrder(ctx, request.AccountId, products, request.CouponCode, request.Currency, address)
+	if errors.Is(err, ErrInvalidAddress) || errors.Is(err, money.ErrInvalidCurrency) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if isCouponError(err) || errors.Is(err, ErrNoShippingRate) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		log.Println("Error quoting order:", err)
+		return nil, err
+	}
+	return &pb.QuoteOrderResponse{Quote: quoteToProto(quote, lineErrors)}, nil
+}
+
+func quoteToProto(order *models.Order, lineErrors []models.LineError) *pb.OrderQuote {
+	quote := &pb.OrderQuote{
+		Currency:      order.Currency,
+		Subtotal:      moneyToProto(order.SubtotalMoney()),
+		DiscountTotal: moneyToProto(order.DiscountTotalMoney()),
+		ShippingTotal: moneyToProto(order.ShippingTotalMoney()),
+		TaxTotal:      moneyToProto(order.TaxTotalMoney()),
+		Total:         moneyToProto(order.TotalMoney()),
+		CouponCode:    order.CouponCode,
+	}
+	for _, d := range order.Discounts {
+		quote.Discounts = append(quote.Discounts, discountToProto(d, order.Currency))
+	}
+	for _, tax := range order.Taxes {
+		quote.Taxes = append(quote.Taxes, taxToProto(tax, order.Currency))
+	}
+	for i := range order.Shipments {
+		quote.Shipments = append(quote.Shipments, shipmentToProto(&order.Shipments[i]))
+	}
+	for _, line := range order.Lines() {
+		quote.Lines = append(quote.Lines, quoteLineToProto(line))
+	}
+	for _, lineError := range lineErrors {
+		quote.Errors = append(quote.Errors, &pb.LineError{
+			ProductId: lineError.ProductID,
+			Code:      lineError.Code,
+			Message:   lineError.Message,
+		})
+	}
+	return quote
+}
+
+func quoteLineToProto(line models.OrderLine) *pb.QuoteLine {
+	return &pb.QuoteLine{
+		ProductId: line.Product.ID,
+		Name:      line.Product.Name,
+		SellerId:  int64(line.Product.SellerID),
+		Quantity:  line.Product.Quantity,
+		UnitPrice: moneyToProto(line.Product.PriceMoney()),
+		Subtotal:  moneyToProto(line.Subtotal),
+		Discount:  moneyToProto(line.Discount),
+		Tax:       moneyToProto(line.Tax),
+		Total:     moneyToProto(line.Total),
+	}
+}
@@ -2,16 +2,63 @@ package internal
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 type Repository interface {
 	Close()
-	PutOrder(ctx context.Context, order *models.Order) error
-	GetOrdersForAccount(ctx context.Context, accountId string) ([]models.Order, error)
+	Outbox() outbox.Store
+	PutOrder(ctx context.Context, order *models.Order, promotion *models.Promotion, key *models.IdempotencyKey) error
+	GetOrdersForAccount(ctx context.Context, accountId string, filter models.OrderFilter, sort string, limit int, afterId uint) ([]models.Order, int64, error)
+	GetOrderCurrencies(ctx context.Context, accountId string) ([]string, error)
+	GetOrdersForSeller(ctx context.Context, sellerId int, filter models.OrderFilter, sort string, limit int, afterId uint) ([]models.Order, int64, error)
+	HasPurchased(ctx context.Context, accountId, productId string) (bool, error)
+
+	GetOrder(ctx context.Context, id uint) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, change models.OrderStatusChange) error
+	CancelOrder(ctx context.Context, change models.OrderStatusChange, reason string, messages []outbox.Message) error
+
+	GetSaga(ctx context.Context, orderId uint) (*models.CheckoutSaga, error)
+	AdvanceSaga(ctx context.Context, orderId uint, from, to string, updates map[string]interface{}, messages ...outbox.Message) error
+	ListStalledSagas(ctx context.Context, now, stalledBefore time.Time) ([]models.CheckoutSaga, error)
+
+	GetShipment(ctx context.Context, id uint) (*models.Shipment, error)
+	UpdateShipment(ctx context.Context, id uint, from string, updates map[string]interface{}, messages []outbox.Message) error
+
+	PutReturn(ctx context.Context, orderReturn *models.OrderReturn, returnable int, message func(*models.OrderReturn) (outbox.Message, error)) error
+	GetReturn(ctx context.Context, id uint) (*models.OrderReturn, error)
+	UpdateReturn(ctx context.Context, id uint, from string, updates map[string]interface{}, messages []outbox.Message) error
+	ClaimReturnRefund(ctx context.Context, id uint, now, stalledBefore time.Time) error
+
+	PutInvoice(ctx context.Context, invoice *models.Invoice, message func(*models.Invoice) (outbox.Message, error)) error
+	GetInvoice(ctx context.Context, id uint) (*models.Invoice, error)
+	ListInvoices(ctx context.Context, orderId uint) ([]models.Invoice, error)
+	ListOrdersWithDocumentsDue(ctx context.Context, dueBefore time.Time) ([]uint, error)
+	ClearDocumentsDue(ctx context.Context, orderId uint, issuedFrom time.Time) error
+
+	PutPaymentIntent(ctx context.Context, intent *models.PaymentIntent) error
+	UpdatePaymentIntent(ctx context.Context, intent *models.PaymentIntent, from string) error
+	GetPaymentIntent(ctx context.Context, id uint) (*models.PaymentIntent, error)
+	RecordRefund(ctx context.Context, intentId uint, refundedMinor int64) error
+	GetPaymentIntentByRef(ctx context.Context, providerRef string) (*models.PaymentIntent, error)
+	HasPaymentEvent(ctx context.Context, eventId string) (bool, error)
+	PutPaymentEvent(ctx context.Context, event *models.PaymentEvent) error
+
+	GetIdempotencyKey(ctx context.Context, accountId, key string) (*models.IdempotencyKey, error)
+	ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, id uint) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+
+	PutPromotion(ctx context.Context, promotion *models.Promotion) error
+	GetPromotionByCode(ctx context.Context, code string) (*models.Promotion, error)
+	ListPromotions(ctx context.Context, createdBy int) ([]models.Promotion, error)
 }
 
 type postgresRepository struct {
@@ -19,7 +66,8 @@ type postgresRepository struct {
 }
 
 func NewPostgresRepository(databaseURl string) (Repository, error) {
-	db, err := gorm.Open(postgres.Open(databaseURl), &gorm.Config{})
+	// Errors are translated so unique violations surface as gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(databaseURl), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +82,27 @@ func NewPostgresRepository(databaseURl string) (Repository, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&models.Order{}, &models.ProductsInfo{})
+	err = db.AutoMigrate(
+		&models.Order{},
+		&models.ProductsInfo{},
+		&models.OrderDiscount{},
+		&models.OrderTax{},
+		&models.ExchangeRate{},
+		&models.OrderStatusChange{},
+		&models.CheckoutSaga{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.OrderReturn{},
+		&models.Invoice{},
+		&models.InvoiceLine{},
+		&models.InvoiceSequence{},
+		&models.PaymentIntent{},
+		&models.PaymentEvent{},
+		&models.IdempotencyKey{},
+		&models.Promotion{},
+		&models.PromotionRedemption{},
+		&outbox.Message{},
+	)
 
 	return &postgresRepository{db}, nil
 }
@@ -46,7 +114,15 @@ func (repository *postgresRepository) Close() {
 	}
 }
 
-func (repository *postgresRepository) PutOrder(ctx context.Context, order *models.Order) error {
+func (repository *postgresRepository) Outbox() outbox.Store {
+	return outbox.NewStore(repository.db)
+}
+
+// PutOrder saves the order with its discounts. When a promotion is given it
+// is redeemed in the same transaction, so the usage limits hold even when
+// orders are placed concurrently. When an idempotency key is given it is
+// linked to the order in the same transaction too.
+func (repository *postgresRepository) PutOrder(ctx context.Context, order *models.Order, promotion *models.Promotion, key *models.IdempotencyKey) error {
 	tx := repository.db.WithContext(ctx).Begin()
 
 	err := tx.WithContext(ctx).Create(&order).Error
@@ -55,18 +131,39 @@ func (repository *postgresRepository) PutOrder(ctx context.Context, order *model
 		return err
 	}
 
+	if promotion != nil {
+		if err = redeemPromotion(tx, promotion.ID, order); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	for _, product := range order.Products {
 		orderedProduct := models.ProductsInfo{
 			OrderID:   order.ID,
 			ProductID: product.ID,
 			Quantity:  int(product.Quantity),
 		}
+		orderedProduct.Name = product.Name
+		orderedProduct.Description = product.Description
+		orderedProduct.UnitPriceMinor = product.PriceMoney().Amount
+		orderedProduct.Currency = money.NormalizeCurrency(product.Currency)
+		orderedProduct.Variant = product.Variant
+		orderedProduct.SellerID = product.SellerID
 		err = tx.Create(&orderedProduct).Error
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
 	}
+	if key != nil {
+		err = tx.Model(&models.IdempotencyKey{}).Where("id = ?", key.ID).Update("order_id", order.ID).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		key.OrderID = order.ID
+	}
 	if err = tx.Commit().Error; err != nil {
 		return err
 	}
@@ -74,38 +171,197 @@ func (repository *postgresRepository) PutOrder(ctx context.Context, order *model
 	return nil
 }
 
-func (repository *postgresRepository) GetOrdersForAccount(ctx context.Context, accountId string) ([]models.Order, error) {
-	// First, get all orders for the account
-	var orders []models.Order
+// GetOrdersForAccount returns the orders of the account matching the filter
+// in the given sort, at most limit of them starting after the order afterId,
+// and how many orders match the filter in total
+func (repository *postgresRepository) GetOrdersForAccount(ctx context.Context, accountId string, filter models.OrderFilter, sort string, limit int, afterId uint) ([]models.Order, int64, error) {
+	return repository.listOrders(ctx, func(db *gorm.DB) *gorm.DB {
+		return filterOrders(db.Where("account_id = ?", accountId), filter)
+	}, sort, limit, afterId)
+}
+
+// GetOrderCurrencies lists the currencies the account has orders in
+func (repository *postgresRepository) GetOrderCurrencies(ctx context.Context, accountId string) ([]string, error) {
+	var currencies []string
 	err := repository.db.WithContext(ctx).
+		Model(&models.Order{}).
 		Where("account_id = ?", accountId).
+		Distinct().
+		Pluck(orderCurrencyColumn, &currencies).Error
+	return currencies, err
+}
+
+// Orders placed before currencies existed have none and are in
+// money.DefaultCurrency, with their totals in total_price only
+var (
+	orderCurrencyColumn = fmt.Sprintf("COALESCE(NULLIF(currency, ''), '%s')", money.DefaultCurrency)
+	orderTotalColumn    = "COALESCE(NULLIF(total_minor, 0), ROUND(total_price * 100))"
+)
+
+// GetOrdersForSeller is GetOrdersForAccount for the orders holding at least
+// one product of the seller. The orders are returned whole.
+func (repository *postgresRepository) GetOrdersForSeller(ctx context.Context, sellerId int, filter models.OrderFilter, sort string, limit int, afterId uint) ([]models.Order, int64, error) {
+	return repository.listOrders(ctx, func(db *gorm.DB) *gorm.DB {
+		db = db.Where("EXISTS (SELECT 1 FROM order_products WHERE order_products.order_id = orders.id AND order_products.seller_id = ?)", sellerId)
+		return filterOrders(db, filter)
+	}, sort, limit, afterId)
+}
+
+// listOrders returns a page of the orders selected by scope
+func (repository *postgresRepository) listOrders(ctx context.Context, scope func(db *gorm.DB) *gorm.DB, sort string, limit int, afterId uint) ([]models.Order, int64, error) {
+
+	var total int64
+	err := repository.db.WithContext(ctx).Model(&models.Order{}).Scopes(scope).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	column, direction := "created_at", "DESC"
+	switch sort {
+	case models.OrderSortOldest:
+		direction = "ASC"
+	case models.OrderSortTotalAsc:
+		column, direction = orderTotalColumn, "ASC"
+	case models.OrderSortTotalDesc:
+		column = orderTotalColumn
+	}
+
+	query := repository.db.WithContext(ctx).Scopes(scope)
+	if afterId != 0 {
+		// Keyset pagination: the orders that sort after the cursor order
+		comparison := ">"
+		if direction == "DESC" {
+			comparison = "<"
+		}
+		query = query.Where(fmt.Sprintf("(%[1]s, id) %[2]s (SELECT %[1]s, id FROM orders WHERE id = ?)", column, comparison), afterId)
+	}
+
+	var orders []models.Order
+	err = query.
+		Preload("Discounts").
+		Preload("Taxes").
+		Preload("ExchangeRates").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Preload("Payments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Scopes(preloadShipments).
+		Preload("Returns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Preload("Invoices", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(limit).
 		Find(&orders).Error
 
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	// For each order, get its products
 	for i := range orders {
-		// Get product infos
-		var productInfos []models.ProductsInfo
-		err = repository.db.WithContext(ctx).
-			Where("order_id = ?", orders[i].ID).
-			Find(&productInfos).Error
-
-		if err != nil {
-			return nil, err
+		backfillAmounts(&orders[i])
+		if err = repository.loadProducts(ctx, &orders[i]); err != nil {
+			return nil, 0, err
 		}
+	}
+
+	return orders, total, nil
+}
+
+func filterOrders(db *gorm.DB, filter models.OrderFilter) *gorm.DB {
+	if filter.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	if len(filter.Statuses) > 0 {
+		db = db.Where("status IN ?", filter.Statuses)
+	}
+	if filter.Currency != "" {
+		db = db.Where(orderCurrencyColumn+" = ?", filter.Currency)
+	}
+	if filter.MinTotal > 0 {
+		db = db.Where(orderTotalColumn+" >= ?", money.FromFloat(filter.MinTotal, filter.Currency).Amount)
+	}
+	if filter.MaxTotal > 0 {
+		db = db.Where(orderTotalColumn+" <= ?", money.FromFloat(filter.MaxTotal, filter.Currency).Amount)
+	}
+	if filter.ProductID != "" {
+		db = db.Where("EXISTS (SELECT 1 FROM order_products WHERE order_products.order_id = orders.id AND order_products.product_id = ?)", filter.ProductID)
+	}
+	return db
+}
+
+func (repository *postgresRepository) loadProducts(ctx context.Context, order *models.Order) error {
+	// Get product infos
+	var productInfos []models.ProductsInfo
+	err := repository.db.WithContext(ctx).
+		Where("order_id = ?", order.ID).
+		Find(&productInfos).Error
+
+	if err != nil {
+		return err
+	}
 
-		// Convert ProductsInfo to OrderedProduct
-		for _, pi := range productInfos {
-			orders[i].Products = append(orders[i].Products, &models.OrderedProduct{
-				ID:       pi.ProductID,
-				Quantity: uint32(pi.Quantity),
-				// Name, Description, and Price will be populated by the server
-			})
+	// Convert ProductsInfo to OrderedProduct
+	for _, pi := range productInfos {
+		product := &models.OrderedProduct{
+			ID:       pi.ProductID,
+			Quantity: uint32(pi.Quantity),
+			// Without a snapshot, Name, Description, and Price will be
+			// populated by the server from the live product
 		}
+		if pi.HasSnapshot() {
+			product.Name = pi.Name
+			product.Description = pi.Description
+			product.Price = money.New(pi.UnitPriceMinor, pi.Currency).Float()
+			product.Currency = pi.Currency
+			product.Variant = pi.Variant
+			product.SellerID = pi.SellerID
+			product.Snapshot = true
+		}
+		order.Products = append(order.Products, product)
+	}
+	return nil
+}
+
+func (repository *postgresRepository) HasPurchased(ctx context.Context, accountId, productId string) (bool, error) {
+	var count int64
+	err := repository.db.WithContext(ctx).
+		Model(&models.ProductsInfo{}).
+		Joins("JOIN orders ON orders.id = order_products.order_id").
+		Where("orders.account_id = ? AND order_products.product_id = ?", accountId, productId).
+		Where("orders.status = ?", models.OrderStatusDelivered).
+		Count(&count).Error
+	if err != nil {
+		return false, err
 	}
+	return count > 0, nil
+}
 
-	return orders, nil
+// backfillAmounts fills in the amounts of orders saved before discounts and
+// minor units existed from their decimal total
+func backfillAmounts(order *models.Order) {
+	if order.Currency == "" {
+		order.Currency = money.DefaultCurrency
+	}
+	if order.Subtotal == 0 {
+		order.Subtotal = order.TotalPrice
+	}
+	if order.TotalMinor == 0 && order.TotalPrice != 0 {
+		order.SubtotalMinor = money.FromFloat(order.Subtotal, order.Currency).Amount
+		order.DiscountTotalMinor = money.FromFloat(order.DiscountTotal, order.Currency).Amount
+		order.TotalMinor = money.FromFloat(order.TotalPrice, order.Currency).Amount
+	}
+	for i := range order.Discounts {
+		if order.Discounts[i].AmountMinor == 0 {
+			order.Discounts[i].AmountMinor = money.FromFloat(order.Discounts[i].Amount, order.Currency).Amount
+		}
+	}
 }
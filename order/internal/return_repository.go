@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+var (
+	ErrReturnNotFound = errors.New("return not found")
+	// ErrReturnStatusChanged means the return was updated by someone else
+	// between reading it and updating it
+	ErrReturnStatusChanged = errors.New("the return status was changed concurrently")
+)
+
+// PutReturn saves the return as long as the returns of its line that were not
+// rejected add up to at most returnable units. The order is locked meanwhile
+// so concurrent returns cannot add up to more. The message built from the
+// saved return, which has its ID, is put in the outbox in the same
+// transaction.
+func (repository *postgresRepository) PutReturn(ctx context.Context, orderReturn *models.OrderReturn, returnable int, message func(*models.OrderReturn) (outbox.Message, error)) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&order, orderReturn.OrderID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var returned int64
+		err = tx.Model(&models.OrderReturn{}).
+			Select("COALESCE(SUM(quantity), 0)").
+			Where("order_id = ? AND product_id = ? AND status <> ?", orderReturn.OrderID, orderReturn.ProductID, models.ReturnRejected).
+			Scan(&returned).Error
+		if err != nil {
+			return err
+		}
+		if int(returned)+orderReturn.Quantity > returnable {
+			return ErrReturnQuantity
+		}
+
+		if err = tx.Create(orderReturn).Error; err != nil {
+			return err
+		}
+		created, err := message(orderReturn)
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, created)
+	})
+}
+
+func (repository *postgresRepository) GetReturn(ctx context.Context, id uint) (*models.OrderReturn, error) {
+	var orderReturn models.OrderReturn
+	err := repository.db.WithContext(ctx).First(&orderReturn, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &orderReturn, nil
+}
+
+// ClaimReturnRefund moves the received return to REFUNDING, so a single call
+// refunds it. A return left REFUNDING since before stalledBefore, by a call
+// that died half way, is claimed again. ErrReturnStatusChanged is returned
+// when the return cannot be claimed.
+func (repository *postgresRepository) ClaimReturnRefund(ctx context.Context, id uint, now, stalledBefore time.Time) error {
+	result := repository.db.WithContext(ctx).Model(&models.OrderReturn{}).
+		Where("id = ? AND (status = ? OR status = ? AND updated_at < ?)", id, models.ReturnReceived, models.ReturnRefunding, stalledBefore).
+		Updates(map[string]interface{}{
+			"status":     models.ReturnRefunding,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReturnStatusChanged
+	}
+	return nil
+}
+
+// UpdateReturn applies the updates to the return as long as it is still in
+// status from, and puts the messages in the outbox in the same transaction
+func (repository *postgresRepository) UpdateReturn(ctx context.Context, id uint, from string, updates map[string]interface{}, messages []outbox.Message) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.OrderReturn{}).
+			Where("id = ? AND status = ?", id, from).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrReturnStatusChanged
+		}
+		return outbox.Enqueue(tx, messages...)
+	})
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+)
+
+func (server *grpcServer) RequestReturn(ctx context.Context, request *pb.RequestReturnRequest) (*pb.ReturnResponse, error) {
+	callerID, _, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderReturn, err := server.service.RequestReturn(
+		ctx,
+		uint(request.GetOrderId()),
+		strconv.Itoa(callerID),
+		request.GetProductId(),
+		int(request.GetQuantity()),
+		request.GetReason(),
+		request.GetComment(),
+	)
+	if err != nil {
+		log.Println("Error requesting return:", err)
+		return nil, returnError(err)
+	}
+	return &pb.ReturnResponse{OrderReturn: returnToProto(orderReturn)}, nil
+}
+
+func (server *grpcServer) ReviewReturn(ctx context.Context, request *pb.ReviewReturnRequest) (*pb.ReturnResponse, error) {
+	actor, err := sellerActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderReturn, err := server.service.ReviewReturn(ctx, uint(request.GetReturnId()), request.GetApprove(), request.GetReason(), actor)
+	if err != nil {
+		log.Println("Error reviewing return:", err)
+		return nil, returnError(err)
+	}
+	return &pb.ReturnResponse{OrderReturn: returnToProto(orderReturn)}, nil
+}
+
+func (server *grpcServer) ShipReturn(ctx context.Context, request *pb.ShipReturnRequest) (*pb.ReturnResponse, error) {
+	callerID, _, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderReturn, err := server.service.ShipReturn(ctx, uint(request.GetReturnId()), strconv.Itoa(callerID), request.GetCarrier(), request.GetTrackingNumber())
+	if err != nil {
+		log.Println("Error shipping return:", err)
+		return nil, returnError(err)
+	}
+	return &pb.ReturnResponse{OrderReturn: returnToProto(orderReturn)}, nil
+}
+
+func (server *grpcServer) ReceiveReturn(ctx context.Context, request *pb.ReceiveReturnRequest) (*pb.ReturnResponse, error) {
+	actor, err := sellerActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderReturn, err := server.service.ReceiveReturn(ctx, uint(request.GetReturnId()), request.GetRestock(), actor)
+	if err != nil {
+		log.Println("Error receiving return:", err)
+		return nil, returnError(err)
+	}
+	return &pb.ReturnResponse{OrderReturn: returnToProto(orderReturn)}, nil
+}
+
+func returnError(err error) error {
+	switch {
+	case errors.Is(err, ErrReturnNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidReturnReason), errors.Is(err, ErrReturnCommentTooLong), errors.Is(err, ErrMissingRejectionReason),
+		errors.Is(err, ErrUnknownCarrier), errors.Is(err, ErrMissingTrackingNumber), errors.Is(err, ErrProductNotOrdered):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotReturnOwner), errors.Is(err, ErrNotReturnSeller):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrOrderNotReturnable), errors.Is(err, ErrReturnWindowClosed), errors.Is(err, ErrReturnQuantity),
+		errors.Is(err, ErrInvalidReturnTransition):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrReturnStatusChanged), errors.Is(err, ErrReturnRefundInProgress):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return statusError(err)
+}
+
+func returnToProto(orderReturn *models.OrderReturn) *pb.OrderReturn {
+	returnProto := &pb.OrderReturn{
+		Id:              uint64(orderReturn.ID),
+		OrderId:         uint64(orderReturn.OrderID),
+		AccountId:       orderReturn.AccountID,
+		SellerId:        int64(orderReturn.SellerID),
+		ProductId:       orderReturn.ProductID,
+		Quantity:        uint32(orderReturn.Quantity),
+		Reason:          orderReturn.Reason,
+		Comment:         orderReturn.Comment,
+		Status:          orderReturn.Status,
+		RejectionReason: orderReturn.RejectionReason,
+		Carrier:         orderReturn.Carrier,
+		TrackingNumber:  orderReturn.TrackingNumber,
+		Refund:          moneyToProto(orderReturn.RefundMoney()),
+		Restocked:       orderReturn.Restocked,
+	}
+	returnProto.CreatedAt, _ = orderReturn.CreatedAt.MarshalBinary()
+	if orderReturn.ShippedAt != nil {
+		returnProto.ShippedAt, _ = orderReturn.ShippedAt.MarshalBinary()
+	}
+	if orderReturn.ReceivedAt != nil {
+		returnProto.ReceivedAt, _ = orderReturn.ReceivedAt.MarshalBinary()
+	}
+	if orderReturn.RefundedAt != nil {
+		returnProto.RefundedAt, _ = orderReturn.RefundedAt.MarshalBinary()
+	}
+	return returnProto
+}
@@ -0,0 +1,356 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+const (
+	// How long after its delivery the products of an order can be returned
+	returnWindow           = 30 * 24 * time.Hour
+	maxReturnCommentLength = 500
+	// A refund claimed this long ago belongs to a call that died, receiving
+	// the return again takes it over
+	stalledRefundAge = time.Minute
+)
+
+var (
+	ErrNotReturnOwner          = errors.New("only the customer who placed the order can return its products")
+	ErrOrderNotReturnable      = errors.New("only delivered orders can be returned")
+	ErrReturnWindowClosed      = errors.New("the return window of the order is closed")
+	ErrProductNotOrdered       = errors.New("the product is not part of the order")
+	ErrReturnQuantity          = errors.New("the quantity exceeds the units left to return")
+	ErrInvalidReturnReason     = errors.New("unknown return reason")
+	ErrReturnCommentTooLong    = errors.New("the return comment is too long")
+	ErrMissingRejectionReason  = errors.New("a reason is required to reject a return")
+	ErrNotReturnSeller         = errors.New("only admins and the seller of the product can handle its returns")
+	ErrInvalidReturnTransition = errors.New("the return cannot move to this status")
+	ErrReturnRefundInProgress  = errors.New("the return is already being refunded")
+)
+
+// RequestReturn lets the customer send back units of a line of their order,
+// within the return window of the delivered order. The refund is the price
+// paid for the units, after discounts and with their taxes.
+func (service orderService) RequestReturn(ctx context.Context, orderId uint, accountId, productId string, quantity int, reason, comment string) (*models.OrderReturn, error) {
+	reason = strings.ToUpper(strings.TrimSpace(reason))
+	comment = strings.TrimSpace(comment)
+	if !models.ReturnReasons[reason] {
+		return nil, ErrInvalidReturnReason
+	}
+	if len(comment) > maxReturnCommentLength {
+		return nil, ErrReturnCommentTooLong
+	}
+	if quantity <= 0 {
+		return nil, ErrReturnQuantity
+	}
+
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return nil, err
+	}
+	if order.AccountID != accountId {
+		return nil, ErrNotReturnOwner
+	}
+	if order.Status != models.OrderStatusDelivered {
+		return nil, ErrOrderNotReturnable
+	}
+	now := time.Now().UTC()
+	if deliveredAt, ok := deliveryTime(order); ok && now.After(deliveredAt.Add(returnWindow)) {
+		return nil, ErrReturnWindowClosed
+	}
+
+	var line *models.OrderLine
+	for _, orderLine := range order.Lines() {
+		if orderLine.Product.ID == productId {
+			line = &orderLine
+			break
+		}
+	}
+	if line == nil {
+		return nil, ErrProductNotOrdered
+	}
+	ordered := int(line.Product.Quantity)
+	returned := 0
+	for _, orderReturn := range order.Returns {
+		if orderReturn.ProductID == productId && orderReturn.Status != models.ReturnRejected {
+			returned += orderReturn.Quantity
+		}
+	}
+	if returned+quantity > ordered {
+		return nil, ErrReturnQuantity
+	}
+
+	// The refund is the share of the line total of the units returned so
+	// far, less what the earlier returns refund, so returning every unit
+	// refunds the whole line
+	before := line.Total.Fraction(float64(returned), float64(ordered), money.RoundDown)
+	after := line.Total.Fraction(float64(returned+quantity), float64(ordered), money.RoundDown)
+
+	orderReturn := &models.OrderReturn{
+		OrderID:     order.ID,
+		AccountID:   order.AccountID,
+		SellerID:    line.Product.SellerID,
+		ProductID:   productId,
+		Quantity:    quantity,
+		Reason:      reason,
+		Comment:     comment,
+		Status:      models.ReturnRequested,
+		RefundMinor: after.Amount - before.Amount,
+		Currency:    order.Currency,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err = service.repository.PutReturn(ctx, orderReturn, ordered, returnEventMessage); err != nil {
+		return nil, err
+	}
+	return orderReturn, nil
+}
+
+// ReviewReturn lets the seller approve a requested return, or reject it with
+// a reason
+func (service orderService) ReviewReturn(ctx context.Context, returnId uint, approve bool, reason string, actor StatusActor) (*models.OrderReturn, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxReturnCommentLength {
+		return nil, ErrReturnCommentTooLong
+	}
+	if !approve && reason == "" {
+		return nil, ErrMissingRejectionReason
+	}
+	orderReturn, err := service.returnForSeller(ctx, returnId, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	status, updates := models.ReturnApproved, map[string]interface{}{}
+	if !approve {
+		status = models.ReturnRejected
+		orderReturn.RejectionReason = reason
+		updates["rejection_reason"] = reason
+	}
+	if err = service.moveReturn(ctx, orderReturn, status, updates); err != nil {
+		return nil, err
+	}
+	return orderReturn, nil
+}
+
+// ShipReturn records the parcel the customer sends the approved return in
+func (service orderService) ShipReturn(ctx context.Context, returnId uint, accountId, carrier, trackingNumber string) (*models.OrderReturn, error) {
+	carrier = strings.ToUpper(strings.TrimSpace(carrier))
+	trackingNumber = strings.TrimSpace(trackingNumber)
+	if _, ok := models.Carriers[carrier]; !ok {
+		return nil, ErrUnknownCarrier
+	}
+	if trackingNumber == "" {
+		return nil, ErrMissingTrackingNumber
+	}
+
+	orderReturn, err := service.repository.GetReturn(ctx, returnId)
+	if err != nil {
+		return nil, err
+	}
+	if orderReturn.AccountID != accountId {
+		return nil, ErrNotReturnOwner
+	}
+
+	now := time.Now().UTC()
+	orderReturn.Carrier = carrier
+	orderReturn.TrackingNumber = trackingNumber
+	orderReturn.ShippedAt = &now
+	err = service.moveReturn(ctx, orderReturn, models.ReturnShipped, map[string]interface{}{
+		"carrier":         carrier,
+		"tracking_number": trackingNumber,
+		"shipped_at":      now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orderReturn, nil
+}
+
+// ReceiveReturn records that the seller got the units back: they are put in
+// stock again when restock is set, a credit note is issued for them and their
+// price is refunded. The refund is claimed first, so concurrent calls do not
+// refund twice. A return whose refund failed goes back to RECEIVED, receiving
+// it again retries the refund.
+func (service orderService) ReceiveReturn(ctx context.Context, returnId uint, restock bool, actor StatusActor) (*models.OrderReturn, error) {
+	orderReturn, err := service.returnForSeller(ctx, returnId, actor)
+	if err != nil {
+		return nil, err
+	}
+	if orderReturn.Status != models.ReturnReceived && orderReturn.Status != models.ReturnRefunding {
+		now := time.Now().UTC()
+		orderReturn.ReceivedAt = &now
+		orderReturn.Restocked = restock
+		err = service.moveReturn(ctx, orderReturn, models.ReturnReceived, map[string]interface{}{
+			"received_at": now,
+			"restocked":   restock,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	err = service.repository.ClaimReturnRefund(ctx, orderReturn.ID, now, now.Add(-stalledRefundAge))
+	if errors.Is(err, ErrReturnStatusChanged) {
+		return nil, ErrReturnRefundInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	orderReturn.Status = models.ReturnRefunding
+	orderReturn.UpdatedAt = now
+
+	if err = service.refundClaimedReturn(ctx, orderReturn); err != nil {
+		// Given back to be received again, the provider does not refund the
+		// same return twice
+		releaseErr := service.repository.UpdateReturn(context.WithoutCancel(ctx), orderReturn.ID, models.ReturnRefunding, map[string]interface{}{
+			"status":     models.ReturnReceived,
+			"updated_at": time.Now().UTC(),
+		}, nil)
+		if releaseErr != nil {
+			log.Printf("Failed to release the refund of return %d: %v", orderReturn.ID, releaseErr)
+		}
+		return nil, err
+	}
+
+	now = time.Now().UTC()
+	orderReturn.RefundedAt = &now
+	if err = service.moveReturn(ctx, orderReturn, models.ReturnRefunded, map[string]interface{}{"refunded_at": now}); err != nil {
+		return nil, err
+	}
+	return orderReturn, nil
+}
+
+// refundClaimedReturn restocks, credits and refunds the return once its
+// refund is claimed
+func (service orderService) refundClaimedReturn(ctx context.Context, orderReturn *models.OrderReturn) error {
+	// The product service restocks a return once, a retry restocks nothing
+	if orderReturn.Restocked {
+		if err := service.stock.RestockReturn(ctx, orderReturn); err != nil {
+			return err
+		}
+	}
+	order, err := service.repository.GetOrder(ctx, orderReturn.OrderID)
+	if err != nil {
+		return err
+	}
+	// Credited before the refund, which may refund the whole order and
+	// credit what is left of it
+	if err = service.creditReturn(ctx, order, orderReturn); err != nil {
+		return err
+	}
+	return service.refundReturn(ctx, order, orderReturn)
+}
+
+// refundReturn gives the refund of the return back on the captured payments
+// of the order. Each refund carries the reference of the return, so one that
+// reached the provider before a failure is not made again by a retry. Once
+// every payment is given back in full the order is REFUNDED.
+func (service orderService) refundReturn(ctx context.Context, order *models.Order, orderReturn *models.OrderReturn) error {
+	left := orderReturn.RefundMinor
+	for i := range order.Payments {
+		intent := &order.Payments[i]
+		if left == 0 {
+			break
+		}
+		if intent.Status != models.PaymentCaptured {
+			continue
+		}
+		part := min(left, intent.AmountMinor-intent.RefundedMinor)
+		if part <= 0 {
+			continue
+		}
+		result, err := service.gateway.Refund(ctx, intent.ProviderRef, returnRefundReference(orderReturn.ID), money.New(part, intent.Currency))
+		if err != nil {
+			return err
+		}
+		// The provider tells what was given back in all, a refund it already
+		// had is not counted twice
+		if err = service.applyRefund(ctx, intent, result.RefundedMinor); err != nil {
+			return err
+		}
+		left -= part
+	}
+	return nil
+}
+
+// returnRefundReference is the reference of the refund of a return
+func returnRefundReference(returnId uint) string {
+	return fmt.Sprintf("return-%d", returnId)
+}
+
+// returnForSeller returns the return as long as the actor may handle it
+func (service orderService) returnForSeller(ctx context.Context, returnId uint, actor StatusActor) (*models.OrderReturn, error) {
+	orderReturn, err := service.repository.GetReturn(ctx, returnId)
+	if err != nil {
+		return nil, err
+	}
+	switch actor.Role {
+	case ActorAdmin, ActorSystem:
+	case ActorSeller:
+		if strconv.Itoa(orderReturn.SellerID) != actor.AccountID {
+			return nil, ErrNotReturnSeller
+		}
+	default:
+		return nil, ErrNotReturnSeller
+	}
+	return orderReturn, nil
+}
+
+// moveReturn saves the new status of the return with its event
+func (service orderService) moveReturn(ctx context.Context, orderReturn *models.OrderReturn, status string, updates map[string]interface{}) error {
+	if !models.CanReturnTransition(orderReturn.Status, status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidReturnTransition, orderReturn.Status, status)
+	}
+	from := orderReturn.Status
+	orderReturn.Status = status
+	orderReturn.UpdatedAt = time.Now().UTC()
+	updates["status"] = status
+	updates["updated_at"] = orderReturn.UpdatedAt
+
+	message, err := returnEventMessage(orderReturn)
+	if err != nil {
+		return err
+	}
+	return service.repository.UpdateReturn(ctx, orderReturn.ID, from, updates, []outbox.Message{message})
+}
+
+// returnEventMessage is an event of the return_events topic, keyed by the
+// order ID
+func returnEventMessage(orderReturn *models.OrderReturn) (outbox.Message, error) {
+	return outbox.NewMessage("return_events", strconv.Itoa(int(orderReturn.OrderID)), models.ReturnEvent{
+		Type: "return_" + strings.ToLower(orderReturn.Status),
+		Data: models.ReturnEventData{
+			ReturnID:    orderReturn.ID,
+			OrderID:     orderReturn.OrderID,
+			AccountID:   orderReturn.AccountID,
+			SellerID:    orderReturn.SellerID,
+			ProductID:   orderReturn.ProductID,
+			Quantity:    orderReturn.Quantity,
+			Reason:      orderReturn.Reason,
+			Status:      orderReturn.Status,
+			RefundMinor: orderReturn.RefundMinor,
+			Currency:    orderReturn.Currency,
+		},
+	})
+}
+
+// deliveryTime returns when the order was delivered
+func deliveryTime(order *models.Order) (time.Time, bool) {
+	for i := len(order.StatusHistory) - 1; i >= 0; i-- {
+		if order.StatusHistory[i].ToStatus == models.OrderStatusDelivered {
+			return order.StatusHistory[i].CreatedAt, true
+		}
+	}
+	return time.Time{}, false
+}
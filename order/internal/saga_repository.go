@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+var (
+	ErrSagaNotFound = errors.New("checkout saga not found")
+	// ErrSagaStepChanged means the saga was moved on by someone else between
+	// reading it and updating it
+	ErrSagaStepChanged = errors.New("the checkout saga step was changed concurrently")
+)
+
+// GetSaga returns the checkout saga of the order. Orders placed before
+// checkouts were sagas have none.
+func (repository *postgresRepository) GetSaga(ctx context.Context, orderId uint) (*models.CheckoutSaga, error) {
+	var saga models.CheckoutSaga
+	err := repository.db.WithContext(ctx).Where("order_id = ?", orderId).First(&saga).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &saga, nil
+}
+
+// AdvanceSaga moves the saga of the order from one step to the next with the
+// other column updates, as long as it is still at step from. The messages are
+// put in the outbox in the same transaction, only when the saga moves.
+func (repository *postgresRepository) AdvanceSaga(ctx context.Context, orderId uint, from, to string, updates map[string]interface{}, messages ...outbox.Message) error {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["step"] = to
+	updates["updated_at"] = time.Now().UTC()
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CheckoutSaga{}).
+			Where("order_id = ? AND step = ?", orderId, from).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSagaStepChanged
+		}
+		return outbox.Enqueue(tx, messages...)
+	})
+}
+
+// ListStalledSagas returns the sagas waiting for a payment past their
+// deadline, and those stuck at a step that has not moved since stalledBefore
+func (repository *postgresRepository) ListStalledSagas(ctx context.Context, now, stalledBefore time.Time) ([]models.CheckoutSaga, error) {
+	var sagas []models.CheckoutSaga
+	running := []string{models.SagaReserveStock, models.SagaAuthorizePayment, models.SagaConfirmOrder, models.SagaCompensating}
+	err := repository.db.WithContext(ctx).
+		Where("step = ? AND payment_deadline < ?", models.SagaAwaitPayment, now).
+		Or("step IN ? AND updated_at < ?", running, stalledBefore).
+		Order("updated_at").
+		Find(&sagas).Error
+	if err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+// The checkout of an order is a saga orchestrated by the order service:
+//
+//	RESERVE_STOCK -> AWAIT_PAYMENT -> AUTHORIZE_PAYMENT -> CONFIRM_ORDER -> COMPLETED
+//
+// PostOrder reserves the stock, PayOrder authorizes and captures the payment
+// and confirms the order. A failed payment goes back to AWAIT_PAYMENT so the
+// customer can try again. When the stock runs out or the payment is late the
+// saga is compensated:
+//
+//	COMPENSATING -> COMPENSATED
+//
+// the order is cancelled, its payments voided or refunded and its stock
+// released. The step is saved before it runs and every step can be run
+// twice, so RunSagas resumes the sagas left halfway by a crash or a restart.
+
+const (
+	stockTimeout = 5 * time.Second
+	// A step that has not moved for this long is taken over by the saga
+	// runner, the call running it is gone
+	stalledSagaAge = time.Minute
+)
+
+var ErrPaymentInProgress = errors.New("the order is already being paid")
+
+// reserveStock runs the first step of the checkout of a new order. When the
+// stock cannot be reserved the checkout is compensated and the error returned.
+// The purchase events are only sent once the stock is held, with the move to
+// AWAIT_PAYMENT.
+func (service orderService) reserveStock(ctx context.Context, order *models.Order) error {
+	messages, err := purchaseMessages(order)
+	if err != nil {
+		return err
+	}
+
+	reserveCtx, cancel := context.WithTimeout(ctx, stockTimeout)
+	err = service.stock.ReserveStock(reserveCtx, order)
+	cancel()
+	if err != nil {
+		reason := "the stock could not be reserved"
+		if errors.Is(err, ErrOutOfStock) {
+			reason = err.Error()
+		}
+		if compensateErr := service.compensate(ctx, order.ID, models.SagaReserveStock, reason); compensateErr != nil {
+			log.Printf("Failed to compensate the checkout of order %d: %v", order.ID, compensateErr)
+		}
+		return err
+	}
+
+	if err = service.repository.AdvanceSaga(ctx, order.ID, models.SagaReserveStock, models.SagaAwaitPayment, nil, messages...); err != nil {
+		// The stock is held, the saga runner moves the checkout on
+		log.Printf("Failed to move the checkout of order %d on: %v", order.ID, err)
+	}
+	return nil
+}
+
+// startPayment moves the checkout of the order to its payment, so the order
+// is not paid twice at once. It reports false for the orders placed before
+// checkouts were sagas, they are paid without one.
+func (service orderService) startPayment(ctx context.Context, orderId uint) (bool, error) {
+	err := service.repository.AdvanceSaga(ctx, orderId, models.SagaAwaitPayment, models.SagaAuthorizePayment, nil)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, ErrSagaStepChanged) {
+		return false, err
+	}
+
+	saga, err := service.repository.GetSaga(ctx, orderId)
+	if errors.Is(err, ErrSagaNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if saga.Step == models.SagaAuthorizePayment {
+		return false, ErrPaymentInProgress
+	}
+	return false, ErrOrderNotPayable
+}
+
+// finishPayment moves the checkout on once the payment is over: a paid order
+// is confirmed, otherwise the customer can pay again until the deadline.
+// Failures are only logged, the saga runner resumes the step.
+func (service orderService) finishPayment(ctx context.Context, orderId uint, paid bool) {
+	if !paid {
+		if err := service.repository.AdvanceSaga(ctx, orderId, models.SagaAuthorizePayment, models.SagaAwaitPayment, nil); err != nil {
+			log.Printf("Failed to reopen the payment of order %d: %v", orderId, err)
+		}
+		return
+	}
+
+	if err := service.repository.AdvanceSaga(ctx, orderId, models.SagaAuthorizePayment, models.SagaConfirmOrder, nil); err != nil {
+		log.Printf("Failed to move the checkout of order %d on: %v", orderId, err)
+		return
+	}
+	if err := service.confirmOrder(ctx, orderId); err != nil {
+		log.Printf("Failed to confirm order %d: %v", orderId, err)
+	}
+}
+
+// confirmOrder makes sure the paid order is PAID and completes its checkout.
+// An order cancelled while it was being paid is compensated instead, which
+// refunds the payment.
+func (service orderService) confirmOrder(ctx context.Context, orderId uint) error {
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	switch order.Status {
+	case models.OrderStatusCancelled, models.OrderStatusRefunded:
+		return service.compensate(ctx, orderId, models.SagaConfirmOrder, "cancelled while being paid")
+	case models.OrderStatusPending:
+		if err = service.moveOrder(ctx, orderId, models.OrderStatusPaid, ""); err != nil {
+			return err
+		}
+	}
+	return service.repository.AdvanceSaga(ctx, orderId, models.SagaConfirmOrder, models.SagaCompleted, nil)
+}
+
+// resumePayment finishes a payment left halfway: an authorized payment is
+// captured, one that never reached the provider is given up
+func (service orderService) resumePayment(ctx context.Context, orderId uint) error {
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return err
+	}
+
+	paid := order.Status != models.OrderStatusPending
+	for i := range order.Payments {
+		intent := &order.Payments[i]
+		switch intent.Status {
+		case models.PaymentCaptured:
+			paid = true
+		case models.PaymentAuthorized:
+			if err = service.capturePayment(ctx, intent); err != nil {
+				log.Printf("Failed to capture payment %d: %v", intent.ID, err)
+			} else {
+				paid = true
+			}
+		case models.PaymentRequiresAction:
+			service.failPayment(ctx, intent, "interrupted")
+		}
+	}
+	service.finishPayment(ctx, orderId, paid)
+	return nil
+}
+
+// compensate gives the checkout of the order up, the saga is moved from step
+// from to COMPENSATING first. The order is cancelled before its payments are
+// voided so a payment landing meanwhile cannot pay it; an order that was paid
+// anyway completes its checkout instead.
+func (service orderService) compensate(ctx context.Context, orderId uint, from, reason string) error {
+	if from != models.SagaCompensating {
+		err := service.repository.AdvanceSaga(ctx, orderId, from, models.SagaCompensating, map[string]interface{}{
+			"failure_reason": reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	switch order.Status {
+	case models.OrderStatusPending:
+		if err = service.cancelCheckout(ctx, order, reason); err != nil {
+			return err
+		}
+	case models.OrderStatusCancelled, models.OrderStatusRefunded:
+	default:
+		return service.repository.AdvanceSaga(ctx, orderId, models.SagaCompensating, models.SagaCompleted, nil)
+	}
+
+	if err = service.refundPayments(ctx, order); err != nil {
+		return err
+	}
+	if err = service.stock.ReleaseStock(ctx, order); err != nil {
+		return err
+	}
+	return service.repository.AdvanceSaga(ctx, orderId, models.SagaCompensating, models.SagaCompensated, nil)
+}
+
+// cancelCheckout cancels the pending order on behalf of the order service
+func (service orderService) cancelCheckout(ctx context.Context, order *models.Order, reason string) error {
+	change := models.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   models.OrderStatusCancelled,
+		Note:       reason,
+		CreatedAt:  time.Now().UTC(),
+	}
+	order.Status = models.OrderStatusCancelled
+	order.CancellationReason = reason
+	order.StatusHistory = append(order.StatusHistory, change)
+
+	message, err := orderEventMessage("order_cancelled", order)
+	if err != nil {
+		return err
+	}
+	return service.repository.CancelOrder(ctx, change, reason, []outbox.Message{message})
+}
+
+// ResumeSagas takes over the checkouts that stopped moving and gives up those
+// whose payment is late
+func (service orderService) ResumeSagas(ctx context.Context, now time.Time) error {
+	sagas, err := service.repository.ListStalledSagas(ctx, now, now.Add(-stalledSagaAge))
+	if err != nil {
+		return err
+	}
+	for _, saga := range sagas {
+		err = service.resumeSaga(ctx, saga)
+		// A step changed meanwhile was moved on by someone else
+		if err != nil && !errors.Is(err, ErrSagaStepChanged) {
+			log.Printf("Failed to resume the checkout of order %d at %s: %v", saga.OrderID, saga.Step, err)
+		}
+	}
+	return nil
+}
+
+func (service orderService) resumeSaga(ctx context.Context, saga models.CheckoutSaga) error {
+	switch saga.Step {
+	case models.SagaReserveStock:
+		order, err := service.repository.GetOrder(ctx, saga.OrderID)
+		if err != nil {
+			return err
+		}
+		return service.reserveStock(ctx, order)
+	case models.SagaAwaitPayment:
+		return service.compensate(ctx, saga.OrderID, saga.Step, "the order was not paid in time")
+	case models.SagaAuthorizePayment:
+		return service.resumePayment(ctx, saga.OrderID)
+	case models.SagaConfirmOrder:
+		return service.confirmOrder(ctx, saga.OrderID)
+	case models.SagaCompensating:
+		return service.compensate(ctx, saga.OrderID, saga.Step, saga.FailureReason)
+	}
+	return nil
+}
+
+// RunSagas resumes the stalled checkouts every interval until ctx is
+// cancelled, including those left by a previous run of the service
+func RunSagas(ctx context.Context, service Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := service.ResumeSagas(ctx, now.UTC()); err != nil {
+				log.Println("Failed to resume checkout sagas:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+)
+
+func (server *grpcServer) GetOrdersForSeller(ctx context.Context, request *pb.GetOrdersForSellerRequest) (*pb.GetOrdersForSellerResponse, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin && int64(callerID) != request.GetSellerId() {
+		return nil, status.Errorf(codes.PermissionDenied, "cannot access the orders of another seller")
+	}
+
+	query, err := orderQueryFromProto(request.GetFirst(), request.GetAfter(), request.GetFilter(), request.GetSort())
+	if err != nil {
+		return nil, err
+	}
+	page, err := server.service.GetOrdersForSeller(ctx, int(request.GetSellerId()), query)
+	if err != nil {
+		log.Println("Error getting orders for seller:", err)
+		return nil, orderQueryError(err)
+	}
+
+	// The lines of a seller always have a snapshot, it holds the seller
+	response := &pb.GetOrdersForSellerResponse{
+		EndCursor:   page.EndCursor,
+		HasNextPage: page.HasNextPage,
+		TotalCount:  uint64(page.TotalCount),
+	}
+	for i := range page.Orders {
+		response.Orders = append(response.Orders, orderToProto(&page.Orders[i]))
+	}
+	return response, nil
+}
@@ -2,15 +2,21 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	account "github.com/thomas/EcommerceAPI/account/client"
 	"github.com/thomas/EcommerceAPI/order/models"
 	"github.com/thomas/EcommerceAPI/order/proto/pb"
+	"github.com/thomas/EcommerceAPI/pkg/money"
 	product "github.com/thomas/EcommerceAPI/product/client"
+	productmodels "github.com/thomas/EcommerceAPI/product/models"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -64,80 +70,133 @@ func (server *grpcServer) PostOrder(ctx context.Context, request *pb.PostOrderRe
 		return nil, err
 	}
 
-	// Create a map to aggregate quantities for duplicate product IDs
-	productQuantities := make(map[string]uint32)
-	var uniqueProductIDs []string
+	productQuantities, uniqueProductIDs := aggregateProducts(request.Products)
+	address := addressFromProto(request.GetShippingAddress())
 
-	// Aggregate quantities and collect unique product IDs
-	for _, p := range request.Products {
-		productQuantities[p.Id] += p.Quantity
-
-		// Only add to uniqueProductIDs if we haven't seen this ID before
-		found := false
-		for _, id := range uniqueProductIDs {
-			if id == p.Id {
-				found = true
-				break
+	// A retried request gets the order the first attempt placed
+	var idempotencyKey *models.IdempotencyKey
+	if request.IdempotencyKey != "" {
+		idempotencyKey = &models.IdempotencyKey{
+			AccountID:   request.AccountId,
+			Key:         request.IdempotencyKey,
+			RequestHash: OrderRequestHash(productQuantities, request.CouponCode, request.Currency, address),
+		}
+		replayed, err := server.service.ReplayOrder(ctx, *idempotencyKey)
+		if err != nil {
+			log.Println("Error replaying order:", err)
+			return nil, idempotencyError(err)
+		}
+		if replayed != nil {
+			if err = server.decorateOrder(ctx, replayed); err != nil {
+				return nil, err
 			}
+			return &pb.PostOrderResponse{Order: orderToProto(replayed)}, nil
 		}
-		if !found {
+	}
+
+	products, lineErrors, err := server.orderedProducts(ctx, productQuantities, uniqueProductIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(lineErrors) > 0 {
+		return nil, lineErrorsStatus(lineErrors)
+	}
+
+	postOrder, err := server.service.PostOrder(ctx, request.AccountId, products, request.CouponCode, request.Currency, address, idempotencyKey)
+	if errors.Is(err, ErrInvalidAddress) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if isCouponError(err) || errors.Is(err, ErrOutOfStock) || errors.Is(err, ErrNoShippingRate) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if isIdempotencyError(err) {
+		return nil, idempotencyError(err)
+	}
+	if err != nil {
+		log.Println("Error posting postOrder", err)
+		return nil, err
+	}
+
+	return &pb.PostOrderResponse{
+		Order: orderToProto(postOrder),
+	}, nil
+}
+
+// aggregateProducts adds up the quantities of the products ordered more than
+// once, and returns their IDs in the order they first appear
+func aggregateProducts(requested []*pb.OrderProduct) (map[string]uint32, []string) {
+	productQuantities := make(map[string]uint32)
+	var uniqueProductIDs []string
+	for _, p := range requested {
+		if _, found := productQuantities[p.Id]; !found {
 			uniqueProductIDs = append(uniqueProductIDs, p.Id)
 		}
+		productQuantities[p.Id] += p.Quantity
 	}
+	return productQuantities, uniqueProductIDs
+}
 
-	// Get product details from the product service
-	orderedProducts, err := server.productClient.GetProducts(ctx, 0, 0, uniqueProductIDs, "")
+// orderedProducts gets the details of the products from the product service,
+// with their aggregated quantities. The lines that cannot be ordered are left
+// out and returned as line errors, in the order of the request.
+func (server *grpcServer) orderedProducts(ctx context.Context, productQuantities map[string]uint32, uniqueProductIDs []string) ([]*models.OrderedProduct, []models.LineError, error) {
+	orderedProducts, err := server.productClient.GetProductsForService(ctx, uniqueProductIDs)
 	if err != nil {
 		log.Println("Error getting ordered products", err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	var products []*models.OrderedProduct
-	totalPrice := 0.0
-
-	// Create ordered products with aggregated quantities
+	found := make(map[string]productmodels.Product, len(orderedProducts))
 	for _, p := range orderedProducts {
-		quantity, exists := productQuantities[p.ID]
-		if exists && quantity > 0 {
-			productObj := &models.OrderedProduct{
+		// Drafts and archived products cannot be ordered
+		if p.IsPublic() {
+			found[p.ID] = p
+		}
+	}
+
+	var products []*models.OrderedProduct
+	var lineErrors []models.LineError
+	for _, id := range uniqueProductIDs {
+		p, exists := found[id]
+		quantity := productQuantities[id]
+		switch {
+		case !exists:
+			lineErrors = append(lineErrors, models.LineError{ProductID: id, Code: models.LineErrorUnknownProduct, Message: "the product does not exist or cannot be ordered"})
+		case quantity > models.MaxLineQuantity:
+			lineErrors = append(lineErrors, models.LineError{ProductID: id, Code: models.LineErrorQuantityLimit, Message: fmt.Sprintf("at most %d units can be ordered", models.MaxLineQuantity)})
+		case p.Stock != nil && int64(quantity) > *p.Stock:
+			lineErrors = append(lineErrors, models.LineError{ProductID: id, Code: models.LineErrorOutOfStock, Message: fmt.Sprintf("only %d units left", *p.Stock)})
+		case quantity > 0:
+			products = append(products, &models.OrderedProduct{
 				ID:          p.ID,
 				Name:        p.Name,
 				Description: p.Description,
 				Price:       p.Price,
+				Currency:    p.Currency,
 				Quantity:    quantity,
-			}
-
-			products = append(products, productObj)
-			totalPrice += productObj.Price * float64(productObj.Quantity)
+				SellerID:    p.AccountID,
+				Category:    p.Category,
+				WeightGrams: p.WeightGrams,
+				TaxCategory: p.TaxCategory,
+			})
 		}
 	}
+	return products, lineErrors, nil
+}
 
-	postOrder, err := server.service.PostOrder(ctx, request.AccountId, totalPrice, products)
-	if err != nil {
-		log.Println("Error posting postOrder", err)
-		return nil, err
-	}
-
-	orderProto := &pb.Order{
-		Id:         uint64(postOrder.ID),
-		AccountId:  postOrder.AccountID,
-		TotalPrice: postOrder.TotalPrice,
-		Products:   []*pb.ProductInfo{},
-	}
-	orderProto.CreatedAt, _ = postOrder.CreatedAt.MarshalBinary()
-	for _, p := range postOrder.Products {
-		orderProto.Products = append(orderProto.Products, &pb.ProductInfo{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    p.Quantity,
-		})
+// lineErrorsStatus refuses an order with line errors. It fails with
+// FAILED_PRECONDITION when only the stock is missing, the request is wrong
+// otherwise.
+func lineErrorsStatus(lineErrors []models.LineError) error {
+	code := codes.FailedPrecondition
+	messages := make([]string, len(lineErrors))
+	for i, lineError := range lineErrors {
+		if lineError.Code != models.LineErrorOutOfStock {
+			code = codes.InvalidArgument
+		}
+		messages[i] = lineError.Error()
 	}
-
-	return &pb.PostOrderResponse{
-		Order: orderProto,
-	}, nil
+	return status.Error(code, strings.Join(messages, "; "))
 }
 
 func (server *grpcServer) GetOrdersForAccount(ctx context.Context, request *pb.GetOrdersForAccountRequest) (*pb.GetOrdersForAccountResponse, error) {
@@ -159,63 +218,252 @@ func (server *grpcServer) GetOrdersForAccount(ctx context.Context, request *pb.G
 		return nil, status.Errorf(codes.PermissionDenied, "cannot access another user's orders")
 	}
 
-	accountOrders, err := server.service.GetOrdersForAccount(ctx, request.AccountId)
+	query, err := orderQueryFromProto(request.GetFirst(), request.GetAfter(), request.GetFilter(), request.GetSort())
 	if err != nil {
-		log.Println("Error getting orders for account:", err)
 		return nil, err
 	}
+	page, err := server.service.GetOrdersForAccount(ctx, request.AccountId, query)
+	if err != nil {
+		log.Println("Error getting orders for account:", err)
+		return nil, orderQueryError(err)
+	}
+	accountOrders := page.Orders
 
-	// Taking unique products. We use set to avoid repeating
+	// Taking unique products of the lines saved without a snapshot. We use
+	// set to avoid repeating
 	productIDsSet := mapset.NewSet[string]()
 	for _, o := range accountOrders {
 		for _, p := range o.Products {
-			productIDsSet.Add(p.ID)
+			if !p.Snapshot {
+				productIDsSet.Add(p.ID)
+			}
 		}
 	}
 
-	productIDs := productIDsSet.ToSlice()
-
-	products, err := server.productClient.GetProducts(ctx, 0, 0, productIDs, "")
-	if err != nil {
-		log.Println("Error getting account products: ", err)
-		return nil, err
+	var products []productmodels.Product
+	if productIDsSet.Cardinality() > 0 {
+		products, err = server.productClient.GetProductsForService(ctx, productIDsSet.ToSlice())
+		if err != nil {
+			log.Println("Error getting account products: ", err)
+			return nil, err
+		}
 	}
 
 	// Collecting orders
 
 	var orders []*pb.Order
 	for _, order := range accountOrders {
-		// Encode order
-		encodedOrder := &pb.Order{
-			AccountId:  order.AccountID,
-			Id:         uint64(order.ID),
-			TotalPrice: order.TotalPrice,
-			Products:   []*pb.ProductInfo{},
+		decorateProducts(&order, products)
+		orders = append(orders, orderToProto(&order))
+	}
+	return &pb.GetOrdersForAccountResponse{
+		Orders:      orders,
+		EndCursor:   page.EndCursor,
+		HasNextPage: page.HasNextPage,
+		TotalCount:  uint64(page.TotalCount),
+	}, nil
+}
+
+// GetOrder returns an order to its owner or to an admin
+func (server *grpcServer) GetOrder(ctx context.Context, request *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderID, err := strconv.ParseUint(request.GetId(), 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid order ID")
+	}
+
+	order, err := server.service.GetOrder(ctx, uint(orderID))
+	if err != nil {
+		log.Println("Error getting order:", err)
+		return nil, statusError(err)
+	}
+	if !isAdmin && order.AccountID != strconv.Itoa(callerID) {
+		return nil, status.Errorf(codes.PermissionDenied, "cannot access another user's orders")
+	}
+	if err = server.decorateOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	return &pb.GetOrderResponse{Order: orderToProto(order)}, nil
+}
+
+func orderQueryFromProto(first uint32, after string, filter *pb.OrderFilter, sort string) (models.OrderQuery, error) {
+	query := models.OrderQuery{
+		Sort:  sort,
+		First: int(first),
+		After: after,
+	}
+	if filter == nil {
+		return query, nil
+	}
+	query.Filter = models.OrderFilter{
+		Statuses:  filter.GetStatuses(),
+		MinTotal:  filter.GetMinTotal(),
+		MaxTotal:  filter.GetMaxTotal(),
+		ProductID: filter.GetProductId(),
+		Currency:  filter.GetCurrency(),
+	}
+	if len(filter.GetCreatedAfter()) > 0 {
+		query.Filter.CreatedAfter = &time.Time{}
+		if err := query.Filter.CreatedAfter.UnmarshalBinary(filter.GetCreatedAfter()); err != nil {
+			return query, status.Errorf(codes.InvalidArgument, "invalid createdAfter")
 		}
-		encodedOrder.CreatedAt, _ = order.CreatedAt.MarshalBinary()
-
-		// Decorate orders with products
-		for _, orderedProduct := range order.Products {
-			// Populate product fields
-			for _, prod := range products {
-				if prod.ID == orderedProduct.ID {
-					orderedProduct.Name = prod.Name
-					orderedProduct.Description = prod.Description
-					orderedProduct.Price = prod.Price
-					break
+	}
+	if len(filter.GetCreatedBefore()) > 0 {
+		query.Filter.CreatedBefore = &time.Time{}
+		if err := query.Filter.CreatedBefore.UnmarshalBinary(filter.GetCreatedBefore()); err != nil {
+			return query, status.Errorf(codes.InvalidArgument, "invalid createdBefore")
+		}
+	}
+	return query, nil
+}
+
+func orderQueryError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrInvalidOrderSort), errors.Is(err, ErrInvalidOrderStatus),
+		errors.Is(err, ErrSellerTotalFilter), errors.Is(err, ErrMixedCurrencyTotals), errors.Is(err, money.ErrInvalidCurrency):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+// decorateProducts fills in the name, description and price of the products
+// of the order that were saved without a snapshot
+func decorateProducts(order *models.Order, products []productmodels.Product) {
+	for _, orderedProduct := range order.Products {
+		if orderedProduct.Snapshot {
+			continue
+		}
+		// Populate product fields
+		for _, prod := range products {
+			if prod.ID == orderedProduct.ID {
+				orderedProduct.Name = prod.Name
+				orderedProduct.Description = prod.Description
+				orderedProduct.Price = prod.Price
+				orderedProduct.Currency = prod.Currency
+				orderedProduct.SellerID = prod.AccountID
+				// Shown in the order currency, at the rate of the checkout
+				if rate, ok := order.LockedRate(prod.Currency); ok {
+					orderedProduct.Price = prod.PriceMoney().Convert(rate, order.Currency).Float()
+					orderedProduct.Currency = order.Currency
 				}
+				break
 			}
+		}
+	}
+}
 
-			encodedOrder.Products = append(encodedOrder.Products, &pb.ProductInfo{
-				Id:          orderedProduct.ID,
-				Name:        orderedProduct.Name,
-				Description: orderedProduct.Description,
-				Price:       orderedProduct.Price,
-				Quantity:    orderedProduct.Quantity,
-			})
+func (server *grpcServer) HasPurchased(ctx context.Context, request *pb.HasPurchasedRequest) (*pb.HasPurchasedResponse, error) {
+	purchased, err := server.service.HasPurchased(ctx, request.AccountId, request.ProductId)
+	if err != nil {
+		log.Println("Error checking purchase:", err)
+		return nil, err
+	}
+	return &pb.HasPurchasedResponse{Purchased: purchased}, nil
+}
+
+func orderToProto(order *models.Order) *pb.Order {
+	orderProto := &pb.Order{
+		Id:            uint64(order.ID),
+		AccountId:     order.AccountID,
+		TotalPrice:    order.TotalPrice,
+		Subtotal:      order.Subtotal,
+		DiscountTotal: order.DiscountTotal,
+		CouponCode:    order.CouponCode,
+		Status:        order.Status,
+		Products:      []*pb.ProductInfo{},
+	}
+	orderProto.CreatedAt, _ = order.CreatedAt.MarshalBinary()
+	orderProto.CancellationReason = order.CancellationReason
+	orderProto.SubtotalMoney = moneyToProto(order.SubtotalMoney())
+	orderProto.DiscountTotalMoney = moneyToProto(order.DiscountTotalMoney())
+	orderProto.TotalMoney = moneyToProto(order.TotalMoney())
+	orderProto.ShippingAddress = addressToProto(order.ShippingAddress)
+	orderProto.ShippingTotalMoney = moneyToProto(order.ShippingTotalMoney())
+	for i := range order.Shipments {
+		orderProto.Shipments = append(orderProto.Shipments, shipmentToProto(&order.Shipments[i]))
+	}
+	orderProto.TaxTotalMoney = moneyToProto(order.TaxTotalMoney())
+	for _, tax := range order.Taxes {
+		orderProto.Taxes = append(orderProto.Taxes, taxToProto(tax, order.Currency))
+	}
+	for i := range order.Returns {
+		orderProto.Returns = append(orderProto.Returns, returnToProto(&order.Returns[i]))
+	}
+	for i := range order.Invoices {
+		orderProto.Invoices = append(orderProto.Invoices, invoiceToProto(&order.Invoices[i]))
+	}
+	for _, p := range order.Products {
+		orderProto.Products = append(orderProto.Products, &pb.ProductInfo{
+			Id:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    p.Quantity,
+			PriceMoney:  moneyToProto(p.PriceMoney()),
+			Variant:     p.Variant,
+			SellerId:    int64(p.SellerID),
+		})
+	}
+	for _, r := range order.ExchangeRates {
+		orderProto.ExchangeRates = append(orderProto.ExchangeRates, &pb.ExchangeRate{
+			From: r.FromCurrency,
+			To:   r.ToCurrency,
+			Rate: r.Rate,
+		})
+	}
+	for _, change := range order.StatusHistory {
+		changeProto := &pb.OrderStatusChange{
+			From:      change.FromStatus,
+			To:        change.ToStatus,
+			ChangedBy: change.ChangedBy,
+			Note:      change.Note,
+		}
+		changeProto.ChangedAt, _ = change.CreatedAt.MarshalBinary()
+		orderProto.StatusHistory = append(orderProto.StatusHistory, changeProto)
+	}
+	for _, intent := range order.Payments {
+		intentProto := &pb.PaymentIntent{
+			Id:            uint64(intent.ID),
+			Provider:      intent.Provider,
+			ProviderRef:   intent.ProviderRef,
+			Amount:        moneyToProto(intent.AmountMoney()),
+			Status:        intent.Status,
+			FailureReason: intent.FailureReason,
+			Refunded:      moneyToProto(intent.RefundedMoney()),
 		}
+		intentProto.CreatedAt, _ = intent.CreatedAt.MarshalBinary()
+		orderProto.Payments = append(orderProto.Payments, intentProto)
+	}
+	for _, d := range order.Discounts {
+		orderProto.Discounts = append(orderProto.Discounts, discountToProto(d, order.Currency))
+	}
+	return orderProto
+}
+
+func discountToProto(d models.OrderDiscount, currency string) *pb.OrderDiscount {
+	return &pb.OrderDiscount{
+		ProductId:   d.ProductID,
+		PromotionId: uint64(d.PromotionID),
+		Code:        d.Code,
+		Amount:      d.Amount,
+		AmountMoney: moneyToProto(money.New(d.AmountMinor, currency)),
+	}
+}
 
-		orders = append(orders, encodedOrder)
+func taxToProto(tax models.OrderTax, currency string) *pb.OrderTax {
+	return &pb.OrderTax{
+		ProductId: tax.ProductID,
+		Name:      tax.Name,
+		Rate:      tax.Rate,
+		Inclusive: tax.Inclusive,
+		Taxable:   moneyToProto(money.New(tax.TaxableMinor, currency)),
+		Amount:    moneyToProto(money.New(tax.AmountMinor, currency)),
 	}
-	return &pb.GetOrdersForAccountResponse{Orders: orders}, nil
+}
+
+func moneyToProto(m money.Money) *pb.Money {
+	return &pb.Money{Amount: m.Amount, Currency: m.Currency}
 }
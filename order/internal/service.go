@@ -2,69 +2,384 @@ package internal
 
 import (
 	"context"
-	"github.com/IBM/sarama"
+	"errors"
 	"log"
 	"strconv"
 	"time"
 
 	"github.com/thomas/EcommerceAPI/order/models"
-	"github.com/thomas/EcommerceAPI/pkg/utils"
+	"github.com/thomas/EcommerceAPI/pkg/blob"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+	"github.com/thomas/EcommerceAPI/pkg/payment"
+)
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrInvalidOrderSort = errors.New("invalid order sort")
+	// The orders of a seller only show the part the seller handles
+	ErrSellerTotalFilter   = errors.New("the orders of a seller cannot be filtered by total")
+	ErrMixedCurrencyTotals = errors.New("the orders are in several currencies, pick one to sort or filter on totals")
 )
 
 type Service interface {
-	PostOrder(ctx context.Context, accountID string, totalPrice float64, products []*models.OrderedProduct) (*models.Order, error)
-	GetOrdersForAccount(ctx context.Context, accountID string) ([]models.Order, error)
+	PostOrder(ctx context.Context, accountID string, products []*models.OrderedProduct, couponCode, currency string, address models.Address, idempotencyKey *models.IdempotencyKey) (*models.Order, error)
+	QuoteOrder(ctx context.Context, accountID string, products []*models.OrderedProduct, couponCode, currency string, address models.Address) (*models.Order, error)
+	ReplayOrder(ctx context.Context, key models.IdempotencyKey) (*models.Order, error)
+	GetOrdersForAccount(ctx context.Context, accountID string, query models.OrderQuery) (*models.OrderPage, error)
+	GetOrdersForSeller(ctx context.Context, sellerID int, query models.OrderQuery) (*models.OrderPage, error)
+	HasPurchased(ctx context.Context, accountID, productID string) (bool, error)
+
+	GetOrder(ctx context.Context, id uint) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, orderId uint, status, note string, actor StatusActor) (*models.Order, error)
+	CancelOrder(ctx context.Context, orderId uint, accountId, reason string) (*models.Order, error)
+	PayOrder(ctx context.Context, orderId uint, accountId, paymentMethod string) (*models.Order, error)
+	HandlePaymentEvent(ctx context.Context, event payment.Event) (bool, error)
+	ShipShipment(ctx context.Context, shipmentId uint, carrier, trackingNumber string, actor StatusActor) (*models.Shipment, error)
+	UpdateShipmentStatus(ctx context.Context, shipmentId uint, status string, actor StatusActor) (*models.Shipment, error)
+	RequestReturn(ctx context.Context, orderId uint, accountId, productId string, quantity int, reason, comment string) (*models.OrderReturn, error)
+	ReviewReturn(ctx context.Context, returnId uint, approve bool, reason string, actor StatusActor) (*models.OrderReturn, error)
+	ShipReturn(ctx context.Context, returnId uint, accountId, carrier, trackingNumber string) (*models.OrderReturn, error)
+	ReceiveReturn(ctx context.Context, returnId uint, restock bool, actor StatusActor) (*models.OrderReturn, error)
+	GetInvoiceDocument(ctx context.Context, invoiceId uint, format string, callerID int, isAdmin bool) (*models.InvoiceDocument, error)
+	ResumeSagas(ctx context.Context, now time.Time) error
+	ReissueDocuments(ctx context.Context, now time.Time) error
+
+	CreatePromotion(ctx context.Context, promotion models.Promotion, callerID int, isAdmin bool) (*models.Promotion, error)
+	GetPromotions(ctx context.Context, callerID int, isAdmin bool) ([]models.Promotion, error)
 }
 
+// orderService publishes its events through the outbox of the repository,
+// see outbox.Relay
 type orderService struct {
 	repository Repository
-	producer   sarama.AsyncProducer
-}
+	rates      money.RateProvider
+	stock      StockReservations
+	gateway    payment.PaymentGateway
+	shipping   ShippingCalculator
+	taxes      TaxCalculator
+	// Where the documents of the invoices are kept
+	documents blob.Store
 
-func NewOrderService(repository Repository, producer sarama.AsyncProducer) Service {
-	return &orderService{repository, producer}
+	// How long a checkout waits for its payment
+	paymentTimeout time.Duration
 }
 
-func (service orderService) Producer() sarama.AsyncProducer {
-	return service.producer
+func NewOrderService(repository Repository, rates money.RateProvider, stock StockReservations, gateway payment.PaymentGateway, shipping ShippingCalculator, taxes TaxCalculator, documents blob.Store, paymentTimeout time.Duration) Service {
+	return &orderService{repository, rates, stock, gateway, shipping, taxes, documents, paymentTimeout}
 }
 
-func (service orderService) PostOrder(ctx context.Context, accountID string, totalPrice float64, products []*models.OrderedProduct) (*models.Order, error) {
-	order := models.Order{
-		AccountID:  accountID,
-		TotalPrice: totalPrice,
-		Products:   products,
-		CreatedAt:  time.Now().UTC(),
+// PostOrder prices the products in the order currency, applies the coupon if
+// one is given, taxes the lines and saves the order. Without a currency the
+// order is in the currency of its first product. The products are split in
+// one shipment per seller, whose shipping costs are added to the total. With
+// an idempotency key, the key is claimed first and linked to the saved order;
+// it is released if the order fails. The stock of the products is then
+// reserved for the order, which waits for its payment, see saga_service.go.
+func (service orderService) PostOrder(ctx context.Context, accountID string, products []*models.OrderedProduct, couponCode, currency string, address models.Address, idempotencyKey *models.IdempotencyKey) (_ *models.Order, err error) {
+	now := time.Now().UTC()
+
+	address, err = normalizeAddress(address)
+	if err != nil {
+		return nil, err
 	}
-	err := service.repository.PutOrder(ctx, &order)
+
+	if idempotencyKey != nil {
+		if err = service.claimIdempotencyKey(ctx, idempotencyKey, now); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			if releaseErr := service.repository.DeleteIdempotencyKey(ctx, idempotencyKey.ID); releaseErr != nil {
+				log.Println("Failed to release idempotency key:", releaseErr)
+			}
+		}()
+	}
+
+	order, promotion, err := service.priceOrder(ctx, accountID, products, couponCode, currency, address, now)
+	if err != nil {
+		return nil, err
+	}
+	order.Status = models.OrderStatusPending
+	order.StatusHistory = []models.OrderStatusChange{{
+		ToStatus:  models.OrderStatusPending,
+		ChangedBy: accountID,
+		CreatedAt: now,
+	}}
+	order.CreatedAt = now
+	order.Saga = &models.CheckoutSaga{
+		Step:            models.SagaReserveStock,
+		PaymentDeadline: now.Add(service.paymentTimeout),
+	}
+	err = service.repository.PutOrder(ctx, order, promotion, idempotencyKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// Send to recommendation service
-	go func() {
-		accountIdInt, err := strconv.Atoi(accountID)
+	// The order is saved first so a crash while reserving leaves a saga to
+	// resume. When the stock runs out the order is cancelled, which gives its
+	// coupon back, and its key released, a retry places a new order.
+	if err = service.reserveStock(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// QuoteOrder prices the order PostOrder would place for the products, with
+// its discounts, shipments and taxes, without placing it. Without products,
+// e.g. when none of them can be ordered, the quote is empty.
+func (service orderService) QuoteOrder(ctx context.Context, accountID string, products []*models.OrderedProduct, couponCode, currency string, address models.Address) (*models.Order, error) {
+	address, err := normalizeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		if err = money.ValidateCurrency(currency); err != nil {
+			return nil, err
+		}
+		return &models.Order{
+			AccountID:       accountID,
+			Currency:        money.NormalizeCurrency(currency),
+			ShippingAddress: address,
+		}, nil
+	}
+	order, _, err := service.priceOrder(ctx, accountID, products, couponCode, currency, address, time.Now().UTC())
+	return order, err
+}
+
+// priceOrder prices an order of the products shipped to the address, and
+// returns it unsaved with the promotion of the coupon
+func (service orderService) priceOrder(ctx context.Context, accountID string, products []*models.OrderedProduct, couponCode, currency string, address models.Address, now time.Time) (*models.Order, *models.Promotion, error) {
+	if currency == "" && len(products) > 0 {
+		currency = products[0].Currency
+	}
+	if err := money.ValidateCurrency(currency); err != nil {
+		return nil, nil, err
+	}
+	currency = money.NormalizeCurrency(currency)
+	rates, err := service.convertPrices(ctx, products, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var promotion *models.Promotion
+	if couponCode != "" {
+		promotion, err = service.repository.GetPromotionByCode(ctx, normalizeCode(couponCode))
 		if err != nil {
-			log.Println("Failed to convert account ID to int:", err)
-			return
+			return nil, nil, err
+		}
+		if !promotion.IsActive(now) {
+			return nil, nil, ErrPromotionExpired
 		}
-		for _, product := range products {
-			err = utils.SendMessageToRecommender(service, models.Event{
-				Type: "purchase",
-				EventData: models.EventData{
-					AccountId: accountIdInt,
-					ProductId: product.ID,
-				},
-			}, "interaction_events")
-			if err != nil {
-				log.Println("Failed to send event to recommendation service:", err)
+	}
+
+	pricing, err := PriceOrder(products, promotion)
+	if err != nil {
+		return nil, nil, err
+	}
+	shipments, shippingTotal, err := service.planShipments(ctx, products, address, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	taxes, taxTotal, exclusiveTax, err := service.taxOrder(ctx, products, pricing, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	total, err := pricing.Total.Add(shippingTotal)
+	if err != nil {
+		return nil, nil, err
+	}
+	if total, err = total.Add(exclusiveTax); err != nil {
+		return nil, nil, err
+	}
+
+	order := &models.Order{
+		AccountID:          accountID,
+		Currency:           currency,
+		SubtotalMinor:      pricing.Subtotal.Amount,
+		DiscountTotalMinor: pricing.DiscountTotal.Amount,
+		TotalMinor:         total.Amount,
+		Subtotal:           pricing.Subtotal.Float(),
+		DiscountTotal:      pricing.DiscountTotal.Float(),
+		TotalPrice:         total.Float(),
+		Products:           products,
+		Discounts:          pricing.Discounts,
+		ExchangeRates:      rates,
+	}
+	if promotion != nil {
+		order.CouponCode = promotion.Code
+	}
+	order.ShippingAddress = address
+	order.ShippingTotalMinor = shippingTotal.Amount
+	order.Shipments = shipments
+	order.TaxTotalMinor = taxTotal.Amount
+	order.Taxes = taxes
+	return order, promotion, nil
+}
+
+// purchaseMessages are the purchase events of the products of an order, sent
+// to the recommendation service and keyed by the order ID
+func purchaseMessages(order *models.Order) ([]outbox.Message, error) {
+	accountIdInt, err := strconv.Atoi(order.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	var messages []outbox.Message
+	for _, product := range order.Products {
+		message, err := outbox.NewMessage("interaction_events", strconv.Itoa(int(order.ID)), models.Event{
+			Type: "purchase",
+			EventData: models.EventData{
+				AccountId: accountIdInt,
+				ProductId: product.ID,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// convertPrices converts the prices of the products into the order currency
+// and returns the rates it used, one per currency, to be kept with the order
+func (service orderService) convertPrices(ctx context.Context, products []*models.OrderedProduct, currency string) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	locked := map[string]float64{}
+	for _, product := range products {
+		from := money.NormalizeCurrency(product.Currency)
+		if from == currency {
+			continue
+		}
+		rate, ok := locked[from]
+		if !ok {
+			var err error
+			if rate, err = service.rates.Rate(ctx, from, currency); err != nil {
+				return nil, err
 			}
+			locked[from] = rate
+			rates = append(rates, models.ExchangeRate{FromCurrency: from, ToCurrency: currency, Rate: rate})
+		}
+		converted := product.PriceMoney().Convert(rate, currency)
+		product.Price = converted.Float()
+		product.Currency = currency
+	}
+	return rates, nil
+}
+
+// GetOrdersForAccount returns a page of the orders of the account, newest
+// first unless another sort is asked for. Totals are compared in minor units
+// of one currency: the currency of the filter, or the only one the orders of
+// the account are in.
+func (service orderService) GetOrdersForAccount(ctx context.Context, accountID string, query models.OrderQuery) (*models.OrderPage, error) {
+	if query.Filter.Currency != "" {
+		if err := money.ValidateCurrency(query.Filter.Currency); err != nil {
+			return nil, err
+		}
+		query.Filter.Currency = money.NormalizeCurrency(query.Filter.Currency)
+	}
+	byTotal := query.Sort == models.OrderSortTotalAsc || query.Sort == models.OrderSortTotalDesc ||
+		query.Filter.MinTotal != 0 || query.Filter.MaxTotal != 0
+	if byTotal && query.Filter.Currency == "" {
+		currencies, err := service.repository.GetOrderCurrencies(ctx, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if len(currencies) > 1 {
+			return nil, ErrMixedCurrencyTotals
+		}
+		if len(currencies) == 1 {
+			query.Filter.Currency = currencies[0]
+		}
+	}
+	return service.pageOrders(query, func(query models.OrderQuery, limit int, afterID uint) ([]models.Order, int64, error) {
+		return service.repository.GetOrdersForAccount(ctx, accountID, query.Filter, query.Sort, limit, afterID)
+	})
+}
+
+// GetOrdersForSeller returns a page of the orders holding products of the
+// seller, newest first unless another sort is asked for. Each order only
+// keeps the part the seller handles, see Order.ForSeller. The totals of the
+// orders are those the customers paid, so they cannot be sorted or filtered
+// on.
+func (service orderService) GetOrdersForSeller(ctx context.Context, sellerID int, query models.OrderQuery) (*models.OrderPage, error) {
+	if query.Sort == models.OrderSortTotalAsc || query.Sort == models.OrderSortTotalDesc {
+		return nil, ErrInvalidOrderSort
+	}
+	if query.Filter.MinTotal != 0 || query.Filter.MaxTotal != 0 {
+		return nil, ErrSellerTotalFilter
+	}
+	page, err := service.pageOrders(query, func(query models.OrderQuery, limit int, afterID uint) ([]models.Order, int64, error) {
+		return service.repository.GetOrdersForSeller(ctx, sellerID, query.Filter, query.Sort, limit, afterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Orders {
+		page.Orders[i] = page.Orders[i].ForSeller(sellerID)
+	}
+	return page, nil
+}
+
+// pageOrders checks the query and lists its page with list, which is given
+// the query with its default sort, how many orders to return at most and the
+// ID of the order of the cursor
+func (service orderService) pageOrders(query models.OrderQuery, list func(query models.OrderQuery, limit int, afterID uint) ([]models.Order, int64, error)) (*models.OrderPage, error) {
+	first := query.First
+	if first <= 0 {
+		first = defaultOrderPageSize
+	}
+	if first > maxOrderPageSize {
+		first = maxOrderPageSize
+	}
+
+	switch query.Sort {
+	case "":
+		query.Sort = models.OrderSortNewest
+	case models.OrderSortNewest, models.OrderSortOldest, models.OrderSortTotalAsc, models.OrderSortTotalDesc:
+	default:
+		return nil, ErrInvalidOrderSort
+	}
+	for _, status := range query.Filter.Statuses {
+		if !models.IsOrderStatus(status) {
+			return nil, ErrInvalidOrderStatus
+		}
+	}
+
+	var afterID uint
+	if query.After != "" {
+		var ok bool
+		if afterID, ok = models.ParseOrderCursor(query.After); !ok {
+			return nil, ErrInvalidCursor
 		}
-	}()
+	}
 
-	return &order, nil
+	// One more order than asked for tells whether there is a next page
+	orders, total, err := list(query, first+1, afterID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.OrderPage{Orders: orders, TotalCount: total}
+	if len(orders) > first {
+		page.Orders = orders[:first]
+		page.HasNextPage = true
+	}
+	if len(page.Orders) > 0 {
+		page.EndCursor = models.OrderCursor(page.Orders[len(page.Orders)-1].ID)
+	}
+	return page, nil
 }
 
-func (service orderService) GetOrdersForAccount(ctx context.Context, accountID string) ([]models.Order, error) {
-	return service.repository.GetOrdersForAccount(ctx, accountID)
+// HasPurchased reports whether the account has a delivered order containing
+// the product
+func (service orderService) HasPurchased(ctx context.Context, accountID, productID string) (bool, error) {
+	return service.repository.HasPurchased(ctx, accountID, productID)
 }
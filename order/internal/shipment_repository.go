@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+var (
+	ErrShipmentNotFound = errors.New("shipment not found")
+	// ErrShipmentStatusChanged means the shipment was updated by someone else
+	// between reading it and updating it
+	ErrShipmentStatusChanged = errors.New("the shipment status was changed concurrently")
+)
+
+func (repository *postgresRepository) GetShipment(ctx context.Context, id uint) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := repository.db.WithContext(ctx).Preload("Items").First(&shipment, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+// UpdateShipment applies the updates to the shipment as long as it is still
+// in status from, and puts the messages in the outbox in the same transaction
+func (repository *postgresRepository) UpdateShipment(ctx context.Context, id uint, from string, updates map[string]interface{}, messages []outbox.Message) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Shipment{}).
+			Where("id = ? AND status = ?", id, from).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrShipmentStatusChanged
+		}
+		return outbox.Enqueue(tx, messages...)
+	})
+}
+
+// preloadShipments loads the shipments of orders with their items
+func preloadShipments(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Shipments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Preload("Shipments.Items")
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+)
+
+func (server *grpcServer) ShipShipment(ctx context.Context, request *pb.ShipShipmentRequest) (*pb.ShipmentResponse, error) {
+	actor, err := sellerActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shipment, err := server.service.ShipShipment(ctx, uint(request.GetShipmentId()), request.GetCarrier(), request.GetTrackingNumber(), actor)
+	if err != nil {
+		log.Println("Error shipping shipment:", err)
+		return nil, shipmentError(err)
+	}
+	return &pb.ShipmentResponse{Shipment: shipmentToProto(shipment)}, nil
+}
+
+func (server *grpcServer) UpdateShipmentStatus(ctx context.Context, request *pb.UpdateShipmentStatusRequest) (*pb.ShipmentResponse, error) {
+	actor, err := sellerActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shipment, err := server.service.UpdateShipmentStatus(ctx, uint(request.GetShipmentId()), request.GetStatus(), actor)
+	if err != nil {
+		log.Println("Error updating shipment status:", err)
+		return nil, shipmentError(err)
+	}
+	return &pb.ShipmentResponse{Shipment: shipmentToProto(shipment)}, nil
+}
+
+// sellerActor is the caller as an admin, or as a seller whose ownership of
+// the shipment or return is checked by the service
+func sellerActor(ctx context.Context) (StatusActor, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return StatusActor{}, err
+	}
+	actor := StatusActor{AccountID: strconv.Itoa(callerID), Role: ActorSeller}
+	if isAdmin {
+		actor.Role = ActorAdmin
+	}
+	return actor, nil
+}
+
+func shipmentError(err error) error {
+	switch {
+	case errors.Is(err, ErrShipmentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrUnknownCarrier), errors.Is(err, ErrMissingTrackingNumber), errors.Is(err, ErrInvalidShipmentStatus):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotShipmentSeller):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrInvalidShipmentTransition), errors.Is(err, ErrOrderNotShippable):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrShipmentStatusChanged):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return statusError(err)
+}
+
+func shipmentToProto(shipment *models.Shipment) *pb.Shipment {
+	shipmentProto := &pb.Shipment{
+		Id:             uint64(shipment.ID),
+		OrderId:        uint64(shipment.OrderID),
+		SellerId:       int64(shipment.SellerID),
+		Cost:           moneyToProto(shipment.CostMoney()),
+		WeightGrams:    shipment.WeightGrams,
+		Status:         shipment.Status,
+		Carrier:        shipment.Carrier,
+		TrackingNumber: shipment.TrackingNumber,
+	}
+	for _, item := range shipment.Items {
+		shipmentProto.Items = append(shipmentProto.Items, &pb.ShipmentItem{
+			ProductId: item.ProductID,
+			Quantity:  uint32(item.Quantity),
+		})
+	}
+	if shipment.ShippedAt != nil {
+		shipmentProto.ShippedAt, _ = shipment.ShippedAt.MarshalBinary()
+	}
+	if shipment.DeliveredAt != nil {
+		shipmentProto.DeliveredAt, _ = shipment.DeliveredAt.MarshalBinary()
+	}
+	shipmentProto.CreatedAt, _ = shipment.CreatedAt.MarshalBinary()
+	return shipmentProto
+}
+
+func addressToProto(address models.Address) *pb.Address {
+	return &pb.Address{
+		Name:       address.Name,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+	}
+}
+
+func addressFromProto(address *pb.Address) models.Address {
+	return models.Address{
+		Name:       address.GetName(),
+		Line1:      address.GetLine1(),
+		Line2:      address.GetLine2(),
+		City:       address.GetCity(),
+		Region:     address.GetRegion(),
+		PostalCode: address.GetPostalCode(),
+		Country:    address.GetCountry(),
+	}
+}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/pkg/outbox"
+)
+
+var (
+	ErrUnknownCarrier            = errors.New("unknown carrier")
+	ErrMissingTrackingNumber     = errors.New("a tracking number is required")
+	ErrInvalidShipmentStatus     = errors.New("unknown shipment status")
+	ErrInvalidShipmentTransition = errors.New("the shipment cannot move to this status")
+	ErrNotShipmentSeller         = errors.New("only admins and the seller of the shipment can update it")
+	ErrOrderNotShippable         = errors.New("only paid orders can be shipped")
+)
+
+// Where an order stands in its delivery, the order follows its shipments
+// forward only
+var deliverySteps = map[string]int{
+	models.OrderStatusPaid:      0,
+	models.OrderStatusFulfilled: 1,
+	models.OrderStatusShipped:   2,
+	models.OrderStatusDelivered: 3,
+}
+
+// planShipments splits the products in one shipment per seller, in the order
+// the sellers first appear, and prices each of them in the order currency.
+// Without an address there is no destination to price, the shipments of the
+// order are not charged.
+func (service orderService) planShipments(ctx context.Context, products []*models.OrderedProduct, address models.Address, currency string) ([]models.Shipment, money.Money, error) {
+	total := money.New(0, currency)
+	var shipments []models.Shipment
+	bySeller := map[int]int{}
+	for _, product := range products {
+		i, ok := bySeller[product.SellerID]
+		if !ok {
+			i = len(shipments)
+			bySeller[product.SellerID] = i
+			shipments = append(shipments, models.Shipment{
+				SellerID: product.SellerID,
+				Currency: currency,
+				Status:   models.ShipmentPending,
+			})
+		}
+		shipments[i].Items = append(shipments[i].Items, models.ShipmentItem{
+			ProductID: product.ID,
+			Quantity:  int(product.Quantity),
+		})
+		shipments[i].WeightGrams += product.WeightGrams * int64(product.Quantity)
+	}
+	if address == (models.Address{}) {
+		return shipments, total, nil
+	}
+
+	for i := range shipments {
+		cost, err := service.shipping.Rate(ctx, Parcel{Destination: address, WeightGrams: shipments[i].WeightGrams})
+		if err != nil {
+			return nil, total, err
+		}
+		if cost.Currency != currency {
+			if cost, _, err = money.Convert(ctx, service.rates, cost, currency); err != nil {
+				return nil, total, err
+			}
+		}
+		shipments[i].CostMinor = cost.Amount
+		if total, err = total.Add(cost); err != nil {
+			return nil, total, err
+		}
+	}
+	return shipments, total, nil
+}
+
+// ShipShipment records that the seller handed the shipment to a carrier. A
+// shipment the carrier failed to deliver can be shipped again.
+func (service orderService) ShipShipment(ctx context.Context, shipmentId uint, carrier, trackingNumber string, actor StatusActor) (*models.Shipment, error) {
+	carrier = strings.ToUpper(strings.TrimSpace(carrier))
+	trackingNumber = strings.TrimSpace(trackingNumber)
+	if _, ok := models.Carriers[carrier]; !ok {
+		return nil, ErrUnknownCarrier
+	}
+	if trackingNumber == "" {
+		return nil, ErrMissingTrackingNumber
+	}
+
+	shipment, order, err := service.shipmentForActor(ctx, shipmentId, actor)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := deliverySteps[order.Status]; !ok {
+		return nil, ErrOrderNotShippable
+	}
+	if !models.CanShipmentTransition(shipment.Status, models.ShipmentShipped) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidShipmentTransition, shipment.Status, models.ShipmentShipped)
+	}
+
+	now := time.Now().UTC()
+	shipment.Carrier = carrier
+	shipment.TrackingNumber = trackingNumber
+	shipment.ShippedAt = &now
+	err = service.moveShipment(ctx, shipment, order, models.ShipmentShipped, map[string]interface{}{
+		"carrier":         carrier,
+		"tracking_number": trackingNumber,
+		"shipped_at":      now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// UpdateShipmentStatus follows a shipped parcel until it is delivered, or the
+// carrier gives up on it
+func (service orderService) UpdateShipmentStatus(ctx context.Context, shipmentId uint, status string, actor StatusActor) (*models.Shipment, error) {
+	if !models.IsShipmentStatus(status) {
+		return nil, ErrInvalidShipmentStatus
+	}
+	shipment, order, err := service.shipmentForActor(ctx, shipmentId, actor)
+	if err != nil {
+		return nil, err
+	}
+	// Shipping goes through ShipShipment, which needs the tracking number
+	if status == models.ShipmentShipped || !models.CanShipmentTransition(shipment.Status, status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidShipmentTransition, shipment.Status, status)
+	}
+
+	updates := map[string]interface{}{}
+	if status == models.ShipmentDelivered {
+		now := time.Now().UTC()
+		shipment.DeliveredAt = &now
+		updates["delivered_at"] = now
+	}
+	if err = service.moveShipment(ctx, shipment, order, status, updates); err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// shipmentForActor returns the shipment with its order, as long as the actor
+// may update it
+func (service orderService) shipmentForActor(ctx context.Context, shipmentId uint, actor StatusActor) (*models.Shipment, *models.Order, error) {
+	shipment, err := service.repository.GetShipment(ctx, shipmentId)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch actor.Role {
+	case ActorAdmin, ActorSystem:
+	case ActorSeller:
+		if strconv.Itoa(shipment.SellerID) != actor.AccountID {
+			return nil, nil, ErrNotShipmentSeller
+		}
+	default:
+		return nil, nil, ErrNotShipmentSeller
+	}
+
+	order, err := service.repository.GetOrder(ctx, shipment.OrderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return shipment, order, nil
+}
+
+// moveShipment saves the new status of the shipment with its event, then
+// moves the order along
+func (service orderService) moveShipment(ctx context.Context, shipment *models.Shipment, order *models.Order, status string, updates map[string]interface{}) error {
+	from := shipment.Status
+	shipment.Status = status
+	updates["status"] = status
+	updates["updated_at"] = time.Now().UTC()
+
+	message, err := outbox.NewMessage("shipment_events", strconv.Itoa(int(order.ID)), models.ShipmentEvent{
+		Type: "shipment_" + strings.ToLower(status),
+		Data: models.ShipmentEventData{
+			ShipmentID:     shipment.ID,
+			OrderID:        order.ID,
+			AccountID:      order.AccountID,
+			SellerID:       shipment.SellerID,
+			Status:         status,
+			Carrier:        shipment.Carrier,
+			TrackingNumber: shipment.TrackingNumber,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = service.repository.UpdateShipment(ctx, shipment.ID, from, updates, []outbox.Message{message}); err != nil {
+		return err
+	}
+
+	// The shipment is saved, the order catches up on the next update when
+	// this fails
+	if err = service.followShipments(ctx, order.ID); err != nil {
+		log.Printf("Failed to move order %d along with its shipments: %v", order.ID, err)
+	}
+	return nil
+}
+
+// followShipments moves the order along with its shipments: it is fulfilled
+// once the first one leaves, shipped once they all left and delivered once
+// they all arrived. The stock of a delivered order is sold.
+func (service orderService) followShipments(ctx context.Context, orderId uint) error {
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	current, ok := deliverySteps[order.Status]
+	if !ok || len(order.Shipments) == 0 {
+		return nil
+	}
+
+	left, delivered := 0, 0
+	for _, shipment := range order.Shipments {
+		switch shipment.Status {
+		case models.ShipmentShipped, models.ShipmentInTransit:
+			left++
+		case models.ShipmentDelivered:
+			left++
+			delivered++
+		}
+	}
+	target := models.OrderStatusPaid
+	switch {
+	case delivered == len(order.Shipments):
+		target = models.OrderStatusDelivered
+	case left == len(order.Shipments):
+		target = models.OrderStatusShipped
+	case left > 0:
+		target = models.OrderStatusFulfilled
+	}
+
+	for _, status := range []string{models.OrderStatusFulfilled, models.OrderStatusShipped, models.OrderStatusDelivered} {
+		if deliverySteps[status] <= current || deliverySteps[status] > deliverySteps[target] {
+			continue
+		}
+		if err = service.moveOrder(ctx, order.ID, status, ""); err != nil {
+			return err
+		}
+	}
+	if target == models.OrderStatusDelivered && current < deliverySteps[target] {
+		return service.stock.CommitStock(ctx, order)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+var (
+	ErrNoShippingRate = errors.New("the products cannot be shipped to this address")
+	ErrInvalidAddress = errors.New("a shipping address needs a street, a city and a two-letter country code")
+)
+
+// Parcel is a shipment to price
+type Parcel struct {
+	Destination models.Address
+	WeightGrams int64
+}
+
+// ShippingCalculator prices the shipments of an order at checkout. The price
+// may be in any currency, it is converted into the order currency.
+type ShippingCalculator interface {
+	Rate(ctx context.Context, parcel Parcel) (money.Money, error)
+}
+
+// flatRate charges the same price for every shipment
+type flatRate struct {
+	price money.Money
+}
+
+func NewFlatRate(price money.Money) ShippingCalculator {
+	return &flatRate{price}
+}
+
+func (rate *flatRate) Rate(context.Context, Parcel) (money.Money, error) {
+	return rate.price, nil
+}
+
+// WeightRate is a row of a weight table: parcels up to MaxGrams going to
+// Country cost Price. Rows without a country are used for the countries that
+// have no row of their own.
+type WeightRate struct {
+	Country  string  `json:"country"`
+	MaxGrams int64   `json:"maxGrams"`
+	Price    float64 `json:"price"`
+}
+
+// WeightTable is the JSON file of a weight table, its prices are in Currency
+type WeightTable struct {
+	Currency string       `json:"currency"`
+	Rates    []WeightRate `json:"rates"`
+}
+
+// weightTable charges the cheapest row of the destination that is heavy
+// enough for the parcel
+type weightTable struct {
+	currency string
+	// Lightest first
+	rates []WeightRate
+}
+
+func NewWeightTable(table WeightTable) (ShippingCalculator, error) {
+	if err := money.ValidateCurrency(table.Currency); err != nil {
+		return nil, err
+	}
+	rates := make([]WeightRate, len(table.Rates))
+	for i, rate := range table.Rates {
+		if rate.MaxGrams <= 0 || rate.Price < 0 {
+			return nil, errors.New("weight rates need a positive weight and a price")
+		}
+		rate.Country = strings.ToUpper(rate.Country)
+		rates[i] = rate
+	}
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].MaxGrams < rates[j].MaxGrams
+	})
+	return &weightTable{money.NormalizeCurrency(table.Currency), rates}, nil
+}
+
+// LoadWeightTable reads a weight table from a JSON file
+func LoadWeightTable(path string) (ShippingCalculator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table WeightTable
+	if err = json.Unmarshal(data, &table); err != nil {
+		return nil, err
+	}
+	return NewWeightTable(table)
+}
+
+func (table *weightTable) Rate(_ context.Context, parcel Parcel) (money.Money, error) {
+	country := strings.ToUpper(parcel.Destination.Country)
+	if rate, ok := table.find(country, parcel.WeightGrams); ok {
+		return money.FromFloat(rate.Price, table.currency), nil
+	}
+	if !table.serves(country) {
+		if rate, ok := table.find("", parcel.WeightGrams); ok {
+			return money.FromFloat(rate.Price, table.currency), nil
+		}
+	}
+	return money.Money{}, ErrNoShippingRate
+}
+
+func (table *weightTable) find(country string, weightGrams int64) (WeightRate, bool) {
+	for _, rate := range table.rates {
+		if rate.Country == country && weightGrams <= rate.MaxGrams {
+			return rate, true
+		}
+	}
+	return WeightRate{}, false
+}
+
+// serves reports whether the country has rows of its own
+func (table *weightTable) serves(country string) bool {
+	for _, rate := range table.rates {
+		if country != "" && rate.Country == country {
+			return true
+		}
+	}
+	return false
+}
+
+// NewShippingCalculator returns the weight table of the file, or a flat rate
+// when there is no file
+func NewShippingCalculator(file string, flat float64, currency string) (ShippingCalculator, error) {
+	if file != "" {
+		return LoadWeightTable(file)
+	}
+	if err := money.ValidateCurrency(currency); err != nil {
+		return nil, err
+	}
+	return NewFlatRate(money.FromFloat(flat, money.NormalizeCurrency(currency))), nil
+}
+
+// normalizeAddress trims the address and upper-cases its codes. Orders can be
+// placed without an address, but one that is given must be complete enough
+// to ship to.
+func normalizeAddress(address models.Address) (models.Address, error) {
+	for _, field := range []*string{&address.Name, &address.Line1, &address.Line2, &address.City, &address.Region, &address.PostalCode, &address.Country} {
+		*field = strings.TrimSpace(*field)
+	}
+	address.Region = strings.ToUpper(address.Region)
+	address.Country = strings.ToUpper(address.Country)
+	if address == (models.Address{}) {
+		return address, nil
+	}
+	if address.Line1 == "" || address.City == "" || len(address.Country) != 2 {
+		return address, ErrInvalidAddress
+	}
+	return address, nil
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderStatusChanged means the status was changed by someone else
+	// between reading the order and updating it
+	ErrOrderStatusChanged = errors.New("the order status was changed concurrently")
+)
+
+func (repository *postgresRepository) GetOrder(ctx context.Context, id uint) (*models.Order, error) {
+	var order models.Order
+	err := repository.db.WithContext(ctx).
+		Preload("Discounts").
+		Preload("Taxes").
+		Preload("ExchangeRates").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Preload("Payments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Scopes(preloadShipments).
+		Preload("Returns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Preload("Invoices", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		First(&order, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backfillAmounts(&order)
+	if err = repository.loadProducts(ctx, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdateOrderStatus moves the order from change.FromStatus to change.ToStatus
+// and records the change in its history. Nothing is written if the order is no
+// longer in change.FromStatus.
+func (repository *postgresRepository) UpdateOrderStatus(ctx context.Context, change models.OrderStatusChange) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return transitionOrder(tx, change, map[string]interface{}{})
+	})
+}
+
+// transitionOrder applies a status change and the other column updates with
+// it, as long as the order is still in change.FromStatus. A cancelled order
+// gives back its coupon.
+func transitionOrder(tx *gorm.DB, change models.OrderStatusChange, updates map[string]interface{}) error {
+	updates["status"] = change.ToStatus
+	if change.ToStatus == models.OrderStatusPaid || change.ToStatus == models.OrderStatusRefunded {
+		// Cleared once the documents of the status are issued, see
+		// issueDocuments
+		updates["documents_due_at"] = time.Now().UTC()
+	}
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", change.OrderID, change.FromStatus).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrderStatusChanged
+	}
+	if change.ToStatus == models.OrderStatusCancelled {
+		if err := releasePromotions(tx, change.OrderID); err != nil {
+			return err
+		}
+	}
+	return tx.Create(&change).Error
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/order/proto/pb"
+)
+
+func (server *grpcServer) UpdateOrderStatus(ctx context.Context, request *pb.UpdateOrderStatusRequest) (*pb.UpdateOrderStatusResponse, error) {
+	callerID, isAdmin, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := server.service.GetOrder(ctx, uint(request.GetOrderId()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if err = server.decorateOrder(ctx, order); err != nil {
+		return nil, err
+	}
+
+	// A seller moves the whole order only when every line is theirs, the
+	// sellers of a shared order ship their part with its shipment
+	actor := StatusActor{AccountID: strconv.Itoa(callerID)}
+	sold := soldLines(order, callerID)
+	switch {
+	case isAdmin:
+		actor.Role = ActorAdmin
+	case sold == len(order.Products):
+		actor.Role = ActorSeller
+	case sold > 0:
+		return nil, statusError(ErrSharedOrder)
+	}
+
+	updated, err := server.service.UpdateOrderStatus(ctx, order.ID, request.GetStatus(), request.GetNote(), actor)
+	if err != nil {
+		log.Println("Error updating order status:", err)
+		return nil, statusError(err)
+	}
+	updated.Products = order.Products
+	return &pb.UpdateOrderStatusResponse{Order: orderToProto(updated)}, nil
+}
+
+// decorateOrder fills in the products of a single order that were saved
+// without a snapshot
+func (server *grpcServer) decorateOrder(ctx context.Context, order *models.Order) error {
+	var productIDs []string
+	for _, p := range order.Products {
+		if !p.Snapshot {
+			productIDs = append(productIDs, p.ID)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil
+	}
+	products, err := server.productClient.GetProductsForService(ctx, productIDs)
+	if err != nil {
+		log.Println("Error getting order products:", err)
+		return err
+	}
+	decorateProducts(order, products)
+	return nil
+}
+
+// soldLines counts the lines of the order sold by the account
+func soldLines(order *models.Order, accountID int) int {
+	var sold int
+	for _, p := range order.Products {
+		if p.SellerID == accountID {
+			sold++
+		}
+	}
+	return sold
+}
+
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidOrderStatus):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrStatusNotAllowed), errors.Is(err, ErrNotOrderParticipant), errors.Is(err, ErrSharedOrder):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrInvalidTransition):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrOrderStatusChanged):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+)
+
+var (
+	ErrInvalidOrderStatus  = errors.New("unknown order status")
+	ErrInvalidTransition   = errors.New("the order cannot move to this status")
+	ErrStatusNotAllowed    = errors.New("sellers can only fulfil, ship and deliver orders")
+	ErrNotOrderParticipant = errors.New("only admins and the sellers of the order can change its status")
+	ErrSharedOrder         = errors.New("the order has products of other sellers, ship yours with its shipment")
+)
+
+// Who changes the status of an order
+const (
+	ActorAdmin = "admin"
+	// A seller of one of the products of the order
+	ActorSeller = "seller"
+	// The order service itself, e.g. when a payment succeeds
+	ActorSystem = "system"
+)
+
+type StatusActor struct {
+	AccountID string
+	Role      string
+}
+
+// Statuses a seller may move their orders to, the others are set by admins or
+// by the system
+var sellerStatuses = map[string]bool{
+	models.OrderStatusFulfilled: true,
+	models.OrderStatusShipped:   true,
+	models.OrderStatusDelivered: true,
+}
+
+// Orders whose products left the warehouse, their stock is not given back
+// when they are refunded
+var shippedStatuses = map[string]bool{
+	models.OrderStatusShipped:   true,
+	models.OrderStatusDelivered: true,
+}
+
+func (service orderService) GetOrder(ctx context.Context, id uint) (*models.Order, error) {
+	return service.repository.GetOrder(ctx, id)
+}
+
+// UpdateOrderStatus moves the order to a new status if the transition table
+// and the role of the actor allow it, and returns the updated order. A
+// cancelled order is undone like one cancelled by its customer, and a
+// refunded order is refunded once the change is recorded; an admin refunding
+// it again retries the payments that failed to refund.
+func (service orderService) UpdateOrderStatus(ctx context.Context, orderId uint, status, note string, actor StatusActor) (*models.Order, error) {
+	if !models.IsOrderStatus(status) {
+		return nil, ErrInvalidOrderStatus
+	}
+	switch actor.Role {
+	case ActorAdmin, ActorSystem:
+	case ActorSeller:
+		if !sellerStatuses[status] {
+			return nil, ErrStatusNotAllowed
+		}
+	default:
+		return nil, ErrNotOrderParticipant
+	}
+
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == models.OrderStatusRefunded && status == models.OrderStatusRefunded && actor.Role == ActorAdmin {
+		if err = service.refundPayments(ctx, order); err != nil {
+			return nil, err
+		}
+		return service.repository.GetOrder(ctx, order.ID)
+	}
+	if !models.CanTransition(order.Status, status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, order.Status, status)
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ChangedBy:  actor.AccountID,
+		Note:       note,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if status == models.OrderStatusCancelled {
+		return service.cancelOrder(ctx, order, change, "cancelled by "+actor.Role)
+	}
+	if err = service.repository.UpdateOrderStatus(ctx, change); err != nil {
+		return nil, err
+	}
+	order.Status = status
+	order.StatusHistory = append(order.StatusHistory, change)
+
+	// The money goes back once the change is claimed, so that it goes back
+	// once. A refund that fails is retried by refunding the order again.
+	var refundErr error
+	if status == models.OrderStatusRefunded {
+		refundErr = service.refundPayments(ctx, order)
+	}
+	service.issueDocuments(ctx, order, status)
+
+	// The stock held since checkout is sold once delivered, and given back
+	// when the order stops before it is shipped
+	switch {
+	case status == models.OrderStatusDelivered:
+		if err = service.stock.CommitStock(ctx, order); err != nil {
+			log.Printf("Failed to commit the stock of order %d: %v", order.ID, err)
+		}
+	case status == models.OrderStatusRefunded && !shippedStatuses[change.FromStatus]:
+		if err = service.stock.ReleaseStock(ctx, order); err != nil {
+			log.Printf("Failed to release the stock of order %d: %v", order.ID, err)
+		}
+	}
+	if refundErr != nil {
+		return nil, fmt.Errorf("order %d is refunded but its payments are not: %w", order.ID, refundErr)
+	}
+	return order, nil
+}
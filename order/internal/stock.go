@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	product "github.com/thomas/EcommerceAPI/product/client"
+	productmodels "github.com/thomas/EcommerceAPI/product/models"
+)
+
+var ErrOutOfStock = errors.New("not enough stock")
+
+// StockReservations holds the stock of the products of an order while it is
+// checked out. Each call can be repeated safely.
+type StockReservations interface {
+	// ReserveStock holds the stock of every product of the order or none of
+	// them, it fails with ErrOutOfStock when one runs out
+	ReserveStock(ctx context.Context, order *models.Order) error
+	// ReleaseStock gives back the stock held for the order
+	ReleaseStock(ctx context.Context, order *models.Order) error
+	// CommitStock keeps the stock held for the order sold, once delivered
+	CommitStock(ctx context.Context, order *models.Order) error
+	// RestockReturn puts the units sent back by a return in stock again
+	RestockReturn(ctx context.Context, orderReturn *models.OrderReturn) error
+}
+
+// productStock reserves the stock in the product service, under a
+// reservation named after the order
+type productStock struct {
+	client *product.Client
+}
+
+func NewProductStock(client *product.Client) StockReservations {
+	return &productStock{client}
+}
+
+func (stock *productStock) ReserveStock(ctx context.Context, order *models.Order) error {
+	var items []productmodels.StockItem
+	for _, product := range order.Products {
+		items = append(items, productmodels.StockItem{ProductID: product.ID, Quantity: int64(product.Quantity)})
+	}
+	err := stock.client.ReserveStock(ctx, reservationID(order), items)
+	if status.Code(err) == codes.FailedPrecondition {
+		return fmt.Errorf("%w: %s", ErrOutOfStock, status.Convert(err).Message())
+	}
+	return err
+}
+
+func (stock *productStock) ReleaseStock(ctx context.Context, order *models.Order) error {
+	return stock.client.ReleaseStock(ctx, reservationID(order), orderProductIDs(order))
+}
+
+func (stock *productStock) CommitStock(ctx context.Context, order *models.Order) error {
+	return stock.client.CommitStock(ctx, reservationID(order), orderProductIDs(order))
+}
+
+func (stock *productStock) RestockReturn(ctx context.Context, orderReturn *models.OrderReturn) error {
+	return stock.client.RestockStock(ctx, fmt.Sprintf("return-%d", orderReturn.ID), []productmodels.StockItem{
+		{ProductID: orderReturn.ProductID, Quantity: int64(orderReturn.Quantity)},
+	})
+}
+
+func reservationID(order *models.Order) string {
+	return fmt.Sprintf("order-%d", order.ID)
+}
+
+func orderProductIDs(order *models.Order) []string {
+	var ids []string
+	for _, product := range order.Products {
+		ids = append(ids, product.ID)
+	}
+	return ids
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+// TaxableLine is a line of an order to tax, Amount is its price after the
+// discounts
+type TaxableLine struct {
+	ProductID   string
+	TaxCategory string
+	Amount      money.Money
+}
+
+// TaxCalculator taxes the lines of an order shipped to the destination. It
+// returns one tax per line, in the currency of the line.
+type TaxCalculator interface {
+	Tax(ctx context.Context, destination models.Address, lines []TaxableLine) ([]models.OrderTax, error)
+}
+
+// TaxRule is a row of a tax table: the products of Category shipped to
+// Country and Region are taxed Rate percent. Empty fields match everything.
+// Inclusive rates are already part of the price, exclusive ones are added to
+// it.
+type TaxRule struct {
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	Region    string  `json:"region"`
+	Category  string  `json:"category"`
+	Rate      float64 `json:"rate"`
+	Inclusive bool    `json:"inclusive"`
+}
+
+// TaxTable is the JSON file of a tax table
+type TaxTable struct {
+	Rules []TaxRule `json:"rules"`
+}
+
+// taxTable taxes each line with the most specific rule matching it: a rule
+// for the category beats a rule for the region, which beats a rule for the
+// country. Lines no rule matches are not taxed.
+type taxTable struct {
+	rules []TaxRule
+}
+
+func NewTaxTable(table TaxTable) (TaxCalculator, error) {
+	rules := make([]TaxRule, len(table.Rules))
+	for i, rule := range table.Rules {
+		if rule.Rate < 0 || rule.Rate > 100 {
+			return nil, errors.New("tax rates must be between 0 and 100")
+		}
+		if rule.Region != "" && rule.Country == "" {
+			return nil, errors.New("tax rules for a region need a country")
+		}
+		rule.Country = strings.ToUpper(rule.Country)
+		rule.Region = strings.ToUpper(rule.Region)
+		rule.Category = strings.ToUpper(rule.Category)
+		if rule.Name == "" {
+			rule.Name = "Tax"
+		}
+		rules[i] = rule
+	}
+	return &taxTable{rules}, nil
+}
+
+// LoadTaxTable reads a tax table from a JSON file
+func LoadTaxTable(path string) (TaxCalculator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table TaxTable
+	if err = json.Unmarshal(data, &table); err != nil {
+		return nil, err
+	}
+	return NewTaxTable(table)
+}
+
+// NewTaxCalculator returns the tax table of the file, or a table without
+// rules, which taxes nothing, when there is no file
+func NewTaxCalculator(file string) (TaxCalculator, error) {
+	if file != "" {
+		return LoadTaxTable(file)
+	}
+	return NewTaxTable(TaxTable{})
+}
+
+func (table *taxTable) Tax(_ context.Context, destination models.Address, lines []TaxableLine) ([]models.OrderTax, error) {
+	var taxes []models.OrderTax
+	for _, line := range lines {
+		rule, ok := table.find(destination, strings.ToUpper(line.TaxCategory))
+		if !ok {
+			continue
+		}
+		var amount money.Money
+		if rule.Inclusive {
+			amount = line.Amount.Fraction(rule.Rate, 100+rule.Rate, money.RoundHalfEven)
+		} else {
+			amount = line.Amount.Percent(rule.Rate, money.RoundHalfEven)
+		}
+		taxes = append(taxes, models.OrderTax{
+			ProductID:    line.ProductID,
+			Name:         rule.Name,
+			Rate:         rule.Rate,
+			Inclusive:    rule.Inclusive,
+			TaxableMinor: line.Amount.Amount,
+			AmountMinor:  amount.Amount,
+		})
+	}
+	return taxes, nil
+}
+
+func (table *taxTable) find(destination models.Address, category string) (TaxRule, bool) {
+	best, bestScore := TaxRule{}, -1
+	for _, rule := range table.rules {
+		if (rule.Country != "" && rule.Country != destination.Country) ||
+			(rule.Region != "" && rule.Region != destination.Region) ||
+			(rule.Category != "" && rule.Category != category) {
+			continue
+		}
+		score := 0
+		if rule.Country != "" {
+			score++
+		}
+		if rule.Region != "" {
+			score += 2
+		}
+		if rule.Category != "" {
+			score += 4
+		}
+		// The first of the rules as specific wins
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// taxOrder taxes the lines of the order after their discounts. It returns the
+// taxes with their total and the part of it added to the order total.
+func (service orderService) taxOrder(ctx context.Context, products []*models.OrderedProduct, pricing *Pricing, address models.Address) ([]models.OrderTax, money.Money, money.Money, error) {
+	total := money.New(0, pricing.Total.Currency)
+	exclusive := total
+
+	discounts := map[string]int64{}
+	for _, discount := range pricing.Discounts {
+		discounts[discount.ProductID] += discount.AmountMinor
+	}
+	lines := make([]TaxableLine, len(products))
+	for i, product := range products {
+		amount := product.PriceMoney().Times(int64(product.Quantity))
+		amount.Amount -= discounts[product.ID]
+		lines[i] = TaxableLine{ProductID: product.ID, TaxCategory: product.TaxCategory, Amount: amount}
+	}
+
+	taxes, err := service.taxes.Tax(ctx, address, lines)
+	if err != nil {
+		return nil, total, exclusive, err
+	}
+	for _, tax := range taxes {
+		total.Amount += tax.AmountMinor
+		if !tax.Inclusive {
+			exclusive.Amount += tax.AmountMinor
+		}
+	}
+	return taxes, total, exclusive, nil
+}
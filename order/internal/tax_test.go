@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thomas/EcommerceAPI/order/models"
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+func testTaxTable(t *testing.T, rules ...TaxRule) TaxCalculator {
+	table, err := NewTaxTable(TaxTable{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestNewTaxTableRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule TaxRule
+	}{
+		{"negative rate", TaxRule{Country: "FR", Rate: -1}},
+		{"rate over 100", TaxRule{Country: "FR", Rate: 101}},
+		{"region without a country", TaxRule{Region: "CA", Rate: 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewTaxTable(TaxTable{Rules: []TaxRule{test.rule}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTaxTablePicksTheMostSpecificRule(t *testing.T) {
+	// Listed from the most to the least specific, so the order of the table
+	// is not what picks the rule
+	table := testTaxTable(t,
+		TaxRule{Name: "Books", Country: "us", Category: "books", Rate: 1},
+		TaxRule{Name: "California", Country: "US", Region: "ca", Rate: 7.25},
+		TaxRule{Name: "Food in California", Country: "US", Region: "CA", Category: "FOOD", Rate: 0},
+		TaxRule{Name: "US", Country: "US", Rate: 5},
+		TaxRule{Name: "Anywhere", Rate: 10},
+		TaxRule{Name: "Second US", Country: "US", Rate: 6},
+	)
+
+	tests := []struct {
+		name        string
+		destination models.Address
+		category    string
+		want        string
+	}{
+		{"category and region beat region", models.Address{Country: "US", Region: "CA"}, "food", "Food in California"},
+		{"category beats region", models.Address{Country: "US", Region: "CA"}, "BOOKS", "Books"},
+		{"region beats country", models.Address{Country: "US", Region: "CA"}, "TOYS", "California"},
+		{"country beats the default", models.Address{Country: "US", Region: "NY"}, "TOYS", "US"},
+		{"the default matches the other countries", models.Address{Country: "FR"}, "BOOKS", "Anywhere"},
+		{"the default matches orders without an address", models.Address{}, "", "Anywhere"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taxes, err := table.Tax(context.Background(), test.destination, []TaxableLine{
+				{ProductID: "p1", TaxCategory: test.category, Amount: money.New(1000, "USD")},
+			})
+			assert.NoError(t, err)
+			if assert.Len(t, taxes, 1) {
+				assert.Equal(t, test.want, taxes[0].Name)
+			}
+		})
+	}
+}
+
+func TestTaxTableLeavesUnmatchedLinesUntaxed(t *testing.T) {
+	table := testTaxTable(t, TaxRule{Country: "FR", Rate: 20})
+
+	taxes, err := table.Tax(context.Background(), models.Address{Country: "DE"}, []TaxableLine{
+		{ProductID: "p1", Amount: money.New(1000, "EUR")},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, taxes)
+}
+
+func TestTaxTableAmounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		inclusive bool
+		amount    int64
+		want      int64
+	}{
+		// amount*rate/(100+rate)
+		{"inclusive", 20, true, 1200, 200},
+		{"inclusive half rounds to even down", 20, true, 3, 0},
+		{"inclusive half rounds to even up", 20, true, 9, 2},
+		{"inclusive decimal rate", 5.5, true, 1055, 55},
+		// amount*rate/100
+		{"exclusive", 20, false, 1000, 200},
+		{"exclusive half rounds to even down", 10, false, 1005, 100},
+		{"exclusive half rounds to even up", 10, false, 1015, 102},
+		{"exclusive decimal rate", 7.25, false, 1000, 72},
+		{"zero rate", 0, false, 1000, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := testTaxTable(t, TaxRule{Name: "VAT", Rate: test.rate, Inclusive: test.inclusive})
+
+			taxes, err := table.Tax(context.Background(), models.Address{Country: "FR"}, []TaxableLine{
+				{ProductID: "p1", Amount: money.New(test.amount, "EUR")},
+			})
+			assert.NoError(t, err)
+			if assert.Len(t, taxes, 1) {
+				assert.Equal(t, models.OrderTax{
+					ProductID:    "p1",
+					Name:         "VAT",
+					Rate:         test.rate,
+					Inclusive:    test.inclusive,
+					TaxableMinor: test.amount,
+					AmountMinor:  test.want,
+				}, taxes[0])
+			}
+		})
+	}
+}
+
+func TestTaxOrderAddsOnlyExclusiveTaxesToTheTotal(t *testing.T) {
+	service := orderService{taxes: testTaxTable(t,
+		TaxRule{Name: "VAT", Country: "FR", Rate: 20, Inclusive: true},
+		TaxRule{Name: "Sales tax", Country: "FR", Category: "BOOKS", Rate: 5.5},
+	)}
+	products := []*models.OrderedProduct{
+		{ID: "p1", Price: 12, Currency: "EUR", Quantity: 1},
+		{ID: "p2", Price: 10, Currency: "EUR", Quantity: 2, TaxCategory: "books"},
+	}
+	pricing, err := PriceOrder(products, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taxes, total, exclusive, err := service.taxOrder(context.Background(), products, pricing, models.Address{Country: "FR"})
+	assert.NoError(t, err)
+	assert.Len(t, taxes, 2)
+	// 200 included in the 12 EUR of p1, 110 on top of the 20 EUR of p2
+	assert.Equal(t, money.New(310, "EUR"), total)
+	assert.Equal(t, money.New(110, "EUR"), exclusive)
+}
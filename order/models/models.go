@@ -1,14 +1,222 @@
 package models
 
-import "time"
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
 
 type Order struct {
-	ID            uint `gorm:"primaryKey;autoIncrement"`
-	CreatedAt     time.Time
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	CreatedAt time.Time
+	// Amounts in minor units of Currency. Subtotal is the price of the
+	// products before discounts, Total what the customer pays.
+	Currency           string
+	SubtotalMinor      int64
+	DiscountTotalMinor int64
+	TotalMinor         int64
+	// Deprecated: decimal copies of the amounts above, kept for the clients
+	// that still read them
+	Subtotal      float64
+	DiscountTotal float64
 	TotalPrice    float64
 	AccountID     string
+	CouponCode    string
 	ProductsInfos []ProductsInfo    `gorm:"foreignKey:OrderID"`
 	Products      []*OrderedProduct `gorm:"-"`
+	Discounts     []OrderDiscount   `gorm:"foreignKey:OrderID"`
+	// Rates used to convert the prices into Currency at checkout
+	ExchangeRates []ExchangeRate      `gorm:"foreignKey:OrderID"`
+	Status        string              `gorm:"default:PENDING;index"`
+	StatusHistory []OrderStatusChange `gorm:"foreignKey:OrderID"`
+	// Given by the customer when they cancel the order
+	CancellationReason string
+	Payments           []PaymentIntent `gorm:"foreignKey:OrderID"`
+	// Only saved with the order, see GetSaga
+	Saga *CheckoutSaga `gorm:"foreignKey:OrderID"`
+	// Empty for the orders placed before they were shipped
+	ShippingAddress Address `gorm:"embedded;embeddedPrefix:shipping_"`
+	// Cost of the shipments in minor units of Currency, included in TotalMinor
+	ShippingTotalMinor int64
+	Shipments          []Shipment `gorm:"foreignKey:OrderID"`
+	// Taxes of the lines in minor units of Currency. Only the exclusive ones
+	// are included in TotalMinor, the inclusive ones are part of the prices.
+	TaxTotalMinor int64
+	Taxes         []OrderTax `gorm:"foreignKey:OrderID"`
+	// Products the customer sends back after delivery
+	Returns []OrderReturn `gorm:"foreignKey:OrderID"`
+	// Invoices of the sellers once the order is paid, and their credit notes
+	Invoices []Invoice `gorm:"foreignKey:OrderID"`
+	// Set when the order is paid or refunded, until its invoices or credit
+	// notes are issued
+	DocumentsDueAt *time.Time `gorm:"index"`
+}
+
+// Address is where an order is shipped. Country is an ISO 3166-1 alpha-2
+// code, Region a state or province code.
+type Address struct {
+	Name       string
+	Line1      string
+	Line2      string
+	City       string
+	Region     string
+	PostalCode string
+	Country    string
+}
+
+const (
+	OrderStatusPending   = "PENDING"
+	OrderStatusPaid      = "PAID"
+	OrderStatusFulfilled = "FULFILLED"
+	OrderStatusShipped   = "SHIPPED"
+	OrderStatusDelivered = "DELIVERED"
+	OrderStatusCancelled = "CANCELLED"
+	OrderStatusRefunded  = "REFUNDED"
+)
+
+// orderTransitions lists the statuses an order can move to from each status.
+// Refunded orders are final, cancelled orders can only be refunded.
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusFulfilled, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusFulfilled: {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {OrderStatusRefunded},
+}
+
+// IsOrderStatus reports whether status is one of the known order statuses
+func IsOrderStatus(status string) bool {
+	if _, ok := orderTransitions[status]; ok {
+		return true
+	}
+	return status == OrderStatusRefunded
+}
+
+// CanTransition reports whether an order can go from one status to the other
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	OrderSortNewest    = "NEWEST"
+	OrderSortOldest    = "OLDEST"
+	OrderSortTotalAsc  = "TOTAL_ASC"
+	OrderSortTotalDesc = "TOTAL_DESC"
+)
+
+// OrderFilter narrows a list of orders, zero values match every order
+type OrderFilter struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Statuses      []string
+	// Totals in Currency
+	MinTotal  float64
+	MaxTotal  float64
+	ProductID string
+	// Only the orders in this currency. The totals of orders in different
+	// currencies do not compare, see GetOrdersForAccount.
+	Currency string
+}
+
+// OrderQuery selects a page of a list of orders. After is the cursor of the
+// last order of the previous page.
+type OrderQuery struct {
+	Filter OrderFilter
+	Sort   string
+	First  int
+	After  string
+}
+
+// OrderPage is a page of a list of orders, EndCursor is the After of the
+// next page
+type OrderPage struct {
+	Orders      []Order
+	TotalCount  int64
+	EndCursor   string
+	HasNextPage bool
+}
+
+// OrderCursor returns the opaque cursor pointing at an order in a list
+func OrderCursor(orderID uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("order:" + strconv.FormatUint(uint64(orderID), 10)))
+}
+
+// ParseOrderCursor returns the ID of the order a cursor points at
+func ParseOrderCursor(cursor string) (uint, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(string(decoded), "order:"), 10, 64)
+	if err != nil || !strings.HasPrefix(string(decoded), "order:") || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// OrderStatusChange is an entry of the status history of an order
+type OrderStatusChange struct {
+	ID         uint `gorm:"primaryKey;autoIncrement"`
+	OrderID    uint `gorm:"index"`
+	FromStatus string
+	ToStatus   string
+	// Account that made the change, empty for changes made by the system
+	ChangedBy string
+	Note      string
+	CreatedAt time.Time
+}
+
+type ExchangeRate struct {
+	ID           uint `gorm:"primaryKey;autoIncrement"`
+	OrderID      uint `gorm:"index"`
+	FromCurrency string
+	ToCurrency   string
+	Rate         float64
+}
+
+// LockedRate returns the rate the order was placed with for a currency
+func (order Order) LockedRate(from string) (float64, bool) {
+	from = money.NormalizeCurrency(from)
+	if from == money.NormalizeCurrency(order.Currency) {
+		return 1, true
+	}
+	for _, rate := range order.ExchangeRates {
+		if rate.FromCurrency == from {
+			return rate.Rate, true
+		}
+	}
+	return 0, false
+}
+
+func (order Order) SubtotalMoney() money.Money {
+	return money.New(order.SubtotalMinor, order.Currency)
+}
+
+func (order Order) DiscountTotalMoney() money.Money {
+	return money.New(order.DiscountTotalMinor, order.Currency)
+}
+
+func (order Order) TotalMoney() money.Money {
+	return money.New(order.TotalMinor, order.Currency)
+}
+
+func (order Order) ShippingTotalMoney() money.Money {
+	return money.New(order.ShippingTotalMinor, order.Currency)
+}
+
+func (order Order) TaxTotalMoney() money.Money {
+	return money.New(order.TaxTotalMinor, order.Currency)
 }
 
 type ProductsInfo struct {
@@ -16,6 +224,22 @@ type ProductsInfo struct {
 	OrderID   uint
 	ProductID string
 	Quantity  int
+
+	// Snapshot of the product when the order was placed, so the order keeps
+	// showing what was bought after the product changes or is deleted. The
+	// unit price is in minor units of Currency, the order currency.
+	Name           string
+	Description    string
+	UnitPriceMinor int64
+	Currency       string
+	Variant        string
+	SellerID       int `gorm:"index"`
+}
+
+// HasSnapshot reports whether the line was saved with a snapshot of the
+// product, lines of older orders only have the product ID and quantity
+func (info ProductsInfo) HasSnapshot() bool {
+	return info.Currency != ""
 }
 
 func (ProductsInfo) TableName() string {
@@ -27,7 +251,758 @@ type OrderedProduct struct {
 	Name        string
 	Description string
 	Price       float64
+	Currency    string
 	Quantity    uint32
+	// Used to scope promotions, only the seller is stored with the order
+	SellerID int
+	Category string
+	// Empty until products have variants
+	Variant string
+	// Shipping weight of one unit and tax category, only known at checkout
+	WeightGrams int64
+	TaxCategory string
+	// Whether the fields above come from the snapshot saved with the order
+	// rather than from the live product
+	Snapshot bool
+}
+
+// OrderDiscount is the part of a promotion applied to one line of an order
+type OrderDiscount struct {
+	ID          uint `gorm:"primaryKey;autoIncrement"`
+	OrderID     uint `gorm:"index"`
+	ProductID   string
+	PromotionID uint
+	Code        string
+	// Amount in minor units of the order currency
+	AmountMinor int64
+	// Deprecated: decimal copy of AmountMinor
+	Amount float64
+}
+
+// OrderLine is a product of an order priced with its discounts and taxes.
+// Total is the subtotal minus the discount plus the exclusive tax.
+type OrderLine struct {
+	Product  *OrderedProduct
+	Subtotal money.Money
+	Discount money.Money
+	Tax      money.Money
+	Total    money.Money
+}
+
+// Lines prices each product of the order with its discounts and taxes
+func (order Order) Lines() []OrderLine {
+	discounts := map[string]int64{}
+	for _, discount := range order.Discounts {
+		discounts[discount.ProductID] += discount.AmountMinor
+	}
+	taxes := map[string]int64{}
+	exclusiveTaxes := map[string]int64{}
+	for _, tax := range order.Taxes {
+		taxes[tax.ProductID] += tax.AmountMinor
+		if !tax.Inclusive {
+			exclusiveTaxes[tax.ProductID] += tax.AmountMinor
+		}
+	}
+
+	var lines []OrderLine
+	for _, product := range order.Products {
+		subtotal := product.PriceMoney().Times(int64(product.Quantity))
+		total := subtotal.Amount - discounts[product.ID] + exclusiveTaxes[product.ID]
+		lines = append(lines, OrderLine{
+			Product:  product,
+			Subtotal: subtotal,
+			Discount: money.New(discounts[product.ID], order.Currency),
+			Tax:      money.New(taxes[product.ID], order.Currency),
+			Total:    money.New(total, order.Currency),
+		})
+	}
+	return lines
+}
+
+// ForSeller returns the part of the order a seller handles: their lines with
+// their discounts and taxes, their shipment, the returns of their products
+// and their invoices. The amounts are those of this part, the payments are left out.
+func (order Order) ForSeller(sellerID int) Order {
+	part := order
+	part.ProductsInfos, part.Products, part.Discounts, part.Taxes = nil, nil, nil, nil
+	part.Payments, part.Saga, part.Shipments, part.Returns, part.Invoices = nil, nil, nil, nil, nil
+
+	lines := map[string]bool{}
+	subtotal := money.New(0, order.Currency)
+	for _, product := range order.Products {
+		if product.SellerID != sellerID {
+			continue
+		}
+		lines[product.ID] = true
+		part.Products = append(part.Products, product)
+		subtotal.Amount += product.PriceMoney().Times(int64(product.Quantity)).Amount
+	}
+	part.SubtotalMinor = subtotal.Amount
+	part.DiscountTotalMinor = 0
+	for _, discount := range order.Discounts {
+		if lines[discount.ProductID] {
+			part.Discounts = append(part.Discounts, discount)
+			part.DiscountTotalMinor += discount.AmountMinor
+		}
+	}
+	part.TaxTotalMinor = 0
+	var exclusiveTax int64
+	for _, tax := range order.Taxes {
+		if lines[tax.ProductID] {
+			part.Taxes = append(part.Taxes, tax)
+			part.TaxTotalMinor += tax.AmountMinor
+			if !tax.Inclusive {
+				exclusiveTax += tax.AmountMinor
+			}
+		}
+	}
+	part.ShippingTotalMinor = 0
+	for _, shipment := range order.Shipments {
+		if shipment.SellerID == sellerID {
+			part.Shipments = append(part.Shipments, shipment)
+			part.ShippingTotalMinor += shipment.CostMinor
+		}
+	}
+	for _, orderReturn := range order.Returns {
+		if orderReturn.SellerID == sellerID {
+			part.Returns = append(part.Returns, orderReturn)
+		}
+	}
+	for _, invoice := range order.Invoices {
+		if invoice.SellerID == sellerID {
+			part.Invoices = append(part.Invoices, invoice)
+		}
+	}
+	part.TotalMinor = part.SubtotalMinor - part.DiscountTotalMinor + exclusiveTax + part.ShippingTotalMinor
+	part.Subtotal = part.SubtotalMoney().Float()
+	part.DiscountTotal = part.DiscountTotalMoney().Float()
+	part.TotalPrice = part.TotalMoney().Float()
+	return part
+}
+
+// What the seller of a line can do next
+const (
+	ActionShip          = "SHIP"
+	ActionMarkInTransit = "MARK_IN_TRANSIT"
+	ActionMarkDelivered = "MARK_DELIVERED"
+	ActionMarkFailed    = "MARK_FAILED"
+	ActionReviewReturn  = "REVIEW_RETURN"
+	ActionReceiveReturn = "RECEIVE_RETURN"
+)
+
+// FulfilmentActions lists what the seller of the product can do next with its
+// line: move the shipment holding it along once the order is paid, and
+// handle its returns
+func (order Order) FulfilmentActions(productID string) []string {
+	var actions []string
+	seen := map[string]bool{}
+	add := func(action string) {
+		if !seen[action] {
+			seen[action] = true
+			actions = append(actions, action)
+		}
+	}
+
+	switch order.Status {
+	case OrderStatusPaid, OrderStatusFulfilled, OrderStatusShipped:
+		for _, shipment := range order.Shipments {
+			if !shipment.Holds(productID) {
+				continue
+			}
+			for _, next := range shipmentTransitions[shipment.Status] {
+				if next == ShipmentShipped {
+					add(ActionShip)
+				} else {
+					add("MARK_" + next)
+				}
+			}
+		}
+	}
+	for _, orderReturn := range order.Returns {
+		if orderReturn.ProductID != productID {
+			continue
+		}
+		switch orderReturn.Status {
+		case ReturnRequested:
+			add(ActionReviewReturn)
+		case ReturnApproved, ReturnShipped, ReturnReceived:
+			// A received return whose refund failed is received again
+			add(ActionReceiveReturn)
+		}
+	}
+	return actions
+}
+
+// MaxLineQuantity is the most units of a product an order can hold
+const MaxLineQuantity = 100
+
+const (
+	LineErrorUnknownProduct = "UNKNOWN_PRODUCT"
+	LineErrorOutOfStock     = "OUT_OF_STOCK"
+	LineErrorQuantityLimit  = "QUANTITY_LIMIT"
+)
+
+// LineError is a problem with a line of an order that keeps it from being
+// placed
+type LineError struct {
+	ProductID string
+	Code      string
+	Message   string
+}
+
+func (lineError LineError) Error() string {
+	return fmt.Sprintf("product %s: %s", lineError.ProductID, lineError.Message)
+}
+
+// OrderQuote is the price of an order that is not placed yet. Order is priced
+// without the lines that have errors.
+type OrderQuote struct {
+	Order  Order
+	Errors []LineError
+}
+
+// OrderTax is the tax of one line of an order
+type OrderTax struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	OrderID   uint `gorm:"index"`
+	ProductID string
+	Name      string
+	// Percent of the taxable amount
+	Rate float64
+	// Whether the tax is part of the price of the line rather than added to it
+	Inclusive bool
+	// Amounts in minor units of the order currency, the taxable amount is the
+	// price of the line after its discounts
+	TaxableMinor int64
+	AmountMinor  int64
+}
+
+func (product OrderedProduct) PriceMoney() money.Money {
+	return money.FromFloat(product.Price, product.Currency)
+}
+
+const (
+	PromotionPercentage = "PERCENTAGE"
+	PromotionFixed      = "FIXED"
+	PromotionBuyXGetY   = "BUY_X_GET_Y"
+)
+
+type Promotion struct {
+	ID   uint   `gorm:"primaryKey;autoIncrement"`
+	Code string `gorm:"uniqueIndex"`
+	Type string
+	// Percent off for PERCENTAGE, amount off the eligible products for FIXED
+	Value float64
+	// Currency of a FIXED value and of MinBasket
+	Currency string
+	// BUY_X_GET_Y: out of every BuyQuantity+GetQuantity units of a product,
+	// GetQuantity are free
+	BuyQuantity int
+	GetQuantity int
+	// Zero and empty mean any seller and any category
+	SellerID int
+	Category string
+	// Minimum price of the eligible products before the discount
+	MinBasket float64
+	// Zero means unlimited
+	MaxUses           int
+	MaxUsesPerAccount int
+	UsedCount         int
+	StartsAt          *time.Time
+	EndsAt            *time.Time
+	CreatedBy         int
+	CreatedAt         time.Time
+}
+
+// IsActive reports whether the promotion can be redeemed at the given time
+func (promotion Promotion) IsActive(now time.Time) bool {
+	if promotion.StartsAt != nil && now.Before(*promotion.StartsAt) {
+		return false
+	}
+	if promotion.EndsAt != nil && !now.Before(*promotion.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// AppliesTo reports whether the product is in the scope of the promotion
+func (promotion Promotion) AppliesTo(product *OrderedProduct) bool {
+	if promotion.SellerID != 0 && promotion.SellerID != product.SellerID {
+		return false
+	}
+	if promotion.Category != "" && promotion.Category != product.Category {
+		return false
+	}
+	return true
+}
+
+type PromotionRedemption struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	PromotionID uint   `gorm:"index"`
+	AccountID   string `gorm:"index"`
+	OrderID     uint   `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+const (
+	PaymentRequiresAction = "REQUIRES_PAYMENT"
+	PaymentAuthorized     = "AUTHORIZED"
+	PaymentCaptured       = "CAPTURED"
+	PaymentFailed         = "FAILED"
+	PaymentRefunded       = "REFUNDED"
+	PaymentVoided         = "VOIDED"
+)
+
+// PaymentIntent is an attempt to pay an order. A declined attempt stays
+// FAILED and the customer can make a new one.
+type PaymentIntent struct {
+	ID       uint `gorm:"primaryKey;autoIncrement"`
+	OrderID  uint `gorm:"index"`
+	Provider string
+	// The provider's ID of the payment
+	ProviderRef   string `gorm:"index"`
+	AmountMinor   int64
+	Currency      string
+	Status        string
+	FailureReason string
+	// Part of the amount given back so far, the payment is REFUNDED once it
+	// is all given back
+	RefundedMinor int64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// paymentTransitions lists the statuses a payment can move to from each
+// status. A captured payment can only be refunded, the other outcomes are
+// final: events reported late or twice cannot take them back.
+var paymentTransitions = map[string][]string{
+	PaymentRequiresAction: {PaymentAuthorized, PaymentCaptured, PaymentFailed, PaymentVoided},
+	PaymentAuthorized:     {PaymentCaptured, PaymentFailed, PaymentVoided},
+	PaymentCaptured:       {PaymentRefunded},
+}
+
+// CanPaymentTransition reports whether a payment can go from one status to
+// the other
+func CanPaymentTransition(from, to string) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (intent PaymentIntent) AmountMoney() money.Money {
+	return money.New(intent.AmountMinor, intent.Currency)
+}
+
+func (intent PaymentIntent) RefundedMoney() money.Money {
+	return money.New(intent.RefundedMinor, intent.Currency)
+}
+
+const (
+	SagaReserveStock     = "RESERVE_STOCK"
+	SagaAwaitPayment     = "AWAIT_PAYMENT"
+	SagaAuthorizePayment = "AUTHORIZE_PAYMENT"
+	SagaConfirmOrder     = "CONFIRM_ORDER"
+	SagaCompleted        = "COMPLETED"
+	SagaCompensating     = "COMPENSATING"
+	SagaCompensated      = "COMPENSATED"
+)
+
+// CheckoutSaga is the progress of the checkout of an order: the stock is
+// reserved, the order waits for its payment, the payment is authorized and
+// the order confirmed. A failed or late checkout is compensated: the order is
+// cancelled, its payment voided and its stock released. Step is saved before
+// each step runs, so a restarted service knows where to resume.
+type CheckoutSaga struct {
+	ID      uint   `gorm:"primaryKey;autoIncrement"`
+	OrderID uint   `gorm:"uniqueIndex"`
+	Step    string `gorm:"index"`
+	// The checkout is compensated when the order is not paid by then
+	PaymentDeadline time.Time `gorm:"index"`
+	// Why the checkout is compensated
+	FailureReason string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time `gorm:"index"`
+}
+
+const (
+	ShipmentPending   = "PENDING"
+	ShipmentShipped   = "SHIPPED"
+	ShipmentInTransit = "IN_TRANSIT"
+	ShipmentDelivered = "DELIVERED"
+	// The carrier could not deliver the parcel, the seller can ship it again
+	ShipmentFailed = "FAILED"
+)
+
+var shipmentTransitions = map[string][]string{
+	ShipmentPending:   {ShipmentShipped},
+	ShipmentShipped:   {ShipmentInTransit, ShipmentDelivered, ShipmentFailed},
+	ShipmentInTransit: {ShipmentDelivered, ShipmentFailed},
+	ShipmentFailed:    {ShipmentShipped},
+}
+
+// IsShipmentStatus reports whether status is one of the known shipment statuses
+func IsShipmentStatus(status string) bool {
+	_, ok := shipmentTransitions[status]
+	return ok || status == ShipmentDelivered
+}
+
+// CanShipmentTransition reports whether a shipment can go from one status to
+// the other
+func CanShipmentTransition(from, to string) bool {
+	for _, next := range shipmentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Shipment is a parcel of an order. Orders are split in one shipment per
+// seller at checkout, each seller ships their own products.
+type Shipment struct {
+	ID       uint           `gorm:"primaryKey;autoIncrement"`
+	OrderID  uint           `gorm:"index"`
+	SellerID int            `gorm:"index"`
+	Items    []ShipmentItem `gorm:"foreignKey:ShipmentID"`
+	// Charged to the customer, in minor units of the order currency
+	CostMinor   int64
+	Currency    string
+	WeightGrams int64
+	Status      string `gorm:"default:PENDING"`
+	// Entered by the seller when the parcel is handed to the carrier
+	Carrier        string
+	TrackingNumber string
+	ShippedAt      *time.Time
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (shipment Shipment) CostMoney() money.Money {
+	return money.New(shipment.CostMinor, shipment.Currency)
+}
+
+// Carriers the sellers ship with, and the page tracking their parcels. Parcels
+// of OTHER carriers cannot be tracked from here.
+var Carriers = map[string]string{
+	"UPS":   "https://www.ups.com/track?tracknum=%s",
+	"FEDEX": "https://www.fedex.com/fedextrack/?trknbr=%s",
+	"DHL":   "https://www.dhl.com/en/express/tracking.html?AWB=%s",
+	"USPS":  "https://tools.usps.com/go/TrackConfirmAction?tLabels=%s",
+	"OTHER": "",
+}
+
+// TrackingURL returns where the customer can follow the shipment, empty when
+// it is not shipped or its carrier has no tracking page
+func (shipment Shipment) TrackingURL() string {
+	page := Carriers[shipment.Carrier]
+	if page == "" || shipment.TrackingNumber == "" {
+		return ""
+	}
+	return fmt.Sprintf(page, url.QueryEscape(shipment.TrackingNumber))
+}
+
+// Holds reports whether the product travels in the shipment
+func (shipment Shipment) Holds(productID string) bool {
+	for _, item := range shipment.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+type ShipmentItem struct {
+	ID         uint `gorm:"primaryKey;autoIncrement"`
+	ShipmentID uint `gorm:"index"`
+	ProductID  string
+	Quantity   int
+}
+
+// ShipmentEvent is published on the shipment_events topic when a shipment
+// changes
+type ShipmentEvent struct {
+	Type string            `json:"type"`
+	Data ShipmentEventData `json:"data"`
+}
+
+type ShipmentEventData struct {
+	ShipmentID     uint   `json:"shipment_id"`
+	OrderID        uint   `json:"order_id"`
+	AccountID      string `json:"account_id"`
+	SellerID       int    `json:"seller_id"`
+	Status         string `json:"status"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"tracking_number,omitempty"`
+}
+
+const (
+	ReturnRequested = "REQUESTED"
+	ReturnApproved  = "APPROVED"
+	ReturnRejected  = "REJECTED"
+	ReturnShipped   = "SHIPPED"
+	ReturnReceived  = "RECEIVED"
+	// The refund was claimed and is being sent to the payment provider
+	ReturnRefunding = "REFUNDING"
+	ReturnRefunded  = "REFUNDED"
+)
+
+// returnTransitions lists the statuses a return can move to from each status.
+// The seller may receive a return the customer did not give a tracking number
+// for. A refund that fails puts the return back to RECEIVED.
+var returnTransitions = map[string][]string{
+	ReturnRequested: {ReturnApproved, ReturnRejected},
+	ReturnApproved:  {ReturnShipped, ReturnReceived},
+	ReturnShipped:   {ReturnReceived},
+	ReturnReceived:  {ReturnRefunding},
+	ReturnRefunding: {ReturnRefunded, ReturnReceived},
+}
+
+// CanReturnTransition reports whether a return can go from one status to the
+// other
+func CanReturnTransition(from, to string) bool {
+	for _, next := range returnTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Reasons a customer gives for a return
+var ReturnReasons = map[string]bool{
+	"DAMAGED":          true,
+	"WRONG_ITEM":       true,
+	"NOT_AS_DESCRIBED": true,
+	"NO_LONGER_NEEDED": true,
+	"OTHER":            true,
+}
+
+// OrderReturn is a request of the customer to send back units of a line of a
+// delivered order. The seller of the line approves or rejects it, then
+// receives the parcel, which restocks the units and refunds their price.
+type OrderReturn struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	OrderID   uint   `gorm:"index"`
+	AccountID string `gorm:"index"`
+	SellerID  int    `gorm:"index"`
+	ProductID string
+	Quantity  int
+	Reason    string
+	Comment   string
+	Status    string `gorm:"index"`
+	// Given by the seller when they reject the return
+	RejectionReason string
+	// Parcel the customer sends the units back in
+	Carrier        string
+	TrackingNumber string
+	// Price paid for the returned units, in minor units of Currency
+	RefundMinor int64
+	Currency    string
+	// Whether the units were put back in stock when received
+	Restocked  bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ShippedAt  *time.Time
+	ReceivedAt *time.Time
+	RefundedAt *time.Time
+}
+
+func (orderReturn OrderReturn) RefundMoney() money.Money {
+	return money.New(orderReturn.RefundMinor, orderReturn.Currency)
+}
+
+// TrackingURL returns where the seller can follow the returned parcel, empty
+// when it is not shipped or its carrier has no tracking page
+func (orderReturn OrderReturn) TrackingURL() string {
+	return Shipment{Carrier: orderReturn.Carrier, TrackingNumber: orderReturn.TrackingNumber}.TrackingURL()
+}
+
+// ReturnEvent is published on the return_events topic when a return changes
+type ReturnEvent struct {
+	Type string          `json:"type"`
+	Data ReturnEventData `json:"data"`
+}
+
+type ReturnEventData struct {
+	ReturnID    uint   `json:"return_id"`
+	OrderID     uint   `json:"order_id"`
+	AccountID   string `json:"account_id"`
+	SellerID    int    `json:"seller_id"`
+	ProductID   string `json:"product_id"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+	Status      string `json:"status"`
+	RefundMinor int64  `json:"refund_minor"`
+	Currency    string `json:"currency"`
+}
+
+const (
+	InvoiceKindInvoice    = "INVOICE"
+	InvoiceKindCreditNote = "CREDIT_NOTE"
+)
+
+// Invoice bills the part of a paid order a seller handles. A credit note is
+// an Invoice of kind CREDIT_NOTE that gives back part of an invoice, for a
+// return or for the refund of the order. Each seller numbers their invoices,
+// and their credit notes, in a sequence without gaps. Amounts are in minor
+// units of Currency, positive for credit notes too.
+type Invoice struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement"`
+	SellerID int    `gorm:"uniqueIndex:idx_invoice_number;uniqueIndex:idx_invoice_document"`
+	Kind     string `gorm:"uniqueIndex:idx_invoice_number;uniqueIndex:idx_invoice_document"`
+	Number   int64  `gorm:"uniqueIndex:idx_invoice_number"`
+	OrderID  uint   `gorm:"uniqueIndex:idx_invoice_document"`
+	// The return a credit note is for, zero for the invoice and for the
+	// credit note of a refunded order
+	ReturnID uint `gorm:"uniqueIndex:idx_invoice_document"`
+	// The invoice a credit note gives back part of
+	CreditedInvoiceID     uint
+	CreditedInvoiceNumber string
+	AccountID             string  `gorm:"index"`
+	BillingAddress        Address `gorm:"embedded;embeddedPrefix:billing_"`
+	Currency              string
+	SubtotalMinor         int64
+	DiscountMinor         int64
+	TaxMinor              int64
+	ShippingMinor         int64
+	TotalMinor            int64
+	Lines                 []InvoiceLine `gorm:"foreignKey:InvoiceID"`
+	IssuedAt              time.Time
+}
+
+// InvoiceLine is a product of an invoice, priced as in OrderLine
+type InvoiceLine struct {
+	ID             uint `gorm:"primaryKey;autoIncrement"`
+	InvoiceID      uint `gorm:"index"`
+	ProductID      string
+	Name           string
+	Quantity       int
+	UnitPriceMinor int64
+	SubtotalMinor  int64
+	DiscountMinor  int64
+	TaxMinor       int64
+	TotalMinor     int64
+}
+
+// InvoiceSequence holds the last number a seller gave to an invoice of a kind
+type InvoiceSequence struct {
+	SellerID   int    `gorm:"primaryKey;autoIncrement:false"`
+	Kind       string `gorm:"primaryKey"`
+	LastNumber int64
+}
+
+// DisplayNumber is the number printed on the invoice, e.g. INV-12-000042 for
+// the 42nd invoice of seller 12, or CN-12-000003 for their third credit note
+func (invoice Invoice) DisplayNumber() string {
+	prefix := "INV"
+	if invoice.Kind == InvoiceKindCreditNote {
+		prefix = "CN"
+	}
+	return fmt.Sprintf("%s-%d-%06d", prefix, invoice.SellerID, invoice.Number)
+}
+
+// Sum sets the amounts of the invoice from its lines and its shipping
+func (invoice *Invoice) Sum() {
+	invoice.SubtotalMinor, invoice.DiscountMinor, invoice.TaxMinor = 0, 0, 0
+	invoice.TotalMinor = invoice.ShippingMinor
+	for _, line := range invoice.Lines {
+		invoice.SubtotalMinor += line.SubtotalMinor
+		invoice.DiscountMinor += line.DiscountMinor
+		invoice.TaxMinor += line.TaxMinor
+		invoice.TotalMinor += line.TotalMinor
+	}
+}
+
+func (invoice Invoice) SubtotalMoney() money.Money {
+	return money.New(invoice.SubtotalMinor, invoice.Currency)
+}
+
+func (invoice Invoice) DiscountMoney() money.Money {
+	return money.New(invoice.DiscountMinor, invoice.Currency)
+}
+
+func (invoice Invoice) TaxMoney() money.Money {
+	return money.New(invoice.TaxMinor, invoice.Currency)
+}
+
+func (invoice Invoice) ShippingMoney() money.Money {
+	return money.New(invoice.ShippingMinor, invoice.Currency)
+}
+
+func (invoice Invoice) TotalMoney() money.Money {
+	return money.New(invoice.TotalMinor, invoice.Currency)
+}
+
+// InvoiceDocument is an invoice or credit note rendered as a file
+type InvoiceDocument struct {
+	FileName    string
+	ContentType string
+	Content     []byte
+}
+
+// InvoiceEvent is published on the invoice_events topic when an invoice or a
+// credit note is issued
+type InvoiceEvent struct {
+	Type string           `json:"type"`
+	Data InvoiceEventData `json:"data"`
+}
+
+type InvoiceEventData struct {
+	InvoiceID  uint   `json:"invoice_id"`
+	Kind       string `json:"kind"`
+	Number     string `json:"number"`
+	OrderID    uint   `json:"order_id"`
+	AccountID  string `json:"account_id"`
+	SellerID   int    `json:"seller_id"`
+	ReturnID   uint   `json:"return_id,omitempty"`
+	TotalMinor int64  `json:"total_minor"`
+	Currency   string `json:"currency"`
+}
+
+// IdempotencyKey remembers the order placed for a key sent by the client, so
+// a retried request returns that order instead of placing another one. Until
+// the order is saved OrderID is zero.
+type IdempotencyKey struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	AccountID string `gorm:"uniqueIndex:idx_idempotency_account_key"`
+	Key       string `gorm:"uniqueIndex:idx_idempotency_account_key"`
+	// Hash of the request the key was first used with
+	RequestHash string
+	OrderID     uint
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// PaymentEvent is a webhook of the payment provider that was processed
+type PaymentEvent struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	EventID     string `gorm:"uniqueIndex"`
+	Type        string
+	ProviderRef string
+	CreatedAt   time.Time
+}
+
+// OrderEvent is published on the order_events topic when an order changes
+type OrderEvent struct {
+	Type string         `json:"type"`
+	Data OrderEventData `json:"data"`
+}
+
+type OrderEventData struct {
+	OrderID   uint                `json:"order_id"`
+	AccountID string              `json:"account_id"`
+	Status    string              `json:"status"`
+	Reason    string              `json:"reason,omitempty"`
+	Products  []OrderEventProduct `json:"products"`
+}
+
+type OrderEventProduct struct {
+	ProductID string `json:"product_id"`
+	Quantity  uint32 `json:"quantity"`
 }
 
 type EventData struct {
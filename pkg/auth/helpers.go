@@ -10,6 +10,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+	// RoleService is sent by the services calling each other, never by users
+	RoleService = "service"
+)
+
 func GetUserId(ctx context.Context, abort bool) string {
 	accountId, ok := ctx.Value("userID").(string)
 	log.Println("userID", accountId)
@@ -31,6 +38,15 @@ func GetUserId(ctx context.Context, abort bool) string {
 	return accountId
 }
 
+// GetUserRole returns the role of the authenticated user, defaulting to RoleCustomer
+func GetUserRole(ctx context.Context) string {
+	role, ok := ctx.Value("userRole").(string)
+	if !ok || role == "" {
+		return RoleCustomer
+	}
+	return role
+}
+
 func GetUserIdInt(ctx context.Context, abort bool) (int, error) {
 	idString := GetUserId(ctx, abort)
 	log.Println("userID", idString)
@@ -9,13 +9,14 @@ import (
 )
 
 type AuthService interface {
-	GenerateToken(userID string) (string, error)
+	GenerateToken(userID, role string) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
 	GetSecretKey() string
 }
 
 type JWTCustomClaims struct {
 	UserID string `json:"user_id"`
+	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -31,9 +32,10 @@ func NewJwtService(secretKey, issuer string) AuthService {
 	}
 }
 
-func (service *JwtService) GenerateToken(userID string) (string, error) {
+func (service *JwtService) GenerateToken(userID, role string) (string, error) {
 	claims := &JWTCustomClaims{
 		UserID: userID,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    service.Issuer,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -73,3 +75,16 @@ func (service *JwtService) ValidateToken(encodedToken string) (*jwt.Token, error
 func (service *JwtService) GetSecretKey() string {
 	return service.SecretKey
 }
+
+// UserIdFromToken reads the user ID of a token this gateway was just handed by
+// the account service, without checking the signature
+func UserIdFromToken(encodedToken string) (string, error) {
+	claims := &JWTCustomClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(encodedToken, claims); err != nil {
+		return "", err
+	}
+	if claims.UserID == "" {
+		return "", errors.New("token has no user ID")
+	}
+	return claims.UserID, nil
+}
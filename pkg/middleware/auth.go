@@ -102,9 +102,11 @@ func AuthorizeJWT(jwtService auth.AuthService) gin.HandlerFunc {
 			log.Println("Successfully validated token")
 			log.Println("User ID from token:", claims.UserID)
 
-			// Set the userID in both gin context and request context
+			// Set the userID and role in both gin context and request context
 			c.Set("userID", claims.UserID)
+			c.Set("userRole", claims.Role)
 			ctxWithVal := context.WithValue(c.Request.Context(), "userID", claims.UserID)
+			ctxWithVal = context.WithValue(ctxWithVal, "userRole", claims.Role)
 			c.Request = c.Request.WithContext(ctxWithVal)
 		}
 
@@ -0,0 +1,222 @@
+// Package money represents amounts as an integer number of minor units (cents
+// for USD) with their ISO 4217 currency, so that adding up prices never
+// accumulates floating point errors.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency is the currency of the prices stored before currencies existed
+const DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("amounts in different currencies")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+)
+
+// Currencies whose minor unit is not the cent
+var exponents = map[string]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// RoundingMode says what to do with a fraction of a minor unit
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds halves away from zero. Discounts use it.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds halves to the nearest even unit, so that rounding
+	// many lines does not drift in one direction. Taxes use it.
+	RoundHalfEven
+	// RoundDown drops the fraction
+	RoundDown
+)
+
+type Money struct {
+	// Amount in minor units of the currency
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: NormalizeCurrency(currency)}
+}
+
+// FromFloat converts a decimal amount, as found in the float64 price fields,
+// rounding it half up to the minor unit
+func FromFloat(amount float64, currency string) Money {
+	currency = NormalizeCurrency(currency)
+	scale := math.Pow10(Exponent(currency))
+	return Money{Amount: int64(math.Round(amount * scale)), Currency: currency}
+}
+
+// Float is the decimal amount, for the fields that still use float64
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+// NormalizeCurrency upper-cases the code and falls back to DefaultCurrency
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// ValidateCurrency checks that the code looks like an ISO 4217 code
+func ValidateCurrency(currency string) error {
+	currency = NormalizeCurrency(currency)
+	if len(currency) != 3 {
+		return ErrInvalidCurrency
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return ErrInvalidCurrency
+		}
+	}
+	return nil
+}
+
+// Exponent is the number of decimals of the minor unit of the currency
+func Exponent(currency string) int {
+	if exponent, ok := exponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Times multiplies the amount by a quantity
+func (m Money) Times(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Percent returns percent % of the amount, rounded to the minor unit
+func (m Money) Percent(percent float64, mode RoundingMode) Money {
+	return m.Multiply(percent/100, mode)
+}
+
+// Multiply returns the amount times a rate, rounded to the minor unit. The
+// product is computed exactly before rounding.
+func (m Money) Multiply(rate float64, mode RoundingMode) Money {
+	exact := new(big.Rat).SetInt64(m.Amount)
+	exact.Mul(exact, exactRate(rate))
+	return Money{Amount: round(exact, mode), Currency: m.Currency}
+}
+
+// Fraction returns the amount times numerator/denominator, rounded to the
+// minor unit. The result is computed exactly before rounding.
+func (m Money) Fraction(numerator, denominator float64, mode RoundingMode) Money {
+	exact := new(big.Rat).SetInt64(m.Amount)
+	exact.Mul(exact, exactRate(numerator))
+	exact.Quo(exact, exactRate(denominator))
+	return Money{Amount: round(exact, mode), Currency: m.Currency}
+}
+
+// exactRate reads the rate as the decimal it prints as, so that 0.1 is one
+// tenth rather than the nearest binary fraction
+func exactRate(rate float64) *big.Rat {
+	factor, ok := new(big.Rat).SetString(fmt.Sprintf("%g", rate))
+	if !ok {
+		factor = new(big.Rat).SetFloat64(rate)
+	}
+	return factor
+}
+
+// Allocate splits the amount in proportion to the weights. The minor units
+// left over by rounding towards zero go one by one to the first shares, so the
+// shares always add up to the amount.
+func (m Money) Allocate(weights []int64) []Money {
+	shares := make([]Money, len(weights))
+	var total int64
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		for i := range shares {
+			shares[i] = Money{Currency: m.Currency}
+		}
+		return shares
+	}
+
+	var allocated int64
+	for i, weight := range weights {
+		share := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(weight))
+		share.Quo(share, big.NewInt(total))
+		shares[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+		allocated += shares[i].Amount
+	}
+	unit := int64(1)
+	if m.Amount < 0 {
+		unit = -1
+	}
+	for i := 0; allocated != m.Amount; i = (i + 1) % len(shares) {
+		if weights[i] > 0 {
+			shares[i].Amount += unit
+			allocated += unit
+		}
+	}
+	return shares
+}
+
+// String formats the amount with its currency, e.g. "12.50 USD"
+func (m Money) String() string {
+	exponent := Exponent(m.Currency)
+	if exponent == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, exponent, amount%scale, m.Currency)
+}
+
+func round(exact *big.Rat, mode RoundingMode) int64 {
+	quotient, remainder := new(big.Int).QuoRem(exact.Num(), exact.Denom(), new(big.Int))
+	if remainder.Sign() == 0 || mode == RoundDown {
+		return quotient.Int64()
+	}
+
+	// Compare twice the remainder with the denominator to find which half the
+	// fraction is in
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	cmp := twice.Cmp(exact.Denom())
+	away := cmp > 0 || (cmp == 0 && (mode == RoundHalfUp || quotient.Bit(0) == 1))
+	if away {
+		if exact.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient.Int64()
+}
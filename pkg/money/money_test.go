@@ -0,0 +1,133 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		rate     float64
+		mode     RoundingMode
+		expected int64
+	}{
+		{"half up rounds a half away from zero", 5, 0.5, RoundHalfUp, 3},
+		{"half up rounds a negative half away from zero", -5, 0.5, RoundHalfUp, -3},
+		{"half even rounds a half to the even unit below", 5, 0.5, RoundHalfEven, 2},
+		{"half even rounds a half to the even unit above", 7, 0.5, RoundHalfEven, 4},
+		{"half even rounds a negative half to the even unit", -5, 0.5, RoundHalfEven, -2},
+		{"half even rounds past a half up", 51, 0.1, RoundHalfEven, 5},
+		{"half even rounds below a half down", 49, 0.1, RoundHalfEven, 5},
+		{"down drops the fraction", 99, 0.1, RoundDown, 9},
+		{"down drops the fraction towards zero", -99, 0.1, RoundDown, -9},
+		{"exact amounts are not rounded", 250, 0.2, RoundHalfUp, 50},
+		// 0.1 * 0.35 is 0.034999... in binary but one half of a cent exactly
+		{"rates are read as decimals", 35, 0.1, RoundHalfUp, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, New(test.amount, "USD").Multiply(test.rate, test.mode).Amount)
+		})
+	}
+}
+
+func TestPercent(t *testing.T) {
+	price := New(1999, "USD")
+	assert.Equal(t, New(200, "USD"), price.Percent(10, RoundHalfUp))
+	assert.Equal(t, New(1000, "USD"), price.Percent(50, RoundHalfUp))
+	assert.Equal(t, New(1000, "USD"), price.Percent(50, RoundHalfEven))
+	assert.Equal(t, New(999, "USD"), price.Percent(50, RoundDown))
+}
+
+func TestFraction(t *testing.T) {
+	tests := []struct {
+		name                   string
+		amount                 int64
+		numerator, denominator float64
+		mode                   RoundingMode
+		expected               int64
+	}{
+		{"one third", 100, 1, 3, RoundHalfUp, 33},
+		{"two thirds", 100, 2, 3, RoundHalfUp, 67},
+		{"two thirds rounded down", 100, 2, 3, RoundDown, 66},
+		// 20 of 120 is exactly 1/6 of 1200, no float drift in the quotient
+		{"tax included at 20%", 1200, 20, 120, RoundHalfEven, 200},
+		{"half a unit goes to the even unit", 1, 1, 2, RoundHalfEven, 0},
+		{"half a unit goes up", 1, 1, 2, RoundHalfUp, 1},
+		{"decimal numerator", 1000, 7.5, 107.5, RoundHalfEven, 70},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, New(test.amount, "EUR").Fraction(test.numerator, test.denominator, test.mode).Amount)
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		weights  []int64
+		expected []int64
+	}{
+		{"even split", 300, []int64{1, 1, 1}, []int64{100, 100, 100}},
+		{"left over units go to the first shares", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"in proportion to the weights", 1000, []int64{1999, 999, 2}, []int64{667, 333, 0}},
+		{"zero weights get nothing", 10, []int64{0, 3, 0, 3}, []int64{0, 5, 0, 5}},
+		{"left over units skip zero weights", 5, []int64{0, 1, 1}, []int64{0, 3, 2}},
+		{"negative amount", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		{"single share", 12345, []int64{7}, []int64{12345}},
+		{"large amounts do not overflow", 1 << 40, []int64{1 << 30, 1 << 30}, []int64{1 << 39, 1 << 39}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shares := New(test.amount, "USD").Allocate(test.weights)
+			var amounts []int64
+			var sum int64
+			for _, share := range shares {
+				assert.Equal(t, "USD", share.Currency)
+				amounts = append(amounts, share.Amount)
+				sum += share.Amount
+			}
+			assert.Equal(t, test.expected, amounts)
+			assert.Equal(t, test.amount, sum, "the shares must add up to the amount")
+		})
+	}
+}
+
+func TestAllocateAlwaysAddsUpToTheAmount(t *testing.T) {
+	weights := [][]int64{{1}, {1, 2}, {3, 3, 3}, {5, 0, 7, 11}, {1, 1, 1, 1, 1, 1, 1}, {9999, 1}}
+	for amount := int64(-250); amount <= 250; amount++ {
+		for _, w := range weights {
+			var sum int64
+			for _, share := range New(amount, "USD").Allocate(w) {
+				sum += share.Amount
+			}
+			assert.Equal(t, amount, sum, "allocating %d over %v", amount, w)
+		}
+	}
+}
+
+func TestAllocateWithoutWeights(t *testing.T) {
+	shares := New(100, "USD").Allocate([]int64{0, 0})
+	assert.Equal(t, []Money{New(0, "USD"), New(0, "USD")}, shares)
+	assert.Empty(t, New(100, "USD").Allocate(nil))
+}
+
+func TestFromFloat(t *testing.T) {
+	assert.Equal(t, New(1999, "USD"), FromFloat(19.99, "usd"))
+	assert.Equal(t, New(1000, "USD"), FromFloat(10, ""))
+	assert.Equal(t, New(1500, "JPY"), FromFloat(1500, "JPY"))
+	assert.Equal(t, New(1235, "KWD"), FromFloat(1.2345, "KWD"))
+	assert.Equal(t, 19.99, New(1999, "USD").Float())
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "12.50 USD", New(1250, "USD").String())
+	assert.Equal(t, "-0.05 EUR", New(-5, "EUR").String())
+	assert.Equal(t, "1500 JPY", New(1500, "JPY").String())
+	assert.Equal(t, "1.005 KWD", New(1005, "KWD").String())
+}
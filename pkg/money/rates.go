@@ -0,0 +1,222 @@
+package money
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrUnknownRate = errors.New("no exchange rate for the currency")
+
+// RateProvider gives the exchange rate between two currencies
+type RateProvider interface {
+	// Rate returns how much one unit of from is worth in to
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+// Rates is a table of exchange rates against a base currency, as read from a
+// rates file or an HTTP provider:
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "GBP": 0.79}}
+type Rates struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Rate computes the rate between two currencies of the table, through the
+// base currency when neither of them is the base
+func (rates Rates) Rate(from, to string) (float64, error) {
+	from, to = NormalizeCurrency(from), NormalizeCurrency(to)
+	if from == to {
+		return 1, nil
+	}
+	fromRate, err := rates.againstBase(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := rates.againstBase(to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+func (rates Rates) againstBase(currency string) (float64, error) {
+	if currency == NormalizeCurrency(rates.Base) {
+		return 1, nil
+	}
+	rate, ok := rates.Rates[currency]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("%w %s", ErrUnknownRate, currency)
+	}
+	return rate, nil
+}
+
+type staticProvider struct {
+	rates Rates
+}
+
+// NewStaticProvider serves a fixed table of rates
+func NewStaticProvider(rates Rates) RateProvider {
+	return &staticProvider{rates}
+}
+
+// LoadStaticProvider reads the table of rates from a JSON file
+func LoadStaticProvider(path string) (RateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rates Rates
+	if err = json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("invalid rates file %s: %w", path, err)
+	}
+	return NewStaticProvider(rates), nil
+}
+
+// NewStubProvider serves made-up rates, for local runs and tests
+func NewStubProvider() RateProvider {
+	return NewStaticProvider(Rates{
+		Base: "USD",
+		Rates: map[string]float64{
+			"EUR": 0.9,
+			"GBP": 0.8,
+			"JPY": 150,
+			"CAD": 1.35,
+		},
+	})
+}
+
+func (provider *staticProvider) Rate(_ context.Context, from, to string) (float64, error) {
+	return provider.rates.Rate(from, to)
+}
+
+type httpProvider struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	rates     *Rates
+	fetchedAt time.Time
+}
+
+// NewHTTPProvider fetches the table of rates from url, in the same format as
+// the rates file, and keeps it for ttl. When a refresh fails the last table is
+// used until the next attempt.
+func NewHTTPProvider(url string, ttl time.Duration) RateProvider {
+	return &httpProvider{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (provider *httpProvider) Rate(ctx context.Context, from, to string) (float64, error) {
+	if NormalizeCurrency(from) == NormalizeCurrency(to) {
+		return 1, nil
+	}
+	rates, err := provider.current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return rates.Rate(from, to)
+}
+
+func (provider *httpProvider) current(ctx context.Context) (*Rates, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.rates != nil && time.Since(provider.fetchedAt) < provider.ttl {
+		return provider.rates, nil
+	}
+	rates, err := provider.fetch(ctx)
+	if err != nil {
+		if provider.rates != nil {
+			log.Println("Failed to refresh exchange rates, using the previous ones:", err)
+			return provider.rates, nil
+		}
+		return nil, err
+	}
+	provider.rates = rates
+	provider.fetchedAt = time.Now()
+	return rates, nil
+}
+
+func (provider *httpProvider) fetch(ctx context.Context) (*Rates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := provider.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate provider answered %s", res.Status)
+	}
+	var rates Rates
+	if err = json.NewDecoder(res.Body).Decode(&rates); err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+// NewRateProvider picks the provider from the configuration: the HTTP
+// provider when a url is set, else the rates file, else the stub
+func NewRateProvider(file, url string, ttl time.Duration) (RateProvider, error) {
+	switch {
+	case url != "":
+		return NewHTTPProvider(url, ttl), nil
+	case file != "":
+		return LoadStaticProvider(file)
+	default:
+		log.Println("No exchange rates configured, using stub rates")
+		return NewStubProvider(), nil
+	}
+}
+
+// Convert returns the amount in another currency, with the rate that was used
+func Convert(ctx context.Context, provider RateProvider, m Money, to string) (Money, float64, error) {
+	to = NormalizeCurrency(to)
+	if m.Currency == to {
+		return m, 1, nil
+	}
+	rate, err := provider.Rate(ctx, m.Currency, to)
+	if err != nil {
+		return Money{}, 0, err
+	}
+	return m.Convert(rate, to), rate, nil
+}
+
+// Convert applies an exchange rate to the amount, rounding half to even to
+// the minor unit of the new currency
+func (m Money) Convert(rate float64, currency string) Money {
+	currency = NormalizeCurrency(currency)
+	exact := new(big.Rat).SetInt64(m.Amount)
+	exact.Mul(exact, exactRate(rate))
+	// Move from the minor unit of one currency to the other's
+	shift := Exponent(currency) - Exponent(m.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift > 0 {
+		exact.Mul(exact, scale)
+	} else if shift < 0 {
+		exact.Quo(exact, scale)
+	}
+	return Money{Amount: round(exact, RoundHalfEven), Currency: currency}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
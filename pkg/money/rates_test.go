@@ -0,0 +1,76 @@
+package money
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     Money
+		rate     float64
+		to       string
+		expected Money
+	}{
+		{"same exponent", New(1000, "USD"), 0.9, "EUR", New(900, "EUR")},
+		// 2998.5 yen
+		{"to a currency without decimals", New(1999, "USD"), 150, "JPY", New(2998, "JPY")},
+		{"from a currency without decimals", New(1500, "JPY"), 1.0 / 150, "USD", New(1000, "USD")},
+		{"to a currency with three decimals", New(100, "USD"), 0.3075, "KWD", New(308, "KWD")},
+		{"half a unit goes to the even unit below", New(1, "USD"), 0.5, "EUR", New(0, "EUR")},
+		{"half a unit goes to the even unit above", New(3, "USD"), 0.5, "EUR", New(2, "EUR")},
+		{"negative amounts", New(-3, "USD"), 0.5, "EUR", New(-2, "EUR")},
+		{"the currency is normalised", New(1000, "USD"), 1.35, "cad", New(1350, "CAD")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.from.Convert(test.rate, test.to))
+		})
+	}
+}
+
+func TestConvertWithProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := NewStubProvider()
+
+	converted, rate, err := Convert(ctx, provider, New(1000, "EUR"), "GBP")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.8/0.9, rate, 1e-12)
+	assert.Equal(t, New(889, "GBP"), converted)
+
+	// The same currency is returned as is, without asking for a rate
+	converted, rate, err = Convert(ctx, provider, New(1000, "CHF"), "chf")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, rate)
+	assert.Equal(t, New(1000, "CHF"), converted)
+
+	_, _, err = Convert(ctx, provider, New(1000, "USD"), "CHF")
+	assert.True(t, errors.Is(err, ErrUnknownRate))
+}
+
+func TestRatesThroughTheBase(t *testing.T) {
+	rates := Rates{Base: "usd", Rates: map[string]float64{"EUR": 0.9, "JPY": 150, "XXX": 0}}
+	tests := []struct {
+		from, to string
+		expected float64
+	}{
+		{"USD", "EUR", 0.9},
+		{"EUR", "USD", 1 / 0.9},
+		{"EUR", "JPY", 150 / 0.9},
+		{"eur", "EUR", 1},
+	}
+	for _, test := range tests {
+		rate, err := rates.Rate(test.from, test.to)
+		assert.NoError(t, err)
+		assert.InDelta(t, test.expected, rate, 1e-9, "%s to %s", test.from, test.to)
+	}
+
+	_, err := rates.Rate("USD", "XXX")
+	assert.True(t, errors.Is(err, ErrUnknownRate), "a zero rate is unknown")
+	_, err = rates.Rate("GBP", "EUR")
+	assert.True(t, errors.Is(err, ErrUnknownRate))
+}
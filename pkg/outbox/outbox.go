@@ -0,0 +1,129 @@
+// Package outbox saves the events of a service in its database, in the same
+// transaction as the change they announce, and relays them to Kafka once the
+// change is committed. An event is never lost when Kafka or the service is
+// down; it may be published more than once.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Message is an event waiting in the outbox, or already published
+type Message struct {
+	ID    uint `gorm:"primaryKey;autoIncrement"`
+	Topic string
+	// Kafka key of the message, usually the ID of the entity it is about.
+	// The messages of a key are published in the order they were saved.
+	Key       string `gorm:"index"`
+	Payload   string
+	CreatedAt time.Time `gorm:"index"`
+	// Nil until the message is published
+	PublishedAt *time.Time `gorm:"index"`
+	// Failed attempts to publish the message, the next one is not made
+	// before NextAttemptAt
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// NewMessage encodes the event in JSON as a message for the topic
+func NewMessage(topic, key string, event any) (Message, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Topic: topic, Key: key, Payload: string(payload)}, nil
+}
+
+// Enqueue saves the messages in the transaction of the change they announce
+func Enqueue(tx *gorm.DB, messages ...Message) error {
+	now := time.Now().UTC()
+	for i := range messages {
+		messages[i].CreatedAt = now
+		messages[i].NextAttemptAt = now
+		if err := tx.Create(&messages[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store is the outbox table of a service
+type Store interface {
+	// Due returns the oldest unpublished message of each key, among those
+	// whose next attempt is due, oldest first
+	Due(ctx context.Context, now time.Time, limit int) ([]Message, error)
+	MarkPublished(ctx context.Context, id uint, at time.Time) error
+	MarkFailed(ctx context.Context, id uint, lastError string, nextAttemptAt time.Time) error
+	// Pending returns how many messages are not published yet and when the
+	// oldest of them was saved
+	Pending(ctx context.Context) (int64, *time.Time, error)
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewStore returns the outbox table of a database, which must have been
+// migrated with Message
+func NewStore(db *gorm.DB) Store {
+	return &gormStore{db}
+}
+
+func (store *gormStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	var messages []Message
+	err := store.db.WithContext(ctx).Raw(`
+		SELECT * FROM (
+			SELECT DISTINCT ON (key) * FROM outbox_messages
+			WHERE published_at IS NULL
+			ORDER BY key, id
+		) AS heads
+		WHERE next_attempt_at <= ?
+		ORDER BY id
+		LIMIT ?`, now, limit).Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (store *gormStore) MarkPublished(ctx context.Context, id uint, at time.Time) error {
+	return store.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).Update("published_at", at).Error
+}
+
+func (store *gormStore) MarkFailed(ctx context.Context, id uint, lastError string, nextAttemptAt time.Time) error {
+	return store.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      lastError,
+		"next_attempt_at": nextAttemptAt,
+	}).Error
+}
+
+func (store *gormStore) Pending(ctx context.Context) (int64, *time.Time, error) {
+	var pending struct {
+		Count  int64
+		Oldest *time.Time
+	}
+	err := store.db.WithContext(ctx).Model(&Message{}).
+		Select("COUNT(*) AS count, MIN(created_at) AS oldest").
+		Where("published_at IS NULL").
+		Scan(&pending).Error
+	if err != nil {
+		return 0, nil, err
+	}
+	return pending.Count, pending.Oldest, nil
+}
+
+func (store *gormStore) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result := store.db.WithContext(ctx).Where("published_at < ?", before).Delete(&Message{})
+	return result.RowsAffected, result.Error
+}
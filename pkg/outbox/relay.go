@@ -0,0 +1,154 @@
+package outbox
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	batchSize = 100
+	// Failed messages are retried after 1s, 2s, 4s... up to maxBackoff
+	maxBackoff = 5 * time.Minute
+	// Published messages are kept this long to investigate duplicates
+	retention = 7 * 24 * time.Hour
+)
+
+// Metrics of the relay, served by expvar under "outbox"
+var (
+	metrics          = expvar.NewMap("outbox")
+	publishedCount   = new(expvar.Int)
+	failedCount      = new(expvar.Int)
+	pendingCount     = new(expvar.Int)
+	lagSeconds       = new(expvar.Float)
+	lastRelayedEpoch = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("published", publishedCount)
+	metrics.Set("failed_attempts", failedCount)
+	metrics.Set("pending", pendingCount)
+	// Age of the oldest unpublished message
+	metrics.Set("lag_seconds", lagSeconds)
+	metrics.Set("last_relayed_at", lastRelayedEpoch)
+}
+
+// NewProducer connects to Kafka with the settings the relay needs: the
+// partition of a message is chosen by its key, so the messages of a key stay
+// in order, and a message is only sent once every replica has it
+func NewProducer(brokers []string) (sarama.SyncProducer, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	return sarama.NewSyncProducer(brokers, config)
+}
+
+// Relay publishes the messages of an outbox. Only one relay should run per
+// database, or the messages of a key could be published out of order.
+type Relay struct {
+	store    Store
+	producer sarama.SyncProducer
+}
+
+func NewRelay(store Store, producer sarama.SyncProducer) *Relay {
+	return &Relay{store, producer}
+}
+
+// Run relays the outbox every interval until the context is done
+func (relay *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		if _, err := relay.Flush(ctx); err != nil {
+			log.Println("Failed to relay the outbox:", err)
+		}
+		if time.Since(lastPurge) > time.Hour {
+			deleted, err := relay.store.DeletePublished(ctx, time.Now().UTC().Add(-retention))
+			if err != nil {
+				log.Println("Failed to delete published outbox messages:", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d published outbox messages", deleted)
+			}
+			lastPurge = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes every message that is due and returns how many were
+// published. A message is only marked published once Kafka has it, so a
+// crash in between publishes it again. Each round publishes at most the
+// oldest message of each key; a message that fails holds back the ones after
+// it with the same key until it is retried.
+func (relay *Relay) Flush(ctx context.Context) (int, error) {
+	defer relay.updateLag(ctx)
+
+	published := 0
+	for {
+		now := time.Now().UTC()
+		messages, err := relay.store.Due(ctx, now, batchSize)
+		if err != nil {
+			return published, err
+		}
+		sent := 0
+		for _, message := range messages {
+			_, _, err = relay.producer.SendMessage(&sarama.ProducerMessage{
+				Topic: message.Topic,
+				Key:   sarama.StringEncoder(message.Key),
+				Value: sarama.StringEncoder(message.Payload),
+			})
+			if err != nil {
+				failedCount.Add(1)
+				log.Printf("Failed to publish outbox message %d: %v", message.ID, err)
+				if err = relay.store.MarkFailed(ctx, message.ID, err.Error(), now.Add(backoff(message.Attempts+1))); err != nil {
+					return published, err
+				}
+				continue
+			}
+			if err = relay.store.MarkPublished(ctx, message.ID, time.Now().UTC()); err != nil {
+				return published, err
+			}
+			publishedCount.Add(1)
+			lastRelayedEpoch.Set(time.Now().Unix())
+			sent++
+		}
+		published += sent
+		if sent == 0 {
+			return published, nil
+		}
+	}
+}
+
+func (relay *Relay) updateLag(ctx context.Context) {
+	count, oldest, err := relay.store.Pending(ctx)
+	if err != nil {
+		log.Println("Failed to measure the outbox lag:", err)
+		return
+	}
+	pendingCount.Set(count)
+	if oldest == nil {
+		lagSeconds.Set(0)
+		return
+	}
+	lagSeconds.Set(time.Since(*oldest).Seconds())
+}
+
+func backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
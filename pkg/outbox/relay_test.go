@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an outbox kept in memory, picking the due messages the way
+// the SQL of gormStore does
+type memoryStore struct {
+	messages []*Message
+}
+
+func (store *memoryStore) add(key string) *Message {
+	message := &Message{
+		ID:      uint(len(store.messages) + 1),
+		Topic:   "test_events",
+		Key:     key,
+		Payload: fmt.Sprintf(`{"n":%d}`, len(store.messages)+1),
+	}
+	store.messages = append(store.messages, message)
+	return message
+}
+
+func (store *memoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	heads := map[string]*Message{}
+	for _, message := range store.messages {
+		if message.PublishedAt != nil {
+			continue
+		}
+		if head, ok := heads[message.Key]; !ok || message.ID < head.ID {
+			heads[message.Key] = message
+		}
+	}
+	var due []Message
+	for _, head := range heads {
+		if !head.NextAttemptAt.After(now) {
+			due = append(due, *head)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (store *memoryStore) MarkPublished(ctx context.Context, id uint, at time.Time) error {
+	store.messages[id-1].PublishedAt = &at
+	return nil
+}
+
+func (store *memoryStore) MarkFailed(ctx context.Context, id uint, lastError string, nextAttemptAt time.Time) error {
+	message := store.messages[id-1]
+	message.Attempts++
+	message.LastError = lastError
+	message.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func (store *memoryStore) Pending(ctx context.Context) (int64, *time.Time, error) {
+	var count int64
+	for _, message := range store.messages {
+		if message.PublishedAt == nil {
+			count++
+		}
+	}
+	return count, nil, nil
+}
+
+func (store *memoryStore) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// expectKey checks that the next message sent has the key and payload of the
+// message
+func expectKey(message *Message) mocks.MessageChecker {
+	return func(sent *sarama.ProducerMessage) error {
+		key, _ := sent.Key.Encode()
+		value, _ := sent.Value.Encode()
+		if string(key) != message.Key || string(value) != message.Payload {
+			return fmt.Errorf("sent %s %s, expected message %d of key %s", key, value, message.ID, message.Key)
+		}
+		return nil
+	}
+}
+
+func TestFlushPublishesTheMessagesOfAKeyInOrder(t *testing.T) {
+	store := &memoryStore{}
+	a1, a2, b1, a3 := store.add("a"), store.add("a"), store.add("b"), store.add("a")
+
+	// One message per key and round: a1 and b1, then a2, then a3
+	producer := mocks.NewSyncProducer(t, nil)
+	for _, message := range []*Message{a1, b1, a2, a3} {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectKey(message))
+	}
+
+	published, err := NewRelay(store, producer).Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, published)
+	for _, message := range store.messages {
+		assert.NotNil(t, message.PublishedAt, "message %d was not marked published", message.ID)
+	}
+	assert.NoError(t, producer.Close())
+}
+
+func TestFlushHoldsBackTheKeyOfAFailedMessage(t *testing.T) {
+	store := &memoryStore{}
+	a1, a2, b1 := store.add("a"), store.add("a"), store.add("b")
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndFail(expectKey(a1), errors.New("broker down"))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectKey(b1))
+	relay := NewRelay(store, producer)
+
+	before := time.Now().UTC()
+	published, err := relay.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Nil(t, a1.PublishedAt)
+	assert.Nil(t, a2.PublishedAt, "a message must wait for the failed one before it")
+	assert.Equal(t, 1, a1.Attempts)
+	assert.Equal(t, "broker down", a1.LastError)
+	assert.False(t, a1.NextAttemptAt.Before(before.Add(time.Second)))
+
+	// Nothing is sent before the failed message is due again
+	published, err = relay.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+
+	a1.NextAttemptAt = time.Time{}
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectKey(a1))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectKey(a2))
+	published, err = relay.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.NoError(t, producer.Close())
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 4*time.Second, backoff(3))
+	assert.Equal(t, 256*time.Second, backoff(9))
+	assert.Equal(t, maxBackoff, backoff(10))
+	// The delay stops doubling at the cap instead of overflowing
+	assert.Equal(t, maxBackoff, backoff(1000))
+}
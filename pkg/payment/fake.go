@@ -0,0 +1,181 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+// Payment methods the fake gateway understands. Any other method is accepted.
+const (
+	FakeMethodOK       = "pm_fake_ok"
+	FakeMethodDeclined = "pm_fake_declined"
+)
+
+type fakePayment struct {
+	authorized money.Money
+	captured   int64
+	refunded   int64
+	status     string
+	// References of the refunds made
+	refunds map[string]bool
+}
+
+// FakeGateway is an in-process payment provider for tests and local runs. It
+// gives the same answers for the same calls: payments are declined only for
+// FakeMethodDeclined, and provider references are derived from our own.
+// When a webhook url is set, it also sends the signed webhooks a real
+// provider would.
+type FakeGateway struct {
+	webhookURL    string
+	webhookSecret string
+	client        *http.Client
+
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+}
+
+func NewFakeGateway(webhookURL, webhookSecret string) *FakeGateway {
+	return &FakeGateway{
+		webhookURL:    webhookURL,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 5 * time.Second},
+		payments:      map[string]*fakePayment{},
+	}
+}
+
+func (gateway *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (gateway *FakeGateway) Authorize(_ context.Context, request AuthorizeRequest) (Result, error) {
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+
+	ref := "fake_" + request.Reference
+	if existing, ok := gateway.payments[ref]; ok {
+		return Result{ProviderRef: ref, Status: existing.status}, nil
+	}
+	if request.PaymentMethod == FakeMethodDeclined {
+		gateway.payments[ref] = &fakePayment{authorized: request.Amount, status: StatusDeclined}
+		gateway.notify(EventFailed, ref, request.Amount)
+		return Result{ProviderRef: ref, Status: StatusDeclined, FailureReason: "card declined"}, nil
+	}
+	gateway.payments[ref] = &fakePayment{authorized: request.Amount, status: StatusAuthorized}
+	return Result{ProviderRef: ref, Status: StatusAuthorized}, nil
+}
+
+func (gateway *FakeGateway) Capture(_ context.Context, providerRef string, amount money.Money) (Result, error) {
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+
+	p, ok := gateway.payments[providerRef]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if p.status == StatusCaptured {
+		return Result{ProviderRef: providerRef, Status: p.status}, nil
+	}
+	if p.status != StatusAuthorized {
+		return Result{}, ErrInvalidState
+	}
+	if amount.Currency != p.authorized.Currency || amount.Amount > p.authorized.Amount {
+		return Result{}, ErrInvalidAmount
+	}
+	p.captured = amount.Amount
+	p.status = StatusCaptured
+	gateway.notify(EventCaptured, providerRef, amount)
+	return Result{ProviderRef: providerRef, Status: p.status}, nil
+}
+
+func (gateway *FakeGateway) Refund(_ context.Context, providerRef, reference string, amount money.Money) (Result, error) {
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+
+	p, ok := gateway.payments[providerRef]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if p.refunds[reference] {
+		return Result{ProviderRef: providerRef, Status: p.status, RefundedMinor: p.refunded}, nil
+	}
+	if p.status != StatusCaptured {
+		return Result{}, ErrInvalidState
+	}
+	if amount.Currency != p.authorized.Currency || p.refunded+amount.Amount > p.captured {
+		return Result{}, ErrInvalidAmount
+	}
+	p.refunded += amount.Amount
+	if p.refunds == nil {
+		p.refunds = map[string]bool{}
+	}
+	p.refunds[reference] = true
+	if p.refunded == p.captured {
+		p.status = StatusRefunded
+	}
+	gateway.notify(EventRefunded, providerRef, money.New(p.refunded, amount.Currency))
+	return Result{ProviderRef: providerRef, Status: p.status, RefundedMinor: p.refunded}, nil
+}
+
+func (gateway *FakeGateway) Void(_ context.Context, providerRef string) (Result, error) {
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+
+	p, ok := gateway.payments[providerRef]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if p.status != StatusAuthorized {
+		return Result{}, ErrInvalidState
+	}
+	p.status = StatusVoided
+	gateway.notify(EventVoided, providerRef, p.authorized)
+	return Result{ProviderRef: providerRef, Status: p.status}, nil
+}
+
+// notify sends the webhook of an event in the background
+func (gateway *FakeGateway) notify(eventType, providerRef string, amount money.Money) {
+	if gateway.webhookURL == "" {
+		return
+	}
+	id := providerRef + "." + eventType
+	if eventType == EventRefunded {
+		// A payment can be refunded in several parts
+		id += "." + strconv.FormatInt(amount.Amount, 10)
+	}
+	event := Event{
+		ID:          id,
+		Type:        eventType,
+		ProviderRef: providerRef,
+		Amount:      amount.Amount,
+		Currency:    amount.Currency,
+		CreatedAt:   time.Now().UTC(),
+	}
+	go func() {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Println("Failed to marshal webhook:", err)
+			return
+		}
+		req, err := http.NewRequest(http.MethodPost, gateway.webhookURL, bytes.NewReader(body))
+		if err != nil {
+			log.Println("Failed to create webhook request:", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, Sign(gateway.webhookSecret, body, time.Now()))
+		res, err := gateway.client.Do(req)
+		if err != nil {
+			log.Println("Failed to send webhook:", err)
+			return
+		}
+		res.Body.Close()
+	}()
+}
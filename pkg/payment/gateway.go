@@ -0,0 +1,63 @@
+// Package payment talks to the payment provider: it authorizes, captures,
+// refunds and voids payments, and verifies the webhooks the provider sends
+// when the state of a payment changes.
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+// Status of a payment at the provider
+const (
+	StatusAuthorized = "AUTHORIZED"
+	StatusCaptured   = "CAPTURED"
+	StatusDeclined   = "DECLINED"
+	StatusRefunded   = "REFUNDED"
+	StatusVoided     = "VOIDED"
+)
+
+var (
+	ErrUnknownPayment = errors.New("the provider has no such payment")
+	ErrInvalidAmount  = errors.New("the amount exceeds what the payment allows")
+	ErrInvalidState   = errors.New("the payment is not in a state that allows this operation")
+)
+
+// AuthorizeRequest asks the provider to hold an amount on a payment method
+type AuthorizeRequest struct {
+	// Our reference for the payment, the provider refuses to authorize the
+	// same reference twice so retries do not charge twice
+	Reference     string
+	Amount        money.Money
+	PaymentMethod string
+}
+
+// Result is the state of a payment after an operation
+type Result struct {
+	// The provider's ID of the payment
+	ProviderRef string
+	Status      string
+	// Why the provider declined the payment
+	FailureReason string
+	// Part of the captured amount given back so far, in minor units
+	RefundedMinor int64
+}
+
+// PaymentGateway is implemented by each payment provider
+type PaymentGateway interface {
+	// Name identifies the provider in the stored payments
+	Name() string
+	// Authorize holds the amount, a declined payment is a result and not an error
+	Authorize(ctx context.Context, request AuthorizeRequest) (Result, error)
+	// Capture takes the money held by an authorization
+	Capture(ctx context.Context, providerRef string, amount money.Money) (Result, error)
+	// Refund gives back money that was captured, in one or several parts. The
+	// payment is REFUNDED once all of it is given back. The reference is ours
+	// for the refund: a payment is refunded once per reference, so a retry
+	// gets the refund already made instead of a second one.
+	Refund(ctx context.Context, providerRef, reference string, amount money.Money) (Result, error)
+	// Void releases an authorization that was not captured
+	Void(ctx context.Context, providerRef string) (Result, error)
+}
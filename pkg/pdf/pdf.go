@@ -0,0 +1,172 @@
+// Package pdf writes simple PDF documents, such as invoices: A4 pages of text
+// and lines. The text is set in Helvetica, one of the fonts every PDF reader
+// has, so no font is embedded and the documents stay small.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+)
+
+// Size of an A4 page in points, the unit of every coordinate
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document is a PDF being written. Coordinates are in points from the bottom
+// left corner of the page.
+type Document struct {
+	pages []*bytes.Buffer
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage starts a new page, what is drawn next goes on it
+func (doc *Document) AddPage() {
+	doc.pages = append(doc.pages, &bytes.Buffer{})
+}
+
+// PageCount returns the number of pages started so far
+func (doc *Document) PageCount() int {
+	return len(doc.pages)
+}
+
+// Text draws text whose baseline starts at x, y
+func (doc *Document) Text(font Font, size, x, y float64, text string) {
+	page := doc.page()
+	fmt.Fprintf(page, "BT /F%d %s Tf %s %s Td (", font+1, number(size), number(x), number(y))
+	page.Write(encode(text))
+	page.WriteString(") Tj ET\n")
+}
+
+// TextRight draws text whose baseline ends at x, y
+func (doc *Document) TextRight(font Font, size, x, y float64, text string) {
+	doc.Text(font, size, x-Width(font, size, text), y, text)
+}
+
+// Line draws a thin line from x1, y1 to x2, y2
+func (doc *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(doc.page(), "0.5 w %s %s m %s %s l S\n", number(x1), number(y1), number(x2), number(y2))
+}
+
+func (doc *Document) page() *bytes.Buffer {
+	if len(doc.pages) == 0 {
+		doc.AddPage()
+	}
+	return doc.pages[len(doc.pages)-1]
+}
+
+// Bytes returns the PDF file: the catalog, the page tree, the two fonts, then
+// each page with its content, and the cross-reference table that locates them
+func (doc *Document) Bytes() []byte {
+	if len(doc.pages) == 0 {
+		doc.AddPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids bytes.Buffer
+	for i := range doc.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", 5+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", bytes.TrimSpace(kids.Bytes()), len(doc.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range doc.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			number(PageWidth), number(PageHeight), 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// Width returns how wide the text is drawn, in points
+func Width(font Font, size float64, text string) float64 {
+	widths := &helveticaWidths
+	if font == Bold {
+		widths = &helveticaBoldWidths
+	}
+	var total int
+	for _, r := range text {
+		if r >= ' ' && r <= '~' {
+			total += widths[r-' ']
+		} else {
+			// Most accented letters are as wide as the digits
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// encode converts the text to WinAnsiEncoding, the encoding of the fonts,
+// and escapes it for a PDF string. The characters it lacks become '?'.
+func encode(text string) []byte {
+	var out []byte
+	for _, r := range text {
+		var b byte
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out = append(out, '\\')
+			b = byte(r)
+		case r < ' ':
+			b = ' '
+		case r <= '~', r >= 0xa0 && r <= 0xff:
+			b = byte(r)
+		case r == '€':
+			b = 0x80
+		default:
+			b = '?'
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func number(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// Advance widths of the printable ASCII characters, from ' ' to '~', in
+// thousandths of the font size, as published in the Adobe font metrics
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
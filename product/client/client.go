@@ -2,12 +2,18 @@ package client
 
 import (
 	"context"
+	"io"
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/pkg/money"
 	"github.com/thomas/EcommerceAPI/product/models"
 	"github.com/thomas/EcommerceAPI/product/proto/pb"
 )
@@ -30,23 +36,21 @@ func (client *Client) Close() {
 	client.conn.Close()
 }
 
-func (client *Client) GetProduct(ctx context.Context, id string) (*models.Product, error) {
+// GetProduct returns a product by id. viewerId is the account asking for
+// it (0 when anonymous), owners can see their unpublished products.
+func (client *Client) GetProduct(ctx context.Context, id string, viewerId int) (*models.Product, error) {
 	res, err := client.service.GetProduct(ctx, &pb.ProductByIdRequest{
-		Id: id,
+		Id:       id,
+		ViewerId: int64(viewerId),
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &models.Product{
-		ID:          res.Product.Id,
-		Name:        res.Product.Name,
-		Description: res.Product.Description,
-		Price:       res.Product.Price,
-		AccountID:   int(res.Product.GetAccountId()),
-		Category:    "", // Category is not available in the current implementation
-	}, nil
+	product := productFromProto(res.Product)
+	return &product, nil
 }
 
+// GetProducts returns the published products, by ID or matching the query
 func (client *Client) GetProducts(ctx context.Context, skip, take uint64, ids []string, query string) ([]models.Product, error) {
 	res, err := client.service.GetProducts(ctx, &pb.GetProductsRequest{
 		Skip:  skip,
@@ -57,70 +61,86 @@ func (client *Client) GetProducts(ctx context.Context, skip, take uint64, ids []
 	if err != nil {
 		return nil, err
 	}
+	// The response already carries every field, so there is no need to
+	// fetch products one by one (which would also count as a product view)
 	var products []models.Product
 	for _, p := range res.Products {
-		// Get the product from Elasticsearch to get the category field
-		product, err := client.GetProduct(ctx, p.Id)
-		if err != nil {
-			// If there's an error, just use the data from the gRPC response
-			products = append(products, models.Product{
-				ID:          p.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-				AccountID:   int(p.AccountId),
-				Category:    "", // Category is not available in the current implementation
-			})
-		} else {
-			// Use the data from Elasticsearch
-			products = append(products, *product)
-		}
+		products = append(products, productFromProto(p))
 	}
 	return products, nil
 }
 
-func (client *Client) PostProduct(ctx context.Context, name, description string, price float64, accountId int64, category string) (*models.Product, error) {
+// GetProductsForService returns the products by ID whatever their status,
+// for the services keeping orders of products that were archived since
+func (client *Client) GetProductsForService(ctx context.Context, ids []string) ([]models.Product, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-role", auth.RoleService)
+	return client.GetProducts(ctx, 0, 0, ids, "")
+}
+
+func (client *Client) PostProduct(ctx context.Context, name, description string, price float64, currency string, accountId int64, category, status string) (*models.Product, error) {
 	// Note: The current implementation doesn't support category
 	res, err := client.service.PostProduct(ctx, &pb.CreateProductRequest{
 		Name:        name,
 		Description: description,
 		Price:       price,
+		Currency:    currency,
 		AccountId:   accountId,
+		Status:      status,
 	})
 	if err != nil {
 		log.Println("Error creating product", err)
 		return nil, err
 	}
-	return &models.Product{
-		ID:          res.Product.Id,
-		Name:        res.Product.Name,
-		Description: res.Product.Description,
-		Price:       res.Product.Price,
-		AccountID:   int(res.Product.GetAccountId()),
-		Category:    category,
-	}, nil
+	product := productFromProto(res.Product)
+	product.Category = category
+	return &product, nil
 }
 
-func (client *Client) UpdateProduct(ctx context.Context, id, name, description string, price float64, accountId int64, category string) (*models.Product, error) {
-	// Note: The current implementation doesn't support category
-	res, err := client.service.UpdateProduct(ctx, &pb.UpdateProductRequest{
-		Id:          id,
-		Name:        name,
-		Description: description,
-		Price:       price,
-		AccountId:   accountId,
-	})
+// UpdateProduct changes the fields set in changes, the others keep their value.
+// A non zero expectedVersion makes the call fail with codes.Aborted if the
+// product was edited meanwhile.
+func (client *Client) UpdateProduct(ctx context.Context, id string, accountId int64, changes models.ProductChanges, expectedVersion int64) (*models.Product, error) {
+	req := &pb.UpdateProductRequest{
+		Id:              id,
+		AccountId:       accountId,
+		ExpectedVersion: expectedVersion,
+		UpdateMask:      &fieldmaskpb.FieldMask{},
+	}
+	if changes.Name != nil {
+		req.Name = *changes.Name
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "name")
+	}
+	if changes.Description != nil {
+		req.Description = *changes.Description
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "description")
+	}
+	if changes.Price != nil {
+		req.Price = *changes.Price
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "price")
+	}
+	if changes.Category != nil {
+		req.Category = *changes.Category
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "category")
+	}
+	if changes.Stock != nil {
+		req.Stock = *changes.Stock
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "stock")
+	}
+	if changes.WeightGrams != nil {
+		req.WeightGrams = *changes.WeightGrams
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "weightGrams")
+	}
+	if changes.TaxCategory != nil {
+		req.TaxCategory = *changes.TaxCategory
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "taxCategory")
+	}
+
+	res, err := client.service.UpdateProduct(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	return &models.Product{
-		ID:          res.Product.Id,
-		Name:        res.Product.Name,
-		Description: res.Product.Description,
-		Price:       res.Product.Price,
-		AccountID:   int(res.Product.GetAccountId()),
-		Category:    category,
-	}, nil
+	product := productFromProto(res.Product)
+	return &product, nil
 }
 
 func (client *Client) DeleteProduct(ctx context.Context, productId string, accountId int64) error {
@@ -128,9 +148,77 @@ func (client *Client) DeleteProduct(ctx context.Context, productId string, accou
 	return err
 }
 
-func (client *Client) SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, sortOrder string) ([]models.Product, error) {
+// ReserveStock holds the stock of the items for the reservation, all of them
+// or none. It fails with codes.FailedPrecondition when one runs out.
+func (client *Client) ReserveStock(ctx context.Context, reservationId string, items []models.StockItem) error {
+	req := &pb.ReserveStockRequest{ReservationId: reservationId}
+	for _, item := range items {
+		req.Items = append(req.Items, &pb.StockItem{ProductId: item.ProductID, Quantity: item.Quantity})
+	}
+	_, err := client.service.ReserveStock(ctx, req)
+	return err
+}
+
+// ReleaseStock puts the stock held for the reservation back
+func (client *Client) ReleaseStock(ctx context.Context, reservationId string, productIds []string) error {
+	_, err := client.service.ReleaseStock(ctx, &pb.StockHoldRequest{ReservationId: reservationId, ProductIds: productIds})
+	return err
+}
+
+// CommitStock keeps the stock held for the reservation sold
+func (client *Client) CommitStock(ctx context.Context, reservationId string, productIds []string) error {
+	_, err := client.service.CommitStock(ctx, &pb.StockHoldRequest{ReservationId: reservationId, ProductIds: productIds})
+	return err
+}
+
+// RestockStock puts the items back in stock, once per restock ID
+func (client *Client) RestockStock(ctx context.Context, restockId string, items []models.StockItem) error {
+	req := &pb.RestockRequest{RestockId: restockId}
+	for _, item := range items {
+		req.Items = append(req.Items, &pb.StockItem{ProductId: item.ProductID, Quantity: item.Quantity})
+	}
+	_, err := client.service.RestockStock(ctx, req)
+	return err
+}
+
+// GetProductsForAccount lists the products of a seller. The seller and
+// admins also get the drafts and archived ones.
+func (client *Client) GetProductsForAccount(ctx context.Context, accountId int64, skip, take uint64, callerID, role string) ([]models.Product, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-id", callerID, "caller-role", role)
+	res, err := client.service.GetProducts(ctx, &pb.GetProductsRequest{
+		Skip:      skip,
+		Take:      take,
+		AccountId: accountId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	for _, p := range res.Products {
+		products = append(products, productFromProto(p))
+	}
+	return products, nil
+}
+
+func (client *Client) SetProductStatus(ctx context.Context, productId string, accountId int64, status string) (*models.Product, error) {
+	res, err := client.service.SetProductStatus(ctx, &pb.SetProductStatusRequest{
+		ProductId: productId,
+		AccountId: accountId,
+		Status:    status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	product := productFromProto(res.Product)
+	return &product, nil
+}
+
+// SearchProducts filters and sorts the published products. Prices in other
+// currencies than the one of the price range are converted with rates before
+// they are compared, for the price filter and the price sorts alike.
+func (client *Client) SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, minRating float64, sortOrder string, rates money.RateProvider) ([]models.Product, error) {
 	// Use the repository's direct search capabilities
-	log.Printf("Searching products with query=%s, priceRange=%v, category=%s, sortOrder=%s", query, priceRange, category, sortOrder)
+	log.Printf("Searching products with query=%s, priceRange=%v, category=%s, minRating=%v, sortOrder=%s", query, priceRange, category, minRating, sortOrder)
 
 	// Get all products first to ensure we have the most up-to-date data
 	allProducts, err := client.GetProducts(ctx, 0, 1000, nil, "")
@@ -148,7 +236,7 @@ func (client *Client) SearchProducts(ctx context.Context, query string, skip, ta
 		for _, product := range allProducts {
 			// Simple case-insensitive substring search
 			if strings.Contains(strings.ToLower(product.Name), strings.ToLower(query)) ||
-			   strings.Contains(strings.ToLower(product.Description), strings.ToLower(query)) {
+				strings.Contains(strings.ToLower(product.Description), strings.ToLower(query)) {
 				filteredProducts = append(filteredProducts, product)
 			}
 		}
@@ -157,21 +245,41 @@ func (client *Client) SearchProducts(ctx context.Context, query string, skip, ta
 		filteredProducts = allProducts
 	}
 
+	// Prices are compared in minor units of the currency of the price range
+	currency := money.DefaultCurrency
+	if priceRange != nil {
+		currency = money.NormalizeCurrency(priceRange.Currency)
+	}
+	filtering := priceRange != nil && (priceRange.Min > 0 || priceRange.Max > 0)
+	prices := map[string]int64{}
+	if filtering || sortOrder == "PRICE_ASC" || sortOrder == "PRICE_DESC" {
+		for _, product := range filteredProducts {
+			price, _, err := money.Convert(ctx, rates, product.PriceMoney(), currency)
+			if err != nil {
+				log.Printf("Cannot compare the price of product %s: %v", product.ID, err)
+				return nil, err
+			}
+			prices[product.ID] = price.Amount
+		}
+	}
+
 	// Apply price range filtering
-	if priceRange != nil && (priceRange.Min > 0 || priceRange.Max > 0) {
-		log.Printf("Applying price range filter: Min=%v, Max=%v", priceRange.Min, priceRange.Max)
+	if filtering {
+		log.Printf("Applying price range filter: Min=%v, Max=%v %s", priceRange.Min, priceRange.Max, currency)
+		minPrice := money.FromFloat(priceRange.Min, currency).Amount
+		maxPrice := money.FromFloat(priceRange.Max, currency).Amount
 		var priceFilteredProducts []models.Product
 
 		for _, product := range filteredProducts {
 			passesFilter := true
 
 			// Apply minimum price filter if set
-			if priceRange.Min > 0 && product.Price < priceRange.Min {
+			if priceRange.Min > 0 && prices[product.ID] < minPrice {
 				passesFilter = false
 			}
 
 			// Apply maximum price filter if set
-			if priceRange.Max > 0 && product.Price > priceRange.Max {
+			if priceRange.Max > 0 && prices[product.ID] > maxPrice {
 				passesFilter = false
 			}
 
@@ -205,6 +313,18 @@ func (client *Client) SearchProducts(ctx context.Context, query string, skip, ta
 		log.Printf("After category filtering: %d products", len(filteredProducts))
 	}
 
+	// Apply minimum rating filtering
+	if minRating > 0 {
+		var ratingFilteredProducts []models.Product
+		for _, product := range filteredProducts {
+			if product.RatingAverage >= minRating {
+				ratingFilteredProducts = append(ratingFilteredProducts, product)
+			}
+		}
+		filteredProducts = ratingFilteredProducts
+		log.Printf("After rating filtering: %d products", len(filteredProducts))
+	}
+
 	// Apply sorting
 	if sortOrder != "" {
 		log.Printf("Applying sort order: %s", sortOrder)
@@ -212,24 +332,36 @@ func (client *Client) SearchProducts(ctx context.Context, query string, skip, ta
 		switch sortOrder {
 		case "PRICE_ASC":
 			sort.Slice(filteredProducts, func(i, j int) bool {
-				return filteredProducts[i].Price < filteredProducts[j].Price
+				return prices[filteredProducts[i].ID] < prices[filteredProducts[j].ID]
 			})
 			log.Printf("Sorted products by price ascending")
 
 		case "PRICE_DESC":
 			sort.Slice(filteredProducts, func(i, j int) bool {
-				return filteredProducts[i].Price > filteredProducts[j].Price
+				return prices[filteredProducts[i].ID] > prices[filteredProducts[j].ID]
 			})
 			log.Printf("Sorted products by price descending")
 
 		case "NEWEST":
-			sort.Slice(filteredProducts, func(i, j int) bool {
-				return filteredProducts[i].ID > filteredProducts[j].ID
+			sort.SliceStable(filteredProducts, func(i, j int) bool {
+				return filteredProducts[i].CreatedAt.After(filteredProducts[j].CreatedAt)
 			})
 			log.Printf("Sorted products by newest first")
 
 		case "POPULARITY":
-			log.Printf("Sorting by popularity not implemented")
+			sort.SliceStable(filteredProducts, func(i, j int) bool {
+				return filteredProducts[i].Popularity > filteredProducts[j].Popularity
+			})
+			log.Printf("Sorted products by popularity")
+
+		case "RATING":
+			sort.SliceStable(filteredProducts, func(i, j int) bool {
+				if filteredProducts[i].RatingAverage != filteredProducts[j].RatingAverage {
+					return filteredProducts[i].RatingAverage > filteredProducts[j].RatingAverage
+				}
+				return filteredProducts[i].ReviewCount > filteredProducts[j].ReviewCount
+			})
+			log.Printf("Sorted products by rating")
 		}
 	}
 
@@ -248,3 +380,315 @@ func (client *Client) SearchProducts(ctx context.Context, query string, skip, ta
 	log.Printf("Returning products %d to %d (total: %d)", start, end, len(filteredProducts))
 	return filteredProducts[start:end], nil
 }
+
+func productFromProto(p *pb.Product) models.Product {
+	product := models.Product{
+		ID:          p.GetId(),
+		Name:        p.GetName(),
+		Description: p.GetDescription(),
+		Price:       p.GetPrice(),
+		AccountID:   int(p.GetAccountId()),
+		Category:    p.GetCategory(),
+		Status:      p.GetStatus(),
+		Popularity:  p.GetPopularity(),
+
+		RatingAverage: p.GetRatingAverage(),
+		ReviewCount:   p.GetReviewCount(),
+		Version:       p.GetVersion(),
+		WeightGrams:   p.GetWeightGrams(),
+		TaxCategory:   p.GetTaxCategory(),
+	}
+	// Servers that predate priceMoney only send the price
+	if price := p.GetPriceMoney(); price != nil {
+		product.Price = money.New(price.GetAmount(), price.GetCurrency()).Float()
+		product.Currency = price.GetCurrency()
+	}
+	product.CreatedAt.UnmarshalBinary(p.GetCreatedAt())
+	product.UpdatedAt.UnmarshalBinary(p.GetUpdatedAt())
+	if p.GetTracksStock() {
+		stock := p.GetStock()
+		product.Stock = &stock
+	}
+	return product
+}
+
+func (client *Client) CreateReview(ctx context.Context, productId string, accountId int64, rating int, title, body string) (*models.Review, error) {
+	res, err := client.service.CreateReview(ctx, &pb.CreateReviewRequest{
+		ProductId: productId,
+		AccountId: accountId,
+		Rating:    int32(rating),
+		Title:     title,
+		Body:      body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	review := reviewFromProto(res.Review)
+	return &review, nil
+}
+
+func (client *Client) GetReviews(ctx context.Context, productId string, skip, take uint64) ([]models.Review, error) {
+	res, err := client.service.GetReviews(ctx, &pb.GetReviewsRequest{
+		ProductId: productId,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var reviews []models.Review
+	for _, r := range res.Reviews {
+		reviews = append(reviews, reviewFromProto(r))
+	}
+	return reviews, nil
+}
+
+func (client *Client) ReplyToReview(ctx context.Context, reviewId string, accountId int64, body string) (*models.Review, error) {
+	res, err := client.service.ReplyToReview(ctx, &pb.ReplyToReviewRequest{
+		ReviewId:  reviewId,
+		AccountId: accountId,
+		Body:      body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	review := reviewFromProto(res.Review)
+	return &review, nil
+}
+
+func (client *Client) VoteReviewHelpful(ctx context.Context, reviewId string, accountId int64) (*models.Review, error) {
+	res, err := client.service.VoteReviewHelpful(ctx, &pb.VoteReviewRequest{
+		ReviewId:  reviewId,
+		AccountId: accountId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	review := reviewFromProto(res.Review)
+	return &review, nil
+}
+
+func (client *Client) ModerateReview(ctx context.Context, reviewId, status, role string) (*models.Review, error) {
+	// Add the caller role to the context metadata
+	ctx = metadata.AppendToOutgoingContext(ctx, "caller-role", role)
+
+	res, err := client.service.ModerateReview(ctx, &pb.ModerateReviewRequest{
+		ReviewId: reviewId,
+		Status:   status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	review := reviewFromProto(res.Review)
+	return &review, nil
+}
+
+func reviewFromProto(r *pb.Review) models.Review {
+	review := models.Review{
+		ID:           r.GetId(),
+		ProductID:    r.GetProductId(),
+		AccountID:    int(r.GetAccountId()),
+		Rating:       int(r.GetRating()),
+		Title:        r.GetTitle(),
+		Body:         r.GetBody(),
+		Status:       r.GetStatus(),
+		HelpfulCount: r.GetHelpfulCount(),
+	}
+	review.CreatedAt.UnmarshalBinary(r.GetCreatedAt())
+	review.UpdatedAt.UnmarshalBinary(r.GetUpdatedAt())
+	if r.Reply != nil {
+		review.Reply = &models.ReviewReply{
+			AccountID: int(r.Reply.GetAccountId()),
+			Body:      r.Reply.GetBody(),
+		}
+		review.Reply.CreatedAt.UnmarshalBinary(r.Reply.GetCreatedAt())
+	}
+	return review
+}
+
+// Size of the chunks an import file is streamed in
+const importChunkSize = 32 * 1024
+
+// ImportProducts streams a CSV or JSON Lines catalog file to the product
+// service and returns the report of the import once the whole file was read.
+func (client *Client) ImportProducts(ctx context.Context, accountId int64, format string, dryRun bool, file io.Reader) (*models.ImportJob, error) {
+	stream, err := client.service.ImportProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.Send(&pb.ImportProductsRequest{
+		AccountId: accountId,
+		Format:    format,
+		DryRun:    dryRun,
+	})
+	buf := make([]byte, importChunkSize)
+	for err == nil {
+		n, readErr := file.Read(buf)
+		if n > 0 {
+			err = stream.Send(&pb.ImportProductsRequest{Chunk: append([]byte(nil), buf[:n]...)})
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	// A failed Send means the server ended the stream, its status is returned by CloseAndRecv
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	job := importJobFromProto(res.Job)
+	return &job, nil
+}
+
+func (client *Client) GetImportJob(ctx context.Context, id string, accountId int64) (*models.ImportJob, error) {
+	res, err := client.service.GetImportJob(ctx, &pb.GetImportJobRequest{
+		Id:        id,
+		AccountId: accountId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	job := importJobFromProto(res.Job)
+	return &job, nil
+}
+
+// ExportProducts writes the catalog of a seller to w as it is streamed by the product service
+func (client *Client) ExportProducts(ctx context.Context, accountId int64, format string, w io.Writer) error {
+	stream, err := client.service.ExportProducts(ctx, &pb.ExportProductsRequest{
+		AccountId: accountId,
+		Format:    format,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(res.GetChunk()); err != nil {
+			return err
+		}
+	}
+}
+
+func importJobFromProto(j *pb.ImportJob) models.ImportJob {
+	job := models.ImportJob{
+		ID:        j.GetId(),
+		AccountID: int(j.GetAccountId()),
+		Format:    j.GetFormat(),
+		DryRun:    j.GetDryRun(),
+		Status:    j.GetStatus(),
+		TotalRows: j.GetTotalRows(),
+		Imported:  j.GetImported(),
+		Failed:    j.GetFailed(),
+		Errors:    []models.ImportRowError{},
+		Error:     j.GetError(),
+	}
+	for _, rowError := range j.GetErrors() {
+		job.Errors = append(job.Errors, models.ImportRowError{
+			Row:     int(rowError.GetRow()),
+			Message: rowError.GetMessage(),
+		})
+	}
+	job.CreatedAt.UnmarshalBinary(j.GetCreatedAt())
+	job.UpdatedAt.UnmarshalBinary(j.GetUpdatedAt())
+	return job
+}
+
+func (client *Client) GetPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]models.PriceChange, error) {
+	res, err := client.service.GetPriceHistory(ctx, &pb.GetPriceHistoryRequest{
+		ProductId: productId,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var changes []models.PriceChange
+	for _, c := range res.Changes {
+		change := models.PriceChange{
+			ID:        c.GetId(),
+			ProductID: c.GetProductId(),
+			OldPrice:  c.GetOldPrice(),
+			NewPrice:  c.GetNewPrice(),
+			AccountID: int(c.GetAccountId()),
+			Reason:    c.GetReason(),
+		}
+		change.ChangedAt.UnmarshalBinary(c.GetChangedAt())
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// SchedulePriceChange plans a new price for a product, a nil endsAt makes it permanent
+func (client *Client) SchedulePriceChange(ctx context.Context, productId string, accountId int64, price float64, startsAt time.Time, endsAt *time.Time) (*models.PriceSchedule, error) {
+	req := &pb.SchedulePriceChangeRequest{
+		ProductId: productId,
+		AccountId: accountId,
+		Price:     price,
+	}
+	req.StartsAt, _ = startsAt.MarshalBinary()
+	if endsAt != nil {
+		req.EndsAt, _ = endsAt.MarshalBinary()
+	}
+	res, err := client.service.SchedulePriceChange(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	schedule := priceScheduleFromProto(res.Schedule)
+	return &schedule, nil
+}
+
+func (client *Client) CancelPriceSchedule(ctx context.Context, scheduleId string, accountId int64) (*models.PriceSchedule, error) {
+	res, err := client.service.CancelPriceSchedule(ctx, &pb.CancelPriceScheduleRequest{
+		ScheduleId: scheduleId,
+		AccountId:  accountId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	schedule := priceScheduleFromProto(res.Schedule)
+	return &schedule, nil
+}
+
+func (client *Client) GetPriceSchedules(ctx context.Context, productId string, accountId int64) ([]models.PriceSchedule, error) {
+	res, err := client.service.GetPriceSchedules(ctx, &pb.GetPriceSchedulesRequest{
+		ProductId: productId,
+		AccountId: accountId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var schedules []models.PriceSchedule
+	for _, s := range res.Schedules {
+		schedules = append(schedules, priceScheduleFromProto(s))
+	}
+	return schedules, nil
+}
+
+func priceScheduleFromProto(s *pb.PriceSchedule) models.PriceSchedule {
+	schedule := models.PriceSchedule{
+		ID:           s.GetId(),
+		ProductID:    s.GetProductId(),
+		AccountID:    int(s.GetAccountId()),
+		Price:        s.GetPrice(),
+		Status:       s.GetStatus(),
+		RegularPrice: s.GetRegularPrice(),
+	}
+	schedule.StartsAt.UnmarshalBinary(s.GetStartsAt())
+	if len(s.GetEndsAt()) > 0 {
+		schedule.EndsAt = &time.Time{}
+		schedule.EndsAt.UnmarshalBinary(s.GetEndsAt())
+	}
+	schedule.CreatedAt.UnmarshalBinary(s.GetCreatedAt())
+	schedule.UpdatedAt.UnmarshalBinary(s.GetUpdatedAt())
+	return schedule
+}
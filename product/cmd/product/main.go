@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -8,18 +9,23 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 
+	order "github.com/thomas/EcommerceAPI/order/client"
 	"github.com/thomas/EcommerceAPI/product/internal"
 )
 
 type Config struct {
 	DatabaseURL      string `envconfig:"DATABASE_URL"`
 	BootstrapServers string `envconfig:"BOOTSTRAP_SERVERS" default:"kafka:9092"`
+	OrderURL         string `envconfig:"ORDER_SERVICE_URL"`
+	// How often scheduled price changes and sales are checked
+	PriceSchedulerInterval time.Duration `envconfig:"PRICE_SCHEDULER_INTERVAL" default:"30s"`
 }
 
 func main() {
 	var cfg Config
 	var repository internal.Repository
 	var producer sarama.AsyncProducer
+	var consumerGroup sarama.ConsumerGroup
 
 	err := envconfig.Process("", &cfg)
 	if err != nil {
@@ -68,7 +74,35 @@ func main() {
 		defer repository.Close()
 	}
 
+	// Consume interaction events to keep the popularity score of products up to date
+	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
+		config := sarama.NewConfig()
+		config.Version = sarama.V2_1_0_0
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+		consumerGroup, err = sarama.NewConsumerGroup([]string{cfg.BootstrapServers}, "product-popularity", config)
+		if err != nil {
+			log.Println("Failed to create Kafka consumer group:", err)
+			return err
+		}
+		return nil
+	})
+	defer consumerGroup.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go internal.ConsumePopularity(ctx, consumerGroup, repository)
+
+	// The order service is used to check that reviewers bought the product
+	orderClient, err := order.NewClient(cfg.OrderURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer orderClient.Close()
+
 	log.Println("Listening on port 8080...")
-	service := internal.NewProductService(repository, producer)
+	service := internal.NewProductService(repository, producer, orderClient)
+	go internal.RunPriceScheduler(ctx, service, cfg.PriceSchedulerInterval)
+
 	log.Fatal(internal.ListenGRPC(service, 8080))
 }
@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported catalog format, use CSV or JSONL")
+
+// Longest line accepted in a JSON Lines file
+const maxCatalogLineSize = 1 << 20
+
+var catalogColumns = []string{"id", "name", "description", "price", "category", "status", "currency"}
+
+// invalidRowError is returned by a catalogReader for a row that could not be
+// parsed. The import reports it and carries on with the next row.
+type invalidRowError struct {
+	message string
+}
+
+func (e invalidRowError) Error() string {
+	return e.message
+}
+
+// catalogReader reads the rows of an import file one at a time, so large files
+// never have to be held in memory. Next returns io.EOF after the last row.
+type catalogReader interface {
+	Next() (models.CatalogRow, error)
+}
+
+type catalogWriter interface {
+	Write(row models.CatalogRow) error
+	Flush() error
+}
+
+func newCatalogReader(format string, r io.Reader) (catalogReader, error) {
+	switch strings.ToUpper(format) {
+	case models.CatalogFormatCSV:
+		return newCSVCatalogReader(r)
+	case models.CatalogFormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxCatalogLineSize)
+		return &jsonlCatalogReader{scanner}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func newCatalogWriter(format string, w io.Writer) (catalogWriter, error) {
+	switch strings.ToUpper(format) {
+	case models.CatalogFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(catalogColumns); err != nil {
+			return nil, err
+		}
+		return &csvCatalogWriter{writer}, nil
+	case models.CatalogFormatJSONL:
+		buffered := bufio.NewWriter(w)
+		return &jsonlCatalogWriter{buffered, json.NewEncoder(buffered)}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type csvCatalogReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVCatalogReader reads the header of the file, columns may come in any
+// order and unknown ones are ignored.
+func newCSVCatalogReader(r io.Reader) (*csvCatalogReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the CSV header has no %q column", required)
+		}
+	}
+	return &csvCatalogReader{reader, columns}, nil
+}
+
+func (c *csvCatalogReader) Next() (models.CatalogRow, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return models.CatalogRow{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return models.CatalogRow{}, invalidRowError{parseErr.Err.Error()}
+	}
+	if err != nil {
+		return models.CatalogRow{}, err
+	}
+
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	row := models.CatalogRow{
+		ID:          field("id"),
+		Name:        field("name"),
+		Description: field("description"),
+		Category:    field("category"),
+		Status:      field("status"),
+		Currency:    field("currency"),
+	}
+	if price := field("price"); price != "" {
+		row.Price, err = strconv.ParseFloat(price, 64)
+		if err != nil {
+			return row, invalidRowError{fmt.Sprintf("invalid price %q", price)}
+		}
+	}
+	return row, nil
+}
+
+type jsonlCatalogReader struct {
+	scanner *bufio.Scanner
+}
+
+func (j *jsonlCatalogReader) Next() (models.CatalogRow, error) {
+	for j.scanner.Scan() {
+		line := strings.TrimSpace(j.scanner.Text())
+		if line == "" {
+			continue
+		}
+		var row models.CatalogRow
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			return row, invalidRowError{"invalid JSON: " + err.Error()}
+		}
+		row.ID = strings.TrimSpace(row.ID)
+		return row, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return models.CatalogRow{}, err
+	}
+	return models.CatalogRow{}, io.EOF
+}
+
+type csvCatalogWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvCatalogWriter) Write(row models.CatalogRow) error {
+	return c.writer.Write([]string{
+		row.ID,
+		row.Name,
+		row.Description,
+		strconv.FormatFloat(row.Price, 'f', -1, 64),
+		row.Category,
+		row.Status,
+		row.Currency,
+	})
+}
+
+func (c *csvCatalogWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonlCatalogWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (j *jsonlCatalogWriter) Write(row models.CatalogRow) error {
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonlCatalogWriter) Flush() error {
+	return j.writer.Flush()
+}
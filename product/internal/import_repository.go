@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+// The row errors of a job are only ever read back with the job, so they are
+// stored without being indexed.
+const importJobsMapping = `{
+  "mappings": {
+    "job": {
+      "properties": {
+        "accountID": {"type": "integer"},
+        "format":    {"type": "keyword"},
+        "dryRun":    {"type": "boolean"},
+        "status":    {"type": "keyword"},
+        "totalRows": {"type": "long"},
+        "imported":  {"type": "long"},
+        "failed":    {"type": "long"},
+        "errors":    {"type": "object", "enabled": false},
+        "error":     {"type": "text", "index": false},
+        "createdAt": {"type": "date"},
+        "updatedAt": {"type": "date"}
+      }
+    }
+  }
+}`
+
+// BulkPutProducts indexes the products in a single bulk request and sets the
+// ids of the ones that were created. Products that Elasticsearch rejected are
+// returned by their position in the slice with the reason.
+func (r *elasticRepository) BulkPutProducts(ctx context.Context, products []models.Product) (map[int]string, error) {
+	bulk := r.client.Bulk()
+	for _, p := range products {
+		bulk.Add(elastic.NewBulkIndexRequest().
+			Index("catalog").
+			Type("product").
+			Doc(models.ProductDocument{
+				Name:        p.Name,
+				Description: p.Description,
+				Price:       p.Price,
+				Currency:    p.Currency,
+				AccountID:   p.AccountID,
+				Category:    p.Category,
+				Status:      p.Status,
+				CreatedAt:   p.CreatedAt,
+				UpdatedAt:   p.UpdatedAt,
+				Version:     1,
+			}))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	failures := map[int]string{}
+	for i, item := range res.Indexed() {
+		if item.Error != nil {
+			failures[i] = item.Error.Reason
+			continue
+		}
+		products[i].ID = item.Id
+		products[i].Version = 1
+	}
+	return failures, nil
+}
+
+func (r *elasticRepository) PutImportJob(ctx context.Context, job *models.ImportJob) error {
+	res, err := r.client.Index().
+		Index("import_jobs").
+		Type("job").
+		BodyJson(importJobToDocument(*job)).
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	job.ID = res.Id
+	return nil
+}
+
+func (r *elasticRepository) UpdateImportJob(ctx context.Context, job models.ImportJob) error {
+	_, err := r.client.Index().
+		Index("import_jobs").
+		Type("job").
+		Id(job.ID).
+		BodyJson(importJobToDocument(job)).
+		Do(ctx)
+	return err
+}
+
+func (r *elasticRepository) GetImportJobById(ctx context.Context, id string) (*models.ImportJob, error) {
+	res, err := r.client.Get().
+		Index("import_jobs").
+		Type("job").
+		Id(id).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc := models.ImportJobDocument{}
+	if err := json.Unmarshal(*res.Source, &doc); err != nil {
+		return nil, err
+	}
+	return &models.ImportJob{
+		ID:        id,
+		AccountID: doc.AccountID,
+		Format:    doc.Format,
+		DryRun:    doc.DryRun,
+		Status:    doc.Status,
+		TotalRows: doc.TotalRows,
+		Imported:  doc.Imported,
+		Failed:    doc.Failed,
+		Errors:    doc.Errors,
+		Error:     doc.Error,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}, nil
+}
+
+func importJobToDocument(job models.ImportJob) models.ImportJobDocument {
+	return models.ImportJobDocument{
+		AccountID: job.AccountID,
+		Format:    job.Format,
+		DryRun:    job.DryRun,
+		Status:    job.Status,
+		TotalRows: job.TotalRows,
+		Imported:  job.Imported,
+		Failed:    job.Failed,
+		Errors:    job.Errors,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"google.golang.org/grpc"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+	"github.com/thomas/EcommerceAPI/product/proto/pb"
+)
+
+// Size of the chunks the export is streamed in
+const exportChunkSize = 32 * 1024
+
+func (s *grpcServer) ImportProducts(stream grpc.ClientStreamingServer[pb.ImportProductsRequest, pb.ImportJobResponse]) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return errors.New("the import stream is empty")
+	}
+	if err != nil {
+		return err
+	}
+
+	input := &importStreamReader{stream: stream, chunk: first.GetChunk()}
+	job, err := s.service.ImportProducts(stream.Context(), int(first.GetAccountId()), first.GetFormat(), first.GetDryRun(), input)
+	if err != nil {
+		log.Println(err)
+		// A job that was started reports its own failure
+		if job == nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(&pb.ImportJobResponse{Job: importJobToProto(job)})
+}
+
+func (s *grpcServer) GetImportJob(ctx context.Context, r *pb.GetImportJobRequest) (*pb.ImportJobResponse, error) {
+	job, err := s.service.GetImportJob(ctx, r.GetId(), int(r.GetAccountId()))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ImportJobResponse{Job: importJobToProto(job)}, nil
+}
+
+func (s *grpcServer) ExportProducts(r *pb.ExportProductsRequest, stream grpc.ServerStreamingServer[pb.ExportProductsChunk]) error {
+	writer := bufio.NewWriterSize(exportStreamWriter{stream}, exportChunkSize)
+	if err := s.service.ExportProducts(stream.Context(), int(r.GetAccountId()), r.GetFormat(), writer); err != nil {
+		log.Println(err)
+		return err
+	}
+	return writer.Flush()
+}
+
+// importStreamReader exposes the chunks of an import stream as an io.Reader
+type importStreamReader struct {
+	stream grpc.ClientStreamingServer[pb.ImportProductsRequest, pb.ImportJobResponse]
+	chunk  []byte
+}
+
+func (r *importStreamReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.chunk = req.GetChunk()
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+type exportStreamWriter struct {
+	stream grpc.ServerStreamingServer[pb.ExportProductsChunk]
+}
+
+func (w exportStreamWriter) Write(p []byte) (int, error) {
+	// The message may be sent after Write returns, so it gets its own copy
+	chunk := append([]byte(nil), p...)
+	if err := w.stream.Send(&pb.ExportProductsChunk{Chunk: chunk}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func importJobToProto(job *models.ImportJob) *pb.ImportJob {
+	result := &pb.ImportJob{
+		Id:        job.ID,
+		AccountId: int64(job.AccountID),
+		Format:    job.Format,
+		DryRun:    job.DryRun,
+		Status:    job.Status,
+		TotalRows: job.TotalRows,
+		Imported:  job.Imported,
+		Failed:    job.Failed,
+		Error:     job.Error,
+	}
+	for _, rowError := range job.Errors {
+		result.Errors = append(result.Errors, &pb.ImportRowError{
+			Row:     int64(rowError.Row),
+			Message: rowError.Message,
+		})
+	}
+	result.CreatedAt, _ = job.CreatedAt.MarshalBinary()
+	result.UpdatedAt, _ = job.UpdatedAt.MarshalBinary()
+	return result
+}
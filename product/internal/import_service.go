@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+const (
+	// Number of valid rows sent to Elasticsearch in one bulk request
+	importBatchSize = 500
+	// Only the first row errors are kept in the job report, the rest are counted
+	maxImportErrors = 1000
+	exportPageSize  = 100
+)
+
+// ImportProducts creates a product for every valid row of the catalog file and
+// reports the invalid ones. A row with the id of one of the seller's products
+// updates it, so an exported catalog can be edited and imported again. In a
+// dry run the rows are only validated. The job
+// is saved as it progresses so its status can be looked up while it runs.
+func (service productService) ImportProducts(ctx context.Context, accountId int, format string, dryRun bool, input io.Reader) (*models.ImportJob, error) {
+	now := time.Now().UTC()
+	job := models.ImportJob{
+		AccountID: accountId,
+		Format:    strings.ToUpper(format),
+		DryRun:    dryRun,
+		Status:    models.ImportJobRunning,
+		Errors:    []models.ImportRowError{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if job.Format != models.CatalogFormatCSV && job.Format != models.CatalogFormatJSONL {
+		return nil, ErrUnsupportedFormat
+	}
+	if err := service.repo.PutImportJob(ctx, &job); err != nil {
+		return nil, err
+	}
+
+	rows, err := newCatalogReader(job.Format, input)
+	if err != nil {
+		return service.failImportJob(ctx, job, err)
+	}
+
+	addError := func(row int, message string) {
+		job.Failed++
+		if len(job.Errors) < maxImportErrors {
+			job.Errors = append(job.Errors, models.ImportRowError{Row: row, Message: message})
+		}
+	}
+
+	var batch []models.Product
+	var batchRows []int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if dryRun {
+			job.Imported += int64(len(batch))
+		} else {
+			failures, err := service.repo.BulkPutProducts(ctx, batch)
+			if err != nil {
+				return err
+			}
+			for i, product := range batch {
+				if reason, failed := failures[i]; failed {
+					addError(batchRows[i], reason)
+					continue
+				}
+				job.Imported++
+				if product.IsPublic() {
+					service.sendProductEvent("product_created", product)
+				}
+			}
+		}
+		batch, batchRows = nil, nil
+
+		job.UpdatedAt = time.Now().UTC()
+		return service.repo.UpdateImportJob(ctx, job)
+	}
+
+	for row := 1; ; row++ {
+		record, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		var invalid invalidRowError
+		if errors.As(err, &invalid) {
+			job.TotalRows++
+			addError(row, invalid.Error())
+			continue
+		}
+		if err != nil {
+			return service.failImportJob(ctx, job, err)
+		}
+		job.TotalRows++
+
+		product, err := productFromRow(record, accountId, now)
+		if err != nil {
+			addError(row, err.Error())
+			continue
+		}
+		if record.ID != "" {
+			err = service.updateFromRow(ctx, record, product, accountId, dryRun)
+			if errors.As(err, &invalid) {
+				addError(row, invalid.Error())
+				continue
+			}
+			if err != nil {
+				return service.failImportJob(ctx, job, err)
+			}
+			job.Imported++
+			continue
+		}
+		batch = append(batch, product)
+		batchRows = append(batchRows, row)
+		if len(batch) == importBatchSize {
+			if err = flush(); err != nil {
+				return service.failImportJob(ctx, job, err)
+			}
+		}
+	}
+	if err = flush(); err != nil {
+		return service.failImportJob(ctx, job, err)
+	}
+
+	job.Status = models.ImportJobCompleted
+	job.UpdatedAt = time.Now().UTC()
+	if err = service.repo.UpdateImportJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// failImportJob records why a job stopped. Rows imported before the failure
+// are kept.
+func (service productService) failImportJob(ctx context.Context, job models.ImportJob, cause error) (*models.ImportJob, error) {
+	job.Status = models.ImportJobFailed
+	job.Error = cause.Error()
+	job.UpdatedAt = time.Now().UTC()
+	// The caller may be gone, the job must still be marked as failed
+	if err := service.repo.UpdateImportJob(context.WithoutCancel(ctx), job); err != nil {
+		log.Println("Failed to save import job:", err)
+	}
+	return &job, cause
+}
+
+func (service productService) GetImportJob(ctx context.Context, id string, accountId int) (*models.ImportJob, error) {
+	job, err := service.repo.GetImportJobById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.AccountID != accountId {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+// ExportProducts writes the catalog of a seller in the same format the import
+// reads. Archived products are left out.
+func (service productService) ExportProducts(ctx context.Context, accountId int, format string, w io.Writer) error {
+	writer, err := newCatalogWriter(format, w)
+	if err != nil {
+		return err
+	}
+	for skip := uint64(0); ; skip += exportPageSize {
+		products, err := service.repo.ListProductsForAccount(ctx, accountId, false, skip, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			if p.Status == models.ProductStatusArchived {
+				continue
+			}
+			status := p.Status
+			if status == "" {
+				status = models.ProductStatusPublished
+			}
+			err = writer.Write(models.CatalogRow{
+				ID:          p.ID,
+				Name:        p.Name,
+				Description: p.Description,
+				Price:       p.Price,
+				Currency:    p.Currency,
+				Category:    p.Category,
+				Status:      status,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(products) < exportPageSize {
+			break
+		}
+	}
+	return writer.Flush()
+}
+
+// updateFromRow applies a row to the product it has the id of. The row holds
+// every field of the product, an empty status keeps the current one. Rows
+// that cannot be applied return an invalidRowError.
+func (service productService) updateFromRow(ctx context.Context, row models.CatalogRow, imported models.Product, accountId int, dryRun bool) error {
+	product, err := service.repo.GetProductById(ctx, row.ID)
+	if errors.Is(err, ErrNotFound) || err == nil && product.AccountID != accountId {
+		return invalidRowError{fmt.Sprintf("unknown product %q", row.ID)}
+	}
+	if err != nil {
+		return err
+	}
+	if imported.Currency != product.Currency {
+		return invalidRowError{fmt.Sprintf("the currency of product %q is %s", row.ID, product.Currency)}
+	}
+
+	// Products indexed before statuses existed are published
+	current := product.Status
+	if current == "" {
+		current = models.ProductStatusPublished
+	}
+	status := current
+	if strings.TrimSpace(row.Status) != "" {
+		status = imported.Status
+	}
+	if status != current && !canTransition(current, status) {
+		return invalidRowError{fmt.Sprintf("a %s product cannot become %s", current, status)}
+	}
+	if dryRun {
+		return nil
+	}
+
+	changes := models.ProductChanges{
+		Name:        &imported.Name,
+		Description: &imported.Description,
+		Price:       &imported.Price,
+		Category:    &imported.Category,
+	}
+	if err = service.applyChanges(ctx, product, accountId, changes, 0, models.PriceChangeManual); err != nil {
+		return err
+	}
+	if status != current {
+		_, err = service.SetProductStatus(ctx, product.ID, accountId, status)
+	}
+	return err
+}
+
+func productFromRow(row models.CatalogRow, accountId int, now time.Time) (models.Product, error) {
+	name := strings.TrimSpace(row.Name)
+	if name == "" {
+		return models.Product{}, errors.New("name is required")
+	}
+	if row.Price <= 0 {
+		return models.Product{}, errors.New("price must be greater than zero")
+	}
+	status := strings.ToUpper(strings.TrimSpace(row.Status))
+	if status == "" {
+		status = models.ProductStatusDraft
+	}
+	if status != models.ProductStatusDraft && status != models.ProductStatusPublished {
+		return models.Product{}, fmt.Errorf("invalid status %q, use DRAFT or PUBLISHED", row.Status)
+	}
+	if err := money.ValidateCurrency(row.Currency); err != nil {
+		return models.Product{}, fmt.Errorf("invalid currency %q", row.Currency)
+	}
+	return models.Product{
+		Name:        name,
+		Description: strings.TrimSpace(row.Description),
+		Price:       roundPrice(row.Price, row.Currency),
+		Currency:    money.NormalizeCurrency(row.Currency),
+		AccountID:   accountId,
+		Category:    strings.TrimSpace(row.Category),
+		Status:      status,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+// Popularity uses forward decay: instead of periodically decaying every
+// stored score, each new interaction is weighted by how far it happened
+// after a fixed landmark. Older interactions therefore count exponentially
+// less than recent ones, and sorting by the stored score gives the same
+// order as sorting by the decayed score at any point in time.
+//
+// The weights double every half-life, so they would leave the range of a
+// float a few years after the landmark. The stored score is therefore the
+// base-2 logarithm of the sum of the weights, which only grows by one per
+// half-life and sorts the same way.
+const (
+	popularityHalfLife = 7 * 24 * time.Hour
+	viewWeight         = 1.0
+	purchaseWeight     = 5.0
+)
+
+var popularityLandmark = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// halfLivesSince returns the number of half-lives between the landmark and t.
+func halfLivesSince(t time.Time) float64 {
+	return t.Sub(popularityLandmark).Hours() / popularityHalfLife.Hours()
+}
+
+// decayedWeight returns the base-2 logarithm of the forward-decayed weight
+// of an interaction of the given base weight that happened at time t.
+func decayedWeight(base float64, t time.Time) float64 {
+	return math.Log2(base) + halfLivesSince(t)
+}
+
+// addWeights adds two weights kept as base-2 logarithms without leaving log
+// space. RecordInteraction runs the same sum as a script.
+func addWeights(a, b float64) float64 {
+	high, low := math.Max(a, b), math.Min(a, b)
+	return high + math.Log2(1+math.Exp2(low-high))
+}
+
+// decayedPopularity converts a stored popularity score back into the decayed
+// score as observed at time now. Products nobody interacted with have none.
+func decayedPopularity(score *float64, now time.Time) float64 {
+	if score == nil {
+		return 0
+	}
+	return math.Exp2(*score - halfLivesSince(now))
+}
+
+type popularityConsumer struct {
+	repository Repository
+}
+
+// ConsumePopularity reads interaction_events until ctx is cancelled and folds
+// product views and purchases into the popularity score of the product.
+func ConsumePopularity(ctx context.Context, group sarama.ConsumerGroup, repository Repository) {
+	handler := popularityConsumer{repository}
+	for {
+		if err := group.Consume(ctx, []string{"interaction_events"}, handler); err != nil {
+			log.Println("Popularity consumer error:", err)
+			time.Sleep(2 * time.Second)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (popularityConsumer) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (popularityConsumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (consumer popularityConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		var event models.InteractionEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			log.Println("Skipping malformed interaction event:", err)
+			session.MarkMessage(msg, "")
+			continue
+		}
+
+		at := msg.Timestamp
+		if at.IsZero() {
+			at = time.Now().UTC()
+		}
+
+		var err error
+		switch event.Type {
+		case "product_retrieved":
+			err = consumer.repository.RecordInteraction(session.Context(), event.Data.ProductID, decayedWeight(viewWeight, at), 1, 0)
+		case "purchase":
+			err = consumer.repository.RecordInteraction(session.Context(), event.Data.ProductID, decayedWeight(purchaseWeight, at), 0, 1)
+		}
+		if err != nil && err != ErrNotFound {
+			// Leave the message unmarked so it is redelivered after a rebalance
+			log.Println("Failed to record interaction for product", event.Data.ProductID, err)
+			return err
+		}
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
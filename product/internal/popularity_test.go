@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayedWeightGrowsByOnePerHalfLife(t *testing.T) {
+	assert.InDelta(t, 0, decayedWeight(viewWeight, popularityLandmark), 1e-9)
+	assert.InDelta(t, math.Log2(purchaseWeight), decayedWeight(purchaseWeight, popularityLandmark), 1e-9)
+
+	later := popularityLandmark.Add(3 * popularityHalfLife)
+	assert.InDelta(t, 3, decayedWeight(viewWeight, later), 1e-9)
+	assert.InDelta(t, 3+math.Log2(purchaseWeight), decayedWeight(purchaseWeight, later), 1e-9)
+}
+
+func TestDecayedWeightStaysFiniteFarFromTheLandmark(t *testing.T) {
+	// A plain weight would pass the largest float32 about 2.5 years after
+	// the landmark and the largest float64 about 20 years after it
+	for _, years := range []int{1, 3, 25, 100} {
+		at := popularityLandmark.AddDate(years, 0, 0)
+		weight := decayedWeight(purchaseWeight, at)
+		assert.False(t, math.IsInf(weight, 0) || math.IsNaN(weight), "weight after %d years", years)
+		assert.Less(t, weight, float64(math.MaxFloat32))
+
+		score := addWeights(weight, decayedWeight(viewWeight, at))
+		assert.InDelta(t, purchaseWeight+viewWeight, decayedPopularity(&score, at), 1e-6)
+	}
+}
+
+func TestAddWeights(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     float64
+		expected float64
+	}{
+		{"equal weights double", 4, 4, 5},
+		{"order does not matter", math.Log2(3), math.Log2(5), 3},
+		{"order does not matter reversed", math.Log2(5), math.Log2(3), 3},
+		{"a far smaller weight is lost", 1000, 0, 1000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.InDelta(t, test.expected, addWeights(test.a, test.b), 1e-9)
+		})
+	}
+}
+
+func TestDecayedPopularity(t *testing.T) {
+	now := popularityLandmark.Add(10 * popularityHalfLife)
+	assert.Equal(t, 0.0, decayedPopularity(nil, now))
+
+	// A view one half-life ago counts half as much as one now
+	score := addWeights(decayedWeight(viewWeight, now.Add(-popularityHalfLife)), decayedWeight(viewWeight, now))
+	assert.InDelta(t, 1.5, decayedPopularity(&score, now), 1e-9)
+	assert.InDelta(t, 0.75, decayedPopularity(&score, now.Add(popularityHalfLife)), 1e-9)
+}
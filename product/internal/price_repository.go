@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+var ErrScheduleChanged = errors.New("the price schedule was changed meanwhile")
+
+const priceHistoryMapping = `{
+  "mappings": {
+    "change": {
+      "properties": {
+        "productId": {"type": "keyword"},
+        "oldPrice":  {"type": "double"},
+        "newPrice":  {"type": "double"},
+        "accountID": {"type": "integer"},
+        "reason":    {"type": "keyword"},
+        "changedAt": {"type": "date"}
+      }
+    }
+  }
+}`
+
+const priceSchedulesMapping = `{
+  "mappings": {
+    "schedule": {
+      "properties": {
+        "productId":    {"type": "keyword"},
+        "accountID":    {"type": "integer"},
+        "price":        {"type": "double"},
+        "startsAt":     {"type": "date"},
+        "endsAt":       {"type": "date"},
+        "status":       {"type": "keyword"},
+        "regularPrice": {"type": "double"},
+        "createdAt":    {"type": "date"},
+        "updatedAt":    {"type": "date"}
+      }
+    }
+  }
+}`
+
+func (r *elasticRepository) PutPriceChange(ctx context.Context, change *models.PriceChange) error {
+	res, err := r.client.Index().
+		Index("price_history").
+		Type("change").
+		BodyJson(models.PriceChangeDocument{
+			ProductID: change.ProductID,
+			OldPrice:  change.OldPrice,
+			NewPrice:  change.NewPrice,
+			AccountID: change.AccountID,
+			Reason:    change.Reason,
+			ChangedAt: change.ChangedAt,
+		}).
+		// Sellers look at the history right after changing a price
+		Refresh("wait_for").
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	change.ID = res.Id
+	return nil
+}
+
+// ListPriceHistory returns the price changes of a product, latest first
+func (r *elasticRepository) ListPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]models.PriceChange, error) {
+	res, err := r.client.Search().
+		Index("price_history").
+		Type("change").
+		Query(elastic.NewBoolQuery().Filter(elastic.NewTermQuery("productId", productId))).
+		Sort("changedAt", false).
+		From(int(skip)).
+		Size(int(take)).
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var changes []models.PriceChange
+	for _, hit := range res.Hits.Hits {
+		doc := models.PriceChangeDocument{}
+		if err = json.Unmarshal(*hit.Source, &doc); err == nil {
+			changes = append(changes, models.PriceChange{
+				ID:        hit.Id,
+				ProductID: doc.ProductID,
+				OldPrice:  doc.OldPrice,
+				NewPrice:  doc.NewPrice,
+				AccountID: doc.AccountID,
+				Reason:    doc.Reason,
+				ChangedAt: doc.ChangedAt,
+			})
+		}
+	}
+	return changes, err
+}
+
+func (r *elasticRepository) PutPriceSchedule(ctx context.Context, schedule *models.PriceSchedule) error {
+	res, err := r.client.Index().
+		Index("price_schedules").
+		Type("schedule").
+		BodyJson(priceScheduleToDocument(*schedule)).
+		// The overlap check of the next schedule must see this one
+		Refresh("wait_for").
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	schedule.ID = res.Id
+	schedule.Version = res.Version
+	return nil
+}
+
+func (r *elasticRepository) GetPriceScheduleById(ctx context.Context, id string) (*models.PriceSchedule, error) {
+	res, err := r.client.Get().
+		Index("price_schedules").
+		Type("schedule").
+		Id(id).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc := models.PriceScheduleDocument{}
+	if err := json.Unmarshal(*res.Source, &doc); err != nil {
+		return nil, err
+	}
+	schedule := priceScheduleFromDocument(id, *res.Version, doc)
+	return &schedule, nil
+}
+
+// ListPriceSchedules returns the schedules of a product in the order they start
+func (r *elasticRepository) ListPriceSchedules(ctx context.Context, productId string) ([]models.PriceSchedule, error) {
+	query := elastic.NewBoolQuery().Filter(elastic.NewTermQuery("productId", productId))
+	return r.searchPriceSchedules(ctx, query)
+}
+
+// ListDuePriceSchedules returns the pending schedules that should have started
+// and the sales that should have ended by now
+func (r *elasticRepository) ListDuePriceSchedules(ctx context.Context, now time.Time) ([]models.PriceSchedule, error) {
+	query := elastic.NewBoolQuery().
+		Should(
+			elastic.NewBoolQuery().Filter(
+				elastic.NewTermQuery("status", models.PriceSchedulePending),
+				elastic.NewRangeQuery("startsAt").Lte(now),
+			),
+			elastic.NewBoolQuery().Filter(
+				elastic.NewTermQuery("status", models.PriceScheduleActive),
+				elastic.NewRangeQuery("endsAt").Lte(now),
+			),
+		).
+		MinimumNumberShouldMatch(1)
+	return r.searchPriceSchedules(ctx, query)
+}
+
+// UpdatePriceSchedule saves the schedule if nobody else changed it since it
+// was read, otherwise it returns ErrScheduleChanged
+func (r *elasticRepository) UpdatePriceSchedule(ctx context.Context, schedule *models.PriceSchedule) error {
+	res, err := r.client.Index().
+		Index("price_schedules").
+		Type("schedule").
+		Id(schedule.ID).
+		Version(schedule.Version).
+		BodyJson(priceScheduleToDocument(*schedule)).
+		Refresh("wait_for").
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		return ErrScheduleChanged
+	}
+	if err != nil {
+		return err
+	}
+	schedule.Version = res.Version
+	return nil
+}
+
+func (r *elasticRepository) searchPriceSchedules(ctx context.Context, query elastic.Query) ([]models.PriceSchedule, error) {
+	res, err := r.client.Search().
+		Index("price_schedules").
+		Type("schedule").
+		Query(query).
+		Sort("startsAt", true).
+		Version(true).
+		Size(100).
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var schedules []models.PriceSchedule
+	for _, hit := range res.Hits.Hits {
+		doc := models.PriceScheduleDocument{}
+		if err = json.Unmarshal(*hit.Source, &doc); err == nil {
+			var version int64
+			if hit.Version != nil {
+				version = *hit.Version
+			}
+			schedules = append(schedules, priceScheduleFromDocument(hit.Id, version, doc))
+		}
+	}
+	return schedules, err
+}
+
+func priceScheduleToDocument(schedule models.PriceSchedule) models.PriceScheduleDocument {
+	return models.PriceScheduleDocument{
+		ProductID:    schedule.ProductID,
+		AccountID:    schedule.AccountID,
+		Price:        schedule.Price,
+		StartsAt:     schedule.StartsAt,
+		EndsAt:       schedule.EndsAt,
+		Status:       schedule.Status,
+		RegularPrice: schedule.RegularPrice,
+		CreatedAt:    schedule.CreatedAt,
+		UpdatedAt:    schedule.UpdatedAt,
+	}
+}
+
+func priceScheduleFromDocument(id string, version int64, doc models.PriceScheduleDocument) models.PriceSchedule {
+	return models.PriceSchedule{
+		ID:           id,
+		ProductID:    doc.ProductID,
+		AccountID:    doc.AccountID,
+		Price:        doc.Price,
+		StartsAt:     doc.StartsAt,
+		EndsAt:       doc.EndsAt,
+		Status:       doc.Status,
+		RegularPrice: doc.RegularPrice,
+		CreatedAt:    doc.CreatedAt,
+		UpdatedAt:    doc.UpdatedAt,
+		Version:      version,
+	}
+}
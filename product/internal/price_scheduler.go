@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunPriceScheduler applies the due price schedules every interval until ctx
+// is cancelled. Several product services can run it at once, each schedule is
+// claimed by a single one.
+func RunPriceScheduler(ctx context.Context, service Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := service.ApplyPriceSchedules(ctx, time.Now().UTC()); err != nil {
+			log.Println("Failed to apply price schedules:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+	"github.com/thomas/EcommerceAPI/product/proto/pb"
+)
+
+func (s *grpcServer) GetPriceHistory(ctx context.Context, r *pb.GetPriceHistoryRequest) (*pb.PriceHistoryResponse, error) {
+	res, err := s.service.GetPriceHistory(ctx, r.GetProductId(), r.GetSkip(), r.GetTake())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var changes []*pb.PriceChange
+	for _, change := range res {
+		pbChange := &pb.PriceChange{
+			Id:        change.ID,
+			ProductId: change.ProductID,
+			OldPrice:  change.OldPrice,
+			NewPrice:  change.NewPrice,
+			AccountId: int64(change.AccountID),
+			Reason:    change.Reason,
+		}
+		pbChange.ChangedAt, _ = change.ChangedAt.MarshalBinary()
+		changes = append(changes, pbChange)
+	}
+	return &pb.PriceHistoryResponse{Changes: changes}, nil
+}
+
+func (s *grpcServer) SchedulePriceChange(ctx context.Context, r *pb.SchedulePriceChangeRequest) (*pb.PriceScheduleResponse, error) {
+	var startsAt time.Time
+	if err := startsAt.UnmarshalBinary(r.GetStartsAt()); err != nil {
+		return nil, ErrInvalidSchedule
+	}
+	var endsAt *time.Time
+	if len(r.GetEndsAt()) > 0 {
+		endsAt = &time.Time{}
+		if err := endsAt.UnmarshalBinary(r.GetEndsAt()); err != nil {
+			return nil, ErrInvalidSchedule
+		}
+	}
+
+	schedule, err := s.service.SchedulePriceChange(ctx, r.GetProductId(), int(r.GetAccountId()), r.GetPrice(), startsAt, endsAt)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.PriceScheduleResponse{Schedule: priceScheduleToProto(schedule)}, nil
+}
+
+func (s *grpcServer) CancelPriceSchedule(ctx context.Context, r *pb.CancelPriceScheduleRequest) (*pb.PriceScheduleResponse, error) {
+	schedule, err := s.service.CancelPriceSchedule(ctx, r.GetScheduleId(), int(r.GetAccountId()))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.PriceScheduleResponse{Schedule: priceScheduleToProto(schedule)}, nil
+}
+
+func (s *grpcServer) GetPriceSchedules(ctx context.Context, r *pb.GetPriceSchedulesRequest) (*pb.PriceSchedulesResponse, error) {
+	res, err := s.service.GetPriceSchedules(ctx, r.GetProductId(), int(r.GetAccountId()))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var schedules []*pb.PriceSchedule
+	for i := range res {
+		schedules = append(schedules, priceScheduleToProto(&res[i]))
+	}
+	return &pb.PriceSchedulesResponse{Schedules: schedules}, nil
+}
+
+func priceScheduleToProto(schedule *models.PriceSchedule) *pb.PriceSchedule {
+	result := &pb.PriceSchedule{
+		Id:           schedule.ID,
+		ProductId:    schedule.ProductID,
+		AccountId:    int64(schedule.AccountID),
+		Price:        schedule.Price,
+		Status:       schedule.Status,
+		RegularPrice: schedule.RegularPrice,
+	}
+	result.StartsAt, _ = schedule.StartsAt.MarshalBinary()
+	if schedule.EndsAt != nil {
+		result.EndsAt, _ = schedule.EndsAt.MarshalBinary()
+	}
+	result.CreatedAt, _ = schedule.CreatedAt.MarshalBinary()
+	result.UpdatedAt, _ = schedule.UpdatedAt.MarshalBinary()
+	return result
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+var (
+	ErrInvalidSchedule        = errors.New("a schedule needs a positive price, a start and an end after the start")
+	ErrOverlappingSale        = errors.New("the product already has a sale during this period")
+	ErrScheduleNotCancellable = errors.New("only pending schedules and running sales can be cancelled")
+)
+
+func (service productService) GetPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]models.PriceChange, error) {
+	if take > 100 || take == 0 {
+		take = 100
+	}
+	return service.repo.ListPriceHistory(ctx, productId, skip, take)
+}
+
+// SchedulePriceChange plans a new price for the product. Without endsAt the
+// price stays once applied, with it the product is on sale until endsAt.
+func (service productService) SchedulePriceChange(ctx context.Context, productId string, accountId int, price float64, startsAt time.Time, endsAt *time.Time) (*models.PriceSchedule, error) {
+	now := time.Now().UTC()
+	if price <= 0 || startsAt.IsZero() {
+		return nil, ErrInvalidSchedule
+	}
+	if endsAt != nil && (!endsAt.After(startsAt) || !endsAt.After(now)) {
+		return nil, ErrInvalidSchedule
+	}
+
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	if product.Status == models.ProductStatusArchived {
+		return nil, errors.New("archived products cannot be repriced")
+	}
+	price = roundPrice(price, product.Currency)
+
+	// Two sales at once would each restore the price the other one set
+	if endsAt != nil {
+		schedules, err := service.repo.ListPriceSchedules(ctx, productId)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range schedules {
+			if !other.IsSale() || (other.Status != models.PriceSchedulePending && other.Status != models.PriceScheduleActive) {
+				continue
+			}
+			if startsAt.Before(*other.EndsAt) && other.StartsAt.Before(*endsAt) {
+				return nil, ErrOverlappingSale
+			}
+		}
+	}
+
+	schedule := models.PriceSchedule{
+		ProductID: productId,
+		AccountID: accountId,
+		Price:     price,
+		StartsAt:  startsAt.UTC(),
+		EndsAt:    endsAt,
+		Status:    models.PriceSchedulePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = service.repo.PutPriceSchedule(ctx, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// CancelPriceSchedule drops a pending schedule, or ends a running sale right away
+func (service productService) CancelPriceSchedule(ctx context.Context, scheduleId string, accountId int) (*models.PriceSchedule, error) {
+	schedule, err := service.repo.GetPriceScheduleById(ctx, scheduleId)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.AccountID != accountId {
+		return nil, ErrNotFound
+	}
+
+	switch schedule.Status {
+	case models.PriceSchedulePending:
+		schedule.Status = models.PriceScheduleCancelled
+		schedule.UpdatedAt = time.Now().UTC()
+		err = service.repo.UpdatePriceSchedule(ctx, schedule)
+	case models.PriceScheduleActive:
+		err = service.endSale(ctx, schedule, models.PriceScheduleCancelled)
+	default:
+		return nil, ErrScheduleNotCancellable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (service productService) GetPriceSchedules(ctx context.Context, productId string, accountId int) ([]models.PriceSchedule, error) {
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	return service.repo.ListPriceSchedules(ctx, productId)
+}
+
+// ApplyPriceSchedules starts the schedules and ends the sales that are due.
+// A schedule that fails is left as it was and tried again on the next run.
+func (service productService) ApplyPriceSchedules(ctx context.Context, now time.Time) error {
+	due, err := service.repo.ListDuePriceSchedules(ctx, now)
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		schedule := &due[i]
+		if schedule.Status == models.PriceSchedulePending {
+			err = service.startSchedule(ctx, schedule)
+		} else {
+			err = service.endSale(ctx, schedule, models.PriceScheduleDone)
+		}
+		// Another instance of the scheduler got to it first
+		if errors.Is(err, ErrScheduleChanged) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to apply price schedule %s: %v", schedule.ID, err)
+		}
+	}
+	return nil
+}
+
+func (service productService) startSchedule(ctx context.Context, schedule *models.PriceSchedule) error {
+	product, err := service.repo.GetProductById(ctx, schedule.ProductID)
+	if errors.Is(err, ErrNotFound) {
+		schedule.Status = models.PriceScheduleCancelled
+		return service.repo.UpdatePriceSchedule(ctx, schedule)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Claim the schedule before touching the price so it is applied only once
+	reason := models.PriceChangeScheduled
+	schedule.Status = models.PriceScheduleDone
+	if schedule.IsSale() {
+		reason = models.PriceChangeSaleStart
+		schedule.Status = models.PriceScheduleActive
+		schedule.RegularPrice = product.Price
+	}
+	schedule.UpdatedAt = time.Now().UTC()
+	if err = service.repo.UpdatePriceSchedule(ctx, schedule); err != nil {
+		return err
+	}
+
+	err = service.applyChanges(ctx, product, schedule.AccountID, models.ProductChanges{Price: &schedule.Price}, 0, reason)
+	if err != nil {
+		service.releaseSchedule(ctx, schedule, models.PriceSchedulePending)
+		return err
+	}
+	return nil
+}
+
+// endSale puts the regular price back, unless the seller changed the price
+// during the sale, in which case their price is kept
+func (service productService) endSale(ctx context.Context, schedule *models.PriceSchedule, status string) error {
+	product, err := service.repo.GetProductById(ctx, schedule.ProductID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if status == models.PriceScheduleCancelled {
+		schedule.EndsAt = &now
+	}
+	schedule.Status = status
+	schedule.UpdatedAt = now
+	if err = service.repo.UpdatePriceSchedule(ctx, schedule); err != nil {
+		return err
+	}
+
+	if product == nil || product.Price != schedule.Price {
+		return nil
+	}
+	err = service.applyChanges(ctx, product, schedule.AccountID, models.ProductChanges{Price: &schedule.RegularPrice}, 0, models.PriceChangeSaleEnd)
+	if err != nil {
+		service.releaseSchedule(ctx, schedule, models.PriceScheduleActive)
+		return err
+	}
+	return nil
+}
+
+// releaseSchedule gives back a schedule that was claimed but could not be applied
+func (service productService) releaseSchedule(ctx context.Context, schedule *models.PriceSchedule, status string) {
+	schedule.Status = status
+	schedule.UpdatedAt = time.Now().UTC()
+	if err := service.repo.UpdatePriceSchedule(ctx, schedule); err != nil {
+		log.Printf("Failed to release price schedule %s: %v", schedule.ID, err)
+	}
+}
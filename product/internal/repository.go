@@ -5,27 +5,70 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"time"
 
 	"gopkg.in/olivere/elastic.v5"
 
+	"github.com/thomas/EcommerceAPI/pkg/money"
 	"github.com/thomas/EcommerceAPI/product/models"
 )
 
 var (
-	ErrNotFound = errors.New("entity not found")
+	ErrNotFound        = errors.New("entity not found")
+	ErrVersionConflict = errors.New("the product was changed by someone else, reload it and try again")
 )
 
+// Number of times an update is retried when only the counters of the product
+// changed under it
+const maxUpdateAttempts = 5
+
 type Repository interface {
 	Close()
 	PutProduct(ctx context.Context, p *models.Product) error
 	GetProductById(ctx context.Context, id string) (*models.Product, error)
 	ListProducts(ctx context.Context, skip, take uint64) ([]models.Product, error)
 	ListProductsWithIDs(ctx context.Context, ids []string) ([]models.Product, error)
-	SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, sortOrder string) ([]models.Product, error)
-	UpdateProduct(ctx context.Context, updatedProduct models.Product) error
-	DeleteProduct(ctx context.Context, productId string) error
+	ListProductsForAccount(ctx context.Context, accountId int, publishedOnly bool, skip, take uint64) ([]models.Product, error)
+	SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, minRating float64, sortOrder string) ([]models.Product, error)
+	UpdateProduct(ctx context.Context, productId string, changes models.ProductChanges, stockFrom *int64, updatedAt time.Time, expectedVersion int64) (int64, *int64, error)
+	UpdateProductStatus(ctx context.Context, productId, status string, updatedAt time.Time) error
+	RecordInteraction(ctx context.Context, productId string, weight float64, views, purchases int64) error
+	HoldStock(ctx context.Context, productId, reservationId string, quantity int64) error
+	DropStockHold(ctx context.Context, productId, reservationId string, restock bool) error
+	AddStock(ctx context.Context, productId, restockId string, quantity int64) error
+
+	PutReview(ctx context.Context, review *models.Review) error
+	GetReviewById(ctx context.Context, id string) (*models.Review, error)
+	ListReviews(ctx context.Context, productId string, skip, take uint64) ([]models.Review, error)
+	UpdateReview(ctx context.Context, review models.Review) error
+	AddHelpfulVote(ctx context.Context, reviewId string, accountId int) error
+	GetRatingSummary(ctx context.Context, productId string) (float64, int64, error)
+	UpdateProductRating(ctx context.Context, productId string, average float64, count int64) error
+
+	BulkPutProducts(ctx context.Context, products []models.Product) (map[int]string, error)
+	PutImportJob(ctx context.Context, job *models.ImportJob) error
+	UpdateImportJob(ctx context.Context, job models.ImportJob) error
+	GetImportJobById(ctx context.Context, id string) (*models.ImportJob, error)
+
+	PutPriceChange(ctx context.Context, change *models.PriceChange) error
+	ListPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]models.PriceChange, error)
+	PutPriceSchedule(ctx context.Context, schedule *models.PriceSchedule) error
+	GetPriceScheduleById(ctx context.Context, id string) (*models.PriceSchedule, error)
+	ListPriceSchedules(ctx context.Context, productId string) ([]models.PriceSchedule, error)
+	ListDuePriceSchedules(ctx context.Context, now time.Time) ([]models.PriceSchedule, error)
+	UpdatePriceSchedule(ctx context.Context, schedule *models.PriceSchedule) error
 }
 
+// The rest of the product document is mapped dynamically. The popularity
+// score is mapped as a double so that close scores still sort apart.
+const productMapping = `{
+  "properties": {
+    "popularityLog": {"type": "double"}
+  }
+}`
+
+const catalogMapping = `{"mappings": {"product": ` + productMapping + `}}`
+
 type elasticRepository struct {
 	client *elastic.Client
 }
@@ -38,6 +81,30 @@ func NewElasticRepository(url string) (Repository, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	ctx := context.Background()
+	if err = ensureIndex(ctx, client, "catalog", catalogMapping); err != nil {
+		return nil, err
+	}
+	// Catalogs created before the mapping existed get the fields added
+	if _, err = client.PutMapping().Index("catalog").Type("product").BodyString(productMapping).Do(ctx); err != nil {
+		return nil, err
+	}
+	if err = ensureIndex(ctx, client, "reviews", reviewsMapping); err != nil {
+		return nil, err
+	}
+	if err = ensureIndex(ctx, client, "review_votes", reviewVotesMapping); err != nil {
+		return nil, err
+	}
+	if err = ensureIndex(ctx, client, "import_jobs", importJobsMapping); err != nil {
+		return nil, err
+	}
+	if err = ensureIndex(ctx, client, "price_history", priceHistoryMapping); err != nil {
+		return nil, err
+	}
+	if err = ensureIndex(ctx, client, "price_schedules", priceSchedulesMapping); err != nil {
+		return nil, err
+	}
 	return &elasticRepository{client}, nil
 }
 
@@ -53,8 +120,13 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p *models.Product) e
 			Name:        p.Name,
 			Description: p.Description,
 			Price:       p.Price,
+			Currency:    p.Currency,
 			AccountID:   p.AccountID,
 			Category:    p.Category,
+			Status:      p.Status,
+			CreatedAt:   p.CreatedAt,
+			UpdatedAt:   p.UpdatedAt,
+			Version:     1,
 		}).
 		Do(ctx)
 	if err != nil {
@@ -62,37 +134,35 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p *models.Product) e
 		return err
 	}
 	p.ID = res.Id
+	p.Version = 1
 	return nil
 }
 
 func (r *elasticRepository) GetProductById(ctx context.Context, id string) (*models.Product, error) {
-	res, _ := r.client.Get().
+	res, err := r.client.Get().
 		Index("catalog").
 		Type("product").
 		Id(id).
 		Do(ctx)
-	if !res.Found {
+	if elastic.IsNotFound(err) || (err == nil && !res.Found) {
 		return nil, ErrNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
 	product := models.ProductDocument{}
 	if err := json.Unmarshal(*res.Source, &product); err != nil {
 		return nil, err
 	}
-	return &models.Product{
-		ID:          id,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		AccountID:   product.AccountID,
-		Category:    product.Category,
-	}, nil
+	result := productFromDocument(id, product)
+	return &result, nil
 }
 
 func (r *elasticRepository) ListProducts(ctx context.Context, skip, take uint64) ([]models.Product, error) {
 	res, err := r.client.Search().
 		Index("catalog").
 		Type("product").
-		Query(elastic.MatchAllQuery{}).
+		Query(elastic.NewBoolQuery().Filter(publishedQuery())).
 		From(int(skip)).
 		Size(int(take)).
 		Do(ctx)
@@ -104,14 +174,7 @@ func (r *elasticRepository) ListProducts(ctx context.Context, skip, take uint64)
 	for _, hit := range res.Hits.Hits {
 		product := models.ProductDocument{}
 		if err = json.Unmarshal(*hit.Source, &product); err == nil {
-			products = append(products, models.Product{
-				ID:          hit.Id,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				AccountID:   product.AccountID,
-				Category:    product.Category,
-			})
+			products = append(products, productFromDocument(hit.Id, product))
 		}
 	}
 	return products, err
@@ -135,24 +198,20 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 
 	var products []models.Product
 	for _, doc := range res.Docs {
+		if !doc.Found || doc.Source == nil {
+			continue
+		}
 		product := models.ProductDocument{}
 		if err = json.Unmarshal(*doc.Source, &product); err == nil {
-			products = append(products, models.Product{
-				ID:          doc.Id,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				AccountID:   product.AccountID,
-				Category:    product.Category,
-			})
+			products = append(products, productFromDocument(doc.Id, product))
 		}
 	}
 	return products, err
 }
 
-func (r *elasticRepository) SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, sortOrder string) ([]models.Product, error) {
-	// Build the query
-	boolQuery := elastic.NewBoolQuery()
+func (r *elasticRepository) SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, minRating float64, sortOrder string) ([]models.Product, error) {
+	// Build the query, only published products can be found
+	boolQuery := elastic.NewBoolQuery().Filter(publishedQuery())
 
 	// Add text search if provided
 	if query != "" {
@@ -160,8 +219,10 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 		boolQuery.Must(textQuery)
 	}
 
-	// Add price range filter if provided
+	// Add price range filter if provided. Prices are only compared with the
+	// range in their own currency, the product client converts the others.
 	if priceRange != nil {
+		boolQuery.Filter(currencyQuery(money.NormalizeCurrency(priceRange.Currency)))
 		priceFilter := elastic.NewRangeQuery("price")
 		if priceRange.Min > 0 {
 			priceFilter.Gte(priceRange.Min)
@@ -178,6 +239,11 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 		boolQuery.Filter(categoryFilter)
 	}
 
+	// Add minimum average rating filter if provided
+	if minRating > 0 {
+		boolQuery.Filter(elastic.NewRangeQuery("ratingAverage").Gte(minRating))
+	}
+
 	// Create search service
 	search := r.client.Search().
 		Index("catalog").
@@ -189,18 +255,26 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 	// Add sorting if provided
 	if sortOrder != "" {
 		switch sortOrder {
+		// Prices in different currencies do not compare, so they are sorted
+		// within their currency
 		case "PRICE_ASC":
-			search = search.Sort("price", true)
+			search = search.SortBy(currencySort(), elastic.NewFieldSort("price").Asc())
 		case "PRICE_DESC":
-			search = search.Sort("price", false)
+			search = search.SortBy(currencySort(), elastic.NewFieldSort("price").Desc())
 		case "NEWEST":
-			// Assuming there's a timestamp field, which might not exist
-			// This is just a placeholder
-			search = search.Sort("_id", false) // Sort by ID as a proxy for creation time
+			// Documents indexed before timestamps existed have no createdAt and sort last
+			search = search.SortBy(elastic.NewFieldSort("createdAt").Desc().UnmappedType("date"))
 		case "POPULARITY":
-			// This would require additional data like view counts
-			// For now, we'll just use a default sort
-			search = search.Sort("_score", false)
+			// Ties (e.g. products nobody has looked at yet) fall back to relevance
+			search = search.SortBy(
+				elastic.NewFieldSort("popularityLog").Desc().UnmappedType("double"),
+				elastic.NewScoreSort(),
+			)
+		case "RATING":
+			search = search.SortBy(
+				elastic.NewFieldSort("ratingAverage").Desc().UnmappedType("double"),
+				elastic.NewFieldSort("reviewCount").Desc().UnmappedType("long"),
+			)
 		}
 	}
 
@@ -216,41 +290,223 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 	for _, hit := range res.Hits.Hits {
 		product := models.ProductDocument{}
 		if err = json.Unmarshal(*hit.Source, &product); err == nil {
-			products = append(products, models.Product{
-				ID:          hit.Id,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				AccountID:   product.AccountID,
-				Category:    product.Category,
-			})
+			products = append(products, productFromDocument(hit.Id, product))
 		}
 	}
 
 	return products, err
 }
 
-func (r *elasticRepository) UpdateProduct(ctx context.Context, updatedProduct models.Product) error {
+// UpdateProduct saves the changed product details if the product is still at
+// expectedVersion (0 skips the check) and returns the new version.
+//
+// The version is a field of the document rather than the Elasticsearch
+// _version, which also moves when views, purchases or ratings are counted.
+// The Elasticsearch _version only makes the check and the write atomic: when
+// it moved because of a counter the update is tried again.
+//
+// A stock change is applied as the difference between changes.Stock and
+// stockFrom, the stock it was made from, so the units held or restocked
+// meanwhile are kept. It returns the stock saved.
+func (r *elasticRepository) UpdateProduct(ctx context.Context, productId string, changes models.ProductChanges, stockFrom *int64, updatedAt time.Time, expectedVersion int64) (int64, *int64, error) {
+	// Partial document so the fields that did not change, createdAt and the
+	// popularity counters are left untouched
+	doc := map[string]interface{}{"updatedAt": updatedAt}
+	if changes.Name != nil {
+		doc["name"] = *changes.Name
+	}
+	if changes.Description != nil {
+		doc["description"] = *changes.Description
+	}
+	if changes.Price != nil {
+		doc["price"] = *changes.Price
+	}
+	if changes.Category != nil {
+		doc["category"] = *changes.Category
+	}
+	if changes.WeightGrams != nil {
+		doc["weightGrams"] = *changes.WeightGrams
+	}
+	if changes.TaxCategory != nil {
+		doc["taxCategory"] = *changes.TaxCategory
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		res, err := r.client.Get().
+			Index("catalog").
+			Type("product").
+			Id(productId).
+			Do(ctx)
+		if elastic.IsNotFound(err) {
+			return 0, nil, ErrNotFound
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		current := models.ProductDocument{}
+		if err = json.Unmarshal(*res.Source, &current); err != nil {
+			return 0, nil, err
+		}
+		if expectedVersion != 0 && current.Version != expectedVersion {
+			return 0, nil, ErrVersionConflict
+		}
+
+		stock := current.Stock
+		if changes.Stock != nil {
+			stock = changes.Stock
+			if stockFrom != nil && current.Stock != nil {
+				moved := *current.Stock + *changes.Stock - *stockFrom
+				if moved < 0 {
+					moved = 0
+				}
+				stock = &moved
+			}
+			doc["stock"] = *stock
+		}
+
+		version := current.Version + 1
+		doc["version"] = version
+		_, err = r.client.Update().
+			Index("catalog").
+			Type("product").
+			Id(productId).
+			Version(*res.Version).
+			Doc(doc).
+			Do(ctx)
+		if elastic.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		return version, stock, nil
+	}
+	return 0, nil, ErrVersionConflict
+}
+
+// ListProductsForAccount returns the products of a seller, whatever their
+// status unless publishedOnly is set
+func (r *elasticRepository) ListProductsForAccount(ctx context.Context, accountId int, publishedOnly bool, skip, take uint64) ([]models.Product, error) {
+	query := elastic.NewBoolQuery().Filter(elastic.NewTermQuery("accountID", accountId))
+	if publishedOnly {
+		query = query.Filter(publishedQuery())
+	}
+	res, err := r.client.Search().
+		Index("catalog").
+		Type("product").
+		Query(query).
+		SortBy(elastic.NewFieldSort("createdAt").Desc().UnmappedType("date")).
+		From(int(skip)).
+		Size(int(take)).
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var products []models.Product
+	for _, hit := range res.Hits.Hits {
+		product := models.ProductDocument{}
+		if err = json.Unmarshal(*hit.Source, &product); err == nil {
+			products = append(products, productFromDocument(hit.Id, product))
+		}
+	}
+	return products, err
+}
+
+func (r *elasticRepository) UpdateProductStatus(ctx context.Context, productId, status string, updatedAt time.Time) error {
 	_, err := r.client.Update().
 		Index("catalog").
 		Type("product").
-		Id(updatedProduct.ID).
-		Doc(models.ProductDocument{
-			Name:        updatedProduct.Name,
-			Description: updatedProduct.Description,
-			Price:       updatedProduct.Price,
-			AccountID:   updatedProduct.AccountID,
-			Category:    updatedProduct.Category,
+		Id(productId).
+		Doc(map[string]interface{}{
+			"status":    status,
+			"updatedAt": updatedAt,
 		}).
 		Do(ctx)
 	return err
 }
 
-func (r *elasticRepository) DeleteProduct(ctx context.Context, productId string) error {
-	_, err := r.client.Delete().
+// publishedQuery matches the products visible to the public. Products indexed
+// before statuses existed have no status and are treated as published. A match
+// query is used because the status may be mapped as analysed text.
+func publishedQuery() elastic.Query {
+	return elastic.NewBoolQuery().
+		Should(
+			elastic.NewMatchQuery("status", models.ProductStatusPublished),
+			elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("status")),
+		).
+		MinimumNumberShouldMatch(1)
+}
+
+// currencyQuery matches the products priced in the currency. Products indexed
+// before currencies existed have none and are in money.DefaultCurrency.
+func currencyQuery(currency string) elastic.Query {
+	query := elastic.NewBoolQuery().
+		Should(elastic.NewMatchQuery("currency", currency)).
+		MinimumNumberShouldMatch(1)
+	if currency == money.DefaultCurrency {
+		query = query.Should(elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("currency")))
+	}
+	return query
+}
+
+// currencySort groups the products by currency, on the keyword the dynamic
+// mapping adds to the currency
+func currencySort() elastic.Sorter {
+	return elastic.NewFieldSort("currency.keyword").Asc().Missing("_first").UnmappedType("keyword")
+}
+
+// RecordInteraction adds weight, the base-2 logarithm of a forward-decayed
+// weight, to the popularity score of the product, see addWeights. A score
+// kept by older versions as a plain sum is carried over on the first update.
+func (r *elasticRepository) RecordInteraction(ctx context.Context, productId string, weight float64, views, purchases int64) error {
+	script := elastic.NewScriptInline(
+		"double weight = params.weight;"+
+			"if (ctx._source.popularityLog == null && ctx._source.popularity != null && ctx._source.popularity > 0) {"+
+			" ctx._source.popularityLog = Math.log(ctx._source.popularity) / Math.log(2) }"+
+			"ctx._source.remove('popularity');"+
+			"if (ctx._source.popularityLog == null) { ctx._source.popularityLog = weight }"+
+			"else { double score = ctx._source.popularityLog; double high = Math.max(score, weight);"+
+			" ctx._source.popularityLog = high + Math.log(1 + Math.pow(2, Math.min(score, weight) - high)) / Math.log(2) }"+
+			"ctx._source.views = (ctx._source.views == null ? 0 : ctx._source.views) + params.views;"+
+			"ctx._source.purchases = (ctx._source.purchases == null ? 0 : ctx._source.purchases) + params.purchases").
+		Lang("painless").
+		Param("weight", weight).
+		Param("views", views).
+		Param("purchases", purchases)
+
+	_, err := r.client.Update().
 		Index("catalog").
 		Type("product").
 		Id(productId).
+		Script(script).
+		RetryOnConflict(3).
 		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
 	return err
 }
+
+func productFromDocument(id string, doc models.ProductDocument) models.Product {
+	return models.Product{
+		ID:          id,
+		Name:        doc.Name,
+		Description: doc.Description,
+		Price:       doc.Price,
+		Currency:    money.NormalizeCurrency(doc.Currency),
+		AccountID:   doc.AccountID,
+		Category:    doc.Category,
+		Status:      doc.Status,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+		Popularity:  decayedPopularity(doc.Popularity, time.Now()),
+
+		RatingAverage: doc.RatingAverage,
+		ReviewCount:   doc.ReviewCount,
+		Version:       doc.Version,
+		Stock:         doc.Stock,
+		WeightGrams:   doc.WeightGrams,
+		TaxCategory:   doc.TaxCategory,
+	}
+}
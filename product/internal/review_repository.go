@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+var (
+	ErrReviewExists = errors.New("you have already reviewed this product")
+	ErrAlreadyVoted = errors.New("you have already marked this review as helpful")
+)
+
+// Reviews are filtered and aggregated by exact values, so the ids and the
+// status are mapped as keywords instead of analysed text.
+const reviewsMapping = `{
+  "mappings": {
+    "review": {
+      "properties": {
+        "productId":    {"type": "keyword"},
+        "accountID":    {"type": "integer"},
+        "rating":       {"type": "integer"},
+        "title":        {"type": "text"},
+        "body":         {"type": "text"},
+        "status":       {"type": "keyword"},
+        "helpfulCount": {"type": "long"},
+        "createdAt":    {"type": "date"},
+        "updatedAt":    {"type": "date"}
+      }
+    }
+  }
+}`
+
+const reviewVotesMapping = `{
+  "mappings": {
+    "vote": {
+      "properties": {
+        "reviewId":  {"type": "keyword"},
+        "accountID": {"type": "integer"}
+      }
+    }
+  }
+}`
+
+func ensureIndex(ctx context.Context, client *elastic.Client, name, mapping string) error {
+	exists, err := client.IndexExists(name).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err = client.CreateIndex(name).BodyString(mapping).Do(ctx)
+	return err
+}
+
+// reviewID makes the document id unique per buyer and product, so the second
+// review of the same product by the same account is rejected by Elasticsearch.
+func reviewID(productId string, accountId int) string {
+	return fmt.Sprintf("%s-%d", productId, accountId)
+}
+
+func (r *elasticRepository) PutReview(ctx context.Context, review *models.Review) error {
+	id := reviewID(review.ProductID, review.AccountID)
+	_, err := r.client.Index().
+		Index("reviews").
+		Type("review").
+		Id(id).
+		OpType("create").
+		BodyJson(models.ReviewDocument{
+			ProductID: review.ProductID,
+			AccountID: review.AccountID,
+			Rating:    review.Rating,
+			Title:     review.Title,
+			Body:      review.Body,
+			Status:    review.Status,
+			CreatedAt: review.CreatedAt,
+			UpdatedAt: review.UpdatedAt,
+		}).
+		// Make the review visible to the rating aggregation that follows
+		Refresh("wait_for").
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		return ErrReviewExists
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	review.ID = id
+	return nil
+}
+
+func (r *elasticRepository) GetReviewById(ctx context.Context, id string) (*models.Review, error) {
+	res, err := r.client.Get().
+		Index("reviews").
+		Type("review").
+		Id(id).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	review := models.ReviewDocument{}
+	if err := json.Unmarshal(*res.Source, &review); err != nil {
+		return nil, err
+	}
+	result := reviewFromDocument(id, review)
+	return &result, nil
+}
+
+func (r *elasticRepository) ListReviews(ctx context.Context, productId string, skip, take uint64) ([]models.Review, error) {
+	query := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("productId", productId),
+		elastic.NewTermQuery("status", models.ReviewStatusPublished),
+	)
+	res, err := r.client.Search().
+		Index("reviews").
+		Type("review").
+		Query(query).
+		SortBy(
+			elastic.NewFieldSort("helpfulCount").Desc(),
+			elastic.NewFieldSort("createdAt").Desc(),
+		).
+		From(int(skip)).
+		Size(int(take)).
+		Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var reviews []models.Review
+	for _, hit := range res.Hits.Hits {
+		review := models.ReviewDocument{}
+		if err = json.Unmarshal(*hit.Source, &review); err == nil {
+			reviews = append(reviews, reviewFromDocument(hit.Id, review))
+		}
+	}
+	return reviews, err
+}
+
+func (r *elasticRepository) UpdateReview(ctx context.Context, review models.Review) error {
+	_, err := r.client.Update().
+		Index("reviews").
+		Type("review").
+		Id(review.ID).
+		Doc(map[string]interface{}{
+			"status":    review.Status,
+			"reply":     review.Reply,
+			"updatedAt": review.UpdatedAt,
+		}).
+		Refresh("wait_for").
+		Do(ctx)
+	return err
+}
+
+// AddHelpfulVote records the vote of the account and sets the helpfulCount
+// of the review to the number of votes. The count is derived from the votes
+// rather than incremented, so a failure between the two writes is repaired
+// by the next vote or by the account voting again.
+func (r *elasticRepository) AddHelpfulVote(ctx context.Context, reviewId string, accountId int) error {
+	_, err := r.client.Index().
+		Index("review_votes").
+		Type("vote").
+		Id(fmt.Sprintf("%s-%d", reviewId, accountId)).
+		OpType("create").
+		BodyJson(map[string]interface{}{
+			"reviewId":  reviewId,
+			"accountID": accountId,
+		}).
+		Refresh("wait_for").
+		Do(ctx)
+	voted := elastic.IsConflict(err)
+	if err != nil && !voted {
+		return err
+	}
+
+	count, err := r.client.Count("review_votes").
+		Type("vote").
+		Query(elastic.NewTermQuery("reviewId", reviewId)).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Concurrent votes may count before seeing each other, so the count
+	// only ever moves up
+	_, err = r.client.Update().
+		Index("reviews").
+		Type("review").
+		Id(reviewId).
+		Script(elastic.NewScriptInline("ctx._source.helpfulCount = Math.max(ctx._source.helpfulCount, params.count)").
+			Lang("painless").
+			Param("count", count)).
+		RetryOnConflict(3).
+		Refresh("wait_for").
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	if voted {
+		return ErrAlreadyVoted
+	}
+	return nil
+}
+
+// GetRatingSummary aggregates the published reviews of a product
+func (r *elasticRepository) GetRatingSummary(ctx context.Context, productId string) (float64, int64, error) {
+	query := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("productId", productId),
+		elastic.NewTermQuery("status", models.ReviewStatusPublished),
+	)
+	res, err := r.client.Search().
+		Index("reviews").
+		Type("review").
+		Query(query).
+		Size(0).
+		Aggregation("average", elastic.NewAvgAggregation().Field("rating")).
+		Do(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	average := 0.0
+	if agg, found := res.Aggregations.Avg("average"); found && agg.Value != nil {
+		average = *agg.Value
+	}
+	return average, res.TotalHits(), nil
+}
+
+func (r *elasticRepository) UpdateProductRating(ctx context.Context, productId string, average float64, count int64) error {
+	_, err := r.client.Update().
+		Index("catalog").
+		Type("product").
+		Id(productId).
+		Doc(map[string]interface{}{
+			"ratingAverage": average,
+			"reviewCount":   count,
+		}).
+		RetryOnConflict(3).
+		Do(ctx)
+	return err
+}
+
+func reviewFromDocument(id string, doc models.ReviewDocument) models.Review {
+	return models.Review{
+		ID:           id,
+		ProductID:    doc.ProductID,
+		AccountID:    doc.AccountID,
+		Rating:       doc.Rating,
+		Title:        doc.Title,
+		Body:         doc.Body,
+		Status:       doc.Status,
+		HelpfulCount: doc.HelpfulCount,
+		Reply:        doc.Reply,
+		CreatedAt:    doc.CreatedAt,
+		UpdatedAt:    doc.UpdatedAt,
+	}
+}
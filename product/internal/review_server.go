@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/thomas/EcommerceAPI/pkg/auth"
+	"github.com/thomas/EcommerceAPI/product/models"
+	"github.com/thomas/EcommerceAPI/product/proto/pb"
+)
+
+func (s *grpcServer) CreateReview(ctx context.Context, r *pb.CreateReviewRequest) (*pb.ReviewResponse, error) {
+	review, err := s.service.CreateReview(ctx, r.GetProductId(), int(r.GetAccountId()), int(r.GetRating()), r.GetTitle(), r.GetBody())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func (s *grpcServer) GetReviews(ctx context.Context, r *pb.GetReviewsRequest) (*pb.ReviewsResponse, error) {
+	res, err := s.service.GetReviews(ctx, r.GetProductId(), r.GetSkip(), r.GetTake())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	var reviews []*pb.Review
+	for i := range res {
+		reviews = append(reviews, reviewToProto(&res[i]))
+	}
+	return &pb.ReviewsResponse{Reviews: reviews}, nil
+}
+
+func (s *grpcServer) ReplyToReview(ctx context.Context, r *pb.ReplyToReviewRequest) (*pb.ReviewResponse, error) {
+	review, err := s.service.ReplyToReview(ctx, r.GetReviewId(), int(r.GetAccountId()), r.GetBody())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func (s *grpcServer) VoteReviewHelpful(ctx context.Context, r *pb.VoteReviewRequest) (*pb.ReviewResponse, error) {
+	review, err := s.service.VoteReviewHelpful(ctx, r.GetReviewId(), int(r.GetAccountId()))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func (s *grpcServer) ModerateReview(ctx context.Context, r *pb.ModerateReviewRequest) (*pb.ReviewResponse, error) {
+	// Only admins can moderate reviews
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "missing metadata")
+	}
+	roles := md.Get("caller-role")
+	if len(roles) == 0 || roles[0] != auth.RoleAdmin {
+		return nil, status.Errorf(codes.PermissionDenied, "only admins can moderate reviews")
+	}
+
+	review, err := s.service.ModerateReview(ctx, r.GetReviewId(), r.GetStatus())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func reviewToProto(r *models.Review) *pb.Review {
+	review := &pb.Review{
+		Id:           r.ID,
+		ProductId:    r.ProductID,
+		AccountId:    int64(r.AccountID),
+		Rating:       int32(r.Rating),
+		Title:        r.Title,
+		Body:         r.Body,
+		Status:       r.Status,
+		HelpfulCount: r.HelpfulCount,
+	}
+	review.CreatedAt, _ = r.CreatedAt.MarshalBinary()
+	review.UpdatedAt, _ = r.UpdatedAt.MarshalBinary()
+	if r.Reply != nil {
+		review.Reply = &pb.ReviewReply{
+			AccountId: int64(r.Reply.AccountID),
+			Body:      r.Reply.Body,
+		}
+		review.Reply.CreatedAt, _ = r.Reply.CreatedAt.MarshalBinary()
+	}
+	return review
+}
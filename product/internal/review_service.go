@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+var (
+	ErrInvalidRating       = errors.New("rating must be between 1 and 5")
+	ErrNotPurchased        = errors.New("only buyers who ordered this product can review it")
+	ErrInvalidReviewStatus = errors.New("invalid review status")
+	ErrReviewNotPublished  = errors.New("only published reviews can be voted on")
+)
+
+const (
+	maxReviewTitleLength = 200
+	maxReviewBodyLength  = 5000
+)
+
+// PurchaseVerifier is implemented by the order service client
+type PurchaseVerifier interface {
+	HasPurchased(ctx context.Context, accountID, productID string) (bool, error)
+}
+
+func (service productService) CreateReview(ctx context.Context, productId string, accountId int, rating int, title, body string) (*models.Review, error) {
+	if rating < 1 || rating > 5 {
+		return nil, ErrInvalidRating
+	}
+	title, body = strings.TrimSpace(title), strings.TrimSpace(body)
+	if len(title) > maxReviewTitleLength || len(body) > maxReviewBodyLength {
+		return nil, errors.New("review title or body is too long")
+	}
+
+	if _, err := service.repo.GetProductById(ctx, productId); err != nil {
+		return nil, err
+	}
+
+	purchased, err := service.orders.HasPurchased(ctx, strconv.Itoa(accountId), productId)
+	if err != nil {
+		return nil, err
+	}
+	if !purchased {
+		return nil, ErrNotPurchased
+	}
+
+	now := time.Now().UTC()
+	review := models.Review{
+		ProductID: productId,
+		AccountID: accountId,
+		Rating:    rating,
+		Title:     title,
+		Body:      body,
+		Status:    models.ReviewStatusPublished,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = service.repo.PutReview(ctx, &review); err != nil {
+		return nil, err
+	}
+
+	service.refreshRating(ctx, productId)
+	return &review, nil
+}
+
+func (service productService) GetReviews(ctx context.Context, productId string, skip, take uint64) ([]models.Review, error) {
+	if take > 100 || take == 0 {
+		take = 100
+	}
+	return service.repo.ListReviews(ctx, productId, skip, take)
+}
+
+// ReplyToReview lets the seller of the product answer a review. Replying
+// again replaces the previous answer.
+func (service productService) ReplyToReview(ctx context.Context, reviewId string, accountId int, body string) (*models.Review, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > maxReviewBodyLength {
+		return nil, errors.New("reply must be between 1 and 5000 characters")
+	}
+
+	review, err := service.repo.GetReviewById(ctx, reviewId)
+	if err != nil {
+		return nil, err
+	}
+	product, err := service.repo.GetProductById(ctx, review.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+
+	now := time.Now().UTC()
+	review.Reply = &models.ReviewReply{
+		AccountID: accountId,
+		Body:      body,
+		CreatedAt: now,
+	}
+	review.UpdatedAt = now
+	if err = service.repo.UpdateReview(ctx, *review); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func (service productService) VoteReviewHelpful(ctx context.Context, reviewId string, accountId int) (*models.Review, error) {
+	review, err := service.repo.GetReviewById(ctx, reviewId)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status != models.ReviewStatusPublished {
+		return nil, ErrReviewNotPublished
+	}
+	if review.AccountID == accountId {
+		return nil, errors.New("you cannot vote on your own review")
+	}
+	if err = service.repo.AddHelpfulVote(ctx, reviewId, accountId); err != nil {
+		return nil, err
+	}
+	// Read the count back, other votes may have been counted with this one
+	return service.repo.GetReviewById(ctx, reviewId)
+}
+
+// ModerateReview publishes or rejects a review. Callers are expected to have
+// checked that the caller is an admin.
+func (service productService) ModerateReview(ctx context.Context, reviewId, status string) (*models.Review, error) {
+	if status != models.ReviewStatusPublished && status != models.ReviewStatusRejected {
+		return nil, ErrInvalidReviewStatus
+	}
+
+	review, err := service.repo.GetReviewById(ctx, reviewId)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status == status {
+		return review, nil
+	}
+
+	review.Status = status
+	review.UpdatedAt = time.Now().UTC()
+	if err = service.repo.UpdateReview(ctx, *review); err != nil {
+		return nil, err
+	}
+
+	service.refreshRating(ctx, review.ProductID)
+	return review, nil
+}
+
+// refreshRating recomputes the denormalised rating of a product from its
+// published reviews. A failure only leaves the product with a stale rating
+// until the next review, so it is logged rather than returned.
+func (service productService) refreshRating(ctx context.Context, productId string) {
+	average, count, err := service.repo.GetRatingSummary(ctx, productId)
+	if err != nil {
+		log.Println("Failed to aggregate ratings for product", productId, err)
+		return
+	}
+	if err = service.repo.UpdateProductRating(ctx, productId, average, count); err != nil {
+		log.Println("Failed to update rating of product", productId, err)
+	}
+}
@@ -2,14 +2,20 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/thomas/EcommerceAPI/pkg/auth"
 	"github.com/thomas/EcommerceAPI/product/models"
 	"github.com/thomas/EcommerceAPI/product/proto/pb"
 )
@@ -34,27 +40,27 @@ func ListenGRPC(s Service, port int) error {
 }
 
 func (s *grpcServer) GetProduct(ctx context.Context, r *pb.ProductByIdRequest) (*pb.ProductResponse, error) {
-	p, err := s.service.GetProduct(ctx, r.Id)
+	p, err := s.service.GetProduct(ctx, r.Id, int(r.GetViewerId()))
 	if err != nil {
 		return nil, err
 	}
-	return &pb.ProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-		AccountId:   int64(p.AccountID),
-	}}, nil
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
 }
 
 func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.ProductsResponse, error) {
+	callerId, privileged, err := requestCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var res []models.Product
-	var err error
 	if r.Query != "" {
 		// Pass nil for priceRange, empty string for category and sortOrder
-		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take, nil, "", "")
+		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take, nil, "", 0, "")
 	} else if len(r.Ids) != 0 {
-		res, err = s.service.GetProductsWithIDs(ctx, r.Ids)
+		res, err = s.service.GetProductsWithIDs(ctx, r.Ids, callerId, privileged)
+	} else if r.AccountId != 0 {
+		res, err = s.service.GetProductsForAccount(ctx, int(r.AccountId), callerId, privileged, r.Skip, r.Take)
 	} else {
 		res, err = s.service.GetProducts(ctx, r.Skip, r.Take)
 	}
@@ -63,48 +69,74 @@ func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest)
 	}
 	var products []*pb.Product
 	for _, p := range res {
-		products = append(products, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			AccountId:   int64(p.AccountID),
-		})
-
+		products = append(products, productToProto(&p))
 	}
 	return &pb.ProductsResponse{Products: products}, nil
 }
 
+// requestCaller reads the caller from the caller-id and caller-role metadata.
+// Anonymous requests get 0. Admins and the other services are privileged and
+// see the products of every seller whatever their status.
+func requestCaller(ctx context.Context) (int, bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	callerId := 0
+	if callerIds := md.Get("caller-id"); len(callerIds) != 0 {
+		var err error
+		if callerId, err = strconv.Atoi(callerIds[0]); err != nil {
+			return 0, false, status.Errorf(codes.Unauthenticated, "invalid caller ID")
+		}
+	}
+	roles := md.Get("caller-role")
+	privileged := len(roles) > 0 && (roles[0] == auth.RoleAdmin || roles[0] == auth.RoleService)
+	return callerId, privileged, nil
+}
+
 func (s *grpcServer) PostProduct(ctx context.Context, r *pb.CreateProductRequest) (*pb.ProductResponse, error) {
 	// For now, we'll use an empty string for the category
-	p, err := s.service.PostProduct(ctx, r.GetName(), r.GetDescription(), r.Price, int(r.GetAccountId()), "")
+	p, err := s.service.PostProduct(ctx, r.GetName(), r.GetDescription(), r.Price, r.GetCurrency(), int(r.GetAccountId()), "", r.GetStatus())
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	return &pb.ProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-		AccountId:   int64(p.AccountID),
-	}}, nil
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
 }
 
 func (s *grpcServer) UpdateProduct(ctx context.Context, r *pb.UpdateProductRequest) (*pb.ProductResponse, error) {
-	// For now, we'll use an empty string for the category
-	p, err := s.service.UpdateProduct(ctx, r.GetId(), r.GetName(), r.GetDescription(), r.Price, int(r.GetAccountId()), "")
+	paths := r.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"name", "description", "price", "category"}
+	}
+	var changes models.ProductChanges
+	for _, path := range paths {
+		switch path {
+		case "name":
+			changes.Name = &r.Name
+		case "description":
+			changes.Description = &r.Description
+		case "price":
+			changes.Price = &r.Price
+		case "category":
+			changes.Category = &r.Category
+		case "stock":
+			changes.Stock = &r.Stock
+		case "weightGrams":
+			changes.WeightGrams = &r.WeightGrams
+		case "taxCategory":
+			changes.TaxCategory = &r.TaxCategory
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown field %q in update mask", path)
+		}
+	}
+
+	p, err := s.service.UpdateProduct(ctx, r.GetId(), int(r.GetAccountId()), changes, r.GetExpectedVersion())
+	if errors.Is(err, ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	return &pb.ProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-		AccountId:   int64(p.AccountID),
-	}}, nil
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
 }
 
 func (s *grpcServer) DeleteProduct(ctx context.Context, r *pb.DeleteProductRequest) (*emptypb.Empty, error) {
@@ -115,3 +147,40 @@ func (s *grpcServer) DeleteProduct(ctx context.Context, r *pb.DeleteProductReque
 	}
 	return &emptypb.Empty{}, nil
 }
+
+func (s *grpcServer) SetProductStatus(ctx context.Context, r *pb.SetProductStatusRequest) (*pb.ProductResponse, error) {
+	p, err := s.service.SetProductStatus(ctx, r.GetProductId(), int(r.GetAccountId()), r.GetStatus())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
+}
+
+func productToProto(p *models.Product) *pb.Product {
+	product := &pb.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		AccountId:   int64(p.AccountID),
+		Category:    p.Category,
+		Status:      p.Status,
+		Popularity:  p.Popularity,
+
+		RatingAverage: p.RatingAverage,
+		ReviewCount:   p.ReviewCount,
+		Version:       p.Version,
+		WeightGrams:   p.WeightGrams,
+		TaxCategory:   p.TaxCategory,
+	}
+	price := p.PriceMoney()
+	product.PriceMoney = &pb.ProductMoney{Amount: price.Amount, Currency: price.Currency}
+	product.CreatedAt, _ = p.CreatedAt.MarshalBinary()
+	product.UpdatedAt, _ = p.UpdatedAt.MarshalBinary()
+	if p.Stock != nil {
+		product.TracksStock = true
+		product.Stock = *p.Stock
+	}
+	return product
+}
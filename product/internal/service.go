@@ -3,45 +3,94 @@ package internal
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/IBM/sarama"
 
+	"github.com/thomas/EcommerceAPI/pkg/money"
 	"github.com/thomas/EcommerceAPI/pkg/utils"
 	"github.com/thomas/EcommerceAPI/product/models"
 )
 
+var (
+	ErrInvalidStatusTransition = errors.New("invalid product status transition")
+	ErrNothingToUpdate         = errors.New("no fields to update")
+)
+
 type Service interface {
-	PostProduct(ctx context.Context, name, description string, price float64, accountId int, category string) (*models.Product, error)
-	GetProduct(ctx context.Context, id string) (*models.Product, error)
+	PostProduct(ctx context.Context, name, description string, price float64, currency string, accountId int, category, status string) (*models.Product, error)
+	GetProduct(ctx context.Context, id string, viewerId int) (*models.Product, error)
 	GetProducts(ctx context.Context, skip, take uint64) ([]models.Product, error)
-	GetProductsWithIDs(ctx context.Context, ids []string) ([]models.Product, error)
-	SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, sortOrder string) ([]models.Product, error)
-	UpdateProduct(ctx context.Context, id, name, description string, price float64, accountId int, category string) (*models.Product, error)
+	GetProductsForAccount(ctx context.Context, accountId, viewerId int, privileged bool, skip, take uint64) ([]models.Product, error)
+	GetProductsWithIDs(ctx context.Context, ids []string, viewerId int, privileged bool) ([]models.Product, error)
+	SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, minRating float64, sortOrder string) ([]models.Product, error)
+	UpdateProduct(ctx context.Context, id string, accountId int, changes models.ProductChanges, expectedVersion int64) (*models.Product, error)
 	DeleteProduct(ctx context.Context, productId string, accountId int) error
+	SetProductStatus(ctx context.Context, productId string, accountId int, status string) (*models.Product, error)
 	Producer() sarama.AsyncProducer
+
+	CreateReview(ctx context.Context, productId string, accountId int, rating int, title, body string) (*models.Review, error)
+	GetReviews(ctx context.Context, productId string, skip, take uint64) ([]models.Review, error)
+	ReplyToReview(ctx context.Context, reviewId string, accountId int, body string) (*models.Review, error)
+	VoteReviewHelpful(ctx context.Context, reviewId string, accountId int) (*models.Review, error)
+	ModerateReview(ctx context.Context, reviewId, status string) (*models.Review, error)
+
+	ImportProducts(ctx context.Context, accountId int, format string, dryRun bool, input io.Reader) (*models.ImportJob, error)
+	GetImportJob(ctx context.Context, id string, accountId int) (*models.ImportJob, error)
+	ExportProducts(ctx context.Context, accountId int, format string, w io.Writer) error
+
+	GetPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]models.PriceChange, error)
+	SchedulePriceChange(ctx context.Context, productId string, accountId int, price float64, startsAt time.Time, endsAt *time.Time) (*models.PriceSchedule, error)
+	CancelPriceSchedule(ctx context.Context, scheduleId string, accountId int) (*models.PriceSchedule, error)
+	GetPriceSchedules(ctx context.Context, productId string, accountId int) ([]models.PriceSchedule, error)
+	ApplyPriceSchedules(ctx context.Context, now time.Time) error
+
+	ReserveStock(ctx context.Context, reservationId string, items []models.StockItem) error
+	ReleaseStock(ctx context.Context, reservationId string, productIds []string) error
+	CommitStock(ctx context.Context, reservationId string, productIds []string) error
+	RestockStock(ctx context.Context, restockId string, items []models.StockItem) error
 }
 
 type productService struct {
 	repo     Repository
 	producer sarama.AsyncProducer
+	orders   PurchaseVerifier
 }
 
-func NewProductService(repository Repository, producer sarama.AsyncProducer) Service {
-	return &productService{repository, producer}
+func NewProductService(repository Repository, producer sarama.AsyncProducer, orders PurchaseVerifier) Service {
+	return &productService{repository, producer, orders}
 }
 
 func (service productService) Producer() sarama.AsyncProducer {
 	return service.producer
 }
 
-func (service productService) PostProduct(ctx context.Context, name, description string, price float64, accountId int, category string) (*models.Product, error) {
+func (service productService) PostProduct(ctx context.Context, name, description string, price float64, currency string, accountId int, category, status string) (*models.Product, error) {
+	// New products are drafts unless the seller publishes them right away
+	if status == "" {
+		status = models.ProductStatusDraft
+	}
+	if status != models.ProductStatusDraft && status != models.ProductStatusPublished {
+		return nil, ErrInvalidStatusTransition
+	}
+	if err := money.ValidateCurrency(currency); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
 	product := models.Product{
 		Name:        name,
 		Description: description,
-		Price:       price,
+		Price:       roundPrice(price, currency),
+		Currency:    money.NormalizeCurrency(currency),
 		AccountID:   accountId,
 		Category:    category,
+		Status:      status,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
 	err := service.repo.PutProduct(ctx, &product)
@@ -49,30 +98,24 @@ func (service productService) PostProduct(ctx context.Context, name, description
 		return nil, err
 	}
 
-	go func() {
-		err = utils.SendMessageToRecommender(service, models.Event{
-			Type: "product_created",
-			Data: models.EventData{
-				ID:          &product.ID,
-				Name:        &product.Name,
-				Description: &product.Description,
-				Price:       &product.Price,
-				AccountID:   &product.AccountID,
-			},
-		}, "product_events")
-		if err != nil {
-			log.Println("Failed to send event to recommendation service:", err)
-		}
-	}()
+	// The recommender only knows about products the public can see
+	if product.IsPublic() {
+		service.sendProductEvent("product_created", product)
+	}
 
 	return &product, nil
 }
 
-func (service productService) GetProduct(ctx context.Context, id string) (*models.Product, error) {
+// GetProduct returns a product by id. Products that are not published are
+// only visible to their owner.
+func (service productService) GetProduct(ctx context.Context, id string, viewerId int) (*models.Product, error) {
 	product, err := service.repo.GetProductById(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if !product.IsPublic() && product.AccountID != viewerId {
+		return nil, ErrNotFound
+	}
 
 	go func() {
 		err = utils.SendMessageToRecommender(service, models.Event{
@@ -94,15 +137,61 @@ func (service productService) GetProducts(ctx context.Context, skip, take uint64
 	return service.repo.ListProducts(ctx, skip, take)
 }
 
-func (service productService) GetProductsWithIDs(ctx context.Context, ids []string) ([]models.Product, error) {
-	return service.repo.ListProductsWithIDs(ctx, ids)
+// GetProductsForAccount lists the products of a seller. Only the seller and
+// privileged callers see the drafts and archived ones.
+func (service productService) GetProductsForAccount(ctx context.Context, accountId, viewerId int, privileged bool, skip, take uint64) ([]models.Product, error) {
+	if take > 100 || take == 0 {
+		take = 100
+	}
+	publishedOnly := !privileged && accountId != viewerId
+	return service.repo.ListProductsForAccount(ctx, accountId, publishedOnly, skip, take)
 }
 
-func (service productService) SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, sortOrder string) ([]models.Product, error) {
-	return service.repo.SearchProducts(ctx, query, skip, take, priceRange, category, sortOrder)
+// GetProductsWithIDs leaves out the products the viewer cannot see, like
+// GetProduct does
+func (service productService) GetProductsWithIDs(ctx context.Context, ids []string, viewerId int, privileged bool) ([]models.Product, error) {
+	products, err := service.repo.ListProductsWithIDs(ctx, ids)
+	if err != nil || privileged {
+		return products, err
+	}
+	visible := products[:0]
+	for _, product := range products {
+		if product.IsPublic() || (viewerId != 0 && product.AccountID == viewerId) {
+			visible = append(visible, product)
+		}
+	}
+	return visible, nil
+}
+
+func (service productService) SearchProducts(ctx context.Context, query string, skip, take uint64, priceRange *models.PriceRange, category string, minRating float64, sortOrder string) ([]models.Product, error) {
+	return service.repo.SearchProducts(ctx, query, skip, take, priceRange, category, minRating, sortOrder)
 }
 
-func (service productService) UpdateProduct(ctx context.Context, id, name, description string, price float64, accountId int, category string) (*models.Product, error) {
+// UpdateProduct changes the fields set in changes and leaves the others as
+// they are. When expectedVersion is set the update fails with
+// ErrVersionConflict if the product was edited since the caller read it.
+// A new stock is applied as a change of the stock, see Repository.UpdateProduct.
+func (service productService) UpdateProduct(ctx context.Context, id string, accountId int, changes models.ProductChanges, expectedVersion int64) (*models.Product, error) {
+	if changes.IsEmpty() {
+		return nil, ErrNothingToUpdate
+	}
+	if changes.Name != nil && strings.TrimSpace(*changes.Name) == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	if changes.Price != nil && *changes.Price < 0 {
+		return nil, errors.New("price cannot be negative")
+	}
+	if changes.Stock != nil && *changes.Stock < 0 {
+		return nil, errors.New("stock cannot be negative")
+	}
+	if changes.WeightGrams != nil && *changes.WeightGrams < 0 {
+		return nil, errors.New("weight cannot be negative")
+	}
+	if changes.TaxCategory != nil {
+		category := strings.ToUpper(strings.TrimSpace(*changes.TaxCategory))
+		changes.TaxCategory = &category
+	}
+
 	product, err := service.repo.GetProductById(ctx, id)
 	if err != nil {
 		return nil, err
@@ -110,58 +199,158 @@ func (service productService) UpdateProduct(ctx context.Context, id, name, descr
 	if product.AccountID != accountId {
 		return nil, errors.New("unauthorized")
 	}
+	if changes.Price != nil {
+		price := roundPrice(*changes.Price, product.Currency)
+		changes.Price = &price
+	}
 
-	updatedProduct := models.Product{
-		ID:          id,
-		Name:        name,
-		Description: description,
-		Price:       price,
-		AccountID:   accountId,
-		Category:    category,
+	if err = service.applyChanges(ctx, product, accountId, changes, expectedVersion, models.PriceChangeManual); err != nil {
+		return nil, err
 	}
-	err = service.repo.UpdateProduct(ctx, updatedProduct)
+	return product, nil
+}
+
+// applyChanges saves the changes, records a price change in the price history
+// and tells the recommender. product is updated in place.
+func (service productService) applyChanges(ctx context.Context, product *models.Product, actorId int, changes models.ProductChanges, expectedVersion int64, reason string) error {
+	oldPrice := product.Price
+
+	var err error
+	product.UpdatedAt = time.Now().UTC()
+	product.Version, product.Stock, err = service.repo.UpdateProduct(ctx, product.ID, changes, product.Stock, product.UpdatedAt, expectedVersion)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	go func() {
-		err = utils.SendMessageToRecommender(service, models.Event{
-			Type: "product_updated",
-			Data: models.EventData{
-				ID:          &updatedProduct.ID,
-				Name:        &updatedProduct.Name,
-				Description: &updatedProduct.Description,
-				Price:       &updatedProduct.Price,
-				AccountID:   &updatedProduct.AccountID,
-			},
-		}, "product_events")
+	if changes.Name != nil {
+		product.Name = *changes.Name
+	}
+	if changes.Description != nil {
+		product.Description = *changes.Description
+	}
+	if changes.Price != nil {
+		product.Price = *changes.Price
+	}
+	if changes.Category != nil {
+		product.Category = *changes.Category
+	}
+	if changes.WeightGrams != nil {
+		product.WeightGrams = *changes.WeightGrams
+	}
+	if changes.TaxCategory != nil {
+		product.TaxCategory = *changes.TaxCategory
+	}
+
+	if product.IsPublic() {
+		service.publishProductEvent("product_updated", models.EventData{
+			ID:          &product.ID,
+			Name:        changes.Name,
+			Description: changes.Description,
+			Price:       changes.Price,
+			Category:    changes.Category,
+		})
+	}
+
+	if changes.Price != nil && *changes.Price != oldPrice {
+		err = service.repo.PutPriceChange(ctx, &models.PriceChange{
+			ProductID: product.ID,
+			OldPrice:  oldPrice,
+			NewPrice:  *changes.Price,
+			AccountID: actorId,
+			Reason:    reason,
+			ChangedAt: product.UpdatedAt,
+		})
 		if err != nil {
-			log.Println("Failed to send event to recommendation service:", err)
+			// The price itself was saved, only its history entry is missing
+			log.Println("Failed to record price change:", err)
 		}
-	}()
-
-	return &updatedProduct, nil
+	}
+	return nil
 }
+
+// DeleteProduct archives the product instead of removing it, so orders that
+// reference it can still show what was bought.
 func (service productService) DeleteProduct(ctx context.Context, productId string, accountId int) error {
 	product, err := service.repo.GetProductById(ctx, productId)
 	if err != nil {
 		return err
 	}
+	if product.Status == models.ProductStatusArchived {
+		return nil
+	}
+	_, err = service.SetProductStatus(ctx, productId, accountId, models.ProductStatusArchived)
+	return err
+}
+
+func (service productService) SetProductStatus(ctx context.Context, productId string, accountId int, status string) (*models.Product, error) {
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
 	if product.AccountID != accountId {
-		return errors.New("unauthorized")
+		return nil, errors.New("unauthorized")
 	}
 
+	// Products indexed before statuses existed are published
+	current := product.Status
+	if current == "" {
+		current = models.ProductStatusPublished
+	}
+	if !canTransition(current, status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	product.Status = status
+	product.UpdatedAt = time.Now().UTC()
+	if err = service.repo.UpdateProductStatus(ctx, productId, status, product.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case models.ProductStatusPublished:
+		service.sendProductEvent("product_created", *product)
+	case models.ProductStatusArchived:
+		service.sendProductEvent("product_deleted", *product)
+	}
+
+	return product, nil
+}
+
+// roundPrice rounds the price to the minor unit of its currency, so that it
+// converts exactly to money.Money
+func roundPrice(price float64, currency string) float64 {
+	return money.FromFloat(price, currency).Float()
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range models.ProductStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// sendProductEvent keeps the recommender's copy of the public catalog in sync
+func (service productService) sendProductEvent(eventType string, product models.Product) {
+	data := models.EventData{ID: &product.ID}
+	if eventType != "product_deleted" {
+		data.Name = &product.Name
+		data.Description = &product.Description
+		data.Price = &product.Price
+		data.AccountID = &product.AccountID
+	}
+	service.publishProductEvent(eventType, data)
+}
+
+func (service productService) publishProductEvent(eventType string, data models.EventData) {
 	go func() {
-		err = utils.SendMessageToRecommender(service, models.Event{
-			Type: "product_deleted",
-			Data: models.EventData{
-				ID: &product.ID,
-			},
+		err := utils.SendMessageToRecommender(service, models.Event{
+			Type: eventType,
+			Data: data,
 		}, "product_events")
 		if err != nil {
 			log.Println("Failed to send event to recommendation service:", err)
 		}
 	}()
-
-	return service.repo.DeleteProduct(ctx, productId)
 }
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gopkg.in/olivere/elastic.v5"
+)
+
+var ErrInsufficientStock = errors.New("not enough stock")
+
+// The holds of a product are kept in its document so a hold and the stock it
+// takes are written together. Holding twice for the same reservation changes
+// nothing; when there is not enough stock the script leaves the document
+// untouched and the update reports a noop.
+const holdStockScript = `
+if (ctx._source.stock != null) {
+  boolean held = false;
+  if (ctx._source.reservations != null) {
+    for (def hold : ctx._source.reservations) {
+      if (hold.id == params.id) { held = true; }
+    }
+  }
+  if (!held) {
+    if (ctx._source.stock < params.quantity) {
+      ctx.op = 'none';
+    } else {
+      ctx._source.stock -= params.quantity;
+      if (ctx._source.reservations == null) { ctx._source.reservations = []; }
+      ctx._source.reservations.add(['id': params.id, 'quantity': params.quantity]);
+    }
+  }
+}`
+
+const dropStockHoldScript = `
+if (ctx._source.reservations != null) {
+  for (int i = ctx._source.reservations.size() - 1; i >= 0; i--) {
+    def hold = ctx._source.reservations[i];
+    if (hold.id == params.id) {
+      if (params.restock && ctx._source.stock != null) { ctx._source.stock += hold.quantity; }
+      ctx._source.reservations.remove(i);
+    }
+  }
+}`
+
+// Restocks used to be recorded in the product document, the ones recorded
+// there are still added once
+const addStockScript = `
+if (ctx._source.stock == null || (ctx._source.restocks != null && ctx._source.restocks.contains(params.id))) {
+  ctx.op = 'none';
+} else {
+  ctx._source.stock += params.quantity;
+}`
+
+// HoldStock takes quantity units of the product out of its stock for the
+// reservation. Products whose stock is not tracked are left alone.
+func (r *elasticRepository) HoldStock(ctx context.Context, productId, reservationId string, quantity int64) error {
+	script := elastic.NewScriptInline(holdStockScript).
+		Lang("painless").
+		Param("id", reservationId).
+		Param("quantity", quantity)
+
+	res, err := r.client.Update().
+		Index("catalog").
+		Type("product").
+		Id(productId).
+		Script(script).
+		RetryOnConflict(3).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if res.Result == "noop" {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// DropStockHold removes the hold of the reservation on the product, putting
+// its units back in stock when restock is set. A missing hold is ignored.
+func (r *elasticRepository) DropStockHold(ctx context.Context, productId, reservationId string, restock bool) error {
+	script := elastic.NewScriptInline(dropStockHoldScript).
+		Lang("painless").
+		Param("id", reservationId).
+		Param("restock", restock)
+
+	_, err := r.client.Update().
+		Index("catalog").
+		Type("product").
+		Id(productId).
+		Script(script).
+		RetryOnConflict(3).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// AddStock puts quantity units of the product back in its stock, once per
+// restock. Products whose stock is not tracked are left alone. The restocks
+// are recorded in their own index, one document per restock and product, so
+// the product document does not grow with every return.
+func (r *elasticRepository) AddStock(ctx context.Context, productId, restockId string, quantity int64) error {
+	markerId := fmt.Sprintf("%s-%s", restockId, productId)
+	_, err := r.client.Index().
+		Index("stock_restocks").
+		Type("restock").
+		Id(markerId).
+		OpType("create").
+		BodyJson(map[string]interface{}{
+			"restockId": restockId,
+			"productId": productId,
+			"quantity":  quantity,
+		}).
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		// Added already
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	script := elastic.NewScriptInline(addStockScript).
+		Lang("painless").
+		Param("id", restockId).
+		Param("quantity", quantity)
+
+	_, err = r.client.Update().
+		Index("catalog").
+		Type("product").
+		Id(productId).
+		Script(script).
+		RetryOnConflict(3).
+		Do(ctx)
+	if err != nil {
+		// Without the units the restock has to be retried, so it must not
+		// count as added
+		if _, deleteErr := r.client.Delete().Index("stock_restocks").Type("restock").Id(markerId).Do(ctx); deleteErr != nil {
+			log.Printf("Failed to remove the marker of restock %s: %v", markerId, deleteErr)
+		}
+	}
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
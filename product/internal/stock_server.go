@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+	"github.com/thomas/EcommerceAPI/product/proto/pb"
+)
+
+func (s *grpcServer) ReserveStock(ctx context.Context, r *pb.ReserveStockRequest) (*emptypb.Empty, error) {
+	var items []models.StockItem
+	for _, item := range r.GetItems() {
+		items = append(items, models.StockItem{ProductID: item.GetProductId(), Quantity: item.GetQuantity()})
+	}
+	if err := s.service.ReserveStock(ctx, r.GetReservationId(), items); err != nil {
+		log.Println("Error reserving stock:", err)
+		return nil, stockError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) ReleaseStock(ctx context.Context, r *pb.StockHoldRequest) (*emptypb.Empty, error) {
+	if err := s.service.ReleaseStock(ctx, r.GetReservationId(), r.GetProductIds()); err != nil {
+		log.Println("Error releasing stock:", err)
+		return nil, stockError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) CommitStock(ctx context.Context, r *pb.StockHoldRequest) (*emptypb.Empty, error) {
+	if err := s.service.CommitStock(ctx, r.GetReservationId(), r.GetProductIds()); err != nil {
+		log.Println("Error committing stock:", err)
+		return nil, stockError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) RestockStock(ctx context.Context, r *pb.RestockRequest) (*emptypb.Empty, error) {
+	var items []models.StockItem
+	for _, item := range r.GetItems() {
+		items = append(items, models.StockItem{ProductID: item.GetProductId(), Quantity: item.GetQuantity()})
+	}
+	if err := s.service.RestockStock(ctx, r.GetRestockId(), items); err != nil {
+		log.Println("Error restocking:", err)
+		return nil, stockError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func stockError(err error) error {
+	switch {
+	case errors.Is(err, ErrInsufficientStock):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrInvalidReservation):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
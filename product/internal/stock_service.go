@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/thomas/EcommerceAPI/product/models"
+)
+
+var ErrInvalidReservation = errors.New("a reservation needs an ID and positive quantities")
+
+// ReserveStock holds the stock of the items for an order. Either every item is
+// held or none is: when one runs out the items held so far are released.
+func (service productService) ReserveStock(ctx context.Context, reservationId string, items []models.StockItem) error {
+	if reservationId == "" || len(items) == 0 {
+		return ErrInvalidReservation
+	}
+	for _, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return ErrInvalidReservation
+		}
+	}
+
+	for i, item := range items {
+		err := service.repo.HoldStock(ctx, item.ProductID, reservationId, item.Quantity)
+		if err == nil {
+			continue
+		}
+		for _, held := range items[:i] {
+			if releaseErr := service.repo.DropStockHold(ctx, held.ProductID, reservationId, true); releaseErr != nil {
+				log.Printf("Failed to release the stock of product %s held for %s: %v", held.ProductID, reservationId, releaseErr)
+			}
+		}
+		return fmt.Errorf("product %s: %w", item.ProductID, err)
+	}
+	return nil
+}
+
+// ReleaseStock puts the stock held for the reservation back
+func (service productService) ReleaseStock(ctx context.Context, reservationId string, productIds []string) error {
+	return service.dropStockHolds(ctx, reservationId, productIds, true)
+}
+
+// CommitStock drops the holds of the reservation, their units stay sold
+func (service productService) CommitStock(ctx context.Context, reservationId string, productIds []string) error {
+	return service.dropStockHolds(ctx, reservationId, productIds, false)
+}
+
+func (service productService) dropStockHolds(ctx context.Context, reservationId string, productIds []string, restock bool) error {
+	if reservationId == "" {
+		return ErrInvalidReservation
+	}
+	for _, productId := range productIds {
+		err := service.repo.DropStockHold(ctx, productId, reservationId, restock)
+		// A deleted product has no stock to give back
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestockStock puts the items back in stock, e.g. when they are returned.
+// Restocking twice under the same ID adds the units once.
+func (service productService) RestockStock(ctx context.Context, restockId string, items []models.StockItem) error {
+	if restockId == "" || len(items) == 0 {
+		return ErrInvalidReservation
+	}
+	for _, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return ErrInvalidReservation
+		}
+	}
+	for _, item := range items {
+		err := service.repo.AddStock(ctx, item.ProductID, restockId, item.Quantity)
+		// A deleted product has no stock to put the units back in
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("product %s: %w", item.ProductID, err)
+		}
+	}
+	return nil
+}
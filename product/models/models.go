@@ -1,29 +1,129 @@
 package models
 
+import (
+	"time"
+
+	"github.com/thomas/EcommerceAPI/pkg/money"
+)
+
+const (
+	ProductStatusDraft     = "DRAFT"
+	ProductStatusPublished = "PUBLISHED"
+	ProductStatusArchived  = "ARCHIVED"
+)
+
+// ProductStatusTransitions lists the statuses a product can move to from each status
+var ProductStatusTransitions = map[string][]string{
+	ProductStatusDraft:     {ProductStatusPublished, ProductStatusArchived},
+	ProductStatusPublished: {ProductStatusArchived},
+	ProductStatusArchived:  {},
+}
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	AccountID   int     `json:"accountID"`
-	Category    string  `json:"category"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       float64   `json:"price"`
+	Currency    string    `json:"currency"`
+	AccountID   int       `json:"accountID"`
+	Category    string    `json:"category"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Popularity  float64   `json:"popularity"`
+	// Denormalised from the published reviews of the product
+	RatingAverage float64 `json:"ratingAverage"`
+	ReviewCount   int64   `json:"reviewCount"`
+	// Version counts the edits of the product details, see UpdateProduct
+	Version int64 `json:"version"`
+	// Nil when the seller does not track the stock of the product
+	Stock *int64 `json:"stock,omitempty"`
+	// Shipping weight of one unit, zero when unknown
+	WeightGrams int64 `json:"weightGrams,omitempty"`
+	// Selects the tax rules of the product, empty for the standard rate
+	TaxCategory string `json:"taxCategory,omitempty"`
 }
 
 type ProductDocument struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
-	AccountID   int     `json:"accountID"`
-	Category    string  `json:"category"`
+	// Products indexed before currencies existed have none, see money.DefaultCurrency
+	Currency  string    `json:"currency,omitempty"`
+	AccountID int       `json:"accountID"`
+	Category  string    `json:"category"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Base-2 logarithm of the forward-decayed popularity score, nil until
+	// the first interaction, see internal/popularity.go
+	Popularity *float64 `json:"popularityLog,omitempty"`
+	Views      int64    `json:"views"`
+	Purchases  int64    `json:"purchases"`
+	// Maintained by the review service, see internal/review_service.go
+	RatingAverage float64 `json:"ratingAverage"`
+	ReviewCount   int64   `json:"reviewCount"`
+	Version       int64   `json:"version"`
+	// Units that can still be ordered, nil when the stock is not tracked.
+	// The units held for orders are already taken out of it.
+	Stock        *int64      `json:"stock,omitempty"`
+	Reservations []StockHold `json:"reservations,omitempty"`
+	WeightGrams  int64       `json:"weightGrams,omitempty"`
+	TaxCategory  string      `json:"taxCategory,omitempty"`
+	// IDs of the restocks added to the stock before they were recorded in
+	// the stock_restocks index, see RestockStock
+	Restocks []string `json:"restocks,omitempty"`
+}
+
+// StockHold is the stock of a product held for an order, from checkout until
+// the order is delivered or given up
+type StockHold struct {
+	ID       string `json:"id"`
+	Quantity int64  `json:"quantity"`
 }
 
+// StockItem is a quantity of a product to reserve
+type StockItem struct {
+	ProductID string
+	Quantity  int64
+}
+
+// IsPublic reports whether the product is visible to everyone. Products indexed
+// before statuses existed have none and are treated as published.
+func (p Product) IsPublic() bool {
+	return p.Status == ProductStatusPublished || p.Status == ""
+}
+
+// PriceMoney is the price in minor units of the product currency. Prices are
+// rounded to the minor unit when they are saved, so the conversion is exact.
+func (p Product) PriceMoney() money.Money {
+	return money.FromFloat(p.Price, p.Currency)
+}
+
+// ProductChanges is a partial update of a product, nil fields are left unchanged
+type ProductChanges struct {
+	Name        *string
+	Description *string
+	Price       *float64
+	Category    *string
+	Stock       *int64
+	WeightGrams *int64
+	TaxCategory *string
+}
+
+func (c ProductChanges) IsEmpty() bool {
+	return c.Name == nil && c.Description == nil && c.Price == nil && c.Category == nil && c.Stock == nil && c.WeightGrams == nil && c.TaxCategory == nil
+}
+
+// EventData leaves out the fields that are not set, a product_updated event
+// only carries the fields that changed.
 type EventData struct {
 	ID          *string  `json:"product_id"`
-	Name        *string  `json:"name"`
-	Description *string  `json:"description"`
-	Price       *float64 `json:"price"`
-	AccountID   *int     `json:"accountID"`
-	Category    *string  `json:"category"`
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Price       *float64 `json:"price,omitempty"`
+	AccountID   *int     `json:"accountID,omitempty"`
+	Category    *string  `json:"category,omitempty"`
 }
 
 type Event struct {
@@ -31,7 +131,190 @@ type Event struct {
 	Data EventData `json:"data"`
 }
 
+// InteractionEvent is the shape shared by the messages on the
+// interaction_events topic (product_retrieved from this service,
+// purchase from the order service).
+type InteractionEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		ProductID string `json:"product_id"`
+	} `json:"data"`
+}
+
+const (
+	ReviewStatusPublished = "PUBLISHED"
+	ReviewStatusRejected  = "REJECTED"
+)
+
+type Review struct {
+	ID           string       `json:"id"`
+	ProductID    string       `json:"productId"`
+	AccountID    int          `json:"accountID"`
+	Rating       int          `json:"rating"`
+	Title        string       `json:"title"`
+	Body         string       `json:"body"`
+	Status       string       `json:"status"`
+	HelpfulCount int64        `json:"helpfulCount"`
+	Reply        *ReviewReply `json:"reply"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+type ReviewDocument struct {
+	ProductID    string       `json:"productId"`
+	AccountID    int          `json:"accountID"`
+	Rating       int          `json:"rating"`
+	Title        string       `json:"title"`
+	Body         string       `json:"body"`
+	Status       string       `json:"status"`
+	HelpfulCount int64        `json:"helpfulCount"`
+	Reply        *ReviewReply `json:"reply,omitempty"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+// ReviewReply is the answer of the seller of the product to a review
+type ReviewReply struct {
+	AccountID int       `json:"accountID"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const (
+	CatalogFormatCSV   = "CSV"
+	CatalogFormatJSONL = "JSONL"
+)
+
+const (
+	ImportJobRunning   = "RUNNING"
+	ImportJobCompleted = "COMPLETED"
+	ImportJobFailed    = "FAILED"
+)
+
+// CatalogRow is one product of an imported or exported catalog file. CSV files
+// use the json names of the fields as their header. The id is filled on
+// export, a row imported with an id updates that product instead of creating
+// a new one.
+type CatalogRow struct {
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Currency    string  `json:"currency,omitempty"`
+	Category    string  `json:"category"`
+	Status      string  `json:"status"`
+}
+
+// ImportRowError explains why a row of an import was rejected. Rows are
+// numbered from 1, not counting the CSV header.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportJob struct {
+	ID        string           `json:"id"`
+	AccountID int              `json:"accountID"`
+	Format    string           `json:"format"`
+	DryRun    bool             `json:"dryRun"`
+	Status    string           `json:"status"`
+	TotalRows int64            `json:"totalRows"`
+	Imported  int64            `json:"imported"`
+	Failed    int64            `json:"failed"`
+	Errors    []ImportRowError `json:"errors"`
+	// Error is set when the whole job failed, e.g. the file could not be read
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ImportJobDocument struct {
+	AccountID int              `json:"accountID"`
+	Format    string           `json:"format"`
+	DryRun    bool             `json:"dryRun"`
+	Status    string           `json:"status"`
+	TotalRows int64            `json:"totalRows"`
+	Imported  int64            `json:"imported"`
+	Failed    int64            `json:"failed"`
+	Errors    []ImportRowError `json:"errors"`
+	Error     string           `json:"error"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// Why the price of a product changed
+const (
+	PriceChangeManual    = "MANUAL"
+	PriceChangeScheduled = "SCHEDULED"
+	PriceChangeSaleStart = "SALE_START"
+	PriceChangeSaleEnd   = "SALE_END"
+)
+
+type PriceChange struct {
+	ID        string  `json:"id"`
+	ProductID string  `json:"productId"`
+	OldPrice  float64 `json:"oldPrice"`
+	NewPrice  float64 `json:"newPrice"`
+	// AccountID is the seller who made or scheduled the change
+	AccountID int       `json:"accountID"`
+	Reason    string    `json:"reason"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+type PriceChangeDocument struct {
+	ProductID string    `json:"productId"`
+	OldPrice  float64   `json:"oldPrice"`
+	NewPrice  float64   `json:"newPrice"`
+	AccountID int       `json:"accountID"`
+	Reason    string    `json:"reason"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+const (
+	PriceSchedulePending   = "PENDING"
+	PriceScheduleActive    = "ACTIVE"
+	PriceScheduleDone      = "DONE"
+	PriceScheduleCancelled = "CANCELLED"
+)
+
+// PriceSchedule is a price change planned by a seller. Without an end it is a
+// permanent change, with one it is a sale: the price goes back to what it was
+// (RegularPrice) once the sale is over.
+type PriceSchedule struct {
+	ID           string     `json:"id"`
+	ProductID    string     `json:"productId"`
+	AccountID    int        `json:"accountID"`
+	Price        float64    `json:"price"`
+	StartsAt     time.Time  `json:"startsAt"`
+	EndsAt       *time.Time `json:"endsAt"`
+	Status       string     `json:"status"`
+	RegularPrice float64    `json:"regularPrice"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	// Elasticsearch version of the document, so two schedulers never apply
+	// the same schedule
+	Version int64 `json:"-"`
+}
+
+type PriceScheduleDocument struct {
+	ProductID    string     `json:"productId"`
+	AccountID    int        `json:"accountID"`
+	Price        float64    `json:"price"`
+	StartsAt     time.Time  `json:"startsAt"`
+	EndsAt       *time.Time `json:"endsAt,omitempty"`
+	Status       string     `json:"status"`
+	RegularPrice float64    `json:"regularPrice"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (s PriceSchedule) IsSale() bool {
+	return s.EndsAt != nil
+}
+
 type PriceRange struct {
 	Min float64 `json:"min"`
 	Max float64 `json:"max"`
+	// Currency of Min and Max, money.DefaultCurrency when empty
+	Currency string `json:"currency,omitempty"`
 }
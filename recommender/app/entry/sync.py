@@ -44,10 +44,12 @@ def sync_products():
 
                             product = session.query(Product).filter_by(id=product_data["product_id"]).first()
                             if product:
-                                product.name = product_data["name"]
-                                product.description = product_data["description"]
-                                product.price = product_data["price"]
-                                product.account_id = product_data["account_id"]
+                                # product_updated only carries the fields that changed
+                                for field in ("name", "description", "price"):
+                                    if product_data.get(field) is not None:
+                                        setattr(product, field, product_data[field])
+                                if product_data.get("accountID") is not None:
+                                    product.account_id = product_data["accountID"]
                             else:
                                 # Extract account ID with fallbacks for different field names
                                 account_id = product_data.get("accountID",
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 16) Build a cart over several requests and check it out
+func Test16CartCheckout(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Cart Product",
+			"description": "Bought through the cart",
+			"price":       4.5,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	addToCart := `
+        mutation AddToCart($productId: String!, $quantity: Int) {
+          addToCart(productId: $productId, quantity: $quantity) {
+            id
+          }
+        }
+    `
+	for i := 0; i < 2; i++ {
+		resp = doRequest(t, serverURL, addToCart, map[string]interface{}{
+			"productId": product["id"],
+			"quantity":  2,
+		})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors during AddToCart")
+	}
+
+	updateCartItem := `
+        mutation UpdateCartItem($productId: String!, $quantity: Int!) {
+          updateCartItem(productId: $productId, quantity: $quantity) {
+            id
+            items {
+              productId
+              quantity
+              lineTotal {
+                amount
+              }
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, updateCartItem, map[string]interface{}{
+		"productId": product["id"],
+		"quantity":  3,
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateCartItem")
+	cart := resp.Data.(map[string]interface{})["updateCartItem"].(map[string]interface{})
+
+	var line map[string]interface{}
+	for _, item := range cart["items"].([]interface{}) {
+		if item.(map[string]interface{})["productId"] == product["id"] {
+			line = item.(map[string]interface{})
+		}
+	}
+	if assert.NotNil(t, line, "expected the product in the cart") {
+		assert.Equal(t, float64(3), line["quantity"])
+		assert.Equal(t, float64(1350), line["lineTotal"].(map[string]interface{})["amount"])
+	}
+
+	checkout := `
+        mutation Checkout($cartId: String!) {
+          checkout(cartId: $cartId) {
+            id
+            products {
+              id
+              quantity
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, checkout, map[string]interface{}{"cartId": cart["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Checkout")
+	order := resp.Data.(map[string]interface{})["checkout"].(map[string]interface{})
+	assert.NotEmpty(t, order["id"])
+
+	// The cart is empty again after the checkout
+	resp = doRequest(t, serverURL, `query { cart { id items { productId } } }`, nil)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Cart")
+	newCart := resp.Data.(map[string]interface{})["cart"].(map[string]interface{})
+	assert.NotEqual(t, cart["id"], newCart["id"])
+	assert.Empty(t, newCart["items"])
+}
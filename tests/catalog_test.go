@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test10ImportProductsDryRun(t *testing.T) {
+	query := `
+        mutation ImportProducts($file: Upload!, $format: CatalogFormat!, $dryRun: Boolean) {
+          importProducts(file: $file, format: $format, dryRun: $dryRun) {
+            id
+            status
+            dryRun
+            totalRows
+            imported
+            failed
+            errors {
+              row
+              message
+            }
+          }
+        }
+    `
+	file := []byte("name,description,price,status\n" +
+		"Imported Lamp,A desk lamp,19.90,PUBLISHED\n" +
+		",Nameless product,5,DRAFT\n" +
+		"Imported Chair,A chair,not-a-price,DRAFT\n")
+
+	resp := doUploadRequest(t, serverURL, query, map[string]interface{}{
+		"format": "CSV",
+		"dryRun": true,
+	}, "catalog.csv", file)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during ImportProducts")
+
+	data, ok := resp.Data.(map[string]interface{})
+	assert.True(t, ok)
+	job, ok := data["importProducts"].(map[string]interface{})
+	assert.True(t, ok)
+
+	assert.Equal(t, "COMPLETED", job["status"])
+	assert.Equal(t, true, job["dryRun"])
+	assert.EqualValues(t, 3, job["totalRows"])
+	assert.EqualValues(t, 1, job["imported"])
+	assert.EqualValues(t, 2, job["failed"])
+
+	errors, _ := job["errors"].([]interface{})
+	if assert.Len(t, errors, 2) {
+		assert.EqualValues(t, 2, errors[0].(map[string]interface{})["row"])
+		assert.EqualValues(t, 3, errors[1].(map[string]interface{})["row"])
+	}
+
+	// The report can be looked up again
+	status := `
+        query ImportJob($id: String!) {
+          importJob(id: $id) {
+            status
+            failed
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, status, map[string]interface{}{"id": job["id"]})
+	assert.Nil(t, resp.Errors)
+	saved := resp.Data.(map[string]interface{})["importJob"].(map[string]interface{})
+	assert.Equal(t, "COMPLETED", saved["status"])
+	assert.EqualValues(t, 2, saved["failed"])
+}
+
+// 30) An exported catalog imported again updates the products it lists
+func Test30ReimportExportedCatalog(t *testing.T) {
+	query := `
+        mutation ImportProducts($file: Upload!, $format: CatalogFormat!) {
+          importProducts(file: $file, format: $format) {
+            status
+            imported
+            failed
+          }
+        }
+    `
+	name := fmt.Sprintf("Reimported Lamp %d", time.Now().UnixNano())
+	resp := doUploadRequest(t, serverURL, query, map[string]interface{}{"format": "CSV"},
+		"catalog.csv", []byte("name,description,price,status\n"+name+",A desk lamp,19.90,DRAFT\n"))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during ImportProducts")
+
+	export := func() []map[string]interface{} {
+		req, err := http.NewRequest("GET", strings.TrimSuffix(serverURL, "/graphql")+"/catalog/export?format=JSONL", nil)
+		assert.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "token", Value: AuthToken, Path: "/"})
+		res, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var rows []map[string]interface{}
+		decoder := json.NewDecoder(res.Body)
+		for decoder.More() {
+			var row map[string]interface{}
+			if !assert.NoError(t, decoder.Decode(&row)) {
+				break
+			}
+			if row["name"] == name {
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	}
+
+	rows := export()
+	if !assert.Len(t, rows, 1) {
+		return
+	}
+	assert.NotEmpty(t, rows[0]["id"])
+
+	// Edit the exported row and import it again
+	rows[0]["price"] = 24.5
+	line, err := json.Marshal(rows[0])
+	assert.NoError(t, err)
+	resp = doUploadRequest(t, serverURL, query, map[string]interface{}{"format": "JSONL"}, "catalog.jsonl", line)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during ImportProducts")
+	job := resp.Data.(map[string]interface{})["importProducts"].(map[string]interface{})
+	assert.EqualValues(t, 1, job["imported"])
+	assert.EqualValues(t, 0, job["failed"])
+
+	updated := export()
+	if assert.Len(t, updated, 1, "the import must not duplicate the product") {
+		assert.Equal(t, rows[0]["id"], updated[0]["id"])
+		assert.EqualValues(t, 24.5, updated[0]["price"])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"mime/multipart"
 	"net/http"
 	"testing"
 )
@@ -67,3 +68,42 @@ func doRequest(t *testing.T, serverURL, query string, variables map[string]inter
 
 	return gqlResp
 }
+
+// doUploadRequest executes a GraphQL operation with a single file, following the
+// multipart request spec. The file is bound to the "file" variable.
+func doUploadRequest(t *testing.T, serverURL, query string, variables map[string]interface{}, filename string, content []byte) GraphQLResponse {
+	variables["file"] = nil
+	operations, err := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+	assert.NoError(t, err)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.NoError(t, writer.WriteField("operations", string(operations)))
+	assert.NoError(t, writer.WriteField("map", `{"0": ["variables.file"]}`))
+	part, err := writer.CreateFormFile("0", filename)
+	assert.NoError(t, err)
+	_, err = part.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	req, err := http.NewRequest("POST", serverURL, &body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if AuthToken != "" {
+		req.AddCookie(&http.Cookie{
+			Name:  "token",
+			Value: AuthToken,
+			Path:  "/",
+		})
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var gqlResp GraphQLResponse
+	err = json.NewDecoder(resp.Body).Decode(&gqlResp)
+	assert.NoError(t, err)
+
+	return gqlResp
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"math/rand"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -110,3 +114,1373 @@ func Test04CreateOrder(t *testing.T) {
 	assert.True(t, ok, "expected products to be a list")
 	assert.Len(t, products, 2, "Expected 2 products in the order")
 }
+
+func Test14CouponDiscount(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Discounted Product",
+			"description": "Sold with a coupon",
+			"price":       20.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	code := fmt.Sprintf("TEST%d", time.Now().UnixNano())
+	createPromotion := `
+        mutation CreatePromotion($promotion: PromotionInput!) {
+          createPromotion(promotion: $promotion) {
+            code
+            sellerId
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createPromotion, map[string]interface{}{
+		"promotion": map[string]interface{}{
+			"code":              code,
+			"type":              "PERCENTAGE",
+			"value":             25,
+			"maxUsesPerAccount": 1,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreatePromotion")
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            subtotal
+            discountTotal
+            totalPrice
+            totalMoney {
+              amount
+              currency
+            }
+            couponCode
+            discounts {
+              productId
+              amount
+            }
+          }
+        }
+    `
+	orderVariables := map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 2},
+			},
+			"couponCode": strings.ToLower(code),
+		},
+	}
+	resp = doRequest(t, serverURL, createOrder, orderVariables)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.EqualValues(t, 40, order["subtotal"])
+	assert.EqualValues(t, 10, order["discountTotal"])
+	assert.EqualValues(t, 30, order["totalPrice"])
+	totalMoney := order["totalMoney"].(map[string]interface{})
+	assert.EqualValues(t, 3000, totalMoney["amount"])
+	assert.Equal(t, "USD", totalMoney["currency"])
+	assert.Equal(t, code, order["couponCode"])
+	discounts := order["discounts"].([]interface{})
+	assert.Len(t, discounts, 1)
+	assert.Equal(t, product["id"], discounts[0].(map[string]interface{})["productId"])
+
+	// The coupon can only be used once per account
+	resp = doRequest(t, serverURL, createOrder, orderVariables)
+	assert.NotEmpty(t, resp.Errors, "expected the second use of the coupon to fail")
+}
+
+// Uses the stub exchange rates: 1 USD = 0.9 EUR = 0.8 GBP
+func Test15OrderInAnotherCurrency(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+            priceMoney {
+              amount
+              currency
+            }
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Euro Product",
+			"description": "Priced in euros",
+			"price":       9.0,
+			"currency":    "eur",
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+	priceMoney := product["priceMoney"].(map[string]interface{})
+	assert.EqualValues(t, 900, priceMoney["amount"])
+	assert.Equal(t, "EUR", priceMoney["currency"])
+
+	productQuery := `
+        query Product($id: String, $currency: String) {
+          product(id: $id, currency: $currency) {
+            priceMoney {
+              amount
+              currency
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, productQuery, map[string]interface{}{"id": product["id"], "currency": "GBP"})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during product query")
+	converted := resp.Data.(map[string]interface{})["product"].([]interface{})[0].(map[string]interface{})["priceMoney"].(map[string]interface{})
+	assert.EqualValues(t, 800, converted["amount"])
+	assert.Equal(t, "GBP", converted["currency"])
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            totalMoney {
+              amount
+              currency
+            }
+            exchangeRates {
+              from
+              to
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createOrder, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+			"currency": "USD",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	total := order["totalMoney"].(map[string]interface{})
+	assert.EqualValues(t, 1000, total["amount"])
+	assert.Equal(t, "USD", total["currency"])
+	rates := order["exchangeRates"].([]interface{})
+	assert.Len(t, rates, 1)
+	assert.Equal(t, "EUR", rates[0].(map[string]interface{})["from"])
+}
+
+// 17) New orders are pending, and sellers cannot skip steps of the lifecycle
+func Test17OrderStatus(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Tracked Product",
+			"description": "Goes through every status",
+			"price":       12.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+            status
+            statusHistory {
+              to
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createOrder, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, "PENDING", order["status"])
+	assert.Len(t, order["statusHistory"], 1)
+
+	updateStatus := `
+        mutation UpdateOrderStatus($orderId: String!, $status: OrderStatus!) {
+          updateOrderStatus(orderId: $orderId, status: $status) {
+            status
+          }
+        }
+    `
+	// Only admins and payments mark an order as paid
+	resp = doRequest(t, serverURL, updateStatus, map[string]interface{}{
+		"orderId": order["id"],
+		"status":  "PAID",
+	})
+	assert.NotEmpty(t, resp.Errors, "expected a seller to be unable to mark an order as paid")
+
+	// An unpaid order cannot be shipped
+	resp = doRequest(t, serverURL, updateStatus, map[string]interface{}{
+		"orderId": order["id"],
+		"status":  "SHIPPED",
+	})
+	assert.NotEmpty(t, resp.Errors, "expected a pending order to be unable to ship")
+}
+
+// 18) A customer can cancel a pending order once, with a reason
+func Test18CancelOrder(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Cancelled Product",
+			"description": "Ordered by mistake",
+			"price":       3.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createOrder, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	cancelOrder := `
+        mutation CancelOrder($orderId: String!, $reason: String) {
+          cancelOrder(orderId: $orderId, reason: $reason) {
+            status
+            cancellationReason
+          }
+        }
+    `
+	variables := map[string]interface{}{
+		"orderId": order["id"],
+		"reason":  "Ordered by mistake",
+	}
+	resp = doRequest(t, serverURL, cancelOrder, variables)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CancelOrder")
+	cancelled := resp.Data.(map[string]interface{})["cancelOrder"].(map[string]interface{})
+	assert.Equal(t, "CANCELLED", cancelled["status"])
+	assert.Equal(t, "Ordered by mistake", cancelled["cancellationReason"])
+
+	resp = doRequest(t, serverURL, cancelOrder, variables)
+	assert.NotEmpty(t, resp.Errors, "expected a cancelled order to be unable to be cancelled again")
+}
+
+// 19) A declined payment leaves the order pending, a captured one pays it and
+// cancelling refunds it
+func Test19PayOrder(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Paid Product",
+			"description": "Paid with the fake gateway",
+			"price":       8.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createOrder, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	payOrder := `
+        mutation PayOrder($orderId: String!, $paymentMethod: String!) {
+          payOrder(orderId: $orderId, paymentMethod: $paymentMethod) {
+            status
+            payments {
+              status
+              amount {
+                amount
+              }
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, payOrder, map[string]interface{}{
+		"orderId":       order["id"],
+		"paymentMethod": "pm_fake_declined",
+	})
+	assert.NotEmpty(t, resp.Errors, "expected the payment to be declined")
+
+	resp = doRequest(t, serverURL, payOrder, map[string]interface{}{
+		"orderId":       order["id"],
+		"paymentMethod": "pm_fake_ok",
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during PayOrder")
+	paid := resp.Data.(map[string]interface{})["payOrder"].(map[string]interface{})
+	assert.Equal(t, "PAID", paid["status"])
+	payments := paid["payments"].([]interface{})
+	if assert.Len(t, payments, 2) {
+		assert.Equal(t, "FAILED", payments[0].(map[string]interface{})["status"])
+		assert.Equal(t, "CAPTURED", payments[1].(map[string]interface{})["status"])
+		assert.Equal(t, float64(800), payments[1].(map[string]interface{})["amount"].(map[string]interface{})["amount"])
+	}
+
+	cancelOrder := `
+        mutation CancelOrder($orderId: String!) {
+          cancelOrder(orderId: $orderId) {
+            status
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, cancelOrder, map[string]interface{}{"orderId": order["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CancelOrder")
+	assert.Equal(t, "REFUNDED", resp.Data.(map[string]interface{})["cancelOrder"].(map[string]interface{})["status"])
+
+	// Webhooks without a valid signature are rejected
+	webhookURL := strings.TrimSuffix(serverURL, "/graphql") + "/payments/webhook"
+	res, err := http.Post(webhookURL, "application/json", strings.NewReader(`{"id":"evt_1","type":"payment.captured"}`))
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+}
+
+// 20) Retrying an order with the same idempotency key returns the first order,
+// reusing the key for another basket or address is rejected
+func Test20IdempotentOrder(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Idempotent Product",
+			"description": "Ordered twice with the same key",
+			"price":       4.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `
+	order := func(quantity int) map[string]interface{} {
+		return map[string]interface{}{
+			"order": map[string]interface{}{
+				"products": []interface{}{
+					map[string]interface{}{"id": product["id"], "quantity": quantity},
+				},
+				"idempotencyKey": "test-20-" + product["id"].(string),
+			},
+		}
+	}
+
+	resp = doRequest(t, serverURL, createOrder, order(2))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	first := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, createOrder, order(2))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during the retried CreateOrder")
+	retried := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, first["id"], retried["id"], "a retry with the same key should return the same order")
+
+	resp = doRequest(t, serverURL, createOrder, order(3))
+	assert.NotEmpty(t, resp.Errors, "expected a reused key with a different basket to be rejected")
+
+	// The shipping address is part of the request, however it is spaced
+	shipTo := func(line1, city, country string) map[string]interface{} {
+		variables := order(2)
+		placed := variables["order"].(map[string]interface{})
+		placed["idempotencyKey"] = "test-20-address-" + product["id"].(string)
+		placed["shippingAddress"] = map[string]interface{}{"line1": line1, "city": city, "country": country}
+		return variables
+	}
+	resp = doRequest(t, serverURL, createOrder, shipTo("1 Main Street", "Springfield", "US"))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	shipped := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, createOrder, shipTo(" 1 Main Street ", "Springfield", "us"))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during the retried CreateOrder")
+	retried = resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, shipped["id"], retried["id"], "a retry with the same address should return the same order")
+
+	resp = doRequest(t, serverURL, createOrder, shipTo("1 Main Street", "Shelbyville", "US"))
+	assert.NotEmpty(t, resp.Errors, "expected a reused key with a different address to be rejected")
+}
+
+// 21) Orders keep the name and price the product had when it was bought
+func Test21OrderLineSnapshot(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Snapshot Product",
+			"description": "Renamed after the order",
+			"price":       6.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createOrder, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	updateProduct := `
+        mutation UpdateProduct($product: UpdateProductInput!) {
+          updateProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, updateProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"id":    product["id"],
+			"name":  "Renamed Snapshot Product",
+			"price": 9.0,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateProduct")
+
+	cancelOrder := `
+        mutation CancelOrder($orderId: String!) {
+          cancelOrder(orderId: $orderId) {
+            products {
+              name
+              priceMoney {
+                amount
+              }
+              product {
+                name
+              }
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, cancelOrder, map[string]interface{}{"orderId": order["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CancelOrder")
+	cancelled := resp.Data.(map[string]interface{})["cancelOrder"].(map[string]interface{})
+	line := cancelled["products"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Snapshot Product", line["name"])
+	assert.EqualValues(t, 600, line["priceMoney"].(map[string]interface{})["amount"])
+	assert.Equal(t, "Renamed Snapshot Product", line["product"].(map[string]interface{})["name"])
+}
+
+// 22) Orders are listed a page at a time and can be filtered by product, and
+// a single order can be fetched by ID
+func Test22OrderHistory(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "History Product",
+			"description": "Ordered three times",
+			"price":       3.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `
+	var orderIDs []interface{}
+	for quantity := 1; quantity <= 3; quantity++ {
+		resp = doRequest(t, serverURL, createOrder, map[string]interface{}{
+			"order": map[string]interface{}{
+				"products": []interface{}{
+					map[string]interface{}{"id": product["id"], "quantity": quantity},
+				},
+			},
+		})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+		orderIDs = append(orderIDs, resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})["id"])
+	}
+
+	orders := `
+        query Orders($filter: OrderFilterInput, $after: String) {
+          accounts {
+            orders(first: 2, after: $after, filter: $filter, sort: OLDEST) {
+              totalCount
+              edges {
+                node {
+                  id
+                }
+              }
+              pageInfo {
+                hasNextPage
+                endCursor
+              }
+            }
+          }
+        }
+    `
+	filter := map[string]interface{}{"productId": product["id"]}
+	page := func(after interface{}) map[string]interface{} {
+		resp := doRequest(t, serverURL, orders, map[string]interface{}{"filter": filter, "after": after})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Orders")
+		account := resp.Data.(map[string]interface{})["accounts"].([]interface{})[0].(map[string]interface{})
+		return account["orders"].(map[string]interface{})
+	}
+	nodeIDs := func(connection map[string]interface{}) []interface{} {
+		var ids []interface{}
+		for _, edge := range connection["edges"].([]interface{}) {
+			ids = append(ids, edge.(map[string]interface{})["node"].(map[string]interface{})["id"])
+		}
+		return ids
+	}
+
+	first := page(nil)
+	assert.EqualValues(t, 3, first["totalCount"])
+	assert.Equal(t, orderIDs[:2], nodeIDs(first))
+	pageInfo := first["pageInfo"].(map[string]interface{})
+	assert.Equal(t, true, pageInfo["hasNextPage"])
+
+	second := page(pageInfo["endCursor"])
+	assert.Equal(t, orderIDs[2:], nodeIDs(second))
+	assert.Equal(t, false, second["pageInfo"].(map[string]interface{})["hasNextPage"])
+
+	getOrder := `
+        query Order($id: String!) {
+          order(id: $id) {
+            id
+            products {
+              quantity
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, getOrder, map[string]interface{}{"id": orderIDs[1]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Order")
+	order := resp.Data.(map[string]interface{})["order"].(map[string]interface{})
+	assert.Equal(t, orderIDs[1], order["id"])
+	assert.EqualValues(t, 2, order["products"].([]interface{})[0].(map[string]interface{})["quantity"])
+}
+
+// 23) Ordering a product holds its stock until the order is cancelled, and an
+// order for more than is left fails
+func Test23StockReservation(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Limited Product",
+			"description": "Only three left",
+			"price":       15.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	updateProduct := `
+        mutation UpdateProduct($product: UpdateProductInput!) {
+          updateProduct(product: $product) {
+            stock
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, updateProduct, map[string]interface{}{
+		"product": map[string]interface{}{"id": product["id"], "stock": 3},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateProduct")
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `
+	order := func(quantity int) map[string]interface{} {
+		return map[string]interface{}{
+			"order": map[string]interface{}{
+				"products": []interface{}{
+					map[string]interface{}{"id": product["id"], "quantity": quantity},
+				},
+			},
+		}
+	}
+	stock := func() float64 {
+		resp := doRequest(t, serverURL, `
+            query Product($id: String!) {
+              product(id: $id) {
+                stock
+              }
+            }
+        `, map[string]interface{}{"id": product["id"]})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Product")
+		products := resp.Data.(map[string]interface{})["product"].([]interface{})
+		return products[0].(map[string]interface{})["stock"].(float64)
+	}
+
+	resp = doRequest(t, serverURL, createOrder, order(2))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, float64(1), stock(), "the ordered units should be held")
+
+	resp = doRequest(t, serverURL, createOrder, order(2))
+	assert.NotEmpty(t, resp.Errors, "expected an order for more than the stock left to fail")
+	assert.Equal(t, float64(1), stock(), "a failed order should not hold any stock")
+
+	resp = doRequest(t, serverURL, `
+        mutation CancelOrder($orderId: String!) {
+          cancelOrder(orderId: $orderId) {
+            status
+          }
+        }
+    `, map[string]interface{}{"orderId": placed["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CancelOrder")
+	assert.Equal(t, float64(3), stock(), "cancelling the order should give the stock back")
+}
+
+// 24) Each seller ships their products of a paid order, and the order follows
+// its shipments until it is delivered
+func Test24ShipOrder(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Shipped Product",
+			"description": "Travels well",
+			"price":       20.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+            shippingAddress {
+              city
+              country
+            }
+            shipments {
+              id
+              status
+            }
+          }
+        }
+    `
+	order := func(address map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"order": map[string]interface{}{
+				"products": []interface{}{
+					map[string]interface{}{"id": product["id"], "quantity": 1},
+				},
+				"shippingAddress": address,
+			},
+		}
+	}
+	resp = doRequest(t, serverURL, createOrder, order(map[string]interface{}{"line1": "1 Main Street", "city": "", "country": "US"}))
+	assert.NotEmpty(t, resp.Errors, "expected an address without a city to be rejected")
+
+	resp = doRequest(t, serverURL, createOrder, order(map[string]interface{}{"line1": "1 Main Street", "city": "Springfield", "country": "us"}))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, "US", placed["shippingAddress"].(map[string]interface{})["country"])
+	shipments := placed["shipments"].([]interface{})
+	if !assert.Len(t, shipments, 1) {
+		return
+	}
+	shipment := shipments[0].(map[string]interface{})
+	assert.Equal(t, "PENDING", shipment["status"])
+
+	shipShipment := `
+        mutation ShipShipment($shipmentId: String!) {
+          shipShipment(shipmentId: $shipmentId, carrier: UPS, trackingNumber: "1Z999") {
+            status
+            trackingUrl
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, shipShipment, map[string]interface{}{"shipmentId": shipment["id"]})
+	assert.NotEmpty(t, resp.Errors, "expected an unpaid order to be unable to ship")
+
+	resp = doRequest(t, serverURL, `
+        mutation PayOrder($orderId: String!) {
+          payOrder(orderId: $orderId, paymentMethod: "pm_fake_ok") {
+            status
+          }
+        }
+    `, map[string]interface{}{"orderId": placed["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during PayOrder")
+
+	resp = doRequest(t, serverURL, shipShipment, map[string]interface{}{"shipmentId": shipment["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during ShipShipment")
+	shipped := resp.Data.(map[string]interface{})["shipShipment"].(map[string]interface{})
+	assert.Equal(t, "SHIPPED", shipped["status"])
+	assert.Contains(t, shipped["trackingUrl"], "1Z999")
+
+	resp = doRequest(t, serverURL, `
+        mutation UpdateShipmentStatus($shipmentId: String!) {
+          updateShipmentStatus(shipmentId: $shipmentId, status: DELIVERED) {
+            status
+          }
+        }
+    `, map[string]interface{}{"shipmentId": shipment["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateShipmentStatus")
+
+	resp = doRequest(t, serverURL, `
+        query Order($id: String!) {
+          order(id: $id) {
+            status
+          }
+        }
+    `, map[string]interface{}{"id": placed["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Order")
+	assert.Equal(t, "DELIVERED", resp.Data.(map[string]interface{})["order"].(map[string]interface{})["status"])
+}
+
+// 25) Quoting an order gives the totals of the order without placing it
+func Test25OrderQuote(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Quoted Product",
+			"description": "Priced before checkout",
+			"price":       12.5,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	order := map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 2},
+			},
+		},
+	}
+	resp = doRequest(t, serverURL, `
+        query OrderQuote($order: OrderInput!) {
+          orderQuote(order: $order) {
+            subtotalMoney { amount currency }
+            taxMoney { amount }
+            totalMoney { amount }
+            taxes { productId }
+          }
+        }
+    `, order)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during OrderQuote")
+	quote := resp.Data.(map[string]interface{})["orderQuote"].(map[string]interface{})
+	assert.Equal(t, float64(2500), quote["subtotalMoney"].(map[string]interface{})["amount"])
+	assert.Equal(t, float64(0), quote["taxMoney"].(map[string]interface{})["amount"], "nothing is taxed without tax rules")
+
+	resp = doRequest(t, serverURL, `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            totalMoney { amount }
+            taxes { productId }
+          }
+        }
+    `, order)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, quote["totalMoney"], placed["totalMoney"], "the order should cost what was quoted")
+}
+
+// 26) A quote lists the lines that cannot be ordered, and an order with such
+// a line is refused instead of dropping it
+func Test26QuoteLineErrors(t *testing.T) {
+	resp := doRequest(t, serverURL, `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Orderable Product",
+			"description": "Can be ordered",
+			"price":       4.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	order := map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 3},
+				map[string]interface{}{"id": "no-such-product", "quantity": 1},
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+		},
+	}
+	orderQuote := `
+        query OrderQuote($order: OrderInput!) {
+          orderQuote(order: $order) {
+            lines { productId quantity totalMoney { amount } }
+            totalMoney { amount }
+            errors { productId code }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, orderQuote, order)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during OrderQuote")
+	quote := resp.Data.(map[string]interface{})["orderQuote"].(map[string]interface{})
+	lines := quote["lines"].([]interface{})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, float64(4), lines[0].(map[string]interface{})["quantity"], "quantities of the same product should add up")
+	}
+	assert.Equal(t, float64(1600), quote["totalMoney"].(map[string]interface{})["amount"])
+	errors := quote["errors"].([]interface{})
+	if assert.Len(t, errors, 1) {
+		assert.Equal(t, "no-such-product", errors[0].(map[string]interface{})["productId"])
+		assert.Equal(t, "UNKNOWN_PRODUCT", errors[0].(map[string]interface{})["code"])
+	}
+
+	resp = doRequest(t, serverURL, `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `, order)
+	assert.NotEmpty(t, resp.Errors, "expected an order with an unknown product to be refused")
+
+	// When no line can be ordered the quote is empty and lists the errors
+	resp = doRequest(t, serverURL, orderQuote, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": "no-such-product", "quantity": 1},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during OrderQuote")
+	quote = resp.Data.(map[string]interface{})["orderQuote"].(map[string]interface{})
+	assert.Empty(t, quote["lines"])
+	assert.Equal(t, float64(0), quote["totalMoney"].(map[string]interface{})["amount"])
+	assert.Len(t, quote["errors"], 1)
+}
+
+// 27) A delivered product can be returned, receiving the return refunds it
+func Test27ReturnProduct(t *testing.T) {
+	resp := doRequest(t, serverURL, `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Returned Product",
+			"description": "Comes back",
+			"price":       15.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+            shipments {
+              id
+            }
+          }
+        }
+    `, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 2},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	shipments := placed["shipments"].([]interface{})
+	if !assert.Len(t, shipments, 1) {
+		return
+	}
+	shipmentId := shipments[0].(map[string]interface{})["id"]
+
+	requestReturn := `
+        mutation RequestReturn($orderId: String!, $productId: String!, $quantity: Int!) {
+          requestReturn(orderId: $orderId, productId: $productId, quantity: $quantity, reason: DAMAGED) {
+            id
+            status
+            refund { amount }
+          }
+        }
+    `
+	returned := func(quantity int) map[string]interface{} {
+		return map[string]interface{}{"orderId": placed["id"], "productId": product["id"], "quantity": quantity}
+	}
+	resp = doRequest(t, serverURL, requestReturn, returned(1))
+	assert.NotEmpty(t, resp.Errors, "expected an undelivered order to be unreturnable")
+
+	for _, step := range []struct {
+		query string
+		id    interface{}
+	}{
+		{`mutation Step($id: String!) { payOrder(orderId: $id, paymentMethod: "pm_fake_ok") { status } }`, placed["id"]},
+		{`mutation Step($id: String!) { shipShipment(shipmentId: $id, carrier: UPS, trackingNumber: "1Z999") { status } }`, shipmentId},
+		{`mutation Step($id: String!) { updateShipmentStatus(shipmentId: $id, status: DELIVERED) { status } }`, shipmentId},
+	} {
+		resp = doRequest(t, serverURL, step.query, map[string]interface{}{"id": step.id})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors delivering the order")
+	}
+
+	resp = doRequest(t, serverURL, requestReturn, returned(3))
+	assert.NotEmpty(t, resp.Errors, "expected more units than ordered to be refused")
+
+	resp = doRequest(t, serverURL, requestReturn, returned(1))
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during RequestReturn")
+	requested := resp.Data.(map[string]interface{})["requestReturn"].(map[string]interface{})
+	assert.Equal(t, "REQUESTED", requested["status"])
+	assert.Equal(t, float64(1500), requested["refund"].(map[string]interface{})["amount"])
+
+	for _, step := range []string{
+		`mutation Step($id: String!) { reviewReturn(returnId: $id, approve: true) { status } }`,
+		`mutation Step($id: String!) { shipReturn(returnId: $id, carrier: UPS, trackingNumber: "1Z111") { status } }`,
+	} {
+		resp = doRequest(t, serverURL, step, map[string]interface{}{"id": requested["id"]})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors moving the return")
+	}
+
+	receiveReturn := `
+        mutation ReceiveReturn($id: String!) {
+          receiveReturn(returnId: $id) {
+            status
+            restocked
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, receiveReturn, map[string]interface{}{"id": requested["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during ReceiveReturn")
+	received := resp.Data.(map[string]interface{})["receiveReturn"].(map[string]interface{})
+	assert.Equal(t, "REFUNDED", received["status"])
+	assert.Equal(t, true, received["restocked"])
+
+	// A refunded return is not refunded again
+	resp = doRequest(t, serverURL, receiveReturn, map[string]interface{}{"id": requested["id"]})
+	assert.NotEmpty(t, resp.Errors, "expected a refunded return to be unable to be received again")
+
+	resp = doRequest(t, serverURL, `
+        query Order($id: String!) {
+          order(id: $id) {
+            status
+            payments { refunded { amount } }
+          }
+        }
+    `, map[string]interface{}{"id": placed["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during Order")
+	order := resp.Data.(map[string]interface{})["order"].(map[string]interface{})
+	assert.Equal(t, "DELIVERED", order["status"], "a partly returned order stays delivered")
+	payments := order["payments"].([]interface{})
+	if assert.Len(t, payments, 1) {
+		assert.Equal(t, float64(1500), payments[0].(map[string]interface{})["refunded"].(map[string]interface{})["amount"])
+	}
+}
+
+// 28) Sellers see the orders of their products with what they can do next
+func Test28SellerOrders(t *testing.T) {
+	resp := doRequest(t, serverURL, `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Sold Product",
+			"description": "Bought from its own seller",
+			"price":       8.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 3},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	sellerOrders := `
+        query SellerOrders($productId: String!, $statuses: [OrderStatus!]) {
+          sellerOrders(filter: { productId: $productId, statuses: $statuses }) {
+            totalCount
+            edges {
+              node {
+                id
+                totalMoney { amount }
+                lines { productId quantity shipmentId actions }
+              }
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, sellerOrders, map[string]interface{}{"productId": product["id"], "statuses": []string{"PAID"}})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during SellerOrders")
+	assert.Equal(t, float64(0), resp.Data.(map[string]interface{})["sellerOrders"].(map[string]interface{})["totalCount"], "expected the pending order to be filtered out")
+
+	resp = doRequest(t, serverURL, `
+        mutation PayOrder($orderId: String!) {
+          payOrder(orderId: $orderId, paymentMethod: "pm_fake_ok") {
+            status
+          }
+        }
+    `, map[string]interface{}{"orderId": placed["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during PayOrder")
+
+	resp = doRequest(t, serverURL, sellerOrders, map[string]interface{}{"productId": product["id"], "statuses": []string{"PAID"}})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during SellerOrders")
+	edges := resp.Data.(map[string]interface{})["sellerOrders"].(map[string]interface{})["edges"].([]interface{})
+	if !assert.Len(t, edges, 1) {
+		return
+	}
+	order := edges[0].(map[string]interface{})["node"].(map[string]interface{})
+	assert.Equal(t, placed["id"], order["id"])
+	assert.Equal(t, float64(2400), order["totalMoney"].(map[string]interface{})["amount"])
+	lines := order["lines"].([]interface{})
+	if assert.Len(t, lines, 1) {
+		line := lines[0].(map[string]interface{})
+		assert.Equal(t, float64(3), line["quantity"])
+		assert.NotNil(t, line["shipmentId"])
+		assert.Equal(t, []interface{}{"SHIP"}, line["actions"])
+	}
+}
+
+// 29) Paying an order invoices it, and the invoice is downloaded as a PDF
+func Test29InvoiceOrder(t *testing.T) {
+	resp := doRequest(t, serverURL, `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Invoiced Product",
+			"description": "Billed when paid",
+			"price":       12.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+            invoices { id }
+          }
+        }
+    `, map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 2},
+			},
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Empty(t, placed["invoices"], "expected no invoice before the order is paid")
+
+	resp = doRequest(t, serverURL, `
+        mutation PayOrder($orderId: String!) {
+          payOrder(orderId: $orderId, paymentMethod: "pm_fake_ok") {
+            invoices {
+              id
+              kind
+              number
+              total { amount }
+              pdfUrl
+            }
+          }
+        }
+    `, map[string]interface{}{"orderId": placed["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during PayOrder")
+	invoices := resp.Data.(map[string]interface{})["payOrder"].(map[string]interface{})["invoices"].([]interface{})
+	if !assert.Len(t, invoices, 1) {
+		return
+	}
+	invoice := invoices[0].(map[string]interface{})
+	assert.Equal(t, "INVOICE", invoice["kind"])
+	assert.True(t, strings.HasPrefix(invoice["number"].(string), "INV-"))
+	assert.Equal(t, float64(2400), invoice["total"].(map[string]interface{})["amount"])
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(serverURL, "/graphql")+invoice["pdfUrl"].(string), nil)
+	assert.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "token", Value: AuthToken, Path: "/"})
+	res, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/pdf", res.Header.Get("Content-Type"))
+		body := make([]byte, 5)
+		_, err = io.ReadFull(res.Body, body)
+		assert.NoError(t, err)
+		assert.Equal(t, "%PDF-", string(body))
+	}
+}
+
+// 31) Cancelling an order gives back its use of a coupon
+func Test31CancelReleasesCoupon(t *testing.T) {
+	resp := doRequest(t, serverURL, `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Coupon Product",
+			"description": "Ordered twice with a single use coupon",
+			"price":       10.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	code := fmt.Sprintf("ONCE%d", time.Now().UnixNano())
+	resp = doRequest(t, serverURL, `
+        mutation CreatePromotion($promotion: PromotionInput!) {
+          createPromotion(promotion: $promotion) {
+            code
+          }
+        }
+    `, map[string]interface{}{
+		"promotion": map[string]interface{}{
+			"code":    code,
+			"type":    "PERCENTAGE",
+			"value":   10,
+			"maxUses": 1,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreatePromotion")
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+            couponCode
+          }
+        }
+    `
+	orderVariables := map[string]interface{}{
+		"order": map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"id": product["id"], "quantity": 1},
+			},
+			"couponCode": code,
+		},
+	}
+	resp = doRequest(t, serverURL, createOrder, orderVariables)
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateOrder")
+	order := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, createOrder, orderVariables)
+	assert.NotEmpty(t, resp.Errors, "expected the coupon to be used up")
+
+	resp = doRequest(t, serverURL, `
+        mutation CancelOrder($orderId: String!) {
+          cancelOrder(orderId: $orderId) {
+            status
+          }
+        }
+    `, map[string]interface{}{"orderId": order["id"]})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CancelOrder")
+
+	resp = doRequest(t, serverURL, createOrder, orderVariables)
+	assert.Nil(t, resp.Errors, "expected the coupon to be usable again once the order is cancelled")
+	reordered := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, code, reordered["couponCode"])
+}
+
+// 32) An order refused for lack of stock gives its coupon back, so the
+// customer can order less with the same coupon
+func Test32OutOfStockReleasesCoupon(t *testing.T) {
+	resp := doRequest(t, serverURL, `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Scarce Product",
+			"description": "Only two left",
+			"price":       12.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	resp = doRequest(t, serverURL, `
+        mutation UpdateProduct($product: UpdateProductInput!) {
+          updateProduct(product: $product) {
+            stock
+          }
+        }
+    `, map[string]interface{}{
+		"product": map[string]interface{}{"id": product["id"], "stock": 2},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateProduct")
+
+	code := fmt.Sprintf("SCARCE%d", time.Now().UnixNano())
+	resp = doRequest(t, serverURL, `
+        mutation CreatePromotion($promotion: PromotionInput!) {
+          createPromotion(promotion: $promotion) {
+            code
+          }
+        }
+    `, map[string]interface{}{
+		"promotion": map[string]interface{}{
+			"code":    code,
+			"type":    "PERCENTAGE",
+			"value":   10,
+			"maxUses": 1,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreatePromotion")
+
+	createOrder := `
+        mutation CreateOrder($order: OrderInput!) {
+          createOrder(order: $order) {
+            id
+            couponCode
+          }
+        }
+    `
+	order := func(quantity int) map[string]interface{} {
+		return map[string]interface{}{
+			"order": map[string]interface{}{
+				"products": []interface{}{
+					map[string]interface{}{"id": product["id"], "quantity": quantity},
+				},
+				"couponCode": code,
+			},
+		}
+	}
+
+	resp = doRequest(t, serverURL, createOrder, order(3))
+	assert.NotEmpty(t, resp.Errors, "expected an order for more than the stock to fail")
+
+	resp = doRequest(t, serverURL, createOrder, order(2))
+	assert.Nil(t, resp.Errors, "expected the coupon of the refused order to be usable again")
+	placed := resp.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	assert.Equal(t, code, placed["couponCode"])
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"log"
 	"testing"
+	"time"
 )
 
 // 3) Create a product
@@ -16,6 +17,7 @@ func Test03CreateProduct(t *testing.T) {
             description
             price
             accountId
+            status
           }
         }
     `
@@ -24,6 +26,7 @@ func Test03CreateProduct(t *testing.T) {
 			"name":        "Test Product",
 			"description": "A test description",
 			"price":       12.99,
+			"status":      "PUBLISHED",
 		},
 	}
 
@@ -40,6 +43,7 @@ func Test03CreateProduct(t *testing.T) {
 	assert.Equal(t, "Test Product", p["name"])
 	assert.Equal(t, "A test description", p["description"])
 	assert.EqualValues(t, 12.99, p["price"])
+	assert.Equal(t, "PUBLISHED", p["status"])
 	log.Println("Created product:", p)
 }
 
@@ -77,3 +81,361 @@ func Test06QueryProducts(t *testing.T) {
 
 	log.Println("Products:", products)
 }
+
+// 7) Newest products come first when sorting by NEWEST
+func Test07SortProductsByNewest(t *testing.T) {
+	query := `
+        query SortedProducts($pagination: PaginationInput, $sortBy: SortOrder) {
+          product(pagination: $pagination, sortBy: $sortBy) {
+            id
+            createdAt
+          }
+        }
+    `
+	variables := map[string]interface{}{
+		"pagination": map[string]interface{}{
+			"skip": 0,
+			"take": 20,
+		},
+		"sortBy": "NEWEST",
+	}
+
+	resp := doRequest(t, serverURL, query, variables)
+	assert.Nil(t, resp.Errors)
+
+	data, ok := resp.Data.(map[string]interface{})
+	assert.True(t, ok)
+
+	products, ok := data["product"].([]interface{})
+	assert.True(t, ok)
+
+	// Products without a timestamp (indexed before createdAt existed) sort last
+	var previous time.Time
+	for _, item := range products {
+		value, _ := item.(map[string]interface{})["createdAt"].(string)
+		if value == "" {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339Nano, value)
+		assert.NoError(t, err)
+		if !previous.IsZero() {
+			assert.False(t, createdAt.After(previous), "expected products to be sorted by createdAt descending")
+		}
+		previous = createdAt
+	}
+}
+
+func Test09DraftProductIsHidden(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+            status
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Draft Product",
+			"description": "Not ready yet",
+			"price":       3.5,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+
+	data, ok := resp.Data.(map[string]interface{})
+	assert.True(t, ok)
+	product, ok := data["createProduct"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, "DRAFT", product["status"])
+	productId := product["id"].(string)
+
+	search := `
+        query SearchProducts($query: String) {
+          product(query: $query) {
+            id
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, search, map[string]interface{}{"query": "Draft Product"})
+	assert.Nil(t, resp.Errors)
+	for _, item := range resp.Data.(map[string]interface{})["product"].([]interface{}) {
+		assert.NotEqual(t, productId, item.(map[string]interface{})["id"], "draft products should not be searchable")
+	}
+
+	setStatus := `
+        mutation SetProductStatus($id: String!, $status: ProductStatus!) {
+          setProductStatus(id: $id, status: $status) {
+            id
+            status
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, setStatus, map[string]interface{}{"id": productId, "status": "PUBLISHED"})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during SetProductStatus")
+	published := resp.Data.(map[string]interface{})["setProductStatus"].(map[string]interface{})
+	assert.Equal(t, "PUBLISHED", published["status"])
+
+	// Archived products cannot go back to draft
+	resp = doRequest(t, serverURL, setStatus, map[string]interface{}{"id": productId, "status": "ARCHIVED"})
+	assert.Nil(t, resp.Errors)
+	resp = doRequest(t, serverURL, setStatus, map[string]interface{}{"id": productId, "status": "DRAFT"})
+	assert.NotNil(t, resp.Errors, "expected archived product to reject going back to draft")
+}
+
+func Test11StaleUpdateIsRejected(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+            version
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Versioned Product",
+			"description": "Edited twice",
+			"price":       8.0,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+	assert.EqualValues(t, 1, product["version"])
+
+	updateProduct := `
+        mutation UpdateProduct($product: UpdateProductInput!) {
+          updateProduct(product: $product) {
+            id
+            version
+          }
+        }
+    `
+	update := func(name string) GraphQLResponse {
+		return doRequest(t, serverURL, updateProduct, map[string]interface{}{
+			"product": map[string]interface{}{
+				"id":              product["id"],
+				"name":            name,
+				"description":     "Edited twice",
+				"price":           8.0,
+				"expectedVersion": 1,
+			},
+		})
+	}
+
+	resp = update("First edit")
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateProduct")
+	updated := resp.Data.(map[string]interface{})["updateProduct"].(map[string]interface{})
+	assert.EqualValues(t, 2, updated["version"])
+
+	// The second edit was based on version 1 as well
+	resp = update("Second edit")
+	if assert.Len(t, resp.Errors, 1) {
+		extensions, _ := resp.Errors[0].(map[string]interface{})["extensions"].(map[string]interface{})
+		assert.Equal(t, "VERSION_CONFLICT", extensions["code"])
+	}
+}
+
+func Test12PartialUpdate(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Partially Updated Product",
+			"description": "Only the price changes",
+			"price":       10.0,
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	product := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})
+
+	updateProduct := `
+        mutation UpdateProduct($product: UpdateProductInput!) {
+          updateProduct(product: $product) {
+            name
+            description
+            price
+            category
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, updateProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"id":       product["id"],
+			"price":    12.5,
+			"category": "Home",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateProduct")
+	updated := resp.Data.(map[string]interface{})["updateProduct"].(map[string]interface{})
+	assert.Equal(t, "Partially Updated Product", updated["name"])
+	assert.Equal(t, "Only the price changes", updated["description"])
+	assert.EqualValues(t, 12.5, updated["price"])
+	assert.Equal(t, "Home", updated["category"])
+}
+
+func Test13PriceHistoryAndSale(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Repriced Product",
+			"description": "Its price changes",
+			"price":       20.0,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+	productId := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})["id"]
+
+	updateProduct := `
+        mutation UpdateProduct($product: UpdateProductInput!) {
+          updateProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, updateProduct, map[string]interface{}{
+		"product": map[string]interface{}{"id": productId, "price": 25.0},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during UpdateProduct")
+
+	history := `
+        query PriceHistory($id: String) {
+          product(id: $id) {
+            priceHistory {
+              oldPrice
+              newPrice
+              reason
+            }
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, history, map[string]interface{}{"id": productId})
+	assert.Nil(t, resp.Errors)
+	products := resp.Data.(map[string]interface{})["product"].([]interface{})
+	if assert.Len(t, products, 1) {
+		changes := products[0].(map[string]interface{})["priceHistory"].([]interface{})
+		if assert.Len(t, changes, 1) {
+			change := changes[0].(map[string]interface{})
+			assert.EqualValues(t, 20.0, change["oldPrice"])
+			assert.EqualValues(t, 25.0, change["newPrice"])
+			assert.Equal(t, "MANUAL", change["reason"])
+		}
+	}
+
+	schedule := `
+        mutation SchedulePriceChange($schedule: SchedulePriceInput!) {
+          schedulePriceChange(schedule: $schedule) {
+            id
+            status
+            endsAt
+          }
+        }
+    `
+	startsAt := time.Now().Add(time.Hour)
+	resp = doRequest(t, serverURL, schedule, map[string]interface{}{
+		"schedule": map[string]interface{}{
+			"productId": productId,
+			"price":     19.0,
+			"startsAt":  startsAt.Format(time.RFC3339),
+			"endsAt":    startsAt.Add(24 * time.Hour).Format(time.RFC3339),
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during SchedulePriceChange")
+	sale := resp.Data.(map[string]interface{})["schedulePriceChange"].(map[string]interface{})
+	assert.Equal(t, "PENDING", sale["status"])
+
+	// A second sale on the same days is rejected
+	resp = doRequest(t, serverURL, schedule, map[string]interface{}{
+		"schedule": map[string]interface{}{
+			"productId": productId,
+			"price":     18.0,
+			"startsAt":  startsAt.Add(time.Hour).Format(time.RFC3339),
+			"endsAt":    startsAt.Add(2 * time.Hour).Format(time.RFC3339),
+		},
+	})
+	assert.NotNil(t, resp.Errors, "expected overlapping sale to be rejected")
+}
+
+// 33) The price range and the price sorts compare prices in the currency of
+// the query. Uses the stub exchange rates: 1 USD = 0.9 EUR
+func Test33PriceRangeAcrossCurrencies(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	name := "Currency Range " + time.Now().Format("150405.000000")
+	created := map[string]string{}
+	for _, product := range []struct {
+		currency string
+		price    float64
+	}{{"EUR", 9}, {"USD", 9.5}, {"USD", 12}} {
+		resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+			"product": map[string]interface{}{
+				"name":        name,
+				"description": "Priced in " + product.currency,
+				"price":       product.price,
+				"currency":    product.currency,
+				"status":      "PUBLISHED",
+			},
+		})
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+		id := resp.Data.(map[string]interface{})["createProduct"].(map[string]interface{})["id"].(string)
+		created[id] = product.currency
+	}
+
+	search := `
+        query SearchProducts($query: String, $priceRange: PriceRangeInput, $sortBy: SortOrder, $currency: String) {
+          product(query: $query, priceRange: $priceRange, sortBy: $sortBy, currency: $currency) {
+            id
+            priceMoney {
+              amount
+              currency
+            }
+          }
+        }
+    `
+	amounts := func(variables map[string]interface{}) []interface{} {
+		variables["query"] = name
+		resp := doRequest(t, serverURL, search, variables)
+		assert.Nil(t, resp.Errors, "unexpected GraphQL errors during SearchProducts")
+		var result []interface{}
+		for _, item := range resp.Data.(map[string]interface{})["product"].([]interface{}) {
+			product := item.(map[string]interface{})
+			if _, ok := created[product["id"].(string)]; ok {
+				result = append(result, product["priceMoney"].(map[string]interface{})["amount"])
+			}
+		}
+		return result
+	}
+
+	// 9 EUR is 10 USD, which is in the range unlike its raw price of 9
+	assert.EqualValues(t, []interface{}{1000.0}, amounts(map[string]interface{}{
+		"priceRange": map[string]interface{}{"min": 9.75, "max": 11},
+		"currency":   "USD",
+	}))
+	assert.EqualValues(t, []interface{}{950.0, 1000.0, 1200.0}, amounts(map[string]interface{}{
+		"sortBy":   "PRICE_ASC",
+		"currency": "USD",
+	}))
+	// Without a currency the range is in USD, and prices keep their own
+	// currency: 12 USD, 9 EUR (10 USD), then 9.50 USD
+	assert.EqualValues(t, []interface{}{1200.0, 900.0, 950.0}, amounts(map[string]interface{}{
+		"priceRange": map[string]interface{}{"min": 9},
+		"sortBy":     "PRICE_DESC",
+	}))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 8) Reviewing a product that was never ordered is rejected
+func Test08ReviewRequiresPurchase(t *testing.T) {
+	createProduct := `
+        mutation CreateProduct($product: CreateProductInput!) {
+          createProduct(product: $product) {
+            id
+          }
+        }
+    `
+	resp := doRequest(t, serverURL, createProduct, map[string]interface{}{
+		"product": map[string]interface{}{
+			"name":        "Unreviewed Product",
+			"description": "Nobody bought this yet",
+			"price":       5.5,
+			"status":      "PUBLISHED",
+		},
+	})
+	assert.Nil(t, resp.Errors, "unexpected GraphQL errors during CreateProduct")
+
+	data, ok := resp.Data.(map[string]interface{})
+	assert.True(t, ok)
+	product, ok := data["createProduct"].(map[string]interface{})
+	assert.True(t, ok)
+
+	createReview := `
+        mutation CreateReview($review: CreateReviewInput!) {
+          createReview(review: $review) {
+            id
+            rating
+          }
+        }
+    `
+	resp = doRequest(t, serverURL, createReview, map[string]interface{}{
+		"review": map[string]interface{}{
+			"productId": product["id"],
+			"rating":    5,
+			"title":     "Great",
+			"body":      "Would buy again",
+		},
+	})
+	assert.NotEmpty(t, resp.Errors, "expected an error when reviewing a product that was not ordered")
+}